@@ -11,8 +11,10 @@ import (
 	"trade-journal/internal/ctrader"
 	"trade-journal/internal/database"
 	"trade-journal/internal/handlers"
+	"trade-journal/internal/images"
 	"trade-journal/internal/middleware"
 	"trade-journal/internal/minio"
+	"trade-journal/internal/trash"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -49,9 +51,17 @@ func main() {
 		log.Fatal("無法初始化MinIO:", err)
 	}
 
+	// 背景將舊資料中的 base64 圖片搬到 MinIO
+	images.StartMigration(db, minioClient)
+	// 背景為既有圖片補上縮圖
+	images.StartRenditionBackfill(db, minioClient)
+
 	// 啟動 cTrader 背景監聽管理器
 	ctrader.StartManager(db)
 
+	// 啟動垃圾桶自動清除
+	trash.StartPurger(db)
+
 	// 設置Gin路由
 	r := gin.Default()
 
@@ -127,6 +137,25 @@ func main() {
 				trades.POST("", handlers.CreateTrade(db))
 				trades.PUT("/:id", handlers.UpdateTrade(db))
 				trades.DELETE("/:id", handlers.DeleteTrade(db))
+				trades.GET("/:id/history", handlers.GetTradeHistory(db))
+				trades.POST("/:id/revert", handlers.RevertTrade(db))
+				trades.GET("/:id/executions", handlers.GetTradeExecutions(db))
+				trades.POST("/:id/executions", handlers.CreateTradeExecution(db))
+				trades.PUT("/:id/executions/:executionId", handlers.UpdateTradeExecution(db))
+				trades.DELETE("/:id/executions/:executionId", handlers.DeleteTradeExecution(db))
+				trades.POST("/bulk", handlers.BulkTrades(db))
+				trades.PUT("/:id/daily-plan", handlers.SetTradeDailyPlan(db))
+				trades.PUT("/:id/review", handlers.UpdateTradeReview(db))
+				trades.GET("/:id/images", handlers.GetTradeImages(db))
+				trades.POST("/:id/images", handlers.AddTradeImage(db))
+				trades.PUT("/:id/images/order", handlers.ReorderTradeImages(db))
+				trades.PUT("/:id/images/:imageId", handlers.UpdateTradeImage(db))
+				trades.DELETE("/:id/images/:imageId", handlers.DeleteTradeImage(db))
+				trades.GET("/:id/images/:imageId/annotations", handlers.GetImageAnnotations(db))
+				trades.POST("/:id/images/:imageId/annotations", handlers.CreateImageAnnotation(db))
+				trades.PUT("/:id/images/:imageId/annotations/:layerId", handlers.UpdateImageAnnotation(db))
+				trades.DELETE("/:id/images/:imageId/annotations/:layerId", handlers.DeleteImageAnnotation(db))
+				trades.GET("/:id/images/:imageId/render", handlers.RenderTradeImage(db))
 			}
 
 			// 統計資料
@@ -137,12 +166,98 @@ func main() {
 				stats.GET("/by-symbol", handlers.GetStatsBySymbol(db))
 				stats.GET("/by-strategy", handlers.GetStatsByStrategy(db))
 				stats.GET("/by-color", handlers.GetStatsByColorTag(db))
+				stats.GET("/by-field/:key", handlers.GetStatsByField(db))
+				stats.GET("/costs", handlers.GetCostStats(db))
+				stats.GET("/portfolio", handlers.GetPortfolioStats(db))
+				stats.GET("/plan-adherence", handlers.GetPlanAdherenceStats(db))
+				stats.GET("/excursions", handlers.GetExcursionStats(db))
+				stats.GET("/daily-plan-adherence", handlers.GetDailyPlanAdherenceStats(db))
+				stats.GET("/reviews", handlers.GetReviewStats(db))
+				stats.GET("/by-tag", handlers.GetStatsByTag(db))
+			}
+
+			// 策略定義
+			strategyGroup := authorized.Group("/strategies")
+			{
+				strategyGroup.GET("", handlers.GetStrategies(db))
+				strategyGroup.GET("/:id", handlers.GetStrategy(db))
+				strategyGroup.POST("", handlers.CreateStrategy(db))
+				strategyGroup.PUT("/:id", handlers.UpdateStrategy(db))
+				strategyGroup.DELETE("/:id", handlers.DeleteStrategy(db))
+			}
+
+			// 自訂欄位
+			customFields := authorized.Group("/custom-fields")
+			{
+				customFields.GET("", handlers.GetCustomFields(db))
+				customFields.POST("", handlers.CreateCustomField(db))
+				customFields.PUT("/:id", handlers.UpdateCustomField(db))
+				customFields.DELETE("/:id", handlers.DeleteCustomField(db))
+			}
+
+			// 交易檢討
+			mistakes := authorized.Group("/mistakes")
+			{
+				mistakes.GET("", handlers.GetMistakes(db))
+				mistakes.POST("", handlers.CreateMistake(db))
+				mistakes.PUT("/:id", handlers.UpdateMistake(db))
+				mistakes.DELETE("/:id", handlers.DeleteMistake(db))
+			}
+			authorized.GET("/reviews/queue", handlers.GetReviewQueue(db))
+
+			// 品種規格
+			instrumentGroup := authorized.Group("/instruments")
+			{
+				instrumentGroup.GET("", handlers.GetInstruments(db))
+				instrumentGroup.GET("/:symbol", handlers.GetInstrument(db))
+				instrumentGroup.PUT("/:symbol", handlers.SaveInstrument(db))
+				instrumentGroup.DELETE("/:symbol", handlers.DeleteInstrument(db))
+			}
+
+			// 品種別名
+			symbols := authorized.Group("/symbols")
+			{
+				symbols.GET("/aliases", handlers.GetSymbolAliases(db))
+				symbols.POST("/aliases", handlers.CreateSymbolAlias(db))
+				symbols.DELETE("/aliases/:id", handlers.DeleteSymbolAlias(db))
+				symbols.POST("/renormalize", handlers.RenormalizeSymbols(db))
+			}
+
+			// 匯率
+			fxRates := authorized.Group("/fx-rates")
+			{
+				fxRates.GET("", handlers.GetFXRates(db))
+				fxRates.POST("", handlers.SaveFXRate(db))
+				fxRates.POST("/import", handlers.ImportFXRates(db))
+				fxRates.DELETE("/:id", handlers.DeleteFXRate(db))
+			}
+
+			// K 線資料
+			barGroup := authorized.Group("/bars")
+			{
+				barGroup.GET("", handlers.GetBars(db))
+				barGroup.GET("/series", handlers.GetBarSeries(db))
+				barGroup.POST("/import", handlers.ImportBars(db))
+				barGroup.DELETE("", handlers.DeleteBars(db))
 			}
 
 			// 標籤管理
 			tags := authorized.Group("/tags")
 			{
 				tags.GET("", handlers.GetTags(db))
+				tags.POST("", handlers.CreateTag(db))
+				tags.PUT("/:id", handlers.UpdateTag(db))
+				tags.DELETE("/:id", handlers.DeleteTag(db))
+				tags.POST("/merge", handlers.MergeTags(db))
+			}
+
+			// 標籤分組
+			tagGroups := authorized.Group("/tag-groups")
+			{
+				tagGroups.GET("", handlers.GetTagGroups(db))
+				tagGroups.POST("", handlers.CreateTagGroup(db))
+				tagGroups.PUT("/:id", handlers.UpdateTagGroup(db))
+				tagGroups.DELETE("/:id", handlers.DeleteTagGroup(db))
 			}
 
 			// 每日規劃
@@ -153,26 +268,46 @@ func main() {
 				dailyPlans.POST("", handlers.CreateDailyPlan(db))
 				dailyPlans.PUT("/:id", handlers.UpdateDailyPlan(db))
 				dailyPlans.DELETE("/:id", handlers.DeleteDailyPlan(db))
+				dailyPlans.GET("/:id/trades", handlers.GetDailyPlanTrades(db))
 			}
 
 			// 分享管理
 			authorized.POST("/shares", handlers.CreateShare(db))
 
+			// 全文搜尋
+			authorized.GET("/search", handlers.Search(db))
+
+			// 垃圾桶
+			trashGroup := authorized.Group("/trash")
+			{
+				trashGroup.GET("", handlers.GetTrash(db))
+				trashGroup.POST("/restore", handlers.RestoreTrash(db))
+				trashGroup.POST("/purge", handlers.PurgeTrash(db))
+			}
+
+			// 備份與還原
+			authorized.GET("/backup", handlers.ExportUserBackup(db, minioClient))
+			authorized.POST("/backup/restore", handlers.RestoreUserBackup(db, minioClient))
+
 			// 管理員路由
 			admin := authorized.Group("/admin")
 			admin.Use(middleware.AdminMiddleware())
 			{
 				admin.GET("/usage", handlers.GetSystemUsageStat(db))
+				admin.GET("/migrations", handlers.GetMigrationStatus(db))
+				admin.GET("/backup", handlers.ExportFullBackup(db, minioClient))
+				admin.POST("/backup/restore", handlers.RestoreFullBackup(db, minioClient))
 			}
 		}
 
 		// 分享路由 (公開)
 		api.GET("/shares/public/:token", handlers.GetSharedResource(db))
+		api.GET("/shares/public/:token/images/:imageId/render", handlers.RenderSharedImage(db))
 
 		// 圖片上傳 (目前先保持公開或也可加入認證)
 		images := api.Group("/images")
 		{
-			images.POST("/upload", handlers.UploadImage(minioClient))
+			images.POST("/upload", handlers.UploadImage(db, minioClient))
 			images.GET("/:filename", handlers.GetImage(minioClient))
 		}
 	}
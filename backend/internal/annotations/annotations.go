@@ -0,0 +1,212 @@
+package annotations
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"trade-journal/internal/database"
+	"trade-journal/internal/models"
+)
+
+// 標註類型
+const (
+	Line       = "line"
+	Rect       = "rect"
+	Text       = "text"
+	PriceLevel = "price_level"
+)
+
+// 單一圖層的限制
+const (
+	MaxShapes     = 500
+	MaxTextLength = 200
+	MaxWidth      = 20
+	MaxSize       = 8
+)
+
+// ErrNotFound 圖層不存在或不屬於該圖片
+var ErrNotFound = errors.New("標註圖層不存在")
+
+var colorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// Validate 檢查標註的類型、座標範圍與樣式
+func Validate(shapes []models.AnnotationShape) error {
+	if len(shapes) > MaxShapes {
+		return fmt.Errorf("單一圖層最多 %d 個標註", MaxShapes)
+	}
+	inRange := func(v ...float64) bool {
+		for _, f := range v {
+			if f < 0 || f > 1 {
+				return false
+			}
+		}
+		return true
+	}
+	for i, s := range shapes {
+		var ok bool
+		switch s.Type {
+		case Line, Rect:
+			ok = inRange(s.X1, s.Y1, s.X2, s.Y2)
+		case Text:
+			if strings.TrimSpace(s.Text) == "" {
+				return fmt.Errorf("第 %d 個標註缺少文字", i+1)
+			}
+			ok = inRange(s.X1, s.Y1)
+		case PriceLevel:
+			ok = inRange(s.Y1)
+		default:
+			return fmt.Errorf("第 %d 個標註的類型不支援: %s", i+1, s.Type)
+		}
+		if !ok {
+			return fmt.Errorf("第 %d 個標註的座標需介於 0 到 1", i+1)
+		}
+		if s.Color != "" && !colorPattern.MatchString(s.Color) {
+			return fmt.Errorf("第 %d 個標註的顏色需為 #RRGGBB", i+1)
+		}
+		if s.Width < 0 || s.Width > MaxWidth {
+			return fmt.Errorf("第 %d 個標註的線寬需介於 0 到 %d", i+1, MaxWidth)
+		}
+		if s.Size < 0 || s.Size > MaxSize {
+			return fmt.Errorf("第 %d 個標註的文字大小需介於 0 到 %d", i+1, MaxSize)
+		}
+		if len([]rune(s.Text)) > MaxTextLength {
+			return fmt.Errorf("第 %d 個標註的文字最多 %d 字", i+1, MaxTextLength)
+		}
+	}
+	return nil
+}
+
+const selectColumns = `
+	SELECT an.id, an.image_id, an.user_id, COALESCE(u.username, ''), an.name, an.shapes, COALESCE(an.visible, TRUE), COALESCE(an.position, 0), an.created_at, an.updated_at
+	FROM image_annotations an
+	LEFT JOIN users u ON an.user_id = u.id`
+
+func scan(row interface{ Scan(...interface{}) error }) (models.AnnotationLayer, error) {
+	var l models.AnnotationLayer
+	var shapes string
+	if err := row.Scan(&l.ID, &l.ImageID, &l.UserID, &l.Username, &l.Name, &shapes, &l.Visible, &l.Position, &l.CreatedAt, &l.UpdatedAt); err != nil {
+		return l, err
+	}
+	if err := json.Unmarshal([]byte(shapes), &l.Shapes); err != nil || l.Shapes == nil {
+		l.Shapes = []models.AnnotationShape{}
+	}
+	return l, nil
+}
+
+func query(q database.Querier, where string, args ...interface{}) ([]models.AnnotationLayer, error) {
+	rows, err := q.Query(selectColumns+" WHERE "+where+" ORDER BY an.position, an.id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []models.AnnotationLayer
+	for rows.Next() {
+		l, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, l)
+	}
+	return list, rows.Err()
+}
+
+// List 取得圖片的所有圖層，依繪製順序排列
+func List(q database.Querier, imageID int64) ([]models.AnnotationLayer, error) {
+	return query(q, "an.image_id = ?", imageID)
+}
+
+// ForTrade 取得交易所有圖片的圖層，以圖片 ID 分組
+func ForTrade(q database.Querier, tradeID int64) (map[int64][]models.AnnotationLayer, error) {
+	list, err := query(q, "an.image_id IN (SELECT id FROM trade_images WHERE trade_id = ?)", tradeID)
+	if err != nil {
+		return nil, err
+	}
+	byImage := map[int64][]models.AnnotationLayer{}
+	for _, l := range list {
+		byImage[l.ImageID] = append(byImage[l.ImageID], l)
+	}
+	return byImage, nil
+}
+
+// Get 取得圖片的單一圖層，找不到時回傳 ErrNotFound
+func Get(q database.Querier, imageID, layerID int64) (models.AnnotationLayer, error) {
+	l, err := scan(q.QueryRow(selectColumns+" WHERE an.id = ? AND an.image_id = ?", layerID, imageID))
+	if err == sql.ErrNoRows {
+		return l, ErrNotFound
+	}
+	return l, err
+}
+
+func encode(shapes []models.AnnotationShape) (string, error) {
+	if shapes == nil {
+		shapes = []models.AnnotationShape{}
+	}
+	data, err := json.Marshal(shapes)
+	return string(data), err
+}
+
+// Create 在圖片最上層新增使用者的圖層，呼叫前需先以 Validate 檢查
+func Create(q database.Querier, imageID, userID int64, req models.AnnotationLayerCreate) (int64, error) {
+	shapes, err := encode(req.Shapes)
+	if err != nil {
+		return 0, err
+	}
+	visible := req.Visible == nil || *req.Visible
+	return database.InsertID(q, `
+		INSERT INTO image_annotations (image_id, user_id, name, shapes, visible, position)
+		VALUES (?, ?, ?, ?, ?, (SELECT COALESCE(MAX(position), -1) + 1 FROM image_annotations WHERE image_id = ?))
+	`, imageID, userID, strings.TrimSpace(req.Name), shapes, visible, imageID)
+}
+
+// Update 修改圖層，呼叫前需先以 Validate 檢查
+func Update(q database.Querier, imageID, layerID int64, req models.AnnotationLayerUpdate) error {
+	sets := []string{"updated_at = CURRENT_TIMESTAMP"}
+	var args []interface{}
+	if req.Name != nil {
+		sets, args = append(sets, "name = ?"), append(args, strings.TrimSpace(*req.Name))
+	}
+	if req.Shapes != nil {
+		shapes, err := encode(*req.Shapes)
+		if err != nil {
+			return err
+		}
+		sets, args = append(sets, "shapes = ?"), append(args, shapes)
+	}
+	if req.Visible != nil {
+		sets, args = append(sets, "visible = ?"), append(args, *req.Visible)
+	}
+	if req.Position != nil {
+		sets, args = append(sets, "position = ?"), append(args, *req.Position)
+	}
+	res, err := q.Exec("UPDATE image_annotations SET "+strings.Join(sets, ", ")+" WHERE id = ? AND image_id = ?", append(args, layerID, imageID)...)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Delete 刪除圖層
+func Delete(q database.Querier, imageID, layerID int64) error {
+	res, err := q.Exec("DELETE FROM image_annotations WHERE id = ? AND image_id = ?", layerID, imageID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DeleteImage 刪除圖片的所有圖層，用於圖片移除時
+func DeleteImage(q database.Querier, imageID int64) error {
+	_, err := q.Exec("DELETE FROM image_annotations WHERE image_id = ?", imageID)
+	return err
+}
@@ -0,0 +1,160 @@
+package annotations
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"trade-journal/internal/models"
+	"trade-journal/internal/testutil"
+)
+
+func TestValidate(t *testing.T) {
+	price := 2345.5
+	valid := []models.AnnotationShape{
+		{Type: Line, X1: 0, Y1: 0, X2: 1, Y2: 1, Color: "#00ff00", Width: 3},
+		{Type: Rect, X1: 0.2, Y1: 0.2, X2: 0.4, Y2: 0.5, Fill: true},
+		{Type: Text, X1: 0.5, Y1: 0.5, Text: "BOS", Size: 3},
+		{Type: PriceLevel, Y1: 0.3, Price: &price},
+	}
+	if err := Validate(valid); err != nil {
+		t.Fatalf("合法的標註不應回傳錯誤: %v", err)
+	}
+
+	for name, s := range map[string]models.AnnotationShape{
+		"類型":   {Type: "circle"},
+		"座標":   {Type: Line, X2: 1.2},
+		"文字":   {Type: Text, Text: " "},
+		"顏色":   {Type: PriceLevel, Y1: 0.5, Color: "red"},
+		"線寬":   {Type: Line, Width: MaxWidth + 1},
+		"文字大小": {Type: Text, Text: "a", Size: -1},
+	} {
+		if err := Validate([]models.AnnotationShape{s}); err == nil {
+			t.Errorf("%s錯誤的標註應回傳錯誤", name)
+		}
+	}
+	if err := Validate(make([]models.AnnotationShape, MaxShapes+1)); err == nil {
+		t.Error("超過數量上限應回傳錯誤")
+	}
+}
+
+func TestLayers(t *testing.T) {
+	db := testutil.OpenDB(t,
+		"INSERT INTO users (id, username, password) VALUES (1, 'student', 'x'), (2, 'mentor', 'x')",
+		"INSERT INTO accounts (id, user_id, name) VALUES (10, 1, 'main')",
+		"INSERT INTO trades (id, account_id, symbol, side, entry_price, entry_time) VALUES (100, 10, 'XAUUSD', 'long', 1, '2024-05-06 08:00:00')",
+		"INSERT INTO trade_images (id, trade_id, image_type, image_path) VALUES (1, 100, 'entry', 'a.png'), (2, 100, 'exit', 'b.png')",
+	)
+
+	own, err := Create(db, 1, 1, models.AnnotationLayerCreate{Name: " 進場 ", Shapes: []models.AnnotationShape{{Type: Line, X2: 1, Y2: 1}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hidden := false
+	mentor, err := Create(db, 1, 2, models.AnnotationLayerCreate{Name: "導師", Visible: &hidden})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := List(db, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].ID != own || list[1].ID != mentor {
+		t.Fatalf("圖層應依建立順序排列: %+v", list)
+	}
+	if l := list[0]; l.Name != "進場" || l.Username != "student" || !l.Visible || len(l.Shapes) != 1 || l.Shapes[0].Type != Line {
+		t.Errorf("圖層內容錯誤: %+v", l)
+	}
+	if l := list[1]; l.UserID != 2 || l.Username != "mentor" || l.Visible || l.Position != 1 || l.Shapes == nil {
+		t.Errorf("導師圖層內容錯誤: %+v", l)
+	}
+
+	shapes := []models.AnnotationShape{{Type: Text, X1: 0.1, Y1: 0.1, Text: "FVG"}}
+	visible := true
+	if err := Update(db, 1, mentor, models.AnnotationLayerUpdate{Shapes: &shapes, Visible: &visible}); err != nil {
+		t.Fatal(err)
+	}
+	l, err := Get(db, 1, mentor)
+	if err != nil || !l.Visible || l.Name != "導師" || len(l.Shapes) != 1 || l.Shapes[0].Text != "FVG" {
+		t.Fatalf("修改後的圖層錯誤: %+v %v", l, err)
+	}
+	if err := Update(db, 2, mentor, models.AnnotationLayerUpdate{Visible: &visible}); err != ErrNotFound {
+		t.Errorf("修改其他圖片的圖層應回傳 ErrNotFound，得到 %v", err)
+	}
+
+	if _, err := Create(db, 2, 1, models.AnnotationLayerCreate{Name: "出場"}); err != nil {
+		t.Fatal(err)
+	}
+	byImage, err := ForTrade(db, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(byImage[1]) != 2 || len(byImage[2]) != 1 || byImage[2][0].Position != 0 {
+		t.Errorf("依圖片分組錯誤: %+v", byImage)
+	}
+
+	if err := Delete(db, 2, own); err != ErrNotFound {
+		t.Errorf("刪除其他圖片的圖層應回傳 ErrNotFound，得到 %v", err)
+	}
+	if err := Delete(db, 1, own); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteImage(db, 1); err != nil {
+		t.Fatal(err)
+	}
+	if list, _ := List(db, 1); len(list) != 0 {
+		t.Errorf("刪除圖片的圖層後應沒有圖層: %+v", list)
+	}
+}
+
+func TestRender(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 101, 101))
+	for i := range src.Pix {
+		src.Pix[i] = 0xff
+	}
+	price := 1.2345
+	layers := []models.AnnotationLayer{
+		{Visible: true, Shapes: []models.AnnotationShape{
+			{Type: Line, X1: 0, Y1: 0, X2: 1, Y2: 1, Color: "#0000ff", Width: 1},
+			{Type: Rect, X1: 0.6, Y1: 0.1, X2: 0.9, Y2: 0.3, Color: "#00ff00", Width: 1, Fill: true},
+			{Type: PriceLevel, Y1: 0.8, Price: &price},
+			{Type: Text, X1: 0.1, Y1: 0.5, Text: "I", Size: 1},
+		}},
+		{Visible: false, Shapes: []models.AnnotationShape{{Type: Line, X1: 0, Y1: 1, X2: 1, Y2: 0}}},
+	}
+	dst := Render(src, layers)
+
+	blue := color.RGBA{B: 0xff, A: 0xff}
+	red := color.RGBA{R: 0xff, A: 0xff}
+	white := color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}
+	for _, c := range []struct {
+		name string
+		x, y int
+		want color.RGBA
+	}{
+		{"對角線起點", 0, 0, blue},
+		{"對角線中點", 50, 50, blue},
+		{"對角線終點", 100, 100, blue},
+		{"矩形邊框", 60, 20, color.RGBA{G: 0xff, A: 0xff}},
+		{"價位線", 5, 80, red},
+		{"價位線下方", 5, 83, white},
+		{"隱藏的圖層", 10, 90, white},
+		{"文字", 12, 51, red}, // 'I' 的中間一欄
+	} {
+		if got := dst.RGBAAt(c.x, c.y); got != c.want {
+			t.Errorf("%s (%d, %d) 為 %v，預期 %v", c.name, c.x, c.y, got, c.want)
+		}
+	}
+	// 半透明填滿，綠色增加而紅色減少
+	if got := dst.RGBAAt(75, 20); got.R == 0xff || got.G != 0xff {
+		t.Errorf("矩形內部應以半透明填滿: %v", got)
+	}
+	// 價位標籤以線的顏色為底，放在右端上方
+	if got := dst.RGBAAt(99, 75); got.G == 0xff {
+		t.Errorf("價位標籤應有底色: %v", got)
+	}
+	if src.RGBAAt(50, 50) != white {
+		t.Error("原圖不應被修改")
+	}
+}
@@ -0,0 +1,171 @@
+package annotations
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"strconv"
+
+	"trade-journal/internal/models"
+)
+
+// 未指定樣式時的預設值
+const (
+	defaultWidth = 2
+	defaultSize  = 2
+)
+
+var defaultColor = color.NRGBA{R: 0xff, A: 0xff}
+
+// Render 將可見的圖層依順序疊加到原圖上，回傳新的圖片，原圖不變
+// 文字使用內建的 5x7 ASCII 點陣字型，其他字元以方框表示
+func Render(src image.Image, layers []models.AnnotationLayer) *image.RGBA {
+	b := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), src, b.Min, draw.Src)
+	for _, l := range layers {
+		if !l.Visible {
+			continue
+		}
+		for _, s := range l.Shapes {
+			drawShape(dst, s)
+		}
+	}
+	return dst
+}
+
+func drawShape(dst *image.RGBA, s models.AnnotationShape) {
+	c := parseColor(s.Color)
+	width := s.Width
+	if width <= 0 {
+		width = defaultWidth
+	}
+	size := s.Size
+	if size <= 0 {
+		size = defaultSize
+	}
+	p1, p2 := point(dst, s.X1, s.Y1), point(dst, s.X2, s.Y2)
+
+	switch s.Type {
+	case Line:
+		drawLine(dst, p1, p2, width, c)
+	case Rect:
+		r := image.Rectangle{Min: p1, Max: p2}.Canon()
+		if s.Fill {
+			fill := c
+			fill.A = 0x40
+			draw.Draw(dst, r, image.NewUniform(fill), image.Point{}, draw.Over)
+		}
+		drawLine(dst, r.Min, image.Pt(r.Max.X, r.Min.Y), width, c)
+		drawLine(dst, image.Pt(r.Max.X, r.Min.Y), r.Max, width, c)
+		drawLine(dst, r.Max, image.Pt(r.Min.X, r.Max.Y), width, c)
+		drawLine(dst, image.Pt(r.Min.X, r.Max.Y), r.Min, width, c)
+	case Text:
+		drawText(dst, p1, s.Text, size, c)
+	case PriceLevel:
+		right := dst.Bounds().Dx() - 1
+		drawLine(dst, image.Pt(0, p1.Y), image.Pt(right, p1.Y), width, c)
+		label := s.Text
+		if label == "" && s.Price != nil {
+			label = strconv.FormatFloat(*s.Price, 'f', -1, 64)
+		}
+		if label == "" {
+			return
+		}
+		// 標籤放在線的右端上方，以線的顏色為底、白色文字
+		w, h := textWidth(label, size), glyphHeight*size
+		box := image.Rect(right-w-2*size, p1.Y-h-2*size, right, p1.Y)
+		if box.Min.Y < 0 {
+			box = box.Add(image.Pt(0, h+2*size))
+		}
+		draw.Draw(dst, box, image.NewUniform(c), image.Point{}, draw.Over)
+		drawText(dst, box.Min.Add(image.Pt(size, size)), label, size, color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff})
+	}
+}
+
+// parseColor 解析 #RRGGBB，格式錯誤時使用預設顏色
+func parseColor(s string) color.NRGBA {
+	if !colorPattern.MatchString(s) {
+		return defaultColor
+	}
+	v, _ := strconv.ParseUint(s[1:], 16, 32)
+	return color.NRGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 0xff}
+}
+
+// point 將 0-1 的比例座標轉為像素座標
+func point(dst *image.RGBA, x, y float64) image.Point {
+	b := dst.Bounds()
+	return image.Pt(int(x*float64(b.Dx()-1)+0.5), int(y*float64(b.Dy()-1)+0.5))
+}
+
+// dot 以 p 為中心畫邊長 width 的正方形
+func dot(dst *image.RGBA, p image.Point, width int, c color.Color) {
+	min := p.Sub(image.Pt(width/2, width/2))
+	draw.Draw(dst, image.Rectangle{Min: min, Max: min.Add(image.Pt(width, width))}, image.NewUniform(c), image.Point{}, draw.Over)
+}
+
+// drawLine 以 Bresenham 演算法畫線
+func drawLine(dst *image.RGBA, p0, p1 image.Point, width int, c color.Color) {
+	dx, dy := abs(p1.X-p0.X), -abs(p1.Y-p0.Y)
+	sx, sy := 1, 1
+	if p0.X > p1.X {
+		sx = -1
+	}
+	if p0.Y > p1.Y {
+		sy = -1
+	}
+	err := dx + dy
+	for {
+		dot(dst, p0, width, c)
+		if p0 == p1 {
+			return
+		}
+		e2 := 2 * err
+		if e2 >= dy {
+			err += dy
+			p0.X += sx
+		}
+		if e2 <= dx {
+			err += dx
+			p0.Y += sy
+		}
+	}
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// drawText 以 p 為左上角畫出文字，size 為放大倍數
+func drawText(dst *image.RGBA, p image.Point, text string, size int, c color.Color) {
+	src := image.NewUniform(c)
+	pixel := func(x, y int) {
+		min := p.Add(image.Pt(x*size, y*size))
+		draw.Draw(dst, image.Rectangle{Min: min, Max: min.Add(image.Pt(size, size))}, src, image.Point{}, draw.Over)
+	}
+	for _, r := range text {
+		cols, ok := glyph(r)
+		for x := 0; x < glyphWidth; x++ {
+			for y := 0; y < glyphHeight; y++ {
+				// 不支援的字元畫成方框
+				if !ok && (x == 0 || x == glyphWidth-1 || y == 0 || y == glyphHeight-2) && y < glyphHeight-1 {
+					pixel(x, y)
+				} else if ok && cols[x]&(1<<y) != 0 {
+					pixel(x, y)
+				}
+			}
+		}
+		p.X += (glyphWidth + 1) * size
+	}
+}
+
+func textWidth(text string, size int) int {
+	n := len([]rune(text))
+	if n == 0 {
+		return 0
+	}
+	return (n*(glyphWidth+1) - 1) * size
+}
@@ -0,0 +1,293 @@
+package audit
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"trade-journal/internal/customfields"
+	"trade-journal/internal/database"
+	"trade-journal/internal/reviews"
+)
+
+// 異動類型
+const (
+	ActionCreate  = "create"
+	ActionUpdate  = "update"
+	ActionDelete  = "delete"
+	ActionRestore = "restore"
+	ActionRevert  = "revert"
+)
+
+// 異動來源
+const (
+	SourceAPI     = "api"
+	SourceCSV     = "csv"
+	SourceMT5     = "mt5"
+	SourceCTrader = "ctrader"
+)
+
+// TagsField 標籤不在 trades 表中，以虛擬欄位記錄在異動中
+const TagsField = "tags"
+
+// CustomFieldsField 自訂欄位的值同樣以虛擬欄位記錄 (key -> 值)
+const CustomFieldsField = "custom_fields"
+
+// MistakesField 交易標記的錯誤類型以名稱記錄
+const MistakesField = "mistakes"
+
+// ignoredFields 不列入異動的欄位
+var ignoredFields = map[string]bool{
+	"id":           true,
+	"created_at":   true,
+	"updated_at":   true,
+	"delete_batch": true,
+}
+
+// Change 單一欄位的前後值
+type Change struct {
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
+
+// Revision 一次異動紀錄
+type Revision struct {
+	ID        int64             `json:"id"`
+	TradeID   int64             `json:"trade_id"`
+	UserID    *int64            `json:"user_id"`
+	Username  *string           `json:"username"`
+	Action    string            `json:"action"`
+	Source    string            `json:"source"`
+	Changes   map[string]Change `json:"changes"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+// Snapshot 讀取交易目前的所有欄位 (含標籤、自訂欄位與錯誤類型)，值已轉為 JSON 型別以便比較
+func Snapshot(q database.Querier, tradeID int64) (map[string]interface{}, error) {
+	raw, err := loadRow(q, tradeID)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := []string{}
+	rows, err := q.Query("SELECT tg.name FROM trade_tags tt JOIN tags tg ON tt.tag_id = tg.id WHERE tt.trade_id = ?", tradeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		tags = append(tags, name)
+	}
+	sort.Strings(tags)
+	raw[TagsField] = tags
+
+	custom, err := customfields.Load(q, tradeID)
+	if err != nil {
+		return nil, err
+	}
+	if custom == nil {
+		custom = map[string]interface{}{}
+	}
+	raw[CustomFieldsField] = custom
+
+	mistakes, err := reviews.Names(q, tradeID)
+	if err != nil {
+		return nil, err
+	}
+	raw[MistakesField] = mistakes
+
+	return normalize(raw)
+}
+
+// loadRow 以 SELECT * 讀取交易，新增欄位時不需修改此處
+func loadRow(q database.Querier, tradeID int64) (map[string]interface{}, error) {
+	rows, err := q.Query("SELECT * FROM trades WHERE id = ?", tradeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		return nil, sql.ErrNoRows
+	}
+	values := make([]interface{}, len(cols))
+	ptrs := make([]interface{}, len(cols))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	if err := rows.Scan(ptrs...); err != nil {
+		return nil, err
+	}
+
+	row := make(map[string]interface{}, len(cols))
+	for i, col := range cols {
+		if b, ok := values[i].([]byte); ok {
+			row[col] = string(b)
+		} else {
+			row[col] = values[i]
+		}
+	}
+	return row, nil
+}
+
+// normalize 經過一次 JSON 編解碼，讓資料庫讀出的值與紀錄中的值可以直接比較
+func normalize(row map[string]interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(row)
+	if err != nil {
+		return nil, err
+	}
+	var out map[string]interface{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Diff 比較兩個快照，before 為 nil 表示新建
+func Diff(before, after map[string]interface{}) map[string]Change {
+	changes := make(map[string]Change)
+	keys := make(map[string]bool)
+	for k := range before {
+		keys[k] = true
+	}
+	for k := range after {
+		keys[k] = true
+	}
+	for k := range keys {
+		if ignoredFields[k] {
+			continue
+		}
+		oldV, newV := before[k], after[k]
+		if isEmpty(oldV) && isEmpty(newV) {
+			continue
+		}
+		if !reflect.DeepEqual(oldV, newV) {
+			changes[k] = Change{Old: oldV, New: newV}
+		}
+	}
+	return changes
+}
+
+func isEmpty(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	if list, ok := v.([]interface{}); ok {
+		return len(list) == 0
+	}
+	if m, ok := v.(map[string]interface{}); ok {
+		return len(m) == 0
+	}
+	return false
+}
+
+// Record 寫入一筆異動，沒有任何欄位變動時不寫入
+// userID 為 0 表示由系統 (同步/推播) 寫入
+func Record(q database.Querier, tradeID, userID int64, action, source string, before, after map[string]interface{}) error {
+	changes := Diff(before, after)
+	if len(changes) == 0 {
+		return nil
+	}
+	return insertRevision(q, tradeID, userID, action, source, changes)
+}
+
+// RecordCreate 新增交易後呼叫，記錄所有初始欄位
+func RecordCreate(q database.Querier, tradeID, userID int64, source string) error {
+	after, err := Snapshot(q, tradeID)
+	if err != nil {
+		return err
+	}
+	return Record(q, tradeID, userID, ActionCreate, source, nil, after)
+}
+
+// RecordBatchDelete 為同一批軟刪除的交易寫入刪除紀錄
+func RecordBatchDelete(q database.Querier, batch string, userID int64, source string) error {
+	rows, err := q.Query("SELECT id, deleted_at FROM trades WHERE delete_batch = ?", batch)
+	if err != nil {
+		return err
+	}
+	deleted := make(map[int64]interface{})
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		var deletedAt interface{}
+		if err := rows.Scan(&id, &deletedAt); err != nil {
+			rows.Close()
+			return err
+		}
+		deleted[id] = deletedAt
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		after, err := normalize(map[string]interface{}{"deleted_at": deleted[id]})
+		if err != nil {
+			return err
+		}
+		if err := Record(q, id, userID, ActionDelete, source, map[string]interface{}{}, after); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func insertRevision(q database.Querier, tradeID, userID int64, action, source string, changes map[string]Change) error {
+	data, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+	var uid interface{}
+	if userID > 0 {
+		uid = userID
+	}
+	_, err = q.Exec("INSERT INTO trade_revisions (trade_id, user_id, action, source, changes) VALUES (?, ?, ?, ?, ?)",
+		tradeID, uid, action, source, string(data))
+	if err != nil {
+		return fmt.Errorf("寫入異動紀錄失敗: %w", err)
+	}
+	return nil
+}
+
+// History 取得交易的所有異動，依時間先後排序
+func History(q database.Querier, tradeID int64) ([]Revision, error) {
+	rows, err := q.Query(`
+		SELECT r.id, r.trade_id, r.user_id, u.username, r.action, r.source, r.changes, r.created_at
+		FROM trade_revisions r
+		LEFT JOIN users u ON r.user_id = u.id
+		WHERE r.trade_id = ?
+		ORDER BY r.id ASC
+	`, tradeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []Revision{}
+	for rows.Next() {
+		var r Revision
+		var changes string
+		if err := rows.Scan(&r.ID, &r.TradeID, &r.UserID, &r.Username, &r.Action, &r.Source, &changes, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(changes), &r.Changes); err != nil {
+			return nil, fmt.Errorf("異動紀錄 %d 格式錯誤: %w", r.ID, err)
+		}
+		revisions = append(revisions, r)
+	}
+	return revisions, rows.Err()
+}
@@ -0,0 +1,96 @@
+package audit
+
+import (
+	"database/sql"
+	"testing"
+
+	"trade-journal/internal/testutil"
+)
+
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	return testutil.OpenDB(t,
+		"INSERT INTO users (id, username, password) VALUES (1, 'alice', 'x')",
+		"INSERT INTO accounts (id, user_id, name) VALUES (10, 1, 'main')",
+		"INSERT INTO trades (id, account_id, symbol, side, entry_price, entry_time) VALUES (100, 10, 'XAUUSD', 'long', 2300, '2024-05-01 08:00:00')",
+	)
+}
+
+func update(t *testing.T, db *sql.DB, query string, args ...interface{}) {
+	t.Helper()
+	before, err := Snapshot(db, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(query, args...); err != nil {
+		t.Fatal(err)
+	}
+	after, err := Snapshot(db, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Record(db, 100, 1, ActionUpdate, SourceAPI, before, after); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRevert(t *testing.T) {
+	db := openTestDB(t)
+	if err := RecordCreate(db, 100, 1, SourceAPI); err != nil {
+		t.Fatal(err)
+	}
+	update(t, db, "UPDATE trades SET entry_price = 2310, notes = 'first' WHERE id = 100")
+	update(t, db, "UPDATE trades SET entry_price = 2320 WHERE id = 100")
+
+	// 沒有變動不應產生紀錄
+	update(t, db, "UPDATE trades SET updated_at = CURRENT_TIMESTAMP WHERE id = 100")
+
+	revisions, err := History(db, 100)
+	if err != nil || len(revisions) != 3 {
+		t.Fatalf("應有 3 筆異動, got %d (%v)", len(revisions), err)
+	}
+	if c := revisions[1].Changes["entry_price"]; c.Old != 2300.0 || c.New != 2310.0 {
+		t.Fatalf("entry_price 異動錯誤: %+v", c)
+	}
+
+	tx, _ := db.Begin()
+	changes, err := Revert(tx, 100, revisions[0].ID, 1)
+	if err != nil {
+		tx.Rollback()
+		t.Fatalf("還原失敗: %v", err)
+	}
+	tx.Commit()
+	if _, ok := changes["notes"]; !ok {
+		t.Fatalf("notes 應被還原: %+v", changes)
+	}
+
+	var price float64
+	var notes sql.NullString
+	db.QueryRow("SELECT entry_price, notes FROM trades WHERE id = 100").Scan(&price, &notes)
+	if price != 2300 || notes.Valid {
+		t.Fatalf("應回到建立時的狀態, got %v %v", price, notes)
+	}
+
+	revisions, _ = History(db, 100)
+	if last := revisions[len(revisions)-1]; last.Action != ActionRevert {
+		t.Fatalf("最後一筆應為 revert, got %s", last.Action)
+	}
+}
+
+func TestStateAtBackfill(t *testing.T) {
+	// 審計上線前的交易沒有 create 紀錄
+	revisions := []Revision{
+		{ID: 1, Changes: map[string]Change{"notes": {Old: "a", New: "b"}}},
+		{ID: 2, Changes: map[string]Change{"pnl": {Old: 10.0, New: 20.0}}},
+	}
+	state, err := StateAt(revisions, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state["notes"] != "b" || state["pnl"] != 10.0 {
+		t.Fatalf("狀態錯誤: %+v", state)
+	}
+	if _, err := StateAt(revisions, 3); err != ErrRevisionNotFound {
+		t.Fatalf("應回傳 ErrRevisionNotFound, got %v", err)
+	}
+}
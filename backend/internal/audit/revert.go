@@ -0,0 +1,188 @@
+package audit
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"trade-journal/internal/customfields"
+	"trade-journal/internal/database"
+	"trade-journal/internal/reviews"
+)
+
+// ErrRevisionNotFound 指定的異動不屬於該交易
+var ErrRevisionNotFound = errors.New("找不到該異動紀錄")
+
+// StateAt 還原出指定異動完成後的欄位值
+// 審計上線前就存在的交易沒有 create 紀錄，之後才被改動的欄位以第一次改動前的值補上
+func StateAt(revisions []Revision, revisionID int64) (map[string]interface{}, error) {
+	found := false
+	state := make(map[string]interface{})
+	for _, r := range revisions {
+		if r.ID > revisionID {
+			continue
+		}
+		if r.ID == revisionID {
+			found = true
+		}
+		for field, c := range r.Changes {
+			state[field] = c.New
+		}
+	}
+	if !found {
+		return nil, ErrRevisionNotFound
+	}
+
+	for _, r := range revisions {
+		if r.ID <= revisionID {
+			continue
+		}
+		for field, c := range r.Changes {
+			if _, ok := state[field]; !ok {
+				state[field] = c.Old
+			}
+		}
+	}
+	return state, nil
+}
+
+// Revert 將交易改回指定異動完成後的狀態，並記錄一筆 revert 異動
+// 刪除狀態不會被改變，已刪除的交易請透過垃圾桶還原
+func Revert(tx *sql.Tx, tradeID, revisionID, userID int64) (map[string]Change, error) {
+	revisions, err := History(tx, tradeID)
+	if err != nil {
+		return nil, err
+	}
+	target, err := StateAt(revisions, revisionID)
+	if err != nil {
+		return nil, err
+	}
+
+	before, err := Snapshot(tx, tradeID)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := loadRow(tx, tradeID)
+	if err != nil {
+		return nil, err
+	}
+
+	var cols []string
+	for col := range target {
+		if _, isColumn := raw[col]; !isColumn || ignoredFields[col] || col == "deleted_at" {
+			continue
+		}
+		if !reflect.DeepEqual(target[col], before[col]) {
+			cols = append(cols, col)
+		}
+	}
+	sort.Strings(cols)
+
+	if len(cols) > 0 {
+		if v, ok := target["account_id"]; ok && !reflect.DeepEqual(v, before["account_id"]) {
+			var exists int
+			tx.QueryRow("SELECT 1 FROM accounts WHERE id = ? AND user_id = ? AND deleted_at IS NULL", v, userID).Scan(&exists)
+			if exists == 0 {
+				return nil, fmt.Errorf("原帳號已不存在或無權限，無法還原帳號欄位")
+			}
+		}
+
+		sets := make([]string, len(cols))
+		args := make([]interface{}, 0, len(cols)+1)
+		for i, col := range cols {
+			sets[i] = col + " = ?"
+			v, err := columnValue(raw[col], col, target[col])
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, v)
+		}
+		args = append(args, tradeID)
+		if _, err := tx.Exec("UPDATE trades SET "+strings.Join(sets, ", ")+", updated_at = CURRENT_TIMESTAMP WHERE id = ?", args...); err != nil {
+			return nil, err
+		}
+	}
+
+	if tags, ok := target[TagsField]; ok && !reflect.DeepEqual(tags, before[TagsField]) {
+		if err := replaceTags(tx, tradeID, userID, tags); err != nil {
+			return nil, err
+		}
+	}
+
+	// 較早的紀錄沒有自訂欄位時維持目前的值
+	if custom, ok := target[CustomFieldsField].(map[string]interface{}); ok && !reflect.DeepEqual(custom, before[CustomFieldsField]) {
+		if err := customfields.Replace(tx, userID, tradeID, custom); err != nil {
+			return nil, err
+		}
+	}
+
+	if mistakes, ok := target[MistakesField].([]interface{}); ok && !reflect.DeepEqual(mistakes, before[MistakesField]) {
+		if err := reviews.ReplaceByName(tx, userID, tradeID, mistakes); err != nil {
+			return nil, err
+		}
+	}
+
+	after, err := Snapshot(tx, tradeID)
+	if err != nil {
+		return nil, err
+	}
+	if err := Record(tx, tradeID, userID, ActionRevert, SourceAPI, before, after); err != nil {
+		return nil, err
+	}
+	return Diff(before, after), nil
+}
+
+// columnValue 將紀錄中的 JSON 值轉回資料庫型別，時間欄位需解析回 time.Time
+func columnValue(current interface{}, col string, v interface{}) (interface{}, error) {
+	s, ok := v.(string)
+	if !ok {
+		return v, nil
+	}
+	if _, isTime := current.(time.Time); isTime || strings.HasSuffix(col, "_time") || strings.HasSuffix(col, "_at") {
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return nil, fmt.Errorf("欄位 %s 時間格式錯誤: %w", col, err)
+		}
+		return t, nil
+	}
+	return s, nil
+}
+
+// replaceTags 依名稱還原交易的標籤，已合併的名稱對應到合併後的標籤，找不到的名稱重新建立
+func replaceTags(tx *sql.Tx, tradeID, userID int64, tags interface{}) error {
+	if _, err := tx.Exec("DELETE FROM trade_tags WHERE trade_id = ?", tradeID); err != nil {
+		return err
+	}
+	list, _ := tags.([]interface{})
+	seen := map[int64]bool{}
+	for _, t := range list {
+		name, ok := t.(string)
+		if !ok || name == "" {
+			continue
+		}
+		var tagID int64
+		err := tx.QueryRow("SELECT id FROM tags WHERE name = ? AND user_id = ?", name, userID).Scan(&tagID)
+		if err == sql.ErrNoRows {
+			err = tx.QueryRow("SELECT tag_id FROM tag_merges WHERE name = ? AND user_id = ?", name, userID).Scan(&tagID)
+		}
+		if err == sql.ErrNoRows {
+			tagID, err = database.InsertID(tx, "INSERT INTO tags (name, user_id) VALUES (?, ?)", name, userID)
+		}
+		if err != nil {
+			return err
+		}
+		// 合併前同時有來源與目標標籤時只寫入一次
+		if seen[tagID] {
+			continue
+		}
+		seen[tagID] = true
+		if _, err := tx.Exec("INSERT INTO trade_tags (trade_id, tag_id) VALUES (?, ?)", tradeID, tagID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
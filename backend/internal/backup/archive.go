@@ -0,0 +1,241 @@
+package backup
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"trade-journal/internal/images"
+)
+
+// FormatVersion 備份檔格式版本，格式不相容時需遞增
+const FormatVersion = 1
+
+const (
+	ScopeFull = "full" // 管理員備份：整個資料庫
+	ScopeUser = "user" // 使用者備份：單一使用者的資料
+
+	manifestName = "manifest.json"
+	tablesDir    = "tables/"
+	imagesDir    = "images/"
+)
+
+// Manifest 備份檔第一個項目，描述內容以便還原前驗證
+type Manifest struct {
+	FormatVersion int         `json:"format_version"`
+	SchemaVersion int         `json:"schema_version"`
+	Scope         string      `json:"scope"`
+	UserID        int64       `json:"user_id,omitempty"`
+	Username      string      `json:"username,omitempty"`
+	CreatedAt     time.Time   `json:"created_at"`
+	Tables        []TableInfo `json:"tables"`
+	Images        []string    `json:"images"`
+}
+
+// TableInfo 單一資料表的匯出資訊
+type TableInfo struct {
+	Name        string   `json:"name"`
+	Rows        int      `json:"rows"`
+	TimeColumns []string `json:"time_columns,omitempty"`
+}
+
+// polyRef 依類型欄位決定參照哪張表的欄位 (例如 shares.resource_id)
+type polyRef struct {
+	column     string
+	typeColumn string
+	tables     map[string]string
+}
+
+// tableSpec 描述資料表的匯出範圍與還原時的 ID 對應方式
+type tableSpec struct {
+	name string
+	// hasID 為 true 時還原會重新配發 id 並記錄新舊對應
+	hasID bool
+	// userFilter 使用者備份的篩選條件，空字串表示僅包含在完整備份中
+	userFilter string
+	// refs 外鍵欄位 -> 參照的資料表
+	refs map[string]string
+	poly *polyRef
+	// matchColumns 還原時若已有相同值的資料列則沿用，不重複建立
+	matchColumns []string
+	boolColumns  []string
+	imageColumns []string
+	// imageRequired 圖片欄位不可為空，使用者備份中沒有對應圖片時略過整列
+	imageRequired bool
+}
+
+// tables 依外鍵相依順序排列，新增資料表時需一併加入
+var tables = []tableSpec{
+	{
+		name:        "users",
+		hasID:       true,
+		boolColumns: []string{"is_admin"},
+	},
+	{
+		name:       "accounts",
+		hasID:      true,
+		userFilter: "user_id = ?",
+		refs:       map[string]string{"user_id": "users"},
+	},
+	{
+		// 還原到已有內建策略的使用者時沿用同名策略
+		name:         "strategies",
+		hasID:        true,
+		userFilter:   "user_id = ?",
+		refs:         map[string]string{"user_id": "users"},
+		matchColumns: []string{"user_id", "name"},
+	},
+	{
+		name:       "daily_plans",
+		hasID:      true,
+		userFilter: "account_id IN (SELECT id FROM accounts WHERE user_id = ?)",
+		refs:       map[string]string{"account_id": "accounts"},
+	},
+	{
+		name:         "trades",
+		hasID:        true,
+		userFilter:   "account_id IN (SELECT id FROM accounts WHERE user_id = ?)",
+		refs:         map[string]string{"account_id": "accounts", "strategy_id": "strategies", "daily_plan_id": "daily_plans"},
+		imageColumns: images.TradeColumns,
+		boolColumns:  []string{"mae_exceeded_sl", "plan_link_manual"},
+	},
+	{
+		name:         "custom_fields",
+		hasID:        true,
+		userFilter:   "user_id = ?",
+		refs:         map[string]string{"user_id": "users"},
+		matchColumns: []string{"user_id", "field_key"},
+		boolColumns:  []string{"required"},
+	},
+	{
+		name:         "instruments",
+		hasID:        true,
+		userFilter:   "user_id = ?",
+		refs:         map[string]string{"user_id": "users"},
+		matchColumns: []string{"user_id", "symbol"},
+	},
+	{
+		name:         "symbol_aliases",
+		hasID:        true,
+		userFilter:   "user_id = ?",
+		refs:         map[string]string{"user_id": "users"},
+		matchColumns: []string{"user_id", "alias"},
+	},
+	{
+		name:         "fx_rates",
+		hasID:        true,
+		userFilter:   "user_id = ?",
+		refs:         map[string]string{"user_id": "users"},
+		matchColumns: []string{"user_id", "base", "quote", "rate_date"},
+	},
+	{
+		name:         "price_bars",
+		hasID:        true,
+		userFilter:   "user_id = ?",
+		refs:         map[string]string{"user_id": "users"},
+		matchColumns: []string{"user_id", "symbol", "timeframe", "bar_time"},
+	},
+	{
+		name:         "mistakes",
+		hasID:        true,
+		userFilter:   "user_id = ?",
+		refs:         map[string]string{"user_id": "users"},
+		matchColumns: []string{"user_id", "name"},
+	},
+	{
+		name:       "trade_mistakes",
+		userFilter: "mistake_id IN (SELECT id FROM mistakes WHERE user_id = ?)",
+		refs:       map[string]string{"trade_id": "trades", "mistake_id": "mistakes"},
+	},
+	{
+		name:       "trade_custom_values",
+		userFilter: "field_id IN (SELECT id FROM custom_fields WHERE user_id = ?)",
+		refs:       map[string]string{"trade_id": "trades", "field_id": "custom_fields"},
+	},
+	{
+		name:          "trade_images",
+		hasID:         true,
+		userFilter:    "trade_id IN (SELECT t.id FROM trades t JOIN accounts a ON t.account_id = a.id WHERE a.user_id = ?)",
+		refs:          map[string]string{"trade_id": "trades"},
+		imageColumns:  []string{"image_path"},
+		imageRequired: true,
+	},
+	{
+		// 其他使用者 (導師) 建立的圖層在使用者備份中因找不到作者而略過
+		name:        "image_annotations",
+		hasID:       true,
+		userFilter:  "image_id IN (SELECT ti.id FROM trade_images ti JOIN trades t ON ti.trade_id = t.id JOIN accounts a ON t.account_id = a.id WHERE a.user_id = ?)",
+		refs:        map[string]string{"image_id": "trade_images", "user_id": "users"},
+		boolColumns: []string{"visible"},
+	},
+	{
+		name:       "trade_executions",
+		hasID:      true,
+		userFilter: "trade_id IN (SELECT t.id FROM trades t JOIN accounts a ON t.account_id = a.id WHERE a.user_id = ?)",
+		refs:       map[string]string{"trade_id": "trades"},
+	},
+	{
+		// 異動內容中的 id 沿用備份當時的值，還原後僅供參考
+		name:       "trade_revisions",
+		hasID:      true,
+		userFilter: "trade_id IN (SELECT t.id FROM trades t JOIN accounts a ON t.account_id = a.id WHERE a.user_id = ?)",
+		refs:       map[string]string{"trade_id": "trades", "user_id": "users"},
+	},
+	{
+		name:         "tag_groups",
+		hasID:        true,
+		userFilter:   "user_id = ?",
+		refs:         map[string]string{"user_id": "users"},
+		matchColumns: []string{"user_id", "name"},
+	},
+	{
+		name:         "tags",
+		hasID:        true,
+		userFilter:   "user_id = ?",
+		refs:         map[string]string{"user_id": "users", "group_id": "tag_groups"},
+		matchColumns: []string{"user_id", "name"},
+	},
+	{
+		name:       "trade_tags",
+		userFilter: "tag_id IN (SELECT id FROM tags WHERE user_id = ?)",
+		refs:       map[string]string{"trade_id": "trades", "tag_id": "tags"},
+	},
+	{
+		// 分享連結與其他使用者相關，只在完整備份中保留
+		name:  "shares",
+		hasID: true,
+		refs:  map[string]string{"user_id": "users"},
+		poly: &polyRef{
+			column:     "resource_id",
+			typeColumn: "resource_type",
+			tables:     map[string]string{"trade": "trades", "plan": "daily_plans"},
+		},
+	},
+	{
+		name: "share_users",
+		refs: map[string]string{"share_id": "shares", "shared_with_user_id": "users"},
+	},
+}
+
+func findSpec(name string) (tableSpec, bool) {
+	for _, t := range tables {
+		if t.name == name {
+			return t, true
+		}
+	}
+	return tableSpec{}, false
+}
+
+// included 判斷資料表是否屬於該備份範圍
+func (t tableSpec) included(scope string) bool {
+	return scope == ScopeFull || t.userFilter != ""
+}
+
+// validObjectPath 避免備份檔中的路徑寫到預期之外的位置
+func validObjectPath(p string) error {
+	if p == "" || strings.HasPrefix(p, "/") || path.Clean(p) != p || strings.Contains(p, "..") {
+		return fmt.Errorf("不合法的圖片路徑: %q", p)
+	}
+	return nil
+}
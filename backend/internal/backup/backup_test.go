@@ -0,0 +1,167 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"testing"
+
+	"trade-journal/internal/testutil"
+)
+
+func mustExec(t *testing.T, db *sql.DB, query string, args ...interface{}) {
+	t.Helper()
+	if _, err := db.Exec(query, args...); err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+}
+
+func seed(t *testing.T, db *sql.DB) {
+	mustExec(t, db, "INSERT INTO users (id, username, password) VALUES (1, 'alice', 'x'), (2, 'bob', 'x')")
+	mustExec(t, db, "INSERT INTO accounts (id, user_id, name) VALUES (10, 1, 'main')")
+	mustExec(t, db, "INSERT INTO trades (id, account_id, symbol, side, entry_time) VALUES (100, 10, 'XAUUSD', 'long', '2024-05-01 08:00:00')")
+	mustExec(t, db, "INSERT INTO tags (id, user_id, name) VALUES (7, 1, 'breakout')")
+	mustExec(t, db, "INSERT INTO trade_tags (trade_id, tag_id) VALUES (100, 7)")
+	mustExec(t, db, "INSERT INTO daily_plans (account_id, plan_date, symbol) VALUES (10, '2024-05-01', 'XAUUSD')")
+	mustExec(t, db, "INSERT INTO shares (user_id, resource_type, resource_id, share_type, token) VALUES (1, 'trade', 100, 'public', 'tok')")
+}
+
+func count(t *testing.T, db *sql.DB, query string, args ...interface{}) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRow(query, args...).Scan(&n); err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	return n
+}
+
+func TestUserBackupRestoreIntoAnotherUser(t *testing.T) {
+	db := testutil.OpenDB(t)
+	seed(t, db)
+
+	var buf bytes.Buffer
+	if err := Export(context.Background(), db, nil, 1, &buf); err != nil {
+		t.Fatalf("匯出失敗: %v", err)
+	}
+
+	report, err := Restore(context.Background(), db, nil, &buf, Target{UserID: 2})
+	if err != nil {
+		t.Fatalf("還原失敗: %v", err)
+	}
+	if report.Inserted["trades"] != 1 || report.Inserted["trade_tags"] != 1 {
+		t.Fatalf("還原筆數不正確: %+v", report)
+	}
+
+	// 新資料需屬於 bob，且標籤關聯指向 bob 的標籤
+	n := count(t, db, `SELECT COUNT(*) FROM trade_tags tt
+		JOIN trades t ON tt.trade_id = t.id
+		JOIN accounts a ON t.account_id = a.id
+		JOIN tags tg ON tt.tag_id = tg.id
+		WHERE a.user_id = 2 AND tg.user_id = 2 AND tg.name = 'breakout'`)
+	if n != 1 {
+		t.Fatalf("標籤關聯未正確對應, got %d", n)
+	}
+	if count(t, db, "SELECT COUNT(*) FROM shares") != 1 {
+		t.Fatal("使用者備份不應包含分享連結")
+	}
+
+	// 再匯入一次，標籤應沿用而非重複建立
+	buf.Reset()
+	Export(context.Background(), db, nil, 1, &buf)
+	report, err = Restore(context.Background(), db, nil, &buf, Target{UserID: 2})
+	if err != nil {
+		t.Fatalf("第二次還原失敗: %v", err)
+	}
+	if report.Reused["tags"] != 1 {
+		t.Fatalf("標籤應被沿用: %+v", report)
+	}
+}
+
+func TestFullBackupRestore(t *testing.T) {
+	src := testutil.OpenDB(t)
+	seed(t, src)
+
+	var buf bytes.Buffer
+	if err := Export(context.Background(), src, nil, 0, &buf); err != nil {
+		t.Fatalf("匯出失敗: %v", err)
+	}
+	archive := buf.Bytes()
+
+	if _, err := Restore(context.Background(), src, nil, bytes.NewReader(archive), Target{UserID: 1}); err == nil {
+		t.Fatal("非管理員不應可還原完整備份")
+	}
+
+	// 還原到同一個資料庫：使用者改名、分享 token 重新產生
+	report, err := Restore(context.Background(), src, nil, bytes.NewReader(archive), Target{AllowFull: true})
+	if err != nil {
+		t.Fatalf("還原失敗: %v", err)
+	}
+	if report.RenamedUsers["alice"] != "alice_restored1" {
+		t.Fatalf("使用者應被改名: %+v", report.RenamedUsers)
+	}
+	if count(t, src, "SELECT COUNT(DISTINCT token) FROM shares") != 2 {
+		t.Fatal("分享 token 應重新產生")
+	}
+	n := count(t, src, `SELECT COUNT(*) FROM shares s
+		JOIN trades t ON s.resource_id = t.id
+		JOIN accounts a ON t.account_id = a.id
+		JOIN users u ON a.user_id = u.id AND u.id = s.user_id
+		WHERE u.username = 'alice_restored1'`)
+	if n != 1 {
+		t.Fatalf("分享的 resource_id 未正確對應, got %d", n)
+	}
+}
+
+func TestRestoreRejectsCorruptArchive(t *testing.T) {
+	db := testutil.OpenDB(t)
+	if _, err := Restore(context.Background(), db, nil, bytes.NewReader([]byte("not an archive")), Target{UserID: 1}); err == nil {
+		t.Fatal("應拒絕無效的備份檔")
+	}
+}
+
+func TestRestoredObjectName(t *testing.T) {
+	cases := []struct {
+		path, symbol, ext string
+	}{
+		{"2024-05/20240501-XAUUSD-1a2b3c4d.png", "XAUUSD", ".png"},
+		{"2024-05/20240501--1a2b3c4d.JPG", "", ".jpg"},
+		{"2024-05/evil", "", ""},
+		{"2024-05/20240501-a$b-1a2b3c4d.p<ng", "", ""},
+	}
+	for _, c := range cases {
+		if got := restoredSymbol(c.path); got != c.symbol {
+			t.Errorf("restoredSymbol(%q) = %q, want %q", c.path, got, c.symbol)
+		}
+		if got := restoredExt(c.path); got != c.ext {
+			t.Errorf("restoredExt(%q) = %q, want %q", c.path, got, c.ext)
+		}
+	}
+}
+
+func TestUserRestoreClearsUnmappedImages(t *testing.T) {
+	db := testutil.OpenDB(t)
+	seed(t, db)
+	mustExec(t, db, "UPDATE trades SET entry_strategy_image = 'XAUUSD/entry.png' WHERE id = 100")
+	mustExec(t, db, "INSERT INTO trade_images (trade_id, image_type, image_path) VALUES (100, 'entry', 'XAUUSD/gallery.png')")
+
+	// 沒有 MinIO 時備份檔不含圖片，使用者還原不能沿用原路徑
+	var buf bytes.Buffer
+	if err := Export(context.Background(), db, nil, 1, &buf); err != nil {
+		t.Fatalf("匯出失敗: %v", err)
+	}
+	report, err := Restore(context.Background(), db, nil, &buf, Target{UserID: 2})
+	if err != nil {
+		t.Fatalf("還原失敗: %v", err)
+	}
+	if len(report.MissingImages) != 2 {
+		t.Fatalf("應回報 2 張遺失的圖片: %v", report.MissingImages)
+	}
+	if report.Skipped["trade_images"] != 1 {
+		t.Fatalf("沒有圖片的相簿資料列應略過: %+v", report)
+	}
+	n := count(t, db, `SELECT COUNT(*) FROM trades t JOIN accounts a ON t.account_id = a.id
+		WHERE a.user_id = 2 AND t.entry_strategy_image IS NULL`)
+	if n != 1 {
+		t.Fatal("沒有對應圖片的欄位應改為 NULL")
+	}
+}
@@ -0,0 +1,260 @@
+package backup
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"trade-journal/internal/database"
+	"trade-journal/internal/images"
+	"trade-journal/internal/minio"
+
+	miniogo "github.com/minio/minio-go/v7"
+)
+
+// Export 將資料寫成 tar.gz 備份檔
+// userID 為 0 時匯出整個資料庫，否則只匯出該使用者的資料
+// 所有資料表在同一個交易中讀取以確保快照一致，資料列逐行寫入暫存檔
+// 讀取完畢即結束交易，之後才傳送資料與圖片，避免下載期間阻擋寫入
+func Export(ctx context.Context, db *sql.DB, client *miniogo.Client, userID int64, w io.Writer) error {
+	manifest, files, err := exportTables(ctx, db, userID)
+	for _, f := range files {
+		defer os.Remove(f.Name())
+		defer f.Close()
+	}
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeEntry(tw, manifestName, manifestData); err != nil {
+		return err
+	}
+	for i, info := range manifest.Tables {
+		if err := writeFileEntry(tw, tablesDir+info.Name+".jsonl", files[i]); err != nil {
+			return err
+		}
+	}
+
+	if client != nil {
+		for _, p := range manifest.Images {
+			err := writeImage(ctx, tw, client, p)
+			if errors.Is(err, errImageUnavailable) {
+				// 圖片遺失不應讓整份備份失敗，還原時會回報缺少的圖片
+				log.Printf("[Backup] 略過圖片 %s: %v", p, err)
+				continue
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// exportTables 在唯讀交易中將資料表寫入暫存檔，files 與 manifest.Tables 的順序相同
+// 回傳錯誤時仍會回傳已建立的暫存檔，由呼叫端刪除
+func exportTables(ctx context.Context, db *sql.DB, userID int64) (*Manifest, []*os.File, error) {
+	opts := &sql.TxOptions{ReadOnly: true}
+	if database.CurrentDialect() == database.DialectPostgres {
+		// PostgreSQL 預設 READ COMMITTED，每個查詢看到的資料可能不同
+		opts.Isolation = sql.LevelRepeatableRead
+	}
+	tx, err := db.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	manifest := &Manifest{
+		FormatVersion: FormatVersion,
+		SchemaVersion: database.LatestVersion(),
+		Scope:         ScopeFull,
+		CreatedAt:     time.Now().UTC(),
+	}
+	if userID > 0 {
+		manifest.Scope = ScopeUser
+		manifest.UserID = userID
+		if err := tx.QueryRow("SELECT username FROM users WHERE id = ?", userID).Scan(&manifest.Username); err != nil {
+			return nil, nil, fmt.Errorf("找不到使用者: %w", err)
+		}
+	}
+
+	var files []*os.File
+	imageSet := make(map[string]bool)
+	for _, spec := range tables {
+		if !spec.included(manifest.Scope) {
+			continue
+		}
+		f, err := os.CreateTemp("", "backup-"+spec.name+"-*.jsonl")
+		if err != nil {
+			return nil, files, err
+		}
+		files = append(files, f)
+		bw := bufio.NewWriter(f)
+		info, err := exportTable(tx, spec, userID, bw, imageSet)
+		if err == nil {
+			err = bw.Flush()
+		}
+		if err != nil {
+			return nil, files, fmt.Errorf("匯出 %s 失敗: %w", spec.name, err)
+		}
+		manifest.Tables = append(manifest.Tables, info)
+	}
+
+	manifest.Images = make([]string, 0, len(imageSet))
+	for p := range imageSet {
+		manifest.Images = append(manifest.Images, p)
+	}
+	sort.Strings(manifest.Images)
+	return manifest, files, nil
+}
+
+// exportTable 將資料表每一列寫成一行 JSON，並收集圖片路徑
+func exportTable(tx *sql.Tx, spec tableSpec, userID int64, w io.Writer, imageSet map[string]bool) (TableInfo, error) {
+	info := TableInfo{Name: spec.name}
+
+	query := "SELECT * FROM " + spec.name
+	var args []interface{}
+	if userID > 0 {
+		query += " WHERE " + spec.userFilter
+		args = append(args, userID)
+	}
+	if spec.hasID {
+		query += " ORDER BY id"
+	}
+
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return info, err
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return info, err
+	}
+
+	imageCols := make(map[string]bool, len(spec.imageColumns))
+	for _, c := range spec.imageColumns {
+		imageCols[c] = true
+	}
+	timeCols := make(map[string]bool)
+	enc := json.NewEncoder(w)
+
+	for rows.Next() {
+		values := make([]interface{}, len(cols))
+		ptrs := make([]interface{}, len(cols))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return info, err
+		}
+
+		row := make(map[string]interface{}, len(cols))
+		for i, col := range cols {
+			v := values[i]
+			switch tv := v.(type) {
+			case []byte:
+				v = string(tv)
+			case time.Time:
+				timeCols[col] = true
+			}
+			if s, ok := v.(string); ok && imageCols[col] && s != "" && !images.IsDataURL(s) {
+				imageSet[images.PathFromValue(s)] = true
+			}
+			row[col] = v
+		}
+		if err := enc.Encode(row); err != nil {
+			return info, err
+		}
+		info.Rows++
+	}
+
+	for col := range timeCols {
+		info.TimeColumns = append(info.TimeColumns, col)
+	}
+	sort.Strings(info.TimeColumns)
+	return info, rows.Err()
+}
+
+func writeEntry(tw *tar.Writer, name string, data []byte) error {
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: time.Now(),
+	}); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+// writeFileEntry 將暫存檔的內容寫成一個項目
+func writeFileEntry(tw *tar.Writer, name string, f *os.File) error {
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    stat.Size(),
+		ModTime: time.Now(),
+	}); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// errImageUnavailable 圖片無法從 MinIO 取得，此時尚未寫入任何內容，可安全略過
+var errImageUnavailable = errors.New("圖片無法取得")
+
+func writeImage(ctx context.Context, tw *tar.Writer, client *miniogo.Client, objectPath string) error {
+	object, err := client.GetObject(ctx, minio.BucketName, objectPath, miniogo.GetObjectOptions{})
+	if err != nil {
+		return fmt.Errorf("%w: %v", errImageUnavailable, err)
+	}
+	defer object.Close()
+
+	stat, err := object.Stat()
+	if err != nil {
+		return fmt.Errorf("%w: %v", errImageUnavailable, err)
+	}
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    imagesDir + objectPath,
+		Mode:    0644,
+		Size:    stat.Size,
+		ModTime: stat.LastModified,
+	}); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, object)
+	return err
+}
@@ -0,0 +1,562 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"trade-journal/internal/database"
+	"trade-journal/internal/images"
+	"trade-journal/internal/minio"
+
+	"github.com/google/uuid"
+	miniogo "github.com/minio/minio-go/v7"
+)
+
+// Target 還原目標
+type Target struct {
+	// UserID 使用者備份要匯入的使用者
+	UserID int64
+	// AllowFull 是否允許還原完整備份 (僅管理員)
+	AllowFull bool
+}
+
+// Report 還原結果
+type Report struct {
+	Scope         string            `json:"scope"`
+	Inserted      map[string]int    `json:"inserted"`
+	Reused        map[string]int    `json:"reused,omitempty"`
+	Skipped       map[string]int    `json:"skipped,omitempty"`
+	Images        int               `json:"images"`
+	MissingImages []string          `json:"missing_images,omitempty"`
+	RenamedUsers  map[string]string `json:"renamed_users,omitempty"`
+}
+
+type restoreState struct {
+	tx     *sql.Tx
+	report *Report
+	ids    map[string]map[int64]int64
+	// images 備份檔中的物件路徑 -> 還原時上傳的新路徑
+	images map[string]string
+	// missing 已列入 MissingImages 的路徑
+	missing map[string]bool
+}
+
+// Restore 驗證並匯入備份檔
+// 所有資料列都會重新配發 id，因此可以匯入仍在使用中的多使用者資料庫
+func Restore(ctx context.Context, db *sql.DB, client *miniogo.Client, r io.Reader, target Target) (*Report, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("不是有效的備份檔: %w", err)
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+
+	// 第一個項目必須是 manifest
+	hdr, err := tr.Next()
+	if err != nil || hdr.Name != manifestName {
+		return nil, fmt.Errorf("備份檔缺少 %s", manifestName)
+	}
+	var manifest Manifest
+	if err := json.NewDecoder(tr).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("%s 格式錯誤: %w", manifestName, err)
+	}
+	if err := validateManifest(&manifest, target); err != nil {
+		return nil, err
+	}
+
+	// 讀取資料表，遇到第一張圖片時停止
+	tableRows := make(map[string][]map[string]interface{})
+	for {
+		hdr, err = tr.Next()
+		if err == io.EOF {
+			hdr = nil
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("讀取備份檔失敗: %w", err)
+		}
+		if !strings.HasPrefix(hdr.Name, tablesDir) {
+			break
+		}
+		name := strings.TrimSuffix(strings.TrimPrefix(hdr.Name, tablesDir), ".jsonl")
+		rows, err := readRows(tr)
+		if err != nil {
+			return nil, fmt.Errorf("%s 格式錯誤: %w", hdr.Name, err)
+		}
+		tableRows[name] = rows
+	}
+	for _, info := range manifest.Tables {
+		if len(tableRows[info.Name]) != info.Rows {
+			return nil, fmt.Errorf("資料表 %s 筆數不符: manifest 為 %d，實際為 %d", info.Name, info.Rows, len(tableRows[info.Name]))
+		}
+	}
+	for name := range tableRows {
+		if !manifestHasTable(&manifest, name) {
+			return nil, fmt.Errorf("備份檔包含未列於 manifest 的資料表 %s", name)
+		}
+	}
+
+	report := &Report{
+		Scope:    manifest.Scope,
+		Inserted: make(map[string]int),
+		Reused:   make(map[string]int),
+		Skipped:  make(map[string]int),
+	}
+
+	// 先上傳圖片再寫入資料庫，避免上傳期間佔用寫入交易
+	// 每張圖片都上傳到新配發的物件路徑，備份檔中的路徑只用來對應資料列，不會直接寫入
+	wanted := make(map[string]bool, len(manifest.Images))
+	for _, p := range manifest.Images {
+		wanted[p] = true
+	}
+	renamed := make(map[string]string)
+	sizes := make(map[string]int64)
+	committed := false
+	defer func() {
+		if !committed {
+			for _, p := range renamed {
+				images.Remove(context.Background(), client, p)
+			}
+		}
+	}()
+	for ; hdr != nil; hdr, err = tr.Next() {
+		if !strings.HasPrefix(hdr.Name, imagesDir) {
+			return nil, fmt.Errorf("備份檔包含未知的項目 %s", hdr.Name)
+		}
+		objectPath := strings.TrimPrefix(hdr.Name, imagesDir)
+		if err := validObjectPath(objectPath); err != nil {
+			return nil, err
+		}
+		if !wanted[objectPath] {
+			return nil, fmt.Errorf("圖片 %s 未列於 manifest", objectPath)
+		}
+		if _, ok := renamed[objectPath]; ok {
+			return nil, fmt.Errorf("圖片 %s 重複", objectPath)
+		}
+		if client == nil {
+			return nil, fmt.Errorf("MinIO 未啟用，無法還原圖片")
+		}
+		ext := restoredExt(objectPath)
+		contentType := mime.TypeByExtension(ext)
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		newPath := images.ObjectPath(restoredSymbol(objectPath), ext)
+		if _, err := client.PutObject(ctx, minio.BucketName, newPath, tr, hdr.Size, miniogo.PutObjectOptions{
+			ContentType: contentType,
+		}); err != nil {
+			return nil, fmt.Errorf("圖片 %s 上傳失敗: %w", objectPath, err)
+		}
+		renamed[objectPath] = newPath
+		sizes[newPath] = hdr.Size
+		report.Images++
+	}
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("讀取備份檔失敗: %w", err)
+	}
+
+	// 備份時已遺失的圖片，完整備份還原到原本的系統時 MinIO 中可能仍存在，此時沿用原路徑不算遺失
+	// 使用者備份不檢查，避免資料列參照到其他使用者的物件
+	for _, p := range manifest.Images {
+		if _, ok := renamed[p]; ok {
+			continue
+		}
+		if client != nil && manifest.Scope == ScopeFull {
+			if _, err := client.StatObject(ctx, minio.BucketName, p, miniogo.StatObjectOptions{}); err == nil {
+				continue
+			}
+		}
+		report.MissingImages = append(report.MissingImages, p)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	st := &restoreState{
+		tx:      tx,
+		report:  report,
+		ids:     make(map[string]map[int64]int64),
+		images:  renamed,
+		missing: make(map[string]bool),
+	}
+	for _, p := range report.MissingImages {
+		st.missing[p] = true
+	}
+	if manifest.Scope == ScopeUser {
+		st.ids["users"] = map[int64]int64{manifest.UserID: target.UserID}
+	}
+	for p, size := range sizes {
+		if err := images.RecordSize(tx, p, size); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, info := range manifest.Tables {
+		spec, _ := findSpec(info.Name)
+		if err := st.restoreTable(spec, info, tableRows[info.Name]); err != nil {
+			return nil, fmt.Errorf("還原 %s 失敗: %w", info.Name, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	committed = true
+	return st.report, nil
+}
+
+var (
+	symbolPattern = regexp.MustCompile(`^[A-Za-z0-9._]{1,20}$`)
+	extPattern    = regexp.MustCompile(`^\.[a-z0-9]{1,5}$`)
+)
+
+// restoredSymbol 從備份的物件名稱 (YYYYMMDD-SYMBOL-UUID.ext) 取回品種，格式不符時回傳空字串
+func restoredSymbol(objectPath string) string {
+	parts := strings.Split(path.Base(objectPath), "-")
+	if len(parts) >= 3 && symbolPattern.MatchString(parts[1]) {
+		return parts[1]
+	}
+	return ""
+}
+
+// restoredExt 備份的物件副檔名，格式不符時不加副檔名
+func restoredExt(objectPath string) string {
+	ext := strings.ToLower(path.Ext(objectPath))
+	if extPattern.MatchString(ext) {
+		return ext
+	}
+	return ""
+}
+
+func validateManifest(m *Manifest, target Target) error {
+	if m.FormatVersion != FormatVersion {
+		return fmt.Errorf("不支援的備份格式版本 %d", m.FormatVersion)
+	}
+	if m.SchemaVersion > database.LatestVersion() {
+		return fmt.Errorf("備份檔來自較新的資料庫版本 (%d)，請先更新程式", m.SchemaVersion)
+	}
+	switch m.Scope {
+	case ScopeFull:
+		if !target.AllowFull {
+			return fmt.Errorf("僅管理員可以還原完整備份")
+		}
+	case ScopeUser:
+		if target.UserID <= 0 {
+			return fmt.Errorf("請指定要還原到哪一位使用者")
+		}
+	default:
+		return fmt.Errorf("未知的備份範圍 %q", m.Scope)
+	}
+
+	seen := make(map[string]bool)
+	for _, info := range m.Tables {
+		spec, ok := findSpec(info.Name)
+		if !ok {
+			return fmt.Errorf("備份檔包含未知的資料表 %s", info.Name)
+		}
+		if !spec.included(m.Scope) {
+			return fmt.Errorf("資料表 %s 不應出現在%s備份中", info.Name, m.Scope)
+		}
+		if seen[info.Name] {
+			return fmt.Errorf("資料表 %s 重複", info.Name)
+		}
+		seen[info.Name] = true
+	}
+	// 依外鍵順序還原
+	order := make(map[string]int, len(tables))
+	for i, t := range tables {
+		order[t.name] = i
+	}
+	sort.SliceStable(m.Tables, func(i, j int) bool {
+		return order[m.Tables[i].Name] < order[m.Tables[j].Name]
+	})
+
+	for _, p := range m.Images {
+		if err := validObjectPath(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func manifestHasTable(m *Manifest, name string) bool {
+	for _, info := range m.Tables {
+		if info.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func readRows(r io.Reader) ([]map[string]interface{}, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	var rows []map[string]interface{}
+	for {
+		var row map[string]interface{}
+		if err := dec.Decode(&row); err == io.EOF {
+			return rows, nil
+		} else if err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
+}
+
+// remapImages 將圖片欄位改為還原後的新路徑
+// 使用者備份中沒有對應圖片的路徑可能指向其他使用者的物件，改為 NULL 並列入 MissingImages；
+// 圖片欄位必填的資料列回傳 false 表示略過
+func (st *restoreState) remapImages(spec tableSpec, row map[string]interface{}) bool {
+	for _, col := range spec.imageColumns {
+		v, ok := row[col].(string)
+		if !ok || v == "" || images.IsDataURL(v) {
+			continue
+		}
+		old := images.PathFromValue(v)
+		if p, ok := st.images[old]; ok {
+			row[col] = p
+			continue
+		}
+		if st.report.Scope != ScopeUser {
+			continue
+		}
+		if !st.missing[old] {
+			st.missing[old] = true
+			st.report.MissingImages = append(st.report.MissingImages, old)
+		}
+		if spec.imageRequired {
+			return false
+		}
+		row[col] = nil
+	}
+	return true
+}
+
+// restoreTable 重新對應外鍵後逐列寫入
+func (st *restoreState) restoreTable(spec tableSpec, info TableInfo, rows []map[string]interface{}) error {
+	liveCols, err := database.TableColumns(st.tx, spec.name)
+	if err != nil {
+		return err
+	}
+	live := make(map[string]bool, len(liveCols))
+	for _, c := range liveCols {
+		live[c] = true
+	}
+	timeCols := make(map[string]bool, len(info.TimeColumns))
+	for _, c := range info.TimeColumns {
+		timeCols[c] = true
+	}
+	boolCols := make(map[string]bool, len(spec.boolColumns))
+	for _, c := range spec.boolColumns {
+		boolCols[c] = true
+	}
+	if spec.hasID && st.ids[spec.name] == nil {
+		st.ids[spec.name] = make(map[int64]int64)
+	}
+
+	for _, row := range rows {
+		for col, v := range row {
+			cv, err := convertValue(v, timeCols[col], boolCols[col])
+			if err != nil {
+				return fmt.Errorf("欄位 %s: %w", col, err)
+			}
+			row[col] = cv
+		}
+
+		if !st.remapImages(spec, row) {
+			st.report.Skipped[spec.name]++
+			continue
+		}
+
+		// 參照的資料列不存在 (舊版 SQLite 未啟用外鍵時可能殘留) 就略過
+		if !st.remapRefs(spec, row) {
+			st.report.Skipped[spec.name]++
+			continue
+		}
+
+		var oldID int64
+		if spec.hasID {
+			id, ok := row["id"].(int64)
+			if !ok {
+				return fmt.Errorf("資料列缺少 id")
+			}
+			oldID = id
+			delete(row, "id")
+		}
+
+		if spec.name == "users" && st.report.Scope == ScopeFull {
+			if err := st.renameConflictingUser(row); err != nil {
+				return err
+			}
+		}
+		if spec.name == "shares" {
+			if err := st.regenerateShareToken(row); err != nil {
+				return err
+			}
+		}
+
+		if len(spec.matchColumns) > 0 {
+			existing, err := st.findExisting(spec, row)
+			if err != nil {
+				return err
+			}
+			if existing > 0 {
+				st.ids[spec.name][oldID] = existing
+				st.report.Reused[spec.name]++
+				continue
+			}
+		}
+
+		var cols []string
+		for col := range row {
+			if live[col] {
+				cols = append(cols, col)
+			}
+		}
+		sort.Strings(cols)
+		args := make([]interface{}, len(cols))
+		for i, col := range cols {
+			args[i] = row[col]
+		}
+		query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", spec.name, strings.Join(cols, ", "),
+			strings.TrimSuffix(strings.Repeat("?, ", len(cols)), ", "))
+
+		if spec.hasID {
+			newID, err := database.InsertID(st.tx, query, args...)
+			if err != nil {
+				return err
+			}
+			st.ids[spec.name][oldID] = newID
+		} else if _, err := st.tx.Exec(query, args...); err != nil {
+			return err
+		}
+		st.report.Inserted[spec.name]++
+	}
+	return nil
+}
+
+// remapRefs 將外鍵改為新配發的 id，找不到對應時回傳 false
+func (st *restoreState) remapRefs(spec tableSpec, row map[string]interface{}) bool {
+	remap := func(col, table string) bool {
+		v, ok := row[col]
+		if !ok || v == nil {
+			return true
+		}
+		old, ok := v.(int64)
+		if !ok {
+			return false
+		}
+		newID, ok := st.ids[table][old]
+		if !ok {
+			return false
+		}
+		row[col] = newID
+		return true
+	}
+
+	for col, table := range spec.refs {
+		if !remap(col, table) {
+			return false
+		}
+	}
+	if spec.poly != nil {
+		typ, _ := row[spec.poly.typeColumn].(string)
+		table, ok := spec.poly.tables[typ]
+		if !ok || !remap(spec.poly.column, table) {
+			return false
+		}
+	}
+	return true
+}
+
+func (st *restoreState) findExisting(spec tableSpec, row map[string]interface{}) (int64, error) {
+	conds := make([]string, len(spec.matchColumns))
+	args := make([]interface{}, len(spec.matchColumns))
+	for i, col := range spec.matchColumns {
+		conds[i] = col + " = ?"
+		args[i] = row[col]
+	}
+	var id int64
+	err := st.tx.QueryRow(fmt.Sprintf("SELECT id FROM %s WHERE %s", spec.name, strings.Join(conds, " AND ")), args...).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return id, err
+}
+
+// renameConflictingUser 使用者名稱已存在時加上後綴，避免覆蓋現有帳號
+func (st *restoreState) renameConflictingUser(row map[string]interface{}) error {
+	original, _ := row["username"].(string)
+	name := original
+	for i := 1; ; i++ {
+		var exists int
+		err := st.tx.QueryRow("SELECT 1 FROM users WHERE username = ?", name).Scan(&exists)
+		if err == sql.ErrNoRows {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		name = fmt.Sprintf("%s_restored%d", original, i)
+	}
+	if name != original {
+		row["username"] = name
+		if st.report.RenamedUsers == nil {
+			st.report.RenamedUsers = make(map[string]string)
+		}
+		st.report.RenamedUsers[original] = name
+	}
+	return nil
+}
+
+// regenerateShareToken 分享連結的 token 已被使用時重新產生
+func (st *restoreState) regenerateShareToken(row map[string]interface{}) error {
+	token, _ := row["token"].(string)
+	if token == "" {
+		return nil
+	}
+	var exists int
+	err := st.tx.QueryRow("SELECT 1 FROM shares WHERE token = ?", token).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	row["token"] = uuid.New().String()
+	return nil
+}
+
+// convertValue 將 JSON 解出的值轉回資料庫型別
+func convertValue(v interface{}, isTime, isBool bool) (interface{}, error) {
+	switch tv := v.(type) {
+	case json.Number:
+		if isBool {
+			n, err := tv.Int64()
+			return n != 0, err
+		}
+		if n, err := tv.Int64(); err == nil {
+			return n, nil
+		}
+		return tv.Float64()
+	case string:
+		if isTime {
+			return time.Parse(time.RFC3339Nano, tv)
+		}
+	}
+	return v, nil
+}
@@ -0,0 +1,157 @@
+package bars
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"trade-journal/internal/database"
+	"trade-journal/internal/models"
+)
+
+// Timeframes 支援的 K 線週期，與交易的 entry_timeframe 相同
+var Timeframes = map[string]time.Duration{
+	"M1":  time.Minute,
+	"M5":  5 * time.Minute,
+	"M15": 15 * time.Minute,
+	"M30": 30 * time.Minute,
+	"H1":  time.Hour,
+	"H4":  4 * time.Hour,
+	"D1":  24 * time.Hour,
+}
+
+// NormalizeTimeframe 檢查週期並轉為大寫
+func NormalizeTimeframe(tf string) (string, error) {
+	tf = strings.ToUpper(strings.TrimSpace(tf))
+	if _, ok := Timeframes[tf]; !ok {
+		return "", fmt.Errorf("無效的週期: %q，可用 M1、M5、M15、M30、H1、H4、D1", tf)
+	}
+	return tf, nil
+}
+
+// ParseFilename 從 MT5 匯出的預設檔名 (例如 XAUUSD_M1_202401020000_202401312359.csv) 推測品種與週期
+// 無法辨識時回傳空字串
+func ParseFilename(name string) (symbol, timeframe string) {
+	base := strings.TrimSuffix(path.Base(strings.ReplaceAll(name, "\\", "/")), path.Ext(name))
+	parts := strings.Split(base, "_")
+	if len(parts) < 2 {
+		return "", ""
+	}
+	tf, err := NormalizeTimeframe(parts[1])
+	if err != nil {
+		return "", ""
+	}
+	return parts[0], tf
+}
+
+// Range 取得品種與週期在 [from, to] 之間的 K 線，依時間排序
+// from / to 為零值時不限制，最多回傳 limit 根
+func Range(q database.Querier, userID int64, symbol, timeframe string, from, to time.Time, limit int) ([]models.PriceBar, error) {
+	query := "SELECT bar_time, open, high, low, close, volume FROM price_bars WHERE user_id = ? AND symbol = ? AND timeframe = ?"
+	args := []interface{}{userID, symbol, timeframe}
+	if !from.IsZero() {
+		query += " AND bar_time >= ?"
+		args = append(args, from.Unix())
+	}
+	if !to.IsZero() {
+		query += " AND bar_time <= ?"
+		args = append(args, to.Unix())
+	}
+	query += " ORDER BY bar_time ASC"
+	if limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", limit)
+	}
+
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []models.PriceBar{}
+	for rows.Next() {
+		var b models.PriceBar
+		var ts int64
+		if err := rows.Scan(&ts, &b.Open, &b.High, &b.Low, &b.Close, &b.Volume); err != nil {
+			return nil, err
+		}
+		b.Time = time.Unix(ts, 0).UTC()
+		list = append(list, b)
+	}
+	return list, rows.Err()
+}
+
+// Series 列出使用者已匯入的品種與週期，含 K 線數量與時間範圍
+func Series(q database.Querier, userID int64) ([]models.PriceBarSeries, error) {
+	rows, err := q.Query(`
+		SELECT symbol, timeframe, COUNT(*), MIN(bar_time), MAX(bar_time)
+		FROM price_bars
+		WHERE user_id = ?
+		GROUP BY symbol, timeframe
+		ORDER BY symbol, timeframe
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []models.PriceBarSeries{}
+	for rows.Next() {
+		var s models.PriceBarSeries
+		var from, to int64
+		if err := rows.Scan(&s.Symbol, &s.Timeframe, &s.Bars, &from, &to); err != nil {
+			return nil, err
+		}
+		s.From, s.To = time.Unix(from, 0).UTC(), time.Unix(to, 0).UTC()
+		list = append(list, s)
+	}
+	return list, rows.Err()
+}
+
+// Delete 刪除品種與週期在 [from, to] 之間的 K 線，from / to 為零值時不限制，回傳刪除數量
+func Delete(q database.Querier, userID int64, symbol, timeframe string, from, to time.Time) (int64, error) {
+	query := "DELETE FROM price_bars WHERE user_id = ? AND symbol = ? AND timeframe = ?"
+	args := []interface{}{userID, symbol, timeframe}
+	if !from.IsZero() {
+		query += " AND bar_time >= ?"
+		args = append(args, from.Unix())
+	}
+	if !to.IsZero() {
+		query += " AND bar_time <= ?"
+		args = append(args, to.Unix())
+	}
+	res, err := q.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// Save 新增或覆寫同一時間的 K 線，回傳是否為新增
+func Save(q database.Querier, userID int64, symbol, timeframe string, b models.PriceBar) (bool, error) {
+	ts := b.Time.Unix()
+	res, err := q.Exec("UPDATE price_bars SET open = ?, high = ?, low = ?, close = ?, volume = ? WHERE user_id = ? AND symbol = ? AND timeframe = ? AND bar_time = ?",
+		b.Open, b.High, b.Low, b.Close, b.Volume, userID, symbol, timeframe, ts)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		return false, nil
+	}
+	_, err = q.Exec("INSERT INTO price_bars (user_id, symbol, timeframe, bar_time, open, high, low, close, volume) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		userID, symbol, timeframe, ts, b.Open, b.High, b.Low, b.Close, b.Volume)
+	return err == nil, err
+}
+
+// Validate 檢查 K 線的價格是否合理
+func Validate(b models.PriceBar) error {
+	if b.Open <= 0 || b.High <= 0 || b.Low <= 0 || b.Close <= 0 {
+		return fmt.Errorf("價格必須大於 0")
+	}
+	if b.High < b.Low || b.High < b.Open || b.High < b.Close || b.Low > b.Open || b.Low > b.Close {
+		return fmt.Errorf("最高價與最低價不一致")
+	}
+	if b.Volume < 0 {
+		return fmt.Errorf("成交量不可為負數")
+	}
+	return nil
+}
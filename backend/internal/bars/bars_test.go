@@ -0,0 +1,98 @@
+package bars
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"trade-journal/internal/testutil"
+)
+
+func TestParseTime(t *testing.T) {
+	offset := 2 * time.Hour
+	want := time.Date(2024, 1, 2, 8, 30, 0, 0, time.UTC)
+	cases := []struct {
+		in   string
+		want time.Time
+	}{
+		{"2024.01.02 10:30:00", want}, // MT5 伺服器時間 UTC+2
+		{"2024.01.02 10:30", want},
+		{"02.01.2024 10:30:00.000", want},
+		{"2024-01-02T08:30:00Z", want}, // 帶時區時不套用偏移
+		{"1704184200", want},
+		{"1704184200000", want},
+		{"20240102", time.Date(2024, 1, 1, 22, 0, 0, 0, time.UTC)},
+	}
+	for _, tc := range cases {
+		got, err := ParseTime(tc.in, offset)
+		if err != nil || !got.Equal(tc.want) {
+			t.Errorf("%s: 得到 %v %v，預期 %v", tc.in, got, err, tc.want)
+		}
+	}
+	if _, err := ParseTime("yesterday", 0); err == nil {
+		t.Error("無效的時間應回傳錯誤")
+	}
+}
+
+func TestParseFilename(t *testing.T) {
+	if s, tf := ParseFilename(`C:\exports\XAUUSD_M15_202401020000_202401312345.csv`); s != "XAUUSD" || tf != "M15" {
+		t.Errorf("得到 %q %q", s, tf)
+	}
+	if s, tf := ParseFilename("bars.csv"); s != "" || tf != "" {
+		t.Errorf("無法辨識的檔名應回傳空字串，得到 %q %q", s, tf)
+	}
+}
+
+func TestImportCSV(t *testing.T) {
+	db := testutil.OpenDB(t, "INSERT INTO users (id, username, password) VALUES (1, 'alice', 'x')")
+
+	// MT5 匯出：Tab 分隔、伺服器時間 UTC+2，外匯的 <VOL> 為 0 時使用 tick 成交量
+	mt5 := "\ufeff<DATE>\t<TIME>\t<OPEN>\t<HIGH>\t<LOW>\t<CLOSE>\t<TICKVOL>\t<VOL>\t<SPREAD>\n" +
+		"2024.01.02\t10:00:00\t2062.40\t2064.10\t2061.90\t2063.50\t120\t0\t12\n" +
+		"2024.01.02\t10:01:00\t2063.50\t2065.00\t2063.00\t2064.80\t98\t0\t12\n" +
+		"2024.01.02\t10:02:00\t2064.80\t2064.00\t2063.10\t2063.40\t75\t0\t12\n" + // 最高價低於開盤價
+		"2024.01.02\t10:03:00\tabc\t2064.00\t2063.10\t2063.40\t75\t0\t12\n"
+	result, err := ImportCSV(db, 1, "XAUUSD", "M1", strings.NewReader(mt5), 2*time.Hour)
+	if err != nil {
+		t.Fatalf("匯入失敗: %v", err)
+	}
+	if result.Created != 2 || result.Skipped != 2 || len(result.Errors) != 2 {
+		t.Fatalf("匯入結果錯誤: %+v", result)
+	}
+	if !result.From.Equal(time.Date(2024, 1, 2, 8, 0, 0, 0, time.UTC)) {
+		t.Errorf("起始時間錯誤: %v", result.From)
+	}
+
+	// cTrader 匯出：逗號分隔、UTC 時間，與既有 K 線重疊的部分覆寫
+	ctrader := "Time,Open,High,Low,Close,Volume\n" +
+		"2024-01-02 08:01:00,2063.50,2065.50,2063.00,2065.00,110\n" +
+		"2024-01-02 08:02:00,2065.00,2066.00,2064.50,2065.80,90\n"
+	result, err = ImportCSV(db, 1, "XAUUSD", "M1", strings.NewReader(ctrader), 0)
+	if err != nil {
+		t.Fatalf("匯入失敗: %v", err)
+	}
+	if result.Created != 1 || result.Updated != 1 {
+		t.Fatalf("重複的 K 線應覆寫: %+v", result)
+	}
+
+	list, err := Range(db, 1, "XAUUSD", "M1", time.Time{}, time.Time{}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 3 || list[0].Volume != 120 || list[1].High != 2065.50 || list[1].Volume != 110 {
+		t.Fatalf("K 線內容錯誤: %+v", list)
+	}
+	list, _ = Range(db, 1, "XAUUSD", "M1", time.Date(2024, 1, 2, 8, 1, 0, 0, time.UTC), time.Time{}, 1)
+	if len(list) != 1 || list[0].Close != 2065.00 {
+		t.Fatalf("範圍查詢錯誤: %+v", list)
+	}
+
+	series, _ := Series(db, 1)
+	if len(series) != 1 || series[0].Bars != 3 || series[0].Timeframe != "M1" {
+		t.Fatalf("品種與週期列表錯誤: %+v", series)
+	}
+
+	if _, err := ImportCSV(db, 1, "XAUUSD", "M1", strings.NewReader("time,open,close\n"), 0); err == nil {
+		t.Error("缺少必要欄位時應回傳錯誤")
+	}
+}
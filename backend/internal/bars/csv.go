@@ -0,0 +1,301 @@
+package bars
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"trade-journal/internal/database"
+	"trade-journal/internal/models"
+)
+
+// maxErrors 匯入結果最多列出的錯誤訊息數，其餘只計入 Skipped
+const maxErrors = 100
+
+// ImportResult K 線 CSV 匯入結果
+type ImportResult struct {
+	Symbol    string     `json:"symbol"`
+	Timeframe string     `json:"timeframe"`
+	Created   int        `json:"created"`
+	Updated   int        `json:"updated"`
+	Skipped   int        `json:"skipped"`
+	From      *time.Time `json:"from"`
+	To        *time.Time `json:"to"`
+	Errors    []string   `json:"errors"`
+
+	// TradesUpdated 匯入後重新計算 MAE / MFE 的交易數，由呼叫端填入
+	TradesUpdated int `json:"trades_updated"`
+}
+
+// timeLayouts 匯出檔常見的時間格式，日期與時間分成兩欄時以空白合併後解析
+var timeLayouts = []string{
+	"2006.01.02 15:04:05",
+	"2006.01.02 15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006/01/02 15:04:05",
+	"2006/01/02 15:04",
+	"02.01.2006 15:04:05.000",
+	"02.01.2006 15:04:05",
+	"02.01.2006 15:04",
+	"20060102 15:04:05",
+	"20060102 15:04",
+	"2006.01.02",
+	"2006-01-02",
+	"2006/01/02",
+	"02.01.2006",
+	"20060102",
+}
+
+// zonedLayouts 帶有時區的格式，不套用匯入時指定的時區偏移
+var zonedLayouts = []string{time.RFC3339Nano, "2006-01-02 15:04:05Z07:00", "2006-01-02 15:04:05 -0700"}
+
+// ParseTime 解析匯出檔的時間，沒有時區的時間視為 UTC+offset
+// 也接受 Unix 秒數或毫秒數
+func ParseTime(s string, offset time.Duration) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil && len(s) >= 10 {
+		if len(s) >= 13 {
+			return time.UnixMilli(n).UTC(), nil
+		}
+		return time.Unix(n, 0).UTC(), nil
+	}
+	for _, layout := range zonedLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Add(-offset), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("無效的時間: %q", s)
+}
+
+// detectDelimiter 依第一列判斷分隔字元：MT5 匯出為 Tab，其他常見為逗號或分號
+func detectDelimiter(line string) rune {
+	switch {
+	case strings.Contains(line, "\t"):
+		return '\t'
+	case strings.Count(line, ";") > strings.Count(line, ","):
+		return ';'
+	default:
+		return ','
+	}
+}
+
+// headerKey 將標題轉為比對用的名稱，例如 "<TICKVOL>" -> "tickvol"、"Open Time" -> "opentime"
+func headerKey(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(strings.TrimPrefix(name, "\ufeff")) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// layout 各欄位在資料列中的位置，-1 表示沒有該欄位
+type layout struct {
+	date, time             int
+	open, high, low, close int
+	volumes                []int
+}
+
+var (
+	dateKeys   = []string{"date", "day"}
+	timeKeys   = []string{"time", "datetime", "timestamp", "opentime", "timeutc", "dateutc", "gmttime"}
+	volumeKeys = []string{"volume", "vol", "realvolume", "tickvol", "tickvolume"}
+)
+
+// parseHeader 解析標題列，沒有 open 欄位時視為沒有標題
+func parseHeader(header []string) (layout, bool) {
+	cols := map[string]int{}
+	for i, name := range header {
+		if _, ok := cols[headerKey(name)]; !ok {
+			cols[headerKey(name)] = i
+		}
+	}
+	find := func(keys ...string) int {
+		for _, k := range keys {
+			if i, ok := cols[k]; ok {
+				return i
+			}
+		}
+		return -1
+	}
+	l := layout{
+		date:  find(dateKeys...),
+		time:  find(timeKeys...),
+		open:  find("open"),
+		high:  find("high"),
+		low:   find("low"),
+		close: find("close"),
+	}
+	if l.open < 0 {
+		return l, false
+	}
+	for _, k := range volumeKeys {
+		if i, ok := cols[k]; ok {
+			l.volumes = append(l.volumes, i)
+		}
+	}
+	return l, true
+}
+
+// guessLayout 沒有標題的檔案：日期、時間分兩欄 (MT4 / MT5 舊格式) 或單一時間欄位，其後為 OHLC 與成交量
+func guessLayout(record []string) layout {
+	if len(record) > 1 && strings.Contains(record[1], ":") {
+		return layout{date: 0, time: 1, open: 2, high: 3, low: 4, close: 5, volumes: []int{6}}
+	}
+	return layout{date: -1, time: 0, open: 1, high: 2, low: 3, close: 4, volumes: []int{5}}
+}
+
+// ImportCSV 匯入 MT5 / cTrader 匯出的 K 線 CSV
+// 支援 MT5 的 <DATE> <TIME> <OPEN>... 標題、一般的 time,open,high,low,close,volume 標題以及沒有標題的檔案
+// 時間沒有時區時視為 UTC+offset (券商伺服器時間)；同一時間的 K 線會被覆寫，格式錯誤的資料列會略過
+func ImportCSV(q database.Querier, userID int64, symbol, timeframe string, r io.Reader, offset time.Duration) (ImportResult, error) {
+	result := ImportResult{Symbol: symbol, Timeframe: timeframe, Errors: []string{}}
+
+	br := bufio.NewReader(r)
+	first, _ := br.Peek(4096)
+	firstLine := string(first)
+	if i := strings.IndexByte(firstLine, '\n'); i >= 0 {
+		firstLine = firstLine[:i]
+	}
+	delimiter := detectDelimiter(firstLine)
+
+	reader := csv.NewReader(br)
+	reader.Comma = delimiter
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.LazyQuotes = true
+
+	fail := func(line int, err error) {
+		result.Skipped++
+		if len(result.Errors) < maxErrors {
+			result.Errors = append(result.Errors, fmt.Sprintf("第 %d 列: %v", line, err))
+		}
+	}
+
+	var cols layout
+	line := 0
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line++
+		if err != nil {
+			fail(line, err)
+			continue
+		}
+		if line == 1 {
+			var hasHeader bool
+			if cols, hasHeader = parseHeader(record); hasHeader {
+				if cols.high < 0 || cols.low < 0 || cols.close < 0 || (cols.date < 0 && cols.time < 0) {
+					return result, fmt.Errorf("CSV 需要時間、open、high、low、close 欄位")
+				}
+				continue
+			}
+			cols = guessLayout(record)
+		}
+		if len(record) == 1 && strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+
+		bar, err := parseRecord(record, cols, delimiter, offset)
+		if err == nil {
+			err = Validate(bar)
+		}
+		if err != nil {
+			fail(line, err)
+			continue
+		}
+
+		created, err := Save(q, userID, symbol, timeframe, bar)
+		if err != nil {
+			return result, err
+		}
+		if created {
+			result.Created++
+		} else {
+			result.Updated++
+		}
+		if result.From == nil || bar.Time.Before(*result.From) {
+			t := bar.Time
+			result.From = &t
+		}
+		if result.To == nil || bar.Time.After(*result.To) {
+			t := bar.Time
+			result.To = &t
+		}
+	}
+	return result, nil
+}
+
+// parseRecord 依欄位位置解析一根 K 線，分號分隔的檔案允許以逗號作為小數點
+func parseRecord(record []string, cols layout, delimiter rune, offset time.Duration) (models.PriceBar, error) {
+	var bar models.PriceBar
+	field := func(i int) string {
+		if i < 0 || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+	number := func(i int) (float64, error) {
+		s := field(i)
+		if delimiter == ';' {
+			s = strings.ReplaceAll(s, ",", ".")
+		}
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return 0, fmt.Errorf("無效的數值 %q", field(i))
+		}
+		return v, nil
+	}
+
+	ts := field(cols.time)
+	if cols.date >= 0 {
+		// 日線的 MT5 匯出沒有時間欄位，日期欄位本身已含時間時不再合併
+		ts = strings.TrimSpace(field(cols.date) + " " + ts)
+		if strings.Contains(field(cols.date), " ") || strings.Contains(field(cols.date), "T") {
+			ts = field(cols.date)
+		}
+	}
+	var err error
+	if bar.Time, err = ParseTime(ts, offset); err != nil {
+		return bar, err
+	}
+
+	for _, f := range []struct {
+		col int
+		dst *float64
+	}{{cols.open, &bar.Open}, {cols.high, &bar.High}, {cols.low, &bar.Low}, {cols.close, &bar.Close}} {
+		if *f.dst, err = number(f.col); err != nil {
+			return bar, err
+		}
+	}
+	// 外匯的實際成交量通常為 0，依序取第一個非零的成交量 (實際成交量、tick 成交量)
+	for _, i := range cols.volumes {
+		if field(i) == "" {
+			continue
+		}
+		v, err := number(i)
+		if err != nil {
+			return bar, err
+		}
+		if v != 0 {
+			bar.Volume = v
+			break
+		}
+	}
+	return bar, nil
+}
@@ -4,10 +4,16 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"log"
 	"strconv"
 	"sync"
 	"time"
 
+	"trade-journal/internal/audit"
+	"trade-journal/internal/executions"
+	"trade-journal/internal/instruments"
+	"trade-journal/internal/models"
+
 	"github.com/gorilla/websocket"
 )
 
@@ -38,7 +44,7 @@ func (m *Manager) run() {
 }
 
 func (m *Manager) reconcileConnections() {
-	rows, err := m.db.Query("SELECT id, ctrader_account_id, ctrader_token, ctrader_client_id, ctrader_client_secret, ctrader_env, sync_status FROM accounts WHERE type = 'ctrader' AND ctrader_token != ''")
+	rows, err := m.db.Query("SELECT id, ctrader_account_id, ctrader_token, ctrader_client_id, ctrader_client_secret, ctrader_env, sync_status FROM accounts WHERE type = 'ctrader' AND ctrader_token != '' AND deleted_at IS NULL")
 	if err != nil { return }
 	defer rows.Close()
 
@@ -106,9 +112,11 @@ func (m *Manager) connectAndListen(accountID int64, ctidStr, token, cid, secret,
 		}
 	}
 
+	aliases, err := instruments.LoadAccountAliases(m.db, accountID)
+	if err != nil { return err }
 	posResp, err := sendRequest(conn, PayloadReconcileReq, map[string]interface{}{"ctidTraderAccountId": ctid})
 	if err == nil {
-		var p struct { Positions []struct { PositionID int64 `json:"positionId"`; TradeData struct { SymbolID int64 `json:"symbolId"`; Volume int64 `json:"volume"`; TradeSide int `json:"tradeSide"`; EntryPrice float64 `json:"entryPrice"`; EntryTimestamp int64 `json:"entryTimestamp"` } `json:"tradeData"`; SymbolName string `json:"symbolName"`; StopLoss float64 `json:"stopLoss"` } `json:"position"` }
+		var p struct { Positions []struct { PositionID int64 `json:"positionId"`; TradeData struct { SymbolID int64 `json:"symbolId"`; Volume int64 `json:"volume"`; TradeSide int `json:"tradeSide"`; EntryPrice float64 `json:"entryPrice"`; EntryTimestamp int64 `json:"entryTimestamp"` } `json:"tradeData"`; SymbolName string `json:"symbolName"`; StopLoss float64 `json:"stopLoss"`; TakeProfit float64 `json:"takeProfit"` } `json:"position"` }
 		json.Unmarshal(posResp.Payload, &p)
 		for _, pos := range p.Positions {
 			fetchSymbol(pos.TradeData.SymbolID)
@@ -120,9 +128,15 @@ func (m *Manager) connectAndListen(accountID int64, ctidStr, token, cid, secret,
 			var exists bool
 			m.db.QueryRow("SELECT EXISTS(SELECT 1 FROM trades WHERE account_id = ? AND (ticket = ? OR ticket = ?))", accountID, ticket, fmt.Sprintf("ctrader-%d", pos.PositionID)).Scan(&exists)
 			if !exists {
-				m.db.Exec(`INSERT INTO trades (account_id, symbol, side, entry_price, lot_size, entry_time, trade_type, notes, ticket, initial_sl)
-					VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-					accountID, symbol, side, pos.TradeData.EntryPrice, vol, time.UnixMilli(pos.TradeData.EntryTimestamp), "actual", "cTrader Push: Initial Sync", ticket, 0)
+				entryTime := time.UnixMilli(pos.TradeData.EntryTimestamp)
+				tps := executions.Levels{}; tps.Add(pos.TakeProfit, time.Now().UnixMilli())
+				fills := []models.ExecutionCreate{{Side: executions.EntrySide(side), Price: pos.TradeData.EntryPrice, Volume: vol, ExecutedAt: entryTime}}
+				tx, err := m.db.Begin(); if err != nil { return err }
+				_, err = executions.CreateTrade(tx, 0, audit.SourceCTrader, fills, `INSERT INTO trades (account_id, symbol, raw_symbol, side, entry_price, lot_size, entry_time, trade_type, notes, ticket, initial_sl, exit_tp, tp_history)
+					VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+					accountID, aliases.Canonical(symbol), symbol, side, pos.TradeData.EntryPrice, vol, entryTime, "actual", "cTrader Push: Initial Sync", ticket, 0, executions.Price(pos.TakeProfit), tps.JSON())
+				if err != nil { tx.Rollback(); return fmt.Errorf("insert position %d: %w", pos.PositionID, err) }
+				if err := tx.Commit(); err != nil { return err }
 			}
 		}
 	}
@@ -154,7 +168,7 @@ func (m *Manager) handleExecutionEvent(accountID int64, payload json.RawMessage,
 	var event struct {
 		ExecutionType int `json:"executionType"`
 		Deal struct { DealID int64 `json:"dealId"`; Volume int64 `json:"volume"`; SymbolID int64 `json:"symbolId"`; ExecutionPrice float64 `json:"executionPrice"`; ExecutionTimestamp int64 `json:"executionTimestamp"`; TradeSide int `json:"tradeSide"`; PositionID int64 `json:"positionId"`; ClosePositionDetail struct { EntryPrice float64 `json:"entryPrice"`; GrossProfit int64 `json:"grossProfit"`; Commission int64 `json:"commission"`; Swap int64 `json:"swap"` } `json:"closePositionDetail"` } `json:"deal"`
-		Position struct { PositionID int64 `json:"positionId"`; TradeData struct { SymbolID int64 `json:"symbolId"`; Volume int64 `json:"volume"`; EntryPrice float64 `json:"entryPrice"` } `json:"tradeData"`; StopLoss float64 `json:"stopLoss"` } `json:"position"`
+		Position struct { PositionID int64 `json:"positionId"`; TradeData struct { SymbolID int64 `json:"symbolId"`; Volume int64 `json:"volume"`; EntryPrice float64 `json:"entryPrice"` } `json:"tradeData"`; StopLoss float64 `json:"stopLoss"`; TakeProfit float64 `json:"takeProfit"` } `json:"position"`
 	}
 	if json.Unmarshal(payload, &event) != nil { return }
 	if event.ExecutionType != 2 && event.ExecutionType != 8 { return }
@@ -167,27 +181,70 @@ func (m *Manager) handleExecutionEvent(accountID int64, payload json.RawMessage,
 	legacyTicket := fmt.Sprintf("ctrader-%d", deal.PositionID)
 	vol := float64(deal.Volume) / float64(lotSize); execTime := time.UnixMilli(deal.ExecutionTimestamp)
 
+	dealSide := executions.SideBuy; if deal.TradeSide == 2 { dealSide = executions.SideSell }
+	fill := models.ExecutionCreate{Side: dealSide, Price: deal.ExecutionPrice, Volume: vol, ExecutedAt: execTime, ExternalID: &ticket}
+	side := "long"; if dealSide == executions.SideSell { side = "short" }
+	notes := "cTrader Push: Open Position"
 	if deal.ClosePositionDetail.EntryPrice > 0 {
-		var initialSL float64
-		m.db.QueryRow("SELECT initial_sl FROM trades WHERE account_id = ? AND (ticket = ? OR ticket = ?)", accountID, posTicket, legacyTicket).Scan(&initialSL)
-		m.db.Exec("DELETE FROM trades WHERE account_id = ? AND (ticket = ? OR ticket = ?)", accountID, posTicket, legacyTicket)
-		side := "long"; if deal.TradeSide == 1 { side = "short" }
-		pnl := float64(deal.ClosePositionDetail.GrossProfit + deal.ClosePositionDetail.Commission + deal.ClosePositionDetail.Swap) / 100.0
-		var exists bool
-		m.db.QueryRow("SELECT EXISTS(SELECT 1 FROM trades WHERE account_id = ? AND ticket = ?)", accountID, ticket).Scan(&exists)
-		if !exists {
-			m.db.Exec(`INSERT INTO trades (account_id, symbol, side, entry_price, exit_price, lot_size, pnl, entry_time, exit_time, trade_type, notes, ticket, initial_sl, exit_sl)
-				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-				accountID, symbol, side, deal.ClosePositionDetail.EntryPrice, deal.ExecutionPrice, vol, pnl, execTime, execTime, "actual", "cTrader Push: Closed Position", ticket, initialSL, event.Position.StopLoss)
+		// 平倉成交的方向與部位相反
+		side = "long"; if dealSide == executions.SideBuy { side = "short" }
+		gross := float64(deal.ClosePositionDetail.GrossProfit) / 100.0
+		fill.PnL = &gross
+		fill.Commission = float64(deal.ClosePositionDetail.Commission) / 100.0; fill.Swap = float64(deal.ClosePositionDetail.Swap) / 100.0
+		notes = "cTrader Push: Closed Position"
+	}
+
+	// 已記錄過的成交 (含舊版每筆平倉各自一筆交易的格式)
+	if exists, _ := executions.ExternalExists(m.db, accountID, ticket); exists { return }
+	var exists bool
+	m.db.QueryRow("SELECT EXISTS(SELECT 1 FROM trades WHERE account_id = ? AND ticket = ?)", accountID, ticket).Scan(&exists)
+	if exists { return }
+
+	tx, err := m.db.Begin(); if err != nil { return }
+	defer tx.Rollback()
+
+	// 同一部位的加倉與分批平倉都記錄在同一筆交易
+	var tradeID int64
+	err = tx.QueryRow("SELECT id FROM trades WHERE account_id = ? AND (ticket = ? OR ticket = ?) AND deleted_at IS NULL", accountID, posTicket, legacyTicket).Scan(&tradeID)
+	if err == nil {
+		before, err := audit.Snapshot(tx, tradeID); if err != nil { return }
+		if executions.EnsureEntry(tx, tradeID) != nil { return }
+		if _, err := executions.Insert(tx, tradeID, fill); err != nil { return }
+		if fill.PnL != nil && event.Position.StopLoss > 0 {
+			tx.Exec("UPDATE trades SET exit_sl = ? WHERE id = ?", event.Position.StopLoss, tradeID)
 		}
-	} else {
-		ticket = posTicket; side := "long"; if deal.TradeSide == 2 { side = "short" }
-		var exists bool
-		m.db.QueryRow("SELECT EXISTS(SELECT 1 FROM trades WHERE account_id = ? AND ticket = ?)", accountID, ticket).Scan(&exists)
-		if !exists {
-			m.db.Exec(`INSERT INTO trades (account_id, symbol, side, entry_price, lot_size, entry_time, trade_type, notes, ticket, initial_sl)
-				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-				accountID, symbol, side, deal.ExecutionPrice, vol, execTime, "actual", "cTrader Push: Open Position", ticket, event.Position.StopLoss)
+		if fill.PnL != nil && event.Position.TakeProfit > 0 {
+			var history *string
+			tx.QueryRow("SELECT tp_history FROM trades WHERE id = ?", tradeID).Scan(&history)
+			tps := executions.ParseLevels(history); tps.Add(event.Position.TakeProfit, deal.ExecutionTimestamp)
+			tx.Exec("UPDATE trades SET exit_tp = ?, tp_history = ? WHERE id = ?", event.Position.TakeProfit, tps.JSON(), tradeID)
 		}
+		if err := executions.Recalculate(tx, tradeID); err != nil { log.Printf("[cTrader Push] Recalculate trade %d failed: %v", tradeID, err); return }
+		after, err := audit.Snapshot(tx, tradeID); if err != nil { return }
+		if err := audit.Record(tx, tradeID, 0, audit.ActionUpdate, audit.SourceCTrader, before, after); err != nil { log.Printf("[cTrader Push] Record trade %d failed: %v", tradeID, err); return }
+		tx.Commit()
+		return
+	} else if err != sql.ErrNoRows {
+		log.Printf("[cTrader Push] Lookup position %d failed: %v", deal.PositionID, err)
+		return
+	}
+
+	fills := []models.ExecutionCreate{fill}
+	var exitSL interface{}
+	// 開倉推播的 TP 為初始停利，平倉時只知道最後的 TP
+	initialTP, exitTP := executions.Price(event.Position.TakeProfit), executions.Price(event.Position.TakeProfit)
+	tps := executions.Levels{}; tps.Add(event.Position.TakeProfit, deal.ExecutionTimestamp)
+	if fill.PnL != nil {
+		// 開倉時未收到推播，以平倉資訊中的進場價補上進場成交
+		fills = []models.ExecutionCreate{{Side: executions.EntrySide(side), Price: deal.ClosePositionDetail.EntryPrice, Volume: vol, ExecutedAt: execTime}, fill}
+		exitSL = event.Position.StopLoss
+		initialTP = nil
 	}
+	summary, _ := executions.Summarize(side, fills)
+	aliases, err := instruments.LoadAccountAliases(tx, accountID); if err != nil { return }
+	_, err = executions.CreateTrade(tx, 0, audit.SourceCTrader, fills, `INSERT INTO trades (account_id, symbol, raw_symbol, side, entry_price, exit_price, lot_size, pnl, entry_time, exit_time, trade_type, notes, ticket, initial_sl, exit_sl, initial_tp, exit_tp, tp_history)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		accountID, aliases.Canonical(symbol), symbol, side, summary.EntryPrice, summary.ExitPrice, summary.LotSize, summary.PnL, summary.EntryTime, summary.ExitTime, "actual", notes, posTicket, event.Position.StopLoss, exitSL, initialTP, exitTP, tps.JSON())
+	if err != nil { log.Printf("[cTrader Push] Insert position %d failed: %v", deal.PositionID, err); return }
+	if err := tx.Commit(); err != nil { log.Printf("[cTrader Push] Commit position %d failed: %v", deal.PositionID, err) }
 }
@@ -8,9 +8,14 @@ import (
 	"math"
 	"sort"
 	"strconv"
-	"strings"
 	"time"
 
+	"trade-journal/internal/audit"
+	"trade-journal/internal/executions"
+	"trade-journal/internal/instruments"
+	"trade-journal/internal/models"
+	"trade-journal/internal/trash"
+
 	"github.com/gorilla/websocket"
 )
 
@@ -49,8 +54,10 @@ type CTraderMessage struct {
 
 func SyncCTraderHistory(db *sql.DB, accountID int64, cTraderAccountID string, token string, clientID string, clientSecret string, env string) error {
 	log.Printf("[cTrader Sync] --- Manual Sync START for Account %d (v2.27) ---", accountID)
-	// Clear existing trades for this account to start fresh and avoid conflicts
-	db.Exec("DELETE FROM trades WHERE account_id = ?", accountID)
+	// Move existing trades to the trash to start fresh and avoid conflicts (notes stay recoverable)
+	batch := trash.NewBatch()
+	db.Exec("UPDATE trades SET deleted_at = CURRENT_TIMESTAMP, delete_batch = ? WHERE account_id = ? AND deleted_at IS NULL", batch, accountID)
+	audit.RecordBatchDelete(db, batch, 0, audit.SourceCTrader)
 	db.Exec("UPDATE accounts SET sync_status = 'syncing (Preparing)...', last_sync_error = '', updated_at = CURRENT_TIMESTAMP WHERE id = ?", accountID)
 	
 	if GlobalManager != nil {
@@ -70,26 +77,26 @@ func SyncCTraderHistory(db *sql.DB, accountID int64, cTraderAccountID string, to
 	return nil
 }
 
-func getMultiplier(symbol string) float64 {
-	if strings.Contains(symbol, "JPY") { return 100.0 } // 2 decimals JPY = 100 pips per $1
-	if strings.Contains(symbol, "XAU") || strings.Contains(symbol, "GOLD") || strings.Contains(symbol, "XPT") { return 1.0 } // Gold: 1.0 = 1 point
-	if strings.Contains(symbol, "NAS") || strings.Contains(symbol, "US30") || strings.Contains(symbol, "SPD") || strings.Contains(symbol, "HSI") { return 1.0 } // Indices: 1.0 = 1 point
-	// Forex pairs: 4 decimals = 10000 points (Pips)
-	if len(symbol) >= 6 && (strings.Contains(symbol, "USD") || strings.Contains(symbol, "EUR") || strings.Contains(symbol, "GBP")) { return 10000.0 }
-	return 1.0 
-}
-
 type dealInfo struct {
 	DealID int64; OrderID int64; SymbolID int64; Volume int64; ExecutionPrice float64; ExecutionTimestamp int64; TradeSide int; PositionID int64; ClosePositionDetail struct { EntryPrice float64; GrossProfit int64; Commission int64; Swap int64; StopLoss float64 `json:"stopLoss"` }
 }
 
 type orderInfo struct {
-	OrderID int64 `json:"orderId"`; PositionID int64 `json:"positionId"`; StopLoss float64 `json:"stopLoss"`; StopPrice float64 `json:"stopPrice"`; TradeTimestamp int64 `json:"utcLastUpdateTimestamp"`; TradeData struct { OpenTimestamp int64 `json:"openTimestamp"` } `json:"tradeData"`
+	OrderID int64 `json:"orderId"`; PositionID int64 `json:"positionId"`; StopLoss float64 `json:"stopLoss"`; StopPrice float64 `json:"stopPrice"`; TakeProfit float64 `json:"takeProfit"`; TradeTimestamp int64 `json:"utcLastUpdateTimestamp"`; TradeData struct { OpenTimestamp int64 `json:"openTimestamp"` } `json:"tradeData"`
+}
+
+// orderLevelTime 價位歷史的時間：訂單建立後未修改時使用建立時間，修改過則使用最後更新時間
+func orderLevelTime(updated, opened int64) int64 {
+	if opened > 0 && math.Abs(float64(updated-opened)) <= 60000 { return opened }
+	return updated
 }
 
 func internalSync(db *sql.DB, accountID int64, cTraderAccountIDStr string, token string, clientID string, clientSecret string, env string) error {
 	cTID, _ := strconv.ParseInt(cTraderAccountIDStr, 10, 64)
 	url := CTraderLiveURL; if env == "demo" { url = CTraderDemoURL }
+	// 券商品種名稱依使用者的別名轉為標準名稱，原始名稱存在 raw_symbol
+	aliases, err := instruments.LoadAccountAliases(db, accountID)
+	if err != nil { return err }
 	
 	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
 	if err != nil { return fmt.Errorf("dial failed: %v", err) }
@@ -193,6 +200,9 @@ func internalSync(db *sql.DB, accountID int64, cTraderAccountIDStr string, token
 		
 		// HYBRID SL SEARCH: Collect all unique SLs (with timestamps) + find authoritative Initial
 		initialSL := 0.0
+		// 停利與停損來自相同的訂單資料，開倉訂單的 TP 為初始停利
+		initialTP := 0.0
+		tps := executions.Levels{}
 		type slEntry struct {
 			Price float64 `json:"price"`
 			Time  int64   `json:"time"`
@@ -229,8 +239,9 @@ func internalSync(db *sql.DB, accountID int64, cTraderAccountIDStr string, token
 			"orderId": openingOrderID,
 		})
 		if odErr == nil {
-			var od struct { Order struct { OrderID int64 `json:"orderId"`; StopLoss float64 `json:"stopLoss"`; StopPrice float64 `json:"stopPrice"`; TradeData struct { OpenTimestamp int64 `json:"openTimestamp"` } `json:"tradeData"` } `json:"order"` }
+			var od struct { Order struct { OrderID int64 `json:"orderId"`; StopLoss float64 `json:"stopLoss"`; StopPrice float64 `json:"stopPrice"`; TakeProfit float64 `json:"takeProfit"`; TradeData struct { OpenTimestamp int64 `json:"openTimestamp"` } `json:"tradeData"` } `json:"order"` }
 			json.Unmarshal(odResp.Payload, &od)
+			if od.Order.TakeProfit > 0 { initialTP = od.Order.TakeProfit; tps.Add(initialTP, entryTime) }
 			sl := od.Order.StopLoss
 			if sl == 0 { sl = od.Order.StopPrice }
 			if sl > 0 {
@@ -248,6 +259,7 @@ func internalSync(db *sql.DB, accountID int64, cTraderAccountIDStr string, token
 		history := orderHistoryMap[pid]
 		sort.Slice(history, func(i, j int) bool { return history[i].TradeTimestamp < history[j].TradeTimestamp })
 		for _, o := range history {
+			tps.Add(o.TakeProfit, orderLevelTime(o.TradeTimestamp, o.TradeData.OpenTimestamp))
 			sl := o.StopLoss; if sl == 0 { sl = o.StopPrice }
 			if sl > 0 {
 				log.Printf("[SL DEBUG] Bulk Order: ID=%d, SL=%.5f, Time=%d, Diff=%d", o.OrderID, sl, o.TradeTimestamp, o.TradeTimestamp-entryTime)
@@ -296,11 +308,12 @@ func internalSync(db *sql.DB, accountID int64, cTraderAccountIDStr string, token
 				"toTimestamp": exitTime + 7200000,
 			})
 			if olErr == nil {
-				var op struct { Order []struct { OrderID int64 `json:"orderId"`; StopLoss float64 `json:"stopLoss"`; StopPrice float64 `json:"stopPrice"`; TradeTimestamp int64 `json:"utcLastUpdateTimestamp"`; TradeData struct { OpenTimestamp int64 `json:"openTimestamp"` } `json:"tradeData"` } `json:"order"` }
+				var op struct { Order []struct { OrderID int64 `json:"orderId"`; StopLoss float64 `json:"stopLoss"`; StopPrice float64 `json:"stopPrice"`; TakeProfit float64 `json:"takeProfit"`; TradeTimestamp int64 `json:"utcLastUpdateTimestamp"`; TradeData struct { OpenTimestamp int64 `json:"openTimestamp"` } `json:"tradeData"` } `json:"order"` }
 				json.Unmarshal(olResp.Payload, &op)
 				if len(op.Order) > 0 {
 					sort.Slice(op.Order, func(i, j int) bool { return op.Order[i].TradeTimestamp < op.Order[j].TradeTimestamp })
 					for _, o := range op.Order {
+						tps.Add(o.TakeProfit, orderLevelTime(o.TradeTimestamp, o.TradeData.OpenTimestamp))
 						sl := o.StopLoss; if sl == 0 { sl = o.StopPrice }
 						if sl > 0 {
 							isModified := false
@@ -352,35 +365,55 @@ func internalSync(db *sql.DB, accountID int64, cTraderAccountIDStr string, token
 	}
 		slHistoryJSON, _ := json.Marshal(allSLEntries)
 
-		// Process each closed deal in this position
+		// 開倉訂單沒有 TP 時，以進場 60 秒內最早設定的 TP 為初始停利；平倉時的停利為最後設定的 TP
+		if first, ok := tps.Earliest(); initialTP == 0 && ok && math.Abs(float64(first.Time-entryTime)) <= 60000 { initialTP = first.Price }
+		exitTP := 0.0
+		if last, ok := tps.Latest(); ok { exitTP = last.Price }
+
+		// 同一部位的所有成交合併為一筆交易，加倉與分批平倉記錄在 trade_executions
+		symbol := symbolMap[deals[0].SymbolID]; if symbol == "" { symbol = "Unknown" }
+		lotSize := symbolLotSizeMap[deals[0].SymbolID]; if lotSize == 0 { lotSize = 100000 }
+		side := ""
+		var fills []models.ExecutionCreate
+		var closeEntryPrice, closedVolume, exitSL float64
 		for _, d := range deals {
-			if d.ClosePositionDetail.EntryPrice == 0 { continue }
-			symbol := symbolMap[d.SymbolID]; if symbol == "" { symbol = "Unknown" }
-			lotSize := symbolLotSizeMap[d.SymbolID]; if lotSize == 0 { lotSize = 100000 }
-			side := "long"; if d.TradeSide == 1 { side = "short" }
-			vol := float64(d.Volume) / float64(lotSize)
-			pnl := float64(d.ClosePositionDetail.GrossProfit + d.ClosePositionDetail.Commission + d.ClosePositionDetail.Swap) / 100.0
-			ticket := fmt.Sprintf("ctrader-deal-%d", d.DealID)
-			
-			exitSL := d.ClosePositionDetail.StopLoss
-			if exitSL == 0 { exitSL = orderSLMap[d.OrderID] }
-			
-			bullet, rr := 0.0, 0.0
-			mult := getMultiplier(symbol)
-			if initialSL > 0 && d.ClosePositionDetail.EntryPrice > 0 {
-				bullet = math.Round(math.Abs(d.ClosePositionDetail.EntryPrice - initialSL) * mult * 100) / 100
-				
-				// Signed PnL Points relative to side
-				pnlPoints := (d.ExecutionPrice - d.ClosePositionDetail.EntryPrice) * mult
-				if side == "short" { pnlPoints = -pnlPoints }
-				pnlPoints = math.Round(pnlPoints * 100) / 100
-				
-				if bullet > 0 { rr = math.Round((pnlPoints / bullet) * 100) / 100 }
+			dealSide := executions.SideBuy; if d.TradeSide == 2 { dealSide = executions.SideSell }
+			externalID := fmt.Sprintf("ctrader-deal-%d", d.DealID)
+			fill := models.ExecutionCreate{Side: dealSide, Price: d.ExecutionPrice, Volume: float64(d.Volume) / float64(lotSize), ExecutedAt: time.UnixMilli(d.ExecutionTimestamp), ExternalID: &externalID}
+			if d.ClosePositionDetail.EntryPrice == 0 {
+				// 開倉或加倉
+				if side == "" { side = "long"; if dealSide == executions.SideSell { side = "short" } }
+			} else {
+				// 平倉成交的方向與部位相反
+				if side == "" { side = "short"; if dealSide == executions.SideSell { side = "long" } }
+				gross := float64(d.ClosePositionDetail.GrossProfit) / 100.0
+				fill.PnL = &gross
+				fill.Commission = float64(d.ClosePositionDetail.Commission) / 100.0; fill.Swap = float64(d.ClosePositionDetail.Swap) / 100.0
+				closeEntryPrice = d.ClosePositionDetail.EntryPrice
+				closedVolume += fill.Volume
+				exitSL = d.ClosePositionDetail.StopLoss
+				if exitSL == 0 { exitSL = orderSLMap[d.OrderID] }
 			}
-
-			tx.Exec(`INSERT INTO trades (account_id, symbol, side, entry_price, exit_price, lot_size, pnl, entry_time, exit_time, trade_type, notes, ticket, initial_sl, exit_sl, bullet_size, rr_ratio, sl_history)
-				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-				accountID, symbol, side, d.ClosePositionDetail.EntryPrice, d.ExecutionPrice, vol, pnl, time.UnixMilli(entryTime), time.UnixMilli(d.ExecutionTimestamp), "actual", "cTrader Sync", ticket, initialSL, exitSL, bullet, rr, string(slHistoryJSON))
+			fills = append(fills, fill)
+		}
+		// 尚未平倉的部位由 Step 4 處理
+		if closedVolume == 0 { continue }
+
+		// 開倉成交早於抓取範圍時，以平倉資訊中的進場價補上
+		hasEntry := false
+		for _, f := range fills { if f.Side == executions.EntrySide(side) { hasEntry = true; break } }
+		if !hasEntry {
+			fills = append([]models.ExecutionCreate{{Side: executions.EntrySide(side), Price: closeEntryPrice, Volume: closedVolume, ExecutedAt: time.UnixMilli(entryTime)}}, fills...)
+		}
+		summary, _ := executions.Summarize(side, fills)
+
+		ticket := fmt.Sprintf("ctrader-pos-%d", pid)
+		_, err := executions.CreateTrade(tx, 0, audit.SourceCTrader, fills, `INSERT INTO trades (account_id, symbol, raw_symbol, side, entry_price, exit_price, lot_size, pnl, entry_time, exit_time, trade_type, notes, ticket, initial_sl, exit_sl, sl_history, initial_tp, exit_tp, tp_history)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			accountID, aliases.Canonical(symbol), symbol, side, summary.EntryPrice, summary.ExitPrice, summary.LotSize, summary.PnL, summary.EntryTime, summary.ExitTime, "actual", "cTrader Sync", ticket, initialSL, exitSL, string(slHistoryJSON), executions.Price(initialTP), executions.Price(exitTP), tps.JSON())
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("insert position %d: %w", pid, err)
 		}
 	}
 	if count > 0 && tx != nil { tx.Commit() }
@@ -390,7 +423,7 @@ func internalSync(db *sql.DB, accountID int64, cTraderAccountIDStr string, token
 	pResp, err := sendRequest(conn, PayloadReconcileReq, map[string]interface{}{"ctidTraderAccountId": cTID})
 	if err == nil {
 		var p struct { Position []struct { 
-			PositionID int64 `json:"positionId"`; Price float64 `json:"price"`; StopLoss float64 `json:"stopLoss"`;
+			PositionID int64 `json:"positionId"`; Price float64 `json:"price"`; StopLoss float64 `json:"stopLoss"`; TakeProfit float64 `json:"takeProfit"`;
 			TradeData struct { SymbolID int64 `json:"symbolId"`; Volume int64 `json:"volume"`; TradeSide int `json:"tradeSide"`; EntryTimestamp int64 `json:"entryTimestamp"` } `json:"tradeData"`
 		} `json:"position"` }
 		if err := json.Unmarshal(pResp.Payload, &p); err == nil {
@@ -417,10 +450,18 @@ func internalSync(db *sql.DB, accountID int64, cTraderAccountIDStr string, token
 					allSLEntries = append(allSLEntries, slEntry{Price: sl, Time: t})
 				}
 				
+				initialTP := 0.0
+				tps := executions.Levels{}
+				addTP := func(tp float64, t int64) {
+					tps.Add(tp, t)
+					if initialTP == 0 && tp > 0 && math.Abs(float64(t - pos.TradeData.EntryTimestamp)) <= 2000 { initialTP = tp }
+				}
+
 				// Try bulk first
 				history := orderHistoryMap[pos.PositionID]
 				sort.Slice(history, func(i, j int) bool { return history[i].TradeTimestamp < history[j].TradeTimestamp })
 				for _, o := range history {
+					addTP(o.TakeProfit, o.TradeTimestamp)
 					sl := o.StopLoss; if sl == 0 { sl = o.StopPrice }
 					if sl > 0 {
 						addSL(sl, o.TradeTimestamp)
@@ -437,11 +478,12 @@ func internalSync(db *sql.DB, accountID int64, cTraderAccountIDStr string, token
 					"toTimestamp": time.Now().UnixMilli() + 3600000,
 				})
 				if olErr == nil {
-					var op struct { Order []struct { StopLoss float64 `json:"stopLoss"`; StopPrice float64 `json:"stopPrice"`; TradeTimestamp int64 `json:"utcLastUpdateTimestamp"` } `json:"order"` }
+					var op struct { Order []struct { StopLoss float64 `json:"stopLoss"`; StopPrice float64 `json:"stopPrice"`; TakeProfit float64 `json:"takeProfit"`; TradeTimestamp int64 `json:"utcLastUpdateTimestamp"` } `json:"order"` }
 					json.Unmarshal(olResp.Payload, &op)
 					if len(op.Order) > 0 {
 						sort.Slice(op.Order, func(i, j int) bool { return op.Order[i].TradeTimestamp < op.Order[j].TradeTimestamp })
 						for _, o := range op.Order {
+							addTP(o.TakeProfit, o.TradeTimestamp)
 							sl := o.StopLoss; if sl == 0 { sl = o.StopPrice }
 							if sl > 0 {
 								addSL(sl, o.TradeTimestamp)
@@ -453,18 +495,28 @@ func internalSync(db *sql.DB, accountID int64, cTraderAccountIDStr string, token
 				
 				if initialSL == 0 && len(allSLEntries) > 0 { initialSL = allSLEntries[0].Price }
 				slHistoryJSON, _ := json.Marshal(allSLEntries)
-
-				bullet := 0.0; mult := getMultiplier(symbol)
-				if initialSL > 0 && pos.Price > 0 { bullet = math.Round(math.Abs(pos.Price - initialSL) * mult * 100) / 100 }
+				if first, ok := tps.Earliest(); initialTP == 0 && ok { initialTP = first.Price }
+				tps.Add(pos.TakeProfit, time.Now().UnixMilli())
 
 				ticket := fmt.Sprintf("ctrader-pos-%d", pos.PositionID)
 				lotSize := symbolLotSizeMap[pos.TradeData.SymbolID]; if lotSize == 0 { lotSize = 100000 }
 				side := "long"; if pos.TradeData.TradeSide == 2 { side = "short" }
 				vol := float64(pos.TradeData.Volume) / float64(lotSize)
+
+				// 已部分平倉的部位在 Step 3 已建立
+				var exists bool
+				tx.QueryRow("SELECT EXISTS(SELECT 1 FROM trades WHERE account_id = ? AND ticket = ? AND deleted_at IS NULL)", accountID, ticket).Scan(&exists)
+				if exists { continue }
 				
-				tx.Exec(`INSERT INTO trades (account_id, symbol, side, entry_price, lot_size, entry_time, trade_type, notes, ticket, initial_sl, exit_sl, bullet_size, sl_history)
-					VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-					accountID, symbol, side, pos.Price, vol, time.UnixMilli(pos.TradeData.EntryTimestamp), "actual", "cTrader Open", ticket, initialSL, pos.StopLoss, bullet, string(slHistoryJSON))
+				entryTime := time.UnixMilli(pos.TradeData.EntryTimestamp)
+				fills := []models.ExecutionCreate{{Side: executions.EntrySide(side), Price: pos.Price, Volume: vol, ExecutedAt: entryTime}}
+				_, err := executions.CreateTrade(tx, 0, audit.SourceCTrader, fills, `INSERT INTO trades (account_id, symbol, raw_symbol, side, entry_price, lot_size, entry_time, trade_type, notes, ticket, initial_sl, exit_sl, sl_history, initial_tp, exit_tp, tp_history)
+					VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+					accountID, aliases.Canonical(symbol), symbol, side, pos.Price, vol, entryTime, "actual", "cTrader Open", ticket, initialSL, pos.StopLoss, string(slHistoryJSON), executions.Price(initialTP), executions.Price(pos.TakeProfit), tps.JSON())
+				if err != nil {
+					tx.Rollback()
+					return fmt.Errorf("insert position %d: %w", pos.PositionID, err)
+				}
 			}
 			if countOpen > 0 && tx != nil { tx.Commit() }
 		}
@@ -0,0 +1,475 @@
+package customfields
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"trade-journal/internal/database"
+	"trade-journal/internal/models"
+)
+
+// 欄位類型
+const (
+	TypeText        = "text"
+	TypeNumber      = "number"
+	TypeSelect      = "select"
+	TypeMultiSelect = "multi_select"
+	TypeBoolean     = "boolean"
+	TypeDate        = "date"
+)
+
+// maxTextLength 文字欄位的長度上限
+const maxTextLength = 1000
+
+// ErrNotFound 欄位不存在或不屬於使用者
+var ErrNotFound = errors.New("自訂欄位不存在")
+
+var keyPattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+const selectColumns = `
+	SELECT id, user_id, field_key, name, field_type, options, COALESCE(required, FALSE), COALESCE(position, 0), created_at, updated_at
+	FROM custom_fields`
+
+func scan(row interface{ Scan(...interface{}) error }) (models.CustomField, error) {
+	var f models.CustomField
+	var options string
+	err := row.Scan(&f.ID, &f.UserID, &f.Key, &f.Name, &f.FieldType, &options, &f.Required, &f.Position, &f.CreatedAt, &f.UpdatedAt)
+	if err != nil {
+		return f, err
+	}
+	if err := json.Unmarshal([]byte(options), &f.Options); err != nil {
+		return f, fmt.Errorf("自訂欄位 %s 選項格式錯誤: %w", f.Key, err)
+	}
+	return f, nil
+}
+
+// List 取得使用者的所有自訂欄位，依 position 排序
+func List(q database.Querier, userID int64) ([]models.CustomField, error) {
+	rows, err := q.Query(selectColumns+" WHERE user_id = ? ORDER BY position, id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.CustomField{}
+	for rows.Next() {
+		f, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, f)
+	}
+	return list, rows.Err()
+}
+
+// Get 取得使用者的單一自訂欄位，找不到時回傳 ErrNotFound
+func Get(q database.Querier, userID, id int64) (models.CustomField, error) {
+	f, err := scan(q.QueryRow(selectColumns+" WHERE id = ? AND user_id = ?", id, userID))
+	if err == sql.ErrNoRows {
+		return f, ErrNotFound
+	}
+	return f, err
+}
+
+// GetByKey 以 key 取得使用者的自訂欄位，找不到時回傳 ErrNotFound
+func GetByKey(q database.Querier, userID int64, key string) (models.CustomField, error) {
+	f, err := scan(q.QueryRow(selectColumns+" WHERE field_key = ? AND user_id = ?", key, userID))
+	if err == sql.ErrNoRows {
+		return f, ErrNotFound
+	}
+	return f, err
+}
+
+// Validate 檢查 key 格式與選項，回傳整理後的選項
+func Validate(key, fieldType string, options []string) ([]string, error) {
+	if !keyPattern.MatchString(key) {
+		return nil, fmt.Errorf("key 只能包含小寫英文、數字與底線，且需以英文開頭")
+	}
+	if fieldType != TypeSelect && fieldType != TypeMultiSelect {
+		return []string{}, nil
+	}
+
+	cleaned := []string{}
+	seen := make(map[string]bool)
+	for _, o := range options {
+		o = strings.TrimSpace(o)
+		if o == "" {
+			continue
+		}
+		if seen[o] {
+			return nil, fmt.Errorf("選項重複: %s", o)
+		}
+		seen[o] = true
+		cleaned = append(cleaned, o)
+	}
+	if len(cleaned) == 0 {
+		return nil, fmt.Errorf("選單欄位至少需要一個選項")
+	}
+	return cleaned, nil
+}
+
+// Create 建立自訂欄位
+func Create(q database.Querier, userID int64, req models.CustomFieldCreate) (int64, error) {
+	options, err := json.Marshal(req.Options)
+	if err != nil {
+		return 0, err
+	}
+	return database.InsertID(q, `
+		INSERT INTO custom_fields (field_key, name, field_type, options, required, position, user_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, req.Key, req.Name, req.FieldType, string(options), req.Required, req.Position, userID)
+}
+
+// Update 更新自訂欄位，移除的選項不影響已儲存的值
+func Update(q database.Querier, userID, id int64, req models.CustomFieldUpdate) error {
+	options, err := json.Marshal(req.Options)
+	if err != nil {
+		return err
+	}
+	res, err := q.Exec(`
+		UPDATE custom_fields SET name = ?, options = ?, required = ?, position = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND user_id = ?
+	`, req.Name, string(options), req.Required, req.Position, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Delete 刪除自訂欄位與所有交易中的值
+func Delete(q database.Querier, userID, id int64) error {
+	if _, err := Get(q, userID, id); err != nil {
+		return err
+	}
+	if _, err := q.Exec("DELETE FROM trade_custom_values WHERE field_id = ?", id); err != nil {
+		return err
+	}
+	_, err := q.Exec("DELETE FROM custom_fields WHERE id = ? AND user_id = ?", id, userID)
+	return err
+}
+
+// value 欄位值的儲存格式
+type value struct {
+	text   string
+	number *float64
+}
+
+// Values 已檢查並轉為儲存格式的欄位值 (field id -> 值)，nil 表示清除
+type Values map[int64]*value
+
+// Prepare 依使用者的欄位定義檢查請求中的值
+// create 為 true 時，未提供的必填欄位也會回傳錯誤
+func Prepare(q database.Querier, userID int64, input map[string]interface{}, create bool) (Values, error) {
+	defs, err := List(q, userID)
+	if err != nil {
+		return nil, err
+	}
+	byKey := make(map[string]models.CustomField, len(defs))
+	for _, f := range defs {
+		byKey[f.Key] = f
+	}
+
+	values := make(Values, len(input))
+	for key, v := range input {
+		f, ok := byKey[key]
+		if !ok {
+			return nil, fmt.Errorf("未定義的自訂欄位: %s", key)
+		}
+		stored, err := encode(f, v)
+		if err != nil {
+			return nil, err
+		}
+		if stored == nil && f.Required {
+			return nil, fmt.Errorf("自訂欄位「%s」為必填", f.Name)
+		}
+		values[f.ID] = stored
+	}
+	if create {
+		for _, f := range defs {
+			if _, ok := values[f.ID]; f.Required && !ok {
+				return nil, fmt.Errorf("自訂欄位「%s」為必填", f.Name)
+			}
+		}
+	}
+	return values, nil
+}
+
+// encode 將 JSON 值轉為儲存格式，空值回傳 nil
+func encode(f models.CustomField, v interface{}) (*value, error) {
+	if v == nil {
+		return nil, nil
+	}
+	invalid := fmt.Errorf("自訂欄位「%s」的值格式錯誤", f.Name)
+
+	switch f.FieldType {
+	case TypeText:
+		s, ok := v.(string)
+		if !ok {
+			return nil, invalid
+		}
+		if s = strings.TrimSpace(s); s == "" {
+			return nil, nil
+		}
+		if len([]rune(s)) > maxTextLength {
+			return nil, fmt.Errorf("自訂欄位「%s」最多 %d 個字", f.Name, maxTextLength)
+		}
+		return &value{text: s}, nil
+
+	case TypeNumber:
+		n, ok := v.(float64)
+		if !ok {
+			return nil, invalid
+		}
+		return &value{text: strconv.FormatFloat(n, 'f', -1, 64), number: &n}, nil
+
+	case TypeBoolean:
+		b, ok := v.(bool)
+		if !ok {
+			return nil, invalid
+		}
+		return &value{text: strconv.FormatBool(b)}, nil
+
+	case TypeDate:
+		s, ok := v.(string)
+		if !ok {
+			return nil, invalid
+		}
+		if s == "" {
+			return nil, nil
+		}
+		if _, err := time.Parse("2006-01-02", s); err != nil {
+			return nil, fmt.Errorf("自訂欄位「%s」日期格式需為 YYYY-MM-DD", f.Name)
+		}
+		return &value{text: s}, nil
+
+	case TypeSelect:
+		s, ok := v.(string)
+		if !ok {
+			return nil, invalid
+		}
+		if s == "" {
+			return nil, nil
+		}
+		if !contains(f.Options, s) {
+			return nil, fmt.Errorf("自訂欄位「%s」沒有選項 %s", f.Name, s)
+		}
+		return &value{text: s}, nil
+
+	case TypeMultiSelect:
+		list, ok := v.([]interface{})
+		if !ok {
+			return nil, invalid
+		}
+		selected := make(map[string]bool)
+		for _, item := range list {
+			s, ok := item.(string)
+			if !ok {
+				return nil, invalid
+			}
+			if !contains(f.Options, s) {
+				return nil, fmt.Errorf("自訂欄位「%s」沒有選項 %s", f.Name, s)
+			}
+			selected[s] = true
+		}
+		if len(selected) == 0 {
+			return nil, nil
+		}
+		// 依選項順序儲存，相同選擇的值才會一致
+		ordered := []string{}
+		for _, o := range f.Options {
+			if selected[o] {
+				ordered = append(ordered, o)
+			}
+		}
+		data, err := json.Marshal(ordered)
+		if err != nil {
+			return nil, err
+		}
+		return &value{text: string(data)}, nil
+	}
+	return nil, fmt.Errorf("不支援的欄位類型: %s", f.FieldType)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Save 寫入交易的欄位值，只修改 values 中有的欄位
+func Save(q database.Querier, tradeID int64, values Values) error {
+	for fieldID, v := range values {
+		if _, err := q.Exec("DELETE FROM trade_custom_values WHERE trade_id = ? AND field_id = ?", tradeID, fieldID); err != nil {
+			return err
+		}
+		if v == nil {
+			continue
+		}
+		if _, err := q.Exec("INSERT INTO trade_custom_values (trade_id, field_id, value, number_value) VALUES (?, ?, ?, ?)", tradeID, fieldID, v.text, v.number); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Replace 以 key -> 值取代交易的所有欄位值，用於還原異動
+// 已刪除的欄位會略過
+func Replace(q database.Querier, userID, tradeID int64, input map[string]interface{}) error {
+	defs, err := List(q, userID)
+	if err != nil {
+		return err
+	}
+	if _, err := q.Exec("DELETE FROM trade_custom_values WHERE trade_id = ?", tradeID); err != nil {
+		return err
+	}
+	values := make(Values)
+	for _, f := range defs {
+		v, ok := input[f.Key]
+		if !ok {
+			continue
+		}
+		stored, err := encode(f, v)
+		if err != nil {
+			return err
+		}
+		values[f.ID] = stored
+	}
+	return Save(q, tradeID, values)
+}
+
+// Load 取得交易的欄位值 (key -> 值)，沒有任何值時回傳 nil
+func Load(q database.Querier, tradeID int64) (map[string]interface{}, error) {
+	rows, err := q.Query(`
+		SELECT f.field_key, f.field_type, v.value
+		FROM trade_custom_values v JOIN custom_fields f ON v.field_id = f.id
+		WHERE v.trade_id = ?
+	`, tradeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values map[string]interface{}
+	for rows.Next() {
+		var key, fieldType, text string
+		if err := rows.Scan(&key, &fieldType, &text); err != nil {
+			return nil, err
+		}
+		if values == nil {
+			values = make(map[string]interface{})
+		}
+		values[key] = Decode(fieldType, text)
+	}
+	return values, rows.Err()
+}
+
+// Decode 將儲存的文字轉回欄位類型對應的 JSON 值
+func Decode(fieldType, text string) interface{} {
+	switch fieldType {
+	case TypeNumber:
+		if n, err := strconv.ParseFloat(text, 64); err == nil {
+			return n
+		}
+	case TypeBoolean:
+		if b, err := strconv.ParseBool(text); err == nil {
+			return b
+		}
+	case TypeMultiSelect:
+		var list []string
+		if json.Unmarshal([]byte(text), &list) == nil {
+			return list
+		}
+	}
+	return text
+}
+
+// Filter 將自訂欄位篩選 (key -> 值) 轉為 SQL 條件 (以 AND 開頭)，t 為 trades 的別名
+// 值可用逗號分隔多個，多選欄位包含任一值即符合；數字欄位可用 min..max 表示範圍，任一端可省略
+func Filter(filters map[string]string) (string, []interface{}) {
+	keys := make([]string, 0, len(filters))
+	for key := range filters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var where string
+	var args []interface{}
+	for _, key := range keys {
+		match, matchArgs := matchValue(strings.TrimSpace(filters[key]))
+		if match == "" {
+			continue
+		}
+		where += " AND EXISTS (SELECT 1 FROM trade_custom_values cv JOIN custom_fields cf ON cv.field_id = cf.id WHERE cv.trade_id = t.id AND cf.field_key = ? AND " + match + ")"
+		args = append(append(args, key), matchArgs...)
+	}
+	return where, args
+}
+
+// matchValue 回傳 cv 需符合的條件，沒有可比對的值時回傳空字串
+func matchValue(filter string) (string, []interface{}) {
+	if cond, args, ok := numberRange(filter); ok {
+		return cond, args
+	}
+
+	var values []interface{}
+	var likes []string
+	for _, v := range strings.Split(filter, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+			likes = append(likes, "cv.value LIKE ?")
+		}
+	}
+	if len(values) == 0 {
+		return "", nil
+	}
+	cond := "(cv.value IN (?" + strings.Repeat(", ?", len(values)-1) + ") OR (cf.field_type = '" + TypeMultiSelect + "' AND (" + strings.Join(likes, " OR ") + ")))"
+	args := append([]interface{}{}, values...)
+	for _, v := range values {
+		// 多選欄位存成 JSON 陣列，以含引號的值比對單一選項
+		quoted, _ := json.Marshal(v)
+		args = append(args, "%"+string(quoted)+"%")
+	}
+	return cond, args
+}
+
+// numberRange 解析 min..max 格式，兩端皆不是數字時回傳 false
+func numberRange(filter string) (string, []interface{}, bool) {
+	min, max, ok := strings.Cut(filter, "..")
+	if !ok {
+		return "", nil, false
+	}
+	var conds []string
+	var args []interface{}
+	for _, bound := range []struct {
+		raw string
+		op  string
+	}{{min, ">="}, {max, "<="}} {
+		raw := strings.TrimSpace(bound.raw)
+		if raw == "" {
+			continue
+		}
+		n, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return "", nil, false
+		}
+		conds = append(conds, "cv.number_value "+bound.op+" ?")
+		args = append(args, n)
+	}
+	if len(conds) == 0 {
+		return "", nil, false
+	}
+	return strings.Join(conds, " AND "), args, true
+}
@@ -0,0 +1,115 @@
+package customfields
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+
+	"trade-journal/internal/models"
+	"trade-journal/internal/testutil"
+)
+
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db := testutil.OpenDB(t,
+		"INSERT INTO users (id, username, password) VALUES (1, 'alice', 'x')",
+		"INSERT INTO accounts (id, user_id, name) VALUES (10, 1, 'main')",
+		"INSERT INTO trades (id, account_id, symbol, side, entry_price, entry_time) VALUES (100, 10, 'XAUUSD', 'long', 2300, '2024-05-01 08:00:00')",
+		"INSERT INTO trades (id, account_id, symbol, side, entry_price, entry_time) VALUES (101, 10, 'XAUUSD', 'short', 2310, '2024-05-02 08:00:00')",
+	)
+	for _, f := range []models.CustomFieldCreate{
+		{Key: "news", Name: "30 分鐘內有新聞", FieldType: TypeBoolean, Required: true},
+		{Key: "spread", Name: "點差", FieldType: TypeNumber},
+		{Key: "setup", Name: "型態", FieldType: TypeMultiSelect, Options: []string{"breakout", "pullback", "range"}},
+		{Key: "review_date", Name: "檢討日期", FieldType: TypeDate},
+	} {
+		if _, err := Create(db, 1, f); err != nil {
+			t.Fatalf("建立欄位 %s 失敗: %v", f.Key, err)
+		}
+	}
+	return db
+}
+
+func save(t *testing.T, db *sql.DB, tradeID int64, input map[string]interface{}, create bool) {
+	t.Helper()
+	values, err := Prepare(db, 1, input, create)
+	if err != nil {
+		t.Fatalf("Prepare 失敗: %v", err)
+	}
+	if err := Save(db, tradeID, values); err != nil {
+		t.Fatalf("Save 失敗: %v", err)
+	}
+}
+
+func TestPrepare(t *testing.T) {
+	db := openTestDB(t)
+
+	for name, input := range map[string]map[string]interface{}{
+		"缺少必填":   {"spread": 1.5},
+		"必填清除":   {"news": nil},
+		"未定義欄位":  {"news": true, "unknown": "x"},
+		"型別錯誤":   {"news": "yes"},
+		"選項不存在":  {"news": true, "setup": []interface{}{"scalp"}},
+		"日期格式錯誤": {"news": true, "review_date": "2024/05/01"},
+	} {
+		if _, err := Prepare(db, 1, input, true); err == nil {
+			t.Errorf("%s: 應回傳錯誤", name)
+		}
+	}
+
+	// 更新時未提供必填欄位不檢查
+	if _, err := Prepare(db, 1, map[string]interface{}{"spread": 2.0}, false); err != nil {
+		t.Fatalf("更新時不應要求未提供的必填欄位: %v", err)
+	}
+}
+
+func TestSaveLoadAndFilter(t *testing.T) {
+	db := openTestDB(t)
+	save(t, db, 100, map[string]interface{}{"news": true, "spread": 1.5, "setup": []interface{}{"range", "breakout"}}, true)
+	save(t, db, 101, map[string]interface{}{"news": false, "spread": 3.0, "review_date": "2024-05-03"}, true)
+
+	got, err := Load(db, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{"news": true, "spread": 1.5, "setup": []string{"breakout", "range"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Load = %v, want %v", got, want)
+	}
+
+	// 更新只修改提供的 key，null 清除
+	save(t, db, 100, map[string]interface{}{"setup": nil}, false)
+	got, _ = Load(db, 100)
+	if _, ok := got["setup"]; ok || got["spread"] != 1.5 {
+		t.Fatalf("更新後的值不正確: %v", got)
+	}
+	save(t, db, 100, map[string]interface{}{"setup": []interface{}{"pullback"}}, false)
+
+	for _, tc := range []struct {
+		filters map[string]string
+		want    []int64
+	}{
+		{map[string]string{"news": "true"}, []int64{100}},
+		{map[string]string{"spread": "2.."}, []int64{101}},
+		{map[string]string{"spread": "..2"}, []int64{100}},
+		{map[string]string{"setup": "pullback,range"}, []int64{100}},
+		{map[string]string{"setup": "breakout"}, nil},
+		{map[string]string{"news": "true,false", "review_date": "2024-05-03"}, []int64{101}},
+	} {
+		where, args := Filter(tc.filters)
+		rows, err := db.Query("SELECT t.id FROM trades t WHERE 1 = 1"+where+" ORDER BY t.id", args...)
+		if err != nil {
+			t.Fatalf("%v: %v", tc.filters, err)
+		}
+		var ids []int64
+		for rows.Next() {
+			var id int64
+			rows.Scan(&id)
+			ids = append(ids, id)
+		}
+		rows.Close()
+		if !reflect.DeepEqual(ids, tc.want) {
+			t.Errorf("Filter(%v) = %v, want %v", tc.filters, ids, tc.want)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package dailyplans
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"trade-journal/internal/database"
+)
+
+// Timeframes 每日規劃記錄趨勢的週期
+var Timeframes = []string{"M5", "M15", "H1", "H4", "D1"}
+
+// DefaultTimeframe 判斷是否逆勢交易的預設週期
+const DefaultTimeframe = "H4"
+
+// 交易方向與規劃方向的比較結果
+const (
+	Aligned  = "aligned"  // 與規劃方向相同
+	Against  = "against"  // 與規劃方向相反
+	NoBias   = "no_bias"  // 規劃在該週期沒有方向
+	Unlinked = "unlinked" // 沒有連結的規劃
+)
+
+// sessions 新格式的 trend_analysis 依時段記錄
+var sessions = []string{"asian", "european", "us"}
+
+// planKey 規劃以帳號、品種與帳號時區的日期對應交易
+type planKey struct {
+	accountID int64
+	symbol    string
+	date      string
+}
+
+// dateKey 規劃的 plan_date 以 UTC 午夜記錄當地日期，交易的進場時間依帳號的 UTC 偏移 (小時) 換算為當地日期
+func dateKey(t time.Time, offset int) string {
+	return t.UTC().Add(time.Duration(offset) * time.Hour).Format("2006-01-02")
+}
+
+// accountOffset 取得交易所屬帳號的 UTC 偏移，未設定時與帳號的預設值相同 (UTC+8)
+const accountOffset = "COALESCE((SELECT a.timezone_offset FROM accounts a WHERE a.id = trades.account_id), 8)"
+
+// relink 重新自動連結符合條件且非手動指定的交易，where 為 trades 的條件
+// SQLite 中的時間以 Go 的格式儲存無法用 date() 比較，日期在程式中比對
+func relink(q database.Querier, where string, args ...interface{}) error {
+	automatic := " AND COALESCE(plan_link_manual, FALSE) = FALSE"
+	plans := map[planKey]int64{}
+	rows, err := q.Query(`
+		SELECT id, account_id, symbol, plan_date FROM daily_plans
+		WHERE deleted_at IS NULL AND account_id IN (SELECT account_id FROM trades WHERE `+where+automatic+`)
+		ORDER BY id DESC
+	`, args...) // 同一天有多筆規劃時使用 ID 最小的一筆
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var id int64
+		var key planKey
+		var planDate time.Time
+		if err := rows.Scan(&id, &key.accountID, &key.symbol, &planDate); err != nil {
+			rows.Close()
+			return err
+		}
+		key.date = dateKey(planDate, 0)
+		plans[key] = id
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	type change struct {
+		tradeID int64
+		planID  *int64
+	}
+	var changes []change
+	rows, err = q.Query("SELECT id, account_id, symbol, entry_time, daily_plan_id, "+accountOffset+" FROM trades WHERE "+where+automatic, args...)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var id int64
+		var key planKey
+		var entryTime time.Time
+		var current sql.NullInt64
+		var offset int
+		if err := rows.Scan(&id, &key.accountID, &key.symbol, &entryTime, &current, &offset); err != nil {
+			rows.Close()
+			return err
+		}
+		key.date = dateKey(entryTime, offset)
+		planID, ok := plans[key]
+		switch {
+		case ok && (!current.Valid || current.Int64 != planID):
+			changes = append(changes, change{id, &planID})
+		case !ok && current.Valid:
+			changes = append(changes, change{id, nil})
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, c := range changes {
+		if _, err := q.Exec("UPDATE trades SET daily_plan_id = ? WHERE id = ?", c.planID, c.tradeID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Link 依帳號、品種與進場日期自動連結交易的規劃，手動指定的連結不變
+func Link(q database.Querier, tradeID int64) error {
+	return relink(q, "id = ?", tradeID)
+}
+
+// LinkAccount 重新自動連結帳號的所有交易，用於規劃建立、修改與還原後
+func LinkAccount(q database.Querier, accountID int64) error {
+	return relink(q, "account_id = ?", accountID)
+}
+
+// LinkUser 重新自動連結使用者所有帳號的交易
+func LinkUser(q database.Querier, userID int64) error {
+	return relink(q, "account_id IN (SELECT id FROM accounts WHERE user_id = ?)", userID)
+}
+
+// SetManual 手動指定交易的規劃，planID 為 nil 表示不連結任何規劃
+func SetManual(q database.Querier, tradeID int64, planID *int64) error {
+	_, err := q.Exec("UPDATE trades SET daily_plan_id = ?, plan_link_manual = TRUE WHERE id = ?", planID, tradeID)
+	return err
+}
+
+// ResetAuto 取消手動指定，改回自動連結
+func ResetAuto(q database.Querier, tradeID int64) error {
+	if _, err := q.Exec("UPDATE trades SET plan_link_manual = FALSE WHERE id = ?", tradeID); err != nil {
+		return err
+	}
+	return Link(q, tradeID)
+}
+
+type trend struct {
+	Direction string `json:"direction"`
+}
+
+type sessionTrends struct {
+	Trends map[string]trend `json:"trends"`
+}
+
+// Bias 取得規劃在交易時段與週期的方向 (long / short)，沒有設定時回傳空字串
+// 新格式依時段記錄 ({"asian": {"trends": {"H4": {...}}}})，交易沒有時段時各時段方向一致才採用
+// 舊格式的規劃只有單一時段 ({"H4": {"direction": ...}})
+func Bias(trendAnalysis, marketSession, timeframe string) string {
+	var raw map[string]json.RawMessage
+	if json.Unmarshal([]byte(trendAnalysis), &raw) != nil {
+		return ""
+	}
+
+	bySession := map[string]string{}
+	for _, s := range sessions {
+		data, ok := raw[s]
+		if !ok {
+			continue
+		}
+		var st sessionTrends
+		if json.Unmarshal(data, &st) == nil {
+			bySession[s] = direction(st.Trends[timeframe].Direction)
+		}
+	}
+	if len(bySession) == 0 {
+		var t trend
+		if data, ok := raw[timeframe]; ok && json.Unmarshal(data, &t) == nil {
+			return direction(t.Direction)
+		}
+		return ""
+	}
+
+	if d, ok := bySession[marketSession]; ok {
+		return d
+	}
+	bias := ""
+	for _, s := range sessions {
+		d := bySession[s]
+		if d == "" {
+			continue
+		}
+		if bias != "" && bias != d {
+			return ""
+		}
+		bias = d
+	}
+	return bias
+}
+
+func direction(d string) string {
+	switch strings.ToLower(strings.TrimSpace(d)) {
+	case "long":
+		return "long"
+	case "short":
+		return "short"
+	}
+	return ""
+}
+
+// Check 比較交易方向與規劃方向，並檢查交易記錄的 trend_type 是否與比較結果一致
+func Check(side, trendType, bias string) (alignment string, trendTypeMismatch bool) {
+	if bias == "" {
+		return NoBias, false
+	}
+	alignment, expected := Against, "against_trend"
+	if side == bias {
+		alignment, expected = Aligned, "with_trend"
+	}
+	return alignment, trendType != "" && trendType != expected
+}
@@ -0,0 +1,135 @@
+package dailyplans
+
+import (
+	"database/sql"
+	"testing"
+
+	"trade-journal/internal/testutil"
+)
+
+func TestBias(t *testing.T) {
+	sessions := `{
+		"asian": {"notes": "", "trends": {"H4": {"direction": "long"}, "M15": {"direction": ""}}},
+		"european": {"notes": "", "trends": {"H4": {"direction": "long"}}},
+		"us": {"notes": "", "trends": {"H4": {"direction": "short"}, "D1": {"direction": "long"}}}
+	}`
+	cases := []struct {
+		analysis, session, timeframe, want string
+	}{
+		{sessions, "asian", "H4", "long"},
+		{sessions, "us", "H4", "short"},
+		{sessions, "asian", "M15", ""},
+		{sessions, "", "H4", ""},     // 各時段方向不一致
+		{sessions, "", "D1", "long"}, // 只有一個時段有方向
+		{`{"H4": {"direction": "SHORT"}, "H1": {"direction": "long"}}`, "european", "H4", "short"}, // 舊格式
+		{`{"H4": {"direction": "sideways"}}`, "asian", "H4", ""},
+		{`not json`, "asian", "H4", ""},
+	}
+	for _, tc := range cases {
+		if got := Bias(tc.analysis, tc.session, tc.timeframe); got != tc.want {
+			t.Errorf("%s %s: 得到 %q，預期 %q", tc.session, tc.timeframe, got, tc.want)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	if a, m := Check("long", "with_trend", "long"); a != Aligned || m {
+		t.Errorf("順勢交易: %s %v", a, m)
+	}
+	if a, m := Check("short", "with_trend", "long"); a != Against || !m {
+		t.Errorf("逆勢交易記錄為順勢應標記不符: %s %v", a, m)
+	}
+	if a, m := Check("short", "", "long"); a != Against || m {
+		t.Errorf("沒有 trend_type 時不比較: %s %v", a, m)
+	}
+	if a, m := Check("long", "against_trend", ""); a != NoBias || m {
+		t.Errorf("規劃沒有方向: %s %v", a, m)
+	}
+}
+
+func TestLink(t *testing.T) {
+	db := testutil.OpenDB(t,
+		"INSERT INTO users (id, username, password) VALUES (1, 'alice', 'x')",
+		"INSERT INTO accounts (id, user_id, name) VALUES (10, 1, 'main'), (11, 1, 'prop')",
+		`INSERT INTO daily_plans (id, account_id, plan_date, symbol, market_session) VALUES
+			(1, 10, '2024-05-06 00:00:00', 'XAUUSD', 'all'),
+			(2, 10, '2024-05-07 00:00:00', 'XAUUSD', 'all')`,
+		// 帳號預設為 UTC+8：100 為當地 05-06 07:30、104 為當地 05-07 00:05 (UTC 仍是 05-06)
+		// 101 不同日、102 不同品種、103 不同帳號
+		`INSERT INTO trades (id, account_id, symbol, side, entry_price, entry_time) VALUES
+			(100, 10, 'XAUUSD', 'long', 1, '2024-05-05 23:30:00'),
+			(101, 10, 'XAUUSD', 'long', 1, '2024-05-08 08:00:00'),
+			(102, 10, 'EURUSD', 'long', 1, '2024-05-06 08:00:00'),
+			(103, 11, 'XAUUSD', 'long', 1, '2024-05-06 08:00:00'),
+			(104, 10, 'XAUUSD', 'long', 1, '2024-05-06 16:05:00')`,
+	)
+
+	planOf := func(id int64) *int64 {
+		t.Helper()
+		var planID sql.NullInt64
+		if err := db.QueryRow("SELECT daily_plan_id FROM trades WHERE id = ?", id).Scan(&planID); err != nil {
+			t.Fatal(err)
+		}
+		if !planID.Valid {
+			return nil
+		}
+		return &planID.Int64
+	}
+
+	for _, id := range []int64{100, 101, 102, 103, 104} {
+		if err := Link(db, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if p := planOf(100); p == nil || *p != 1 {
+		t.Fatalf("交易 100 應連結規劃 1，得到 %v", p)
+	}
+	if p := planOf(104); p == nil || *p != 2 {
+		t.Fatalf("當地午夜後進場的交易 104 應連結隔天的規劃 2，得到 %v", p)
+	}
+	for _, id := range []int64{101, 102, 103} {
+		if p := planOf(id); p != nil {
+			t.Errorf("交易 %d 不應連結規劃，得到 %d", id, *p)
+		}
+	}
+
+	// 手動指定後自動連結不會覆寫，改回自動後重新依日期連結
+	plan2 := int64(2)
+	if err := SetManual(db, 100, &plan2); err != nil {
+		t.Fatal(err)
+	}
+	if err := LinkAccount(db, 10); err != nil {
+		t.Fatal(err)
+	}
+	if p := planOf(100); p == nil || *p != 2 {
+		t.Fatalf("手動連結被覆寫: %v", p)
+	}
+	if err := ResetAuto(db, 100); err != nil {
+		t.Fatal(err)
+	}
+	if p := planOf(100); p == nil || *p != 1 {
+		t.Fatalf("改回自動連結錯誤: %v", p)
+	}
+
+	// 新增規劃後重新連結帳號的交易
+	if _, err := db.Exec("INSERT INTO daily_plans (id, account_id, plan_date, symbol, market_session) VALUES (3, 10, '2024-05-08 00:00:00', 'XAUUSD', 'all')"); err != nil {
+		t.Fatal(err)
+	}
+	if err := LinkAccount(db, 10); err != nil {
+		t.Fatal(err)
+	}
+	if p := planOf(101); p == nil || *p != 3 {
+		t.Fatalf("交易 101 應連結新規劃，得到 %v", p)
+	}
+
+	// 帳號改為 UTC 後 104 依 UTC 日期連結
+	if _, err := db.Exec("UPDATE accounts SET timezone_offset = 0 WHERE id = 10"); err != nil {
+		t.Fatal(err)
+	}
+	if err := LinkAccount(db, 10); err != nil {
+		t.Fatal(err)
+	}
+	if p := planOf(104); p == nil || *p != 1 {
+		t.Fatalf("UTC 帳號的交易 104 應連結規劃 1，得到 %v", p)
+	}
+}
@@ -0,0 +1,152 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// CopyTables 依外鍵相依順序排列的資料表，新增資料表時需一併加入
+var CopyTables = []string{
+	"users",
+	"accounts",
+	"strategies",
+	"daily_plans",
+	"trades",
+	"trade_images",
+	"image_annotations",
+	"tag_groups",
+	"tags",
+	"trade_tags",
+	"tag_merges",
+	"shares",
+	"share_users",
+	"trade_revisions",
+	"trade_executions",
+	"custom_fields",
+	"trade_custom_values",
+	"instruments",
+	"symbol_aliases",
+	"fx_rates",
+	"price_bars",
+	"mistakes",
+	"trade_mistakes",
+	"image_sizes",
+}
+
+// CopyDatabase 將 src 的所有資料複製到 dst
+// dst 必須已完成遷移且沒有任何使用者資料，整個複製在單一交易中完成
+func CopyDatabase(src, dst *sql.DB) (map[string]int, error) {
+	var userCount int
+	if err := dst.QueryRow("SELECT COUNT(*) FROM users").Scan(&userCount); err != nil {
+		return nil, fmt.Errorf("檢查目標資料庫失敗: %w", err)
+	}
+	if userCount > 0 {
+		return nil, fmt.Errorf("目標資料庫已有 %d 位使用者，請使用空的資料庫", userCount)
+	}
+
+	tx, err := dst.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	counts := make(map[string]int)
+	for _, table := range CopyTables {
+		n, err := copyTable(src, tx, table)
+		if err != nil {
+			return nil, fmt.Errorf("複製 %s 失敗: %w", table, err)
+		}
+		counts[table] = n
+		log.Printf("[Copy] %s: %d 筆", table, n)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	if current == DialectPostgres {
+		if err := resetSequences(dst); err != nil {
+			return counts, err
+		}
+	}
+	return counts, nil
+}
+
+// copyTable 只複製來源與目標共有的欄位
+func copyTable(src *sql.DB, dst *sql.Tx, table string) (int, error) {
+	srcCols, err := TableColumns(src, table)
+	if err != nil {
+		return 0, err
+	}
+	dstCols, err := TableColumns(dst, table)
+	if err != nil {
+		return 0, err
+	}
+
+	dstSet := make(map[string]bool, len(dstCols))
+	for _, c := range dstCols {
+		dstSet[c] = true
+	}
+	var cols []string
+	for _, c := range srcCols {
+		if dstSet[c] {
+			cols = append(cols, c)
+		}
+	}
+	if len(cols) == 0 {
+		return 0, nil
+	}
+
+	rows, err := src.Query(fmt.Sprintf("SELECT %s FROM %s", strings.Join(cols, ", "), table))
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(cols)), ", ")
+	insertSQL := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", table, strings.Join(cols, ", "), placeholders)
+
+	count := 0
+	for rows.Next() {
+		values := make([]interface{}, len(cols))
+		ptrs := make([]interface{}, len(cols))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return count, err
+		}
+		if _, err := dst.Exec(insertSQL, values...); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, rows.Err()
+}
+
+// TableColumns 以空查詢取得欄位名稱，不依賴特定方言的系統表
+func TableColumns(q Querier, table string) ([]string, error) {
+	rows, err := q.Query(fmt.Sprintf("SELECT * FROM %s LIMIT 0", table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return rows.Columns()
+}
+
+// resetSequences 複製保留了原本的 id，需把序列推進到最大值之後
+func resetSequences(db *sql.DB) error {
+	for _, table := range CopyTables {
+		var seq sql.NullString
+		if err := db.QueryRow("SELECT pg_get_serial_sequence(?, 'id')", table).Scan(&seq); err != nil || !seq.Valid {
+			continue
+		}
+		_, err := db.Exec(fmt.Sprintf("SELECT setval('%s', COALESCE((SELECT MAX(id) FROM %s), 0) + 1, false)", seq.String, table))
+		if err != nil {
+			return fmt.Errorf("重設 %s 序列失敗: %w", table, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// Dialect 資料庫方言
+type Dialect string
+
+const (
+	DialectSQLite   Dialect = "sqlite"
+	DialectPostgres Dialect = "postgres"
+)
+
+// current 目前使用中的方言，由 InitDB 依 DB_DRIVER 設定
+var current = DialectSQLite
+
+// CurrentDialect 取得目前使用中的資料庫方言
+func CurrentDialect() Dialect {
+	return current
+}
+
+// Querier *sql.DB 與 *sql.Tx 共有的查詢介面
+type Querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// InsertID 執行 INSERT 並取得新資料的 id
+// PostgreSQL 不支援 LastInsertId，改以 RETURNING id 取得
+func InsertID(q Querier, query string, args ...interface{}) (int64, error) {
+	if current == DialectPostgres {
+		var id int64
+		err := q.QueryRow(strings.TrimRight(strings.TrimSpace(query), ";")+" RETURNING id", args...).Scan(&id)
+		return id, err
+	}
+
+	result, err := q.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// DateOf 取出時間欄位的日期部分，用於比較
+func DateOf(expr string) string {
+	if current == DialectPostgres {
+		return "CAST(" + expr + " AS DATE)"
+	}
+	return "date(" + expr + ")"
+}
+
+// DateString 將時間欄位格式化為 YYYY-MM-DD 字串
+func DateString(expr string) string {
+	if current == DialectPostgres {
+		return "TO_CHAR(" + expr + ", 'YYYY-MM-DD')"
+	}
+	return "DATE(" + expr + ")"
+}
+
+// IsUniqueViolation 判斷錯誤是否為唯一索引衝突
+func IsUniqueViolation(err error) bool {
+	if err == nil {
+		return false
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "23505"
+	}
+	return strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
+
+// Rebind 將 ? 佔位符轉為 PostgreSQL 的 $1, $2 ...，字串常值中的 ? 不會被替換
+func Rebind(query string) string {
+	if !strings.Contains(query, "?") {
+		return query
+	}
+
+	var b strings.Builder
+	b.Grow(len(query) + 16)
+	n := 0
+	inString := false
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		switch {
+		case ch == '\'':
+			inString = !inString
+			b.WriteByte(ch)
+		case ch == '?' && !inString:
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+		default:
+			b.WriteByte(ch)
+		}
+	}
+	return b.String()
+}
+
+var ddlReplacements = []struct {
+	pattern *regexp.Regexp
+	replace string
+}{
+	{regexp.MustCompile(`\bINTEGER PRIMARY KEY AUTOINCREMENT\b`), "BIGSERIAL PRIMARY KEY"},
+	{regexp.MustCompile(`\bINTEGER\b`), "BIGINT"},
+	{regexp.MustCompile(`\bDATETIME\b`), "TIMESTAMPTZ"},
+	{regexp.MustCompile(`\bREAL\b`), "DOUBLE PRECISION"},
+	{regexp.MustCompile(`\bBLOB\b`), "BYTEA"},
+}
+
+// translateDDL 將以 SQLite 撰寫的 DDL 轉為目前方言
+// 型別關鍵字需為大寫，欄位名稱一律小寫，避免誤換
+func translateDDL(ddl string) string {
+	if current != DialectPostgres {
+		return ddl
+	}
+	for _, r := range ddlReplacements {
+		ddl = r.pattern.ReplaceAllString(ddl, r.replace)
+	}
+	return ddl
+}
+
+// execDDL 以目前方言執行 DDL
+func execDDL(q Querier, ddl string) error {
+	_, err := q.Exec(translateDDL(ddl))
+	return err
+}
@@ -0,0 +1,29 @@
+package database
+
+import "testing"
+
+func TestRebind(t *testing.T) {
+	cases := map[string]string{
+		"SELECT 1":                                 "SELECT 1",
+		"SELECT * FROM t WHERE a = ? AND b = ?":    "SELECT * FROM t WHERE a = $1 AND b = $2",
+		"SELECT '?' FROM t WHERE a = ?":            "SELECT '?' FROM t WHERE a = $1",
+		"UPDATE t SET a = 'it''s?' WHERE id = ?":   "UPDATE t SET a = 'it''s?' WHERE id = $1",
+		"INSERT INTO t (a, b, c) VALUES (?, ?, ?)": "INSERT INTO t (a, b, c) VALUES ($1, $2, $3)",
+	}
+	for in, want := range cases {
+		if got := Rebind(in); got != want {
+			t.Errorf("Rebind(%q) = %q, 期望 %q", in, got, want)
+		}
+	}
+}
+
+func TestTranslateDDL(t *testing.T) {
+	current = DialectPostgres
+	defer func() { current = DialectSQLite }()
+
+	in := "id INTEGER PRIMARY KEY AUTOINCREMENT, account_id INTEGER NOT NULL, pnl REAL, entry_time DATETIME, timezone_offset INTEGER DEFAULT 8"
+	want := "id BIGSERIAL PRIMARY KEY, account_id BIGINT NOT NULL, pnl DOUBLE PRECISION, entry_time TIMESTAMPTZ, timezone_offset BIGINT DEFAULT 8"
+	if got := translateDDL(in); got != want {
+		t.Errorf("translateDDL = %q, 期望 %q", got, want)
+	}
+}
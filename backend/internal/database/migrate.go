@@ -0,0 +1,224 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Migration 單一版本的結構變更，Up 會在交易中執行
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *sql.Tx) error
+}
+
+// MigrationStatus 遷移狀態報告
+type MigrationStatus struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	Applied   bool       `json:"applied"`
+	Dirty     bool       `json:"dirty"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+}
+
+const createMigrationsTable = `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name VARCHAR(100) NOT NULL,
+		dirty BOOLEAN NOT NULL DEFAULT FALSE,
+		applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+`
+
+type appliedMigration struct {
+	name      string
+	dirty     bool
+	appliedAt *time.Time
+}
+
+// Migrate 依序執行尚未套用的遷移
+func Migrate(db *sql.DB) error {
+	if err := execDDL(db, createMigrationsTable); err != nil {
+		return fmt.Errorf("建立 schema_migrations 失敗: %w", err)
+	}
+
+	// 有未完成的遷移時不可再往下執行，避免在半套用的資料庫上疊加變更
+	if err := CheckMigrations(db, false); err != nil {
+		return err
+	}
+
+	applied, err := loadAppliedMigrations(db)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		if err := applyMigration(db, m); err != nil {
+			return err
+		}
+		log.Printf("[DB] 已套用遷移 %03d_%s", m.Version, m.Name)
+	}
+	return nil
+}
+
+// applyMigration 先標記 dirty，再於交易中執行 Up 並清除標記
+// 若程序在交易途中中斷，dirty 紀錄會保留下來讓下次啟動時拒絕服務
+func applyMigration(db *sql.DB, m Migration) error {
+	if _, err := db.Exec("INSERT INTO schema_migrations (version, name, dirty) VALUES (?, ?, TRUE)", m.Version, m.Name); err != nil {
+		return fmt.Errorf("遷移 %03d_%s 標記失敗: %w", m.Version, m.Name, err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := m.Up(tx); err != nil {
+		tx.Rollback()
+		// 交易已回滾，資料庫仍維持遷移前的狀態，移除標記以便修正後重試
+		db.Exec("DELETE FROM schema_migrations WHERE version = ? AND dirty = TRUE", m.Version)
+		return fmt.Errorf("遷移 %03d_%s 失敗: %w", m.Version, m.Name, err)
+	}
+
+	if _, err := tx.Exec("UPDATE schema_migrations SET dirty = FALSE, applied_at = CURRENT_TIMESTAMP WHERE version = ?", m.Version); err != nil {
+		return fmt.Errorf("遷移 %03d_%s 紀錄失敗: %w", m.Version, m.Name, err)
+	}
+
+	return tx.Commit()
+}
+
+// CheckMigrations 檢查資料庫是否處於可服務的狀態
+// requireComplete 為 true 時，所有已知的遷移都必須已套用
+func CheckMigrations(db *sql.DB, requireComplete bool) error {
+	applied, err := loadAppliedMigrations(db)
+	if err != nil {
+		return err
+	}
+
+	known := make(map[int]Migration, len(migrations))
+	for _, m := range migrations {
+		known[m.Version] = m
+	}
+
+	for version, a := range applied {
+		if a.dirty {
+			return fmt.Errorf("遷移 %03d_%s 未完成 (dirty)，請確認資料庫狀態後再移除 schema_migrations 中的該筆紀錄", version, a.name)
+		}
+		m, ok := known[version]
+		if !ok {
+			return fmt.Errorf("資料庫包含未知的遷移版本 %d (%s)，可能由較新版本的程式建立", version, a.name)
+		}
+		if m.Name != a.name {
+			return fmt.Errorf("遷移版本 %d 名稱不符: 資料庫為 %s，程式為 %s", version, a.name, m.Name)
+		}
+	}
+
+	if requireComplete {
+		for _, m := range migrations {
+			if _, ok := applied[m.Version]; !ok {
+				return fmt.Errorf("遷移 %03d_%s 尚未套用", m.Version, m.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// GetMigrationStatus 列出所有已知遷移與套用狀態
+func GetMigrationStatus(db *sql.DB) ([]MigrationStatus, error) {
+	applied, err := loadAppliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	status := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		s := MigrationStatus{Version: m.Version, Name: m.Name}
+		if a, ok := applied[m.Version]; ok {
+			s.Applied = !a.dirty
+			s.Dirty = a.dirty
+			s.AppliedAt = a.appliedAt
+		}
+		status = append(status, s)
+	}
+	return status, nil
+}
+
+// LatestVersion 程式已知的最新遷移版本
+func LatestVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+func loadAppliedMigrations(db *sql.DB) (map[int]appliedMigration, error) {
+	rows, err := db.Query("SELECT version, name, dirty, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("讀取 schema_migrations 失敗: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]appliedMigration)
+	for rows.Next() {
+		var version int
+		var a appliedMigration
+		var appliedAt sql.NullTime
+		if err := rows.Scan(&version, &a.name, &a.dirty, &appliedAt); err != nil {
+			return nil, fmt.Errorf("讀取 schema_migrations 失敗: %w", err)
+		}
+		if appliedAt.Valid {
+			a.appliedAt = &appliedAt.Time
+		}
+		applied[version] = a
+	}
+	return applied, rows.Err()
+}
+
+// columnExists 檢查資料表是否已有指定欄位
+func columnExists(tx *sql.Tx, table, column string) (bool, error) {
+	if current == DialectPostgres {
+		var exists bool
+		err := tx.QueryRow(`
+			SELECT EXISTS(SELECT 1 FROM information_schema.columns
+			WHERE table_schema = current_schema() AND table_name = ? AND column_name = ?)
+		`, table, column).Scan(&exists)
+		return exists, err
+	}
+
+	rows, err := tx.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
+
+// addColumn 欄位不存在時才新增；與舊版不同，ALTER TABLE 的錯誤會直接回傳
+func addColumn(tx *sql.Tx, table, column, definition string) error {
+	exists, err := columnExists(tx, table, column)
+	if err != nil {
+		return fmt.Errorf("檢查 %s.%s 失敗: %w", table, column, err)
+	}
+	if exists {
+		return nil
+	}
+	if err := execDDL(tx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)); err != nil {
+		return fmt.Errorf("新增 %s.%s 失敗: %w", table, column, err)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package database
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("開啟資料庫失敗: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestMigrateFreshDatabase(t *testing.T) {
+	db := openTestDB(t)
+
+	if err := Migrate(db); err != nil {
+		t.Fatalf("遷移失敗: %v", err)
+	}
+	// 重複執行應為 no-op
+	if err := Migrate(db); err != nil {
+		t.Fatalf("重複遷移失敗: %v", err)
+	}
+	if err := CheckMigrations(db, true); err != nil {
+		t.Fatalf("遷移檢查失敗: %v", err)
+	}
+
+	status, err := GetMigrationStatus(db)
+	if err != nil {
+		t.Fatalf("取得遷移狀態失敗: %v", err)
+	}
+	for _, s := range status {
+		if !s.Applied || s.Dirty {
+			t.Errorf("遷移 %d_%s 狀態不正確: %+v", s.Version, s.Name, s)
+		}
+	}
+}
+
+func TestMigrateLegacyDatabase(t *testing.T) {
+	db := openTestDB(t)
+
+	// 模擬缺少後期欄位的舊資料庫
+	_, err := db.Exec(`
+		CREATE TABLE trades (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			symbol VARCHAR(20) NOT NULL,
+			side VARCHAR(10) NOT NULL,
+			entry_time DATETIME NOT NULL
+		);
+		CREATE TABLE daily_plans (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			plan_date DATETIME NOT NULL
+		);
+	`)
+	if err != nil {
+		t.Fatalf("建立舊資料表失敗: %v", err)
+	}
+
+	if err := Migrate(db); err != nil {
+		t.Fatalf("遷移失敗: %v", err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	for _, col := range []string{"account_id", "color_tag", "sl_history", "entry_strategy", "strategy_id"} {
+		exists, err := columnExists(tx, "trades", col)
+		if err != nil || !exists {
+			t.Errorf("trades.%s 應該存在 (err=%v)", col, err)
+		}
+	}
+}
+
+func TestCheckMigrationsRejectsDirtyDatabase(t *testing.T) {
+	db := openTestDB(t)
+	if err := Migrate(db); err != nil {
+		t.Fatalf("遷移失敗: %v", err)
+	}
+
+	db.Exec("UPDATE schema_migrations SET dirty = TRUE WHERE version = ?", migrations[len(migrations)-1].Version)
+	if err := CheckMigrations(db, true); err == nil {
+		t.Fatal("dirty 的資料庫應該被拒絕")
+	}
+	if err := Migrate(db); err == nil {
+		t.Fatal("dirty 的資料庫不應繼續遷移")
+	}
+}
+
+func TestCheckMigrationsRejectsUnknownVersion(t *testing.T) {
+	db := openTestDB(t)
+	if err := Migrate(db); err != nil {
+		t.Fatalf("遷移失敗: %v", err)
+	}
+
+	db.Exec("INSERT INTO schema_migrations (version, name) VALUES (9999, 'from_the_future')")
+	if err := CheckMigrations(db, true); err == nil {
+		t.Fatal("包含未知版本的資料庫應該被拒絕")
+	}
+}
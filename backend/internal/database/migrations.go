@@ -0,0 +1,843 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+// migrations 依版本排序的遷移清單，新增遷移時只能附加在最後
+var migrations = []Migration{
+	{Version: 1, Name: "initial_schema", Up: migrateInitialSchema},
+	{Version: 2, Name: "legacy_columns", Up: migrateLegacyColumns},
+	{Version: 3, Name: "indexes", Up: migrateIndexes},
+	{Version: 4, Name: "trades_sl_history", Up: migrateTradesSLHistory},
+	{Version: 5, Name: "soft_delete", Up: migrateSoftDelete},
+	{Version: 6, Name: "trade_revisions", Up: migrateTradeRevisions},
+	{Version: 7, Name: "search_index", Up: migrateSearchIndex},
+	{Version: 8, Name: "trade_executions", Up: migrateTradeExecutions},
+	{Version: 9, Name: "strategies", Up: migrateStrategies},
+	{Version: 10, Name: "custom_fields", Up: migrateCustomFields},
+	{Version: 11, Name: "instruments", Up: migrateInstruments},
+	{Version: 12, Name: "symbol_aliases", Up: migrateSymbolAliases},
+	{Version: 13, Name: "trade_costs", Up: migrateTradeCosts},
+	{Version: 14, Name: "currencies", Up: migrateCurrencies},
+	{Version: 15, Name: "trade_targets", Up: migrateTradeTargets},
+	{Version: 16, Name: "price_bars", Up: migratePriceBars},
+	{Version: 17, Name: "trade_excursions", Up: migrateTradeExcursions},
+	{Version: 18, Name: "trade_plan_links", Up: migrateTradePlanLinks},
+	{Version: 19, Name: "trade_reviews", Up: migrateTradeReviews},
+	{Version: 20, Name: "tag_groups", Up: migrateTagGroups},
+	{Version: 21, Name: "trade_image_gallery", Up: migrateTradeImageGallery},
+	{Version: 22, Name: "image_annotations", Up: migrateImageAnnotations},
+	{Version: 23, Name: "image_sizes", Up: migrateImageSizes},
+	{Version: 24, Name: "tag_merges", Up: migrateTagMerges},
+}
+
+// migrateInitialSchema 建立基礎資料表（舊資料庫已存在的表會被略過）
+func migrateInitialSchema(tx *sql.Tx) error {
+	return execDDL(tx, `
+	CREATE TABLE IF NOT EXISTS users (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		username VARCHAR(50) UNIQUE NOT NULL,
+		password TEXT NOT NULL,
+		is_admin BOOLEAN DEFAULT FALSE,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS accounts (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL DEFAULT 1,
+		name VARCHAR(100) NOT NULL,
+		type VARCHAR(20) DEFAULT 'local', -- 'local' or 'metatrader'
+		mt5_account_id VARCHAR(100),    -- MetaApi Account ID
+		mt5_token TEXT,                 -- MetaApi Token
+		ctrader_account_id VARCHAR(100), -- cTrader Account ID
+		ctrader_token TEXT,             -- cTrader Token
+		ctrader_client_id VARCHAR(100), -- cTrader Client ID
+		ctrader_client_secret TEXT,     -- cTrader Client Secret
+		ctrader_env VARCHAR(20) DEFAULT 'live', -- 'live' or 'demo'
+		status VARCHAR(20) DEFAULT 'active',
+		storage_usage INTEGER DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE IF NOT EXISTS trades (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		account_id INTEGER NOT NULL DEFAULT 1,
+		symbol VARCHAR(20) NOT NULL,
+		side VARCHAR(10) NOT NULL,
+		entry_price REAL,
+		exit_price REAL,
+		lot_size REAL,
+		pnl REAL,
+		pnl_points REAL,
+		notes TEXT,
+		entry_reason TEXT,
+		exit_reason TEXT,
+		initial_sl REAL,
+		exit_sl REAL,
+		legend_king_htf VARCHAR(20),
+		legend_king_image TEXT,
+		legend_king_image_original TEXT,
+		legend_htf VARCHAR(20),
+		legend_htf_image TEXT,
+		legend_htf_image_original TEXT,
+		legend_de_htf VARCHAR(20),
+		entry_time DATETIME NOT NULL,
+		exit_time DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (account_id) REFERENCES accounts(id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE IF NOT EXISTS trade_images (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		trade_id INTEGER NOT NULL,
+		image_type VARCHAR(20) NOT NULL,
+		image_path VARCHAR(500) NOT NULL,
+		image_order INTEGER DEFAULT 0,
+		description TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (trade_id) REFERENCES trades(id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE IF NOT EXISTS tags (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL DEFAULT 1,
+		name VARCHAR(50) NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+		UNIQUE(user_id, name)
+	);
+
+	CREATE TABLE IF NOT EXISTS trade_tags (
+		trade_id INTEGER NOT NULL,
+		tag_id INTEGER NOT NULL,
+		PRIMARY KEY (trade_id, tag_id),
+		FOREIGN KEY (trade_id) REFERENCES trades(id) ON DELETE CASCADE,
+		FOREIGN KEY (tag_id) REFERENCES tags(id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE IF NOT EXISTS daily_plans (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		account_id INTEGER NOT NULL DEFAULT 1,
+		plan_date DATETIME NOT NULL,
+		symbol VARCHAR(20) DEFAULT 'XAUUSD',
+		market_session VARCHAR(20),
+		notes TEXT,
+		trend_analysis TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (account_id) REFERENCES accounts(id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE IF NOT EXISTS shares (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		resource_type VARCHAR(20) NOT NULL, -- 'trade', 'plan'
+		resource_id INTEGER NOT NULL,
+		share_type VARCHAR(20) NOT NULL,    -- 'public' (link), 'specific' (users)
+		token VARCHAR(100) UNIQUE,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		expires_at DATETIME,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE IF NOT EXISTS share_users (
+		share_id INTEGER NOT NULL,
+		shared_with_user_id INTEGER NOT NULL,
+		PRIMARY KEY (share_id, shared_with_user_id),
+		FOREIGN KEY (share_id) REFERENCES shares(id) ON DELETE CASCADE,
+		FOREIGN KEY (shared_with_user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	`)
+}
+
+// legacyColumns 過去以 ALTER TABLE 逐步加入、且錯誤被忽略的欄位
+var legacyColumns = []struct {
+	table      string
+	column     string
+	definition string
+}{
+	{"accounts", "user_id", "INTEGER NOT NULL DEFAULT 1"},
+	{"accounts", "sync_status", "VARCHAR(20) DEFAULT 'idle'"},
+	{"accounts", "last_synced_at", "DATETIME"},
+	{"accounts", "last_sync_error", "TEXT"},
+	{"accounts", "timezone_offset", "INTEGER DEFAULT 8"},
+	{"accounts", "storage_usage", "INTEGER DEFAULT 0"},
+	{"accounts", "ctrader_account_id", "VARCHAR(100)"},
+	{"accounts", "ctrader_token", "TEXT"},
+	{"accounts", "ctrader_client_id", "VARCHAR(100)"},
+	{"accounts", "ctrader_client_secret", "TEXT"},
+	{"accounts", "ctrader_env", "VARCHAR(20) DEFAULT 'live'"},
+
+	{"tags", "user_id", "INTEGER NOT NULL DEFAULT 1"},
+
+	{"trades", "account_id", "INTEGER NOT NULL DEFAULT 1"},
+	{"trades", "entry_reason", "TEXT"},
+	{"trades", "exit_reason", "TEXT"},
+	{"trades", "trade_type", "VARCHAR(20) DEFAULT 'actual'"}, // actual=實際交易, observation=純觀察
+	{"trades", "entry_strategy", "VARCHAR(20)"},              // expert=達人, elite=菁英, legend=傳奇
+	{"trades", "entry_signals", "TEXT"},                      // 達人訊號，JSON格式
+	{"trades", "entry_checklist", "TEXT"},                    // 菁英/傳奇檢查清單，JSON格式
+	{"trades", "market_session", "VARCHAR(20)"},              // 亞盤/歐盤/美盤
+	{"trades", "timezone_offset", "INTEGER DEFAULT 8"},
+	{"trades", "trend_analysis", "TEXT"}, // 各時間週期趨勢，JSON格式
+	{"trades", "entry_strategy_image", "TEXT"},
+	{"trades", "entry_strategy_image_original", "TEXT"},
+	{"trades", "entry_timeframe", "VARCHAR(10)"},
+	{"trades", "trend_type", "VARCHAR(20)"},    // 順勢/逆勢
+	{"trades", "entry_pattern", "VARCHAR(20)"}, // 進場樣態，僅菁英使用
+	{"trades", "initial_sl", "REAL"},
+	{"trades", "bullet_size", "REAL"},
+	{"trades", "rr_ratio", "REAL"},
+	{"trades", "ticket", "VARCHAR(50)"},
+	{"trades", "exit_sl", "REAL"},
+	{"trades", "legend_king_htf", "VARCHAR(20)"},
+	{"trades", "legend_king_image", "TEXT"},
+	{"trades", "legend_king_image_original", "TEXT"},
+	{"trades", "legend_htf", "VARCHAR(20)"},
+	{"trades", "legend_htf_image", "TEXT"},
+	{"trades", "legend_htf_image_original", "TEXT"},
+	{"trades", "legend_de_htf", "VARCHAR(20)"},
+	{"trades", "color_tag", "VARCHAR(20)"}, // red, yellow, green
+
+	{"daily_plans", "account_id", "INTEGER NOT NULL DEFAULT 1"},
+	{"daily_plans", "symbol", "VARCHAR(20) DEFAULT 'XAUUSD'"},
+}
+
+// migrateLegacyColumns 補齊舊資料庫缺少的欄位，新資料庫則會全部加上
+func migrateLegacyColumns(tx *sql.Tx) error {
+	for _, c := range legacyColumns {
+		if err := addColumn(tx, c.table, c.column, c.definition); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateIndexes 建立索引，需在欄位補齊之後執行
+func migrateIndexes(tx *sql.Tx) error {
+	return execDDL(tx, `
+	CREATE INDEX IF NOT EXISTS idx_trades_symbol ON trades(symbol);
+	CREATE INDEX IF NOT EXISTS idx_trades_entry_time ON trades(entry_time);
+	CREATE INDEX IF NOT EXISTS idx_trade_images_trade_id ON trade_images(trade_id);
+	CREATE INDEX IF NOT EXISTS idx_trade_tags_trade_id ON trade_tags(trade_id);
+	CREATE INDEX IF NOT EXISTS idx_users_username ON users(username);
+
+	-- 確保同品種同一天只能有一組規劃
+	DROP INDEX IF EXISTS idx_daily_plans_date_symbol;
+	CREATE UNIQUE INDEX idx_daily_plans_date_symbol ON daily_plans(plan_date, symbol, account_id);
+	`)
+}
+
+// migrateTradesSLHistory 新增 sl_history 欄位 (所有曾經設定過的 SL，JSON array)
+// GetTrades 與 cTrader 同步都會使用此欄位，但過去從未有遷移建立它
+func migrateTradesSLHistory(tx *sql.Tx) error {
+	return addColumn(tx, "trades", "sl_history", "TEXT")
+}
+
+// migrateSoftDelete 交易、規劃與帳號改為軟刪除，刪除的資料進入垃圾桶
+// delete_batch 記錄同一次操作刪除的資料，讓「清除帳號資料」可以整批還原
+func migrateSoftDelete(tx *sql.Tx) error {
+	for _, table := range []string{"trades", "daily_plans", "accounts"} {
+		if err := addColumn(tx, table, "deleted_at", "DATETIME"); err != nil {
+			return err
+		}
+		if err := addColumn(tx, table, "delete_batch", "VARCHAR(36)"); err != nil {
+			return err
+		}
+	}
+
+	return execDDL(tx, `
+	CREATE INDEX IF NOT EXISTS idx_trades_deleted_at ON trades(deleted_at);
+	CREATE INDEX IF NOT EXISTS idx_daily_plans_deleted_at ON daily_plans(deleted_at);
+	CREATE INDEX IF NOT EXISTS idx_accounts_deleted_at ON accounts(deleted_at);
+
+	-- 已刪除的規劃不應阻擋同一天重新建立
+	DROP INDEX IF EXISTS idx_daily_plans_date_symbol;
+	CREATE UNIQUE INDEX idx_daily_plans_date_symbol ON daily_plans(plan_date, symbol, account_id) WHERE deleted_at IS NULL;
+	`)
+}
+
+// migrateTradeRevisions 交易的欄位異動紀錄，user_id 為空表示由同步程式寫入
+func migrateTradeRevisions(tx *sql.Tx) error {
+	return execDDL(tx, `
+	CREATE TABLE IF NOT EXISTS trade_revisions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		trade_id INTEGER NOT NULL,
+		user_id INTEGER,
+		action VARCHAR(20) NOT NULL, -- create, update, delete, restore, revert
+		source VARCHAR(20) NOT NULL, -- api, csv, mt5, ctrader
+		changes TEXT NOT NULL,       -- {"欄位": {"old": ..., "new": ...}}
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (trade_id) REFERENCES trades(id) ON DELETE CASCADE,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_trade_revisions_trade_id ON trade_revisions(trade_id);
+	`)
+}
+
+// TradeSearchDocument / PlanSearchDocument PostgreSQL 全文檢索的文件內容
+// 查詢時需使用完全相同的運算式才會用到索引
+const (
+	TradeSearchDocument = "to_tsvector('simple', COALESCE(notes, '') || ' ' || COALESCE(entry_reason, '') || ' ' || COALESCE(exit_reason, ''))"
+	PlanSearchDocument  = "to_tsvector('simple', COALESCE(notes, '') || ' ' || COALESCE(trend_analysis, ''))"
+)
+
+// migrateSearchIndex 建立交易心得與每日規劃的全文檢索索引
+// SQLite 使用 FTS5 (trigram 分詞，中文也能以子字串搜尋)，由觸發器與原表保持同步，
+// 因此 API、匯入、同步與還原等所有寫入路徑都不需另外處理
+func migrateSearchIndex(tx *sql.Tx) error {
+	// 極舊的資料庫可能缺少這些文字欄位
+	for _, c := range [][2]string{{"trades", "notes"}, {"daily_plans", "notes"}, {"daily_plans", "trend_analysis"}} {
+		if err := addColumn(tx, c[0], c[1], "TEXT"); err != nil {
+			return err
+		}
+	}
+
+	if current == DialectPostgres {
+		return execDDL(tx, `
+		CREATE INDEX IF NOT EXISTS idx_trades_search ON trades USING GIN (`+TradeSearchDocument+`);
+		CREATE INDEX IF NOT EXISTS idx_daily_plans_search ON daily_plans USING GIN (`+PlanSearchDocument+`);
+		`)
+	}
+
+	return execDDL(tx, `
+	CREATE VIRTUAL TABLE IF NOT EXISTS trades_fts USING fts5(
+		notes, entry_reason, exit_reason,
+		content='trades', content_rowid='id', tokenize='trigram'
+	);
+
+	CREATE TRIGGER IF NOT EXISTS trades_fts_insert AFTER INSERT ON trades BEGIN
+		INSERT INTO trades_fts(rowid, notes, entry_reason, exit_reason)
+		VALUES (new.id, new.notes, new.entry_reason, new.exit_reason);
+	END;
+
+	CREATE TRIGGER IF NOT EXISTS trades_fts_delete AFTER DELETE ON trades BEGIN
+		INSERT INTO trades_fts(trades_fts, rowid, notes, entry_reason, exit_reason)
+		VALUES ('delete', old.id, old.notes, old.entry_reason, old.exit_reason);
+	END;
+
+	CREATE TRIGGER IF NOT EXISTS trades_fts_update AFTER UPDATE OF notes, entry_reason, exit_reason ON trades BEGIN
+		INSERT INTO trades_fts(trades_fts, rowid, notes, entry_reason, exit_reason)
+		VALUES ('delete', old.id, old.notes, old.entry_reason, old.exit_reason);
+		INSERT INTO trades_fts(rowid, notes, entry_reason, exit_reason)
+		VALUES (new.id, new.notes, new.entry_reason, new.exit_reason);
+	END;
+
+	CREATE VIRTUAL TABLE IF NOT EXISTS daily_plans_fts USING fts5(
+		notes, trend_analysis,
+		content='daily_plans', content_rowid='id', tokenize='trigram'
+	);
+
+	CREATE TRIGGER IF NOT EXISTS daily_plans_fts_insert AFTER INSERT ON daily_plans BEGIN
+		INSERT INTO daily_plans_fts(rowid, notes, trend_analysis)
+		VALUES (new.id, new.notes, new.trend_analysis);
+	END;
+
+	CREATE TRIGGER IF NOT EXISTS daily_plans_fts_delete AFTER DELETE ON daily_plans BEGIN
+		INSERT INTO daily_plans_fts(daily_plans_fts, rowid, notes, trend_analysis)
+		VALUES ('delete', old.id, old.notes, old.trend_analysis);
+	END;
+
+	CREATE TRIGGER IF NOT EXISTS daily_plans_fts_update AFTER UPDATE OF notes, trend_analysis ON daily_plans BEGIN
+		INSERT INTO daily_plans_fts(daily_plans_fts, rowid, notes, trend_analysis)
+		VALUES ('delete', old.id, old.notes, old.trend_analysis);
+		INSERT INTO daily_plans_fts(rowid, notes, trend_analysis)
+		VALUES (new.id, new.notes, new.trend_analysis);
+	END;
+
+	-- 為既有資料建立索引
+	INSERT INTO trades_fts(trades_fts) VALUES ('rebuild');
+	INSERT INTO daily_plans_fts(daily_plans_fts) VALUES ('rebuild');
+	`)
+}
+
+// migrateTradeExecutions 交易的每一筆成交 (加倉、分批平倉)
+// 有成交紀錄的交易，其均價、手數、時間與盈虧由成交推導
+func migrateTradeExecutions(tx *sql.Tx) error {
+	return execDDL(tx, `
+	CREATE TABLE IF NOT EXISTS trade_executions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		trade_id INTEGER NOT NULL,
+		side VARCHAR(10) NOT NULL,   -- buy, sell
+		price REAL NOT NULL,
+		volume REAL NOT NULL,
+		executed_at DATETIME NOT NULL,
+		fee REAL DEFAULT 0,          -- 佣金與隔夜利息，支出為負數
+		pnl REAL,                    -- 平台回報的已實現盈虧 (不含 fee)
+		external_id VARCHAR(100),    -- 平台成交編號，用於同步去重
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (trade_id) REFERENCES trades(id) ON DELETE CASCADE
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_trade_executions_trade_id ON trade_executions(trade_id);
+	CREATE INDEX IF NOT EXISTS idx_trade_executions_external_id ON trade_executions(external_id);
+	`)
+}
+
+// migrateStrategies 使用者自訂的策略 (playbook)，取代寫死的達人/菁英/傳奇
+// 既有使用者會建立三個內建策略，並依 entry_strategy 回填交易的 strategy_id
+func migrateStrategies(tx *sql.Tx) error {
+	err := execDDL(tx, `
+	CREATE TABLE IF NOT EXISTS strategies (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		builtin_key VARCHAR(20),       -- 內建策略代碼 (expert, elite, legend)，對應 trades.entry_strategy
+		name VARCHAR(100) NOT NULL,
+		description TEXT,
+		signals TEXT NOT NULL,         -- [{"id", "label", "side"}]
+		checklist TEXT NOT NULL,       -- [{"id", "label"}]
+		patterns TEXT NOT NULL,        -- [{"id", "label"}]
+		image_slots TEXT NOT NULL,     -- [{"id", "label", "required"}]
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_strategies_user_name ON strategies(user_id, name);
+	`)
+	if err != nil {
+		return err
+	}
+	if err := addColumn(tx, "trades", "strategy_id", "INTEGER"); err != nil {
+		return err
+	}
+	// 策略的圖片欄位存在 trade_images，image_type 為 strategy
+	if err := addColumn(tx, "trade_images", "slot", "VARCHAR(50)"); err != nil {
+		return err
+	}
+	if err := execDDL(tx, `CREATE INDEX IF NOT EXISTS idx_trades_strategy_id ON trades(strategy_id);`); err != nil {
+		return err
+	}
+
+	rows, err := tx.Query("SELECT id FROM users")
+	if err != nil {
+		return err
+	}
+	var userIDs []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		userIDs = append(userIDs, id)
+	}
+	rows.Close()
+	for _, id := range userIDs {
+		if err := SeedDefaultStrategies(tx, id); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`
+		UPDATE trades SET strategy_id = (
+			SELECT s.id FROM strategies s JOIN accounts a ON s.user_id = a.user_id
+			WHERE a.id = trades.account_id AND s.builtin_key = trades.entry_strategy
+		)
+		WHERE strategy_id IS NULL AND entry_strategy IN ('expert', 'elite', 'legend')
+	`)
+	return err
+}
+
+// migrateCustomFields 使用者自訂的交易欄位與每筆交易的值
+// value 依欄位類型存成文字 (多選為 JSON 陣列)，數字另存 number_value 以便範圍篩選
+func migrateCustomFields(tx *sql.Tx) error {
+	return execDDL(tx, `
+	CREATE TABLE IF NOT EXISTS custom_fields (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		field_key VARCHAR(50) NOT NULL,   -- 交易 custom_fields 中使用的 key，建立後不可修改
+		name VARCHAR(100) NOT NULL,
+		field_type VARCHAR(20) NOT NULL,  -- text, number, select, multi_select, boolean, date
+		options TEXT NOT NULL,            -- 選項 (JSON 字串陣列)，僅 select / multi_select 使用
+		required BOOLEAN DEFAULT FALSE,
+		position INTEGER DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_custom_fields_user_key ON custom_fields(user_id, field_key);
+
+	CREATE TABLE IF NOT EXISTS trade_custom_values (
+		trade_id INTEGER NOT NULL,
+		field_id INTEGER NOT NULL,
+		value TEXT NOT NULL,
+		number_value REAL,
+		PRIMARY KEY (trade_id, field_id),
+		FOREIGN KEY (trade_id) REFERENCES trades(id) ON DELETE CASCADE,
+		FOREIGN KEY (field_id) REFERENCES custom_fields(id) ON DELETE CASCADE
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_trade_custom_values_field ON trade_custom_values(field_id, value);
+	`)
+}
+
+// migrateInstruments 使用者自訂的品種規格，沒有自訂時使用 instruments 套件的內建規格
+func migrateInstruments(tx *sql.Tx) error {
+	return execDDL(tx, `
+	CREATE TABLE IF NOT EXISTS instruments (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		symbol VARCHAR(20) NOT NULL,        -- 正規化後的品種名稱 (大寫、去除券商後綴)
+		tick_size REAL NOT NULL,
+		contract_size REAL NOT NULL,
+		quote_currency VARCHAR(10) NOT NULL,
+		pip_size REAL NOT NULL,             -- 一點的價格變動，pnl_points 與 bullet_size 以此為單位
+		point_value REAL,                   -- 每手每點的價值，NULL 表示以 pip_size × contract_size 計算
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_instruments_user_symbol ON instruments(user_id, symbol);
+	`)
+}
+
+// migrateSymbolAliases 使用者自訂的品種別名，匯入與同步時將券商品種名稱轉為標準名稱
+// trades.raw_symbol 保留券商的原始名稱，舊交易為 NULL，重新正規化時以 symbol 為原始名稱
+func migrateSymbolAliases(tx *sql.Tx) error {
+	err := execDDL(tx, `
+	CREATE TABLE IF NOT EXISTS symbol_aliases (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		alias VARCHAR(50) NOT NULL,    -- 券商的品種名稱 (大寫)
+		symbol VARCHAR(20) NOT NULL,   -- 標準品種名稱
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_symbol_aliases_user_alias ON symbol_aliases(user_id, alias);
+	`)
+	if err != nil {
+		return err
+	}
+	return addColumn(tx, "trades", "raw_symbol", "VARCHAR(50)")
+}
+
+// migrateTradeCosts 將佣金、隔夜利息與其他費用從盈虧中分開記錄，pnl 維持淨盈虧
+// 成交的 fee 改為其他費用；舊成交無法拆分，既有的 fee 歸入交易的 fees
+func migrateTradeCosts(tx *sql.Tx) error {
+	for _, col := range []string{"gross_pnl", "commission", "swap", "fees"} {
+		if err := addColumn(tx, "trades", col, "REAL"); err != nil {
+			return err
+		}
+	}
+	for _, col := range []string{"commission", "swap"} {
+		if err := addColumn(tx, "trade_executions", col, "REAL DEFAULT 0"); err != nil {
+			return err
+		}
+	}
+	_, err := tx.Exec(`
+		UPDATE trades SET
+			gross_pnl = (SELECT SUM(e.pnl) FROM trade_executions e WHERE e.trade_id = trades.id),
+			commission = 0,
+			swap = 0,
+			fees = (SELECT COALESCE(SUM(e.fee), 0) FROM trade_executions e WHERE e.trade_id = trades.id)
+		WHERE EXISTS (SELECT 1 FROM trade_executions e WHERE e.trade_id = trades.id)
+	`)
+	return err
+}
+
+// migrateCurrencies 帳號的基礎幣別、交易的盈虧幣別與使用者匯入的匯率
+// trades.pnl_currency 為 NULL 表示與帳號的基礎幣別相同
+func migrateCurrencies(tx *sql.Tx) error {
+	if err := addColumn(tx, "accounts", "currency", "VARCHAR(3) NOT NULL DEFAULT 'USD'"); err != nil {
+		return err
+	}
+	if err := addColumn(tx, "trades", "pnl_currency", "VARCHAR(3)"); err != nil {
+		return err
+	}
+	return execDDL(tx, `
+	CREATE TABLE IF NOT EXISTS fx_rates (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		base VARCHAR(3) NOT NULL,
+		quote VARCHAR(3) NOT NULL,
+		rate_date VARCHAR(10) NOT NULL,     -- YYYY-MM-DD
+		rate REAL NOT NULL,                 -- 1 單位 base 可兌換的 quote 數量
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_fx_rates_user_pair_date ON fx_rates(user_id, base, quote, rate_date);
+	`)
+}
+
+// migrateTradeTargets 新增停利相關欄位：初始停利、平倉時的停利、停利歷史 (與 sl_history 相同格式)
+// 以及進場時的計畫風報比 (初始停利距離 / 初始停損距離)
+func migrateTradeTargets(tx *sql.Tx) error {
+	for _, col := range []struct{ name, def string }{
+		{"initial_tp", "REAL"},
+		{"exit_tp", "REAL"},
+		{"tp_history", "TEXT"},
+		{"planned_rr", "REAL"},
+	} {
+		if err := addColumn(tx, "trades", col.name, col.def); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migratePriceBars 使用者匯入的 K 線資料，依品種與週期儲存
+// bar_time 為 K 線開盤時間的 Unix 秒數 (UTC)，同一品種、週期與時間只保留一根
+func migratePriceBars(tx *sql.Tx) error {
+	return execDDL(tx, `
+	CREATE TABLE IF NOT EXISTS price_bars (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		symbol VARCHAR(20) NOT NULL,        -- 標準品種名稱
+		timeframe VARCHAR(3) NOT NULL,      -- M1、M5、M15、M30、H1、H4、D1
+		bar_time INTEGER NOT NULL,
+		open REAL NOT NULL,
+		high REAL NOT NULL,
+		low REAL NOT NULL,
+		close REAL NOT NULL,
+		volume REAL NOT NULL DEFAULT 0,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_price_bars_series_time ON price_bars(user_id, symbol, timeframe, bar_time);
+	`)
+}
+
+// migrateTradeExcursions 依 K 線計算的最大不利 / 有利偏移 (MAE / MFE)
+// mae / mfe 為距離進場價的價差，mae_exceeded_sl 表示不利偏移超過初始停損距離 (停損曾被移動)
+// excursion_timeframe 為計算使用的 K 線週期，沒有涵蓋持倉期間的 K 線時所有欄位為 NULL
+func migrateTradeExcursions(tx *sql.Tx) error {
+	for _, col := range []struct{ name, def string }{
+		{"mae", "REAL"},
+		{"mfe", "REAL"},
+		{"mae_points", "REAL"},
+		{"mfe_points", "REAL"},
+		{"mae_r", "REAL"},
+		{"mfe_r", "REAL"},
+		{"mae_exceeded_sl", "BOOLEAN"},
+		{"excursion_timeframe", "VARCHAR(3)"},
+	} {
+		if err := addColumn(tx, "trades", col.name, col.def); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateTradePlanLinks 交易連結到同帳號、同品種、同日期 (帳號時區) 的每日規劃
+// plan_link_manual 表示使用者手動指定 (或取消) 連結，自動連結不會覆寫
+func migrateTradePlanLinks(tx *sql.Tx) error {
+	if err := addColumn(tx, "trades", "daily_plan_id", "INTEGER"); err != nil {
+		return err
+	}
+	if err := addColumn(tx, "trades", "plan_link_manual", "BOOLEAN DEFAULT FALSE"); err != nil {
+		return err
+	}
+	if err := execDDL(tx, `CREATE INDEX IF NOT EXISTS idx_trades_daily_plan_id ON trades(daily_plan_id);`); err != nil {
+		return err
+	}
+
+	// 回填既有交易，SQLite 中的時間無法用 date() 比較，日期在程式中比對
+	// plan_date 以 UTC 午夜記錄當地日期，進場時間依帳號的 UTC 偏移換算為當地日期
+	type planKey struct {
+		accountID    int64
+		symbol, date string
+	}
+	plans := map[planKey]int64{}
+	rows, err := tx.Query("SELECT id, account_id, symbol, plan_date FROM daily_plans WHERE deleted_at IS NULL ORDER BY id DESC")
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var id, accountID int64
+		var symbol string
+		var planDate time.Time
+		if err := rows.Scan(&id, &accountID, &symbol, &planDate); err != nil {
+			rows.Close()
+			return err
+		}
+		plans[planKey{accountID, symbol, planDate.UTC().Format("2006-01-02")}] = id
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(plans) == 0 {
+		return nil
+	}
+
+	links := map[int64]int64{}
+	rows, err = tx.Query(`
+		SELECT t.id, t.account_id, t.symbol, t.entry_time, COALESCE(a.timezone_offset, 8)
+		FROM trades t LEFT JOIN accounts a ON a.id = t.account_id
+	`)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var id, accountID int64
+		var symbol string
+		var entryTime time.Time
+		var offset int
+		if err := rows.Scan(&id, &accountID, &symbol, &entryTime, &offset); err != nil {
+			rows.Close()
+			return err
+		}
+		local := entryTime.UTC().Add(time.Duration(offset) * time.Hour)
+		if planID, ok := plans[planKey{accountID, symbol, local.Format("2006-01-02")}]; ok {
+			links[id] = planID
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for tradeID, planID := range links {
+		if _, err := tx.Exec("UPDATE trades SET daily_plan_id = ? WHERE id = ?", planID, tradeID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateTradeReviews 交易檢討：檢討狀態、品質評等、心得，以及使用者自訂的錯誤類型
+// review_status 為 unreviewed / reviewed / needs_mentor，reviewed_at 為最後一次標記為已檢討或需導師檢討的時間
+func migrateTradeReviews(tx *sql.Tx) error {
+	for _, col := range []struct{ name, def string }{
+		{"review_status", "VARCHAR(20) DEFAULT 'unreviewed'"},
+		{"quality_grade", "VARCHAR(1)"},
+		{"lessons", "TEXT"},
+		{"reviewed_at", "DATETIME"},
+	} {
+		if err := addColumn(tx, "trades", col.name, col.def); err != nil {
+			return err
+		}
+	}
+	return execDDL(tx, `
+	CREATE INDEX IF NOT EXISTS idx_trades_review_status ON trades(review_status);
+
+	CREATE TABLE IF NOT EXISTS mistakes (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		name VARCHAR(100) NOT NULL,
+		description TEXT,
+		position INTEGER DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_mistakes_user_name ON mistakes(user_id, name);
+
+	CREATE TABLE IF NOT EXISTS trade_mistakes (
+		trade_id INTEGER NOT NULL,
+		mistake_id INTEGER NOT NULL,
+		PRIMARY KEY (trade_id, mistake_id),
+		FOREIGN KEY (trade_id) REFERENCES trades(id) ON DELETE CASCADE,
+		FOREIGN KEY (mistake_id) REFERENCES mistakes(id) ON DELETE CASCADE
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_trade_mistakes_mistake ON trade_mistakes(mistake_id);
+	`)
+}
+
+// migrateTagGroups 標籤顏色、說明與分組 (例如「型態」、「情緒」、「市場狀況」)
+func migrateTagGroups(tx *sql.Tx) error {
+	if err := execDDL(tx, `
+	CREATE TABLE IF NOT EXISTS tag_groups (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		name VARCHAR(50) NOT NULL,
+		color VARCHAR(7),
+		position INTEGER DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_tag_groups_user_name ON tag_groups(user_id, name);
+	`); err != nil {
+		return err
+	}
+	for _, col := range []struct{ name, def string }{
+		{"color", "VARCHAR(7)"},
+		{"description", "TEXT"},
+		{"group_id", "INTEGER"},
+	} {
+		if err := addColumn(tx, "tags", col.name, col.def); err != nil {
+			return err
+		}
+	}
+	return execDDL(tx, "CREATE INDEX IF NOT EXISTS idx_tags_group_id ON tags(group_id)")
+}
+
+// migrateTradeImageGallery 交易圖片的順序、說明與截圖時間 (taken_at)
+// 原本的圖片 image_order 皆為 0，依新增順序補上
+func migrateTradeImageGallery(tx *sql.Tx) error {
+	if err := addColumn(tx, "trade_images", "taken_at", "DATETIME"); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`
+		UPDATE trade_images SET image_order = (
+			SELECT COUNT(*) FROM trade_images ti WHERE ti.trade_id = trade_images.trade_id AND ti.id < trade_images.id
+		)
+	`); err != nil {
+		return err
+	}
+	return execDDL(tx, "CREATE INDEX IF NOT EXISTS idx_trade_images_trade_order ON trade_images(trade_id, image_order)")
+}
+
+// migrateImageAnnotations 圖片的向量標註圖層，shapes 以 JSON 儲存
+// user_id 為圖層作者，導師可在學生的圖片上建立自己的圖層
+func migrateImageAnnotations(tx *sql.Tx) error {
+	return execDDL(tx, `
+	CREATE TABLE IF NOT EXISTS image_annotations (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		image_id INTEGER NOT NULL,
+		user_id INTEGER NOT NULL,
+		name VARCHAR(100) NOT NULL,
+		shapes TEXT NOT NULL DEFAULT '[]',
+		visible BOOLEAN DEFAULT TRUE,
+		position INTEGER DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (image_id) REFERENCES trade_images(id) ON DELETE CASCADE,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_image_annotations_image ON image_annotations(image_id, position);
+	`)
+}
+
+// migrateImageSizes 記錄 MinIO 物件的大小，計算儲存空間使用量時不需每次查詢 MinIO
+// 物件路徑含隨機碼且不會覆寫，大小記錄後不需更新
+func migrateImageSizes(tx *sql.Tx) error {
+	return execDDL(tx, `
+	CREATE TABLE IF NOT EXISTS image_sizes (
+		object_path VARCHAR(255) PRIMARY KEY,
+		size INTEGER NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	`)
+}
+
+// migrateTagMerges 記錄合併後消失的標籤名稱對應到哪個標籤，還原舊紀錄時使用
+func migrateTagMerges(tx *sql.Tx) error {
+	return execDDL(tx, `
+	CREATE TABLE IF NOT EXISTS tag_merges (
+		user_id INTEGER NOT NULL,
+		name VARCHAR(50) NOT NULL,
+		tag_id INTEGER NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (user_id, name),
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+		FOREIGN KEY (tag_id) REFERENCES tags(id) ON DELETE CASCADE
+	);
+	`)
+}
@@ -0,0 +1,78 @@
+package database
+
+// defaultStrategy 內建策略，對應過去寫死在程式中的達人、菁英、傳奇
+// 項目 id 與交易 entry_signals / entry_checklist / entry_pattern 中儲存的值相同
+type defaultStrategy struct {
+	key       string
+	name      string
+	signals   string
+	checklist string
+	patterns  string
+}
+
+var defaultStrategies = []defaultStrategy{
+	{
+		key:  "expert",
+		name: "達人",
+		signals: `[
+			{"id": "向下蘇美", "label": "向下蘇美", "side": "long"},
+			{"id": "起漲靠山", "label": "起漲靠山", "side": "long"},
+			{"id": "雙柱", "label": "雙柱", "side": "long"},
+			{"id": "倚天", "label": "倚天", "side": "long"},
+			{"id": "攻城池上", "label": "攻城池上", "side": "long"},
+			{"id": "起跌靠山", "label": "起跌靠山", "side": "short"},
+			{"id": "君臨城下", "label": "君臨城下", "side": "short"},
+			{"id": "雙塔", "label": "雙塔", "side": "short"},
+			{"id": "向上蘇美", "label": "向上蘇美", "side": "short"},
+			{"id": "雷霆", "label": "雷霆", "side": "short"}
+		]`,
+		checklist: `[]`,
+		patterns:  `[]`,
+	},
+	{
+		key:     "elite",
+		name:    "菁英",
+		signals: `[]`,
+		checklist: `[
+			{"id": "trend_line", "label": "破趨勢線了嗎?"},
+			{"id": "price_level", "label": "破價位了嗎?"},
+			{"id": "impulse_wave", "label": "有驅動浪了嗎?"},
+			{"id": "high_low", "label": "不過高低了嗎?"},
+			{"id": "sentiment", "label": "情緒轉換了嗎?"}
+		]`,
+		patterns: `[
+			{"id": "甲", "label": "甲"},
+			{"id": "乙", "label": "乙"},
+			{"id": "丙", "label": "丙"},
+			{"id": "丁", "label": "丁"},
+			{"id": "大Leading", "label": "大Leading"},
+			{"id": "小Leading", "label": "小Leading"}
+		]`,
+	},
+	{
+		key:     "legend",
+		name:    "傳奇",
+		signals: `[]`,
+		checklist: `[
+			{"id": "item_618_786", "label": "王者出現回調618或786"},
+			{"id": "item_che", "label": "大時區破[測]破"},
+			{"id": "item_de", "label": "整理段的ABC[D][E]"}
+		]`,
+		patterns: `[]`,
+	},
+}
+
+// SeedDefaultStrategies 為使用者建立內建策略，已存在的會略過
+func SeedDefaultStrategies(q Querier, userID int64) error {
+	for _, s := range defaultStrategies {
+		_, err := q.Exec(`
+			INSERT INTO strategies (user_id, builtin_key, name, signals, checklist, patterns, image_slots)
+			SELECT ?, ?, ?, ?, ?, ?, '[]'
+			WHERE NOT EXISTS (SELECT 1 FROM strategies WHERE user_id = ? AND builtin_key = ?)
+		`, userID, s.key, s.name, s.signals, s.checklist, s.patterns, userID, s.key)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
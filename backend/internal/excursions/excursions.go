@@ -0,0 +1,195 @@
+package excursions
+
+import (
+	"database/sql"
+	"math"
+	"time"
+
+	"trade-journal/internal/bars"
+	"trade-journal/internal/database"
+	"trade-journal/internal/instruments"
+	"trade-journal/internal/models"
+)
+
+// timeframeOrder 由細到粗嘗試的 K 線週期，使用第一個完整涵蓋持倉期間的週期
+var timeframeOrder = []string{"M1", "M5", "M15", "M30", "H1", "H4", "D1"}
+
+// stopSlippage 出場在 -1R 附近 (含此比例的滑價) 時視為在原停損出場
+// 出場那根 K 線的高低點可能在出場後才出現，此時超過停損距離不代表停損被移動
+const stopSlippage = 0.1
+
+// Range 持倉期間 K 線的最高價與最低價
+type Range struct {
+	Timeframe string
+	High      float64
+	Low       float64
+}
+
+// Metrics MAE / MFE 結果，價差一律為正值，無法計算的欄位為 nil
+type Metrics struct {
+	MAE        float64
+	MFE        float64
+	MAEPoints  *float64
+	MFEPoints  *float64
+	MAER       *float64
+	MFER       *float64
+	ExceededSL *bool
+}
+
+// Compute 依持倉期間的高低點計算 MAE / MFE，點數以 pip_size 換算，R 以初始停損距離換算
+func Compute(s models.Instrument, side string, entry, exit float64, initialSL *float64, r Range) Metrics {
+	var m Metrics
+	if side == "short" {
+		m.MAE, m.MFE = r.High-entry, entry-r.Low
+	} else {
+		m.MAE, m.MFE = entry-r.Low, r.High-entry
+	}
+	m.MAE, m.MFE = math.Max(m.MAE, 0), math.Max(m.MFE, 0)
+
+	round := func(v float64) *float64 {
+		v = math.Round(v*100) / 100
+		return &v
+	}
+	if s.PipSize > 0 {
+		m.MAEPoints, m.MFEPoints = round(m.MAE/s.PipSize), round(m.MFE/s.PipSize)
+	}
+	if initialSL == nil || *initialSL <= 0 {
+		return m
+	}
+	risk := math.Abs(entry - *initialSL)
+	if risk == 0 {
+		return m
+	}
+	m.MAER, m.MFER = round(m.MAE/risk), round(m.MFE/risk)
+
+	move := exit - entry
+	if side == "short" {
+		move = -move
+	}
+	exitR := move / risk
+	stoppedAtSL := exitR <= -1 && exitR >= -1-stopSlippage
+	exceeded := m.MAE > risk && !stoppedAtSL
+	m.ExceededSL = &exceeded
+	return m
+}
+
+// load 取得持倉期間的高低點：依序嘗試各週期，K 線需涵蓋進場與出場時間
+func load(q database.Querier, userID int64, symbol string, entry, exit time.Time) (Range, bool, error) {
+	available := map[string]bool{}
+	rows, err := q.Query("SELECT DISTINCT timeframe FROM price_bars WHERE user_id = ? AND symbol = ?", userID, symbol)
+	if err != nil {
+		return Range{}, false, err
+	}
+	for rows.Next() {
+		var tf string
+		if err := rows.Scan(&tf); err != nil {
+			rows.Close()
+			return Range{}, false, err
+		}
+		available[tf] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return Range{}, false, err
+	}
+
+	for _, tf := range timeframeOrder {
+		if !available[tf] {
+			continue
+		}
+		dur := int64(bars.Timeframes[tf] / time.Second)
+		// 包含進場時間所在的 K 線
+		var high, low sql.NullFloat64
+		var first, last sql.NullInt64
+		err := q.QueryRow(`
+			SELECT MAX(high), MIN(low), MIN(bar_time), MAX(bar_time) FROM price_bars
+			WHERE user_id = ? AND symbol = ? AND timeframe = ? AND bar_time > ? AND bar_time <= ?
+		`, userID, symbol, tf, entry.Unix()-dur, exit.Unix()).Scan(&high, &low, &first, &last)
+		if err != nil {
+			return Range{}, false, err
+		}
+		if !first.Valid || first.Int64 > entry.Unix() || last.Int64+dur <= exit.Unix() {
+			continue
+		}
+		return Range{Timeframe: tf, High: high.Float64, Low: low.Float64}, true, nil
+	}
+	return Range{}, false, nil
+}
+
+// Apply 依已匯入的 K 線重新計算已平倉交易的 MAE / MFE
+// 未平倉或沒有涵蓋持倉期間的 K 線時清除所有欄位
+func Apply(q database.Querier, tradeID int64) error {
+	var userID int64
+	var symbol, side string
+	var entry float64
+	var exit, initialSL sql.NullFloat64
+	var entryTime time.Time
+	var exitTime sql.NullTime
+	err := q.QueryRow(`
+		SELECT a.user_id, t.symbol, t.side, t.entry_price, t.exit_price, t.initial_sl, t.entry_time, t.exit_time
+		FROM trades t JOIN accounts a ON t.account_id = a.id WHERE t.id = ?
+	`, tradeID).Scan(&userID, &symbol, &side, &entry, &exit, &initialSL, &entryTime, &exitTime)
+	if err != nil {
+		return err
+	}
+
+	const clear = "UPDATE trades SET mae = NULL, mfe = NULL, mae_points = NULL, mfe_points = NULL, mae_r = NULL, mfe_r = NULL, mae_exceeded_sl = NULL, excursion_timeframe = NULL WHERE id = ?"
+	if !exit.Valid || !exitTime.Valid || entry <= 0 || exitTime.Time.Before(entryTime) {
+		_, err := q.Exec(clear, tradeID)
+		return err
+	}
+	r, ok, err := load(q, userID, symbol, entryTime, exitTime.Time)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		_, err := q.Exec(clear, tradeID)
+		return err
+	}
+
+	s, err := instruments.Resolve(q, userID, symbol)
+	if err != nil {
+		return err
+	}
+	var sl *float64
+	if initialSL.Valid {
+		sl = &initialSL.Float64
+	}
+	m := Compute(s, side, entry, exit.Float64, sl, r)
+	_, err = q.Exec(`
+		UPDATE trades SET mae = ?, mfe = ?, mae_points = ?, mfe_points = ?, mae_r = ?, mfe_r = ?, mae_exceeded_sl = ?, excursion_timeframe = ?
+		WHERE id = ?
+	`, m.MAE, m.MFE, m.MAEPoints, m.MFEPoints, m.MAER, m.MFER, m.ExceededSL, r.Timeframe, tradeID)
+	return err
+}
+
+// RecalculateSymbol 匯入或刪除 K 線後，重新計算使用者該品種所有已平倉交易 (含垃圾桶)，回傳交易數
+func RecalculateSymbol(q database.Querier, userID int64, symbol string) (int, error) {
+	rows, err := q.Query(`
+		SELECT t.id FROM trades t JOIN accounts a ON t.account_id = a.id
+		WHERE a.user_id = ? AND t.symbol = ? AND t.exit_price IS NOT NULL
+	`, userID, symbol)
+	if err != nil {
+		return 0, err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, id := range ids {
+		if err := Apply(q, id); err != nil {
+			return 0, err
+		}
+	}
+	return len(ids), nil
+}
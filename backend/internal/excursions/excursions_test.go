@@ -0,0 +1,119 @@
+package excursions
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"trade-journal/internal/bars"
+	"trade-journal/internal/models"
+	"trade-journal/internal/testutil"
+)
+
+func TestCompute(t *testing.T) {
+	spec := models.Instrument{PipSize: 1}
+	sl := 95.0
+	r := Range{High: 112, Low: 93}
+
+	// 多單：最低 93 (MAE 7 = 1.4R)，最高 112 (MFE 12 = 2.4R)，以獲利出場代表停損曾被移動
+	m := Compute(spec, "long", 100, 110, &sl, r)
+	if m.MAE != 7 || m.MFE != 12 || *m.MAEPoints != 7 || *m.MAER != 1.4 || *m.MFER != 2.4 || !*m.ExceededSL {
+		t.Errorf("多單結果錯誤: %+v", m)
+	}
+	// 在原停損出場 (含滑價) 時，出場 K 線超過停損的部分不算停損被移動
+	if m := Compute(spec, "long", 100, 94.8, &sl, r); *m.ExceededSL {
+		t.Errorf("停損出場不應標記: %+v", m)
+	}
+	// 虧損超過 1R 太多代表停損被放寬
+	if m := Compute(spec, "long", 100, 93, &sl, r); !*m.ExceededSL {
+		t.Errorf("放寬停損應標記: %+v", m)
+	}
+	// 空單方向相反，價格沒有到不利方向時 MAE 為 0
+	shortSL := 120.0
+	m = Compute(spec, "short", 90, 95, &shortSL, r)
+	if m.MAE != 22 || m.MFE != 0 || *m.MAER != 0.73 {
+		t.Errorf("空單結果錯誤: %+v", m)
+	}
+	// 沒有初始停損時只有價差與點數
+	if m := Compute(spec, "long", 100, 110, nil, r); m.MAER != nil || m.ExceededSL != nil || *m.MFEPoints != 12 {
+		t.Errorf("沒有停損時不應計算 R: %+v", m)
+	}
+}
+
+func TestApply(t *testing.T) {
+	db := testutil.OpenDB(t,
+		"INSERT INTO users (id, username, password) VALUES (1, 'alice', 'x')",
+		"INSERT INTO accounts (id, user_id, name) VALUES (10, 1, 'main')",
+		"INSERT INTO trades (id, account_id, symbol, side, entry_price, exit_price, initial_sl, entry_time, exit_time) VALUES (100, 10, 'XAUUSD', 'long', 2300, 2310, 2295, '2024-05-01 08:00:30', '2024-05-01 08:03:10')",
+		"INSERT INTO trades (id, account_id, symbol, side, entry_price, exit_price, initial_sl, entry_time, exit_time) VALUES (101, 10, 'EURUSD', 'short', 1.0850, 1.0865, 1.0865, '2024-05-01 09:02:00', '2024-05-01 09:17:00')",
+		"INSERT INTO trades (id, account_id, symbol, side, entry_price, initial_sl, entry_time) VALUES (102, 10, 'XAUUSD', 'long', 2300, 2295, '2024-05-01 08:00:30')",
+		"INSERT INTO trades (id, account_id, symbol, side, entry_price, exit_price, initial_sl, entry_time, exit_time) VALUES (103, 10, 'XAUUSD', 'long', 2300, 2310, 2295, '2024-05-01 08:02:00', '2024-05-01 08:30:00')",
+	)
+
+	save := func(symbol, tf, at string, o, h, l, c float64) {
+		ts, _ := time.Parse("2006-01-02 15:04", at)
+		if _, err := bars.Save(db, 1, symbol, tf, models.PriceBar{Time: ts, Open: o, High: h, Low: l, Close: c}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	save("XAUUSD", "M1", "2024-05-01 08:00", 2300, 2301, 2299, 2300)
+	save("XAUUSD", "M1", "2024-05-01 08:01", 2300, 2302, 2293, 2295)
+	save("XAUUSD", "M1", "2024-05-01 08:02", 2295, 2308, 2295, 2307)
+	save("XAUUSD", "M1", "2024-05-01 08:03", 2307, 2312, 2306, 2310)
+	save("XAUUSD", "M1", "2024-05-01 08:04", 2310, 2340, 2310, 2330) // 出場後，不計入
+	// EURUSD 的 M1 K 線不足以涵蓋持倉期間，改用較粗的 M5
+	save("EURUSD", "M1", "2024-05-01 09:02", 1.0850, 1.0851, 1.0849, 1.0850)
+	save("EURUSD", "M5", "2024-05-01 09:00", 1.0850, 1.0855, 1.0840, 1.0852)
+	save("EURUSD", "M5", "2024-05-01 09:05", 1.0852, 1.0860, 1.0845, 1.0858)
+	save("EURUSD", "M5", "2024-05-01 09:10", 1.0858, 1.0868, 1.0850, 1.0866)
+	save("EURUSD", "M5", "2024-05-01 09:15", 1.0866, 1.0867, 1.0860, 1.0862)
+
+	for _, id := range []int64{100, 101, 102, 103} {
+		if err := Apply(db, id); err != nil {
+			t.Fatalf("計算交易 %d 失敗: %v", id, err)
+		}
+	}
+
+	type row struct {
+		mae, mfe, maePoints, maeR, mfeR sql.NullFloat64
+		exceeded                        sql.NullBool
+		tf                              sql.NullString
+	}
+	read := func(id int64) row {
+		var r row
+		err := db.QueryRow("SELECT mae, mfe, mae_points, mae_r, mfe_r, mae_exceeded_sl, excursion_timeframe FROM trades WHERE id = ?", id).
+			Scan(&r.mae, &r.mfe, &r.maePoints, &r.maeR, &r.mfeR, &r.exceeded, &r.tf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+
+	if r := read(100); r.tf.String != "M1" || r.mae.Float64 != 7 || r.mfe.Float64 != 12 || r.maeR.Float64 != 1.4 || r.mfeR.Float64 != 2.4 || !r.exceeded.Bool {
+		t.Errorf("交易 100 錯誤: %+v", r)
+	}
+	if r := read(101); r.tf.String != "M5" || r.maePoints.Float64 != 18 || r.maeR.Float64 != 1.2 || r.mfeR.Float64 != 0.67 || !r.exceeded.Valid || r.exceeded.Bool {
+		t.Errorf("交易 101 錯誤: %+v", r)
+	}
+	for _, id := range []int64{102, 103} {
+		if r := read(id); r.tf.Valid || r.mae.Valid || r.exceeded.Valid {
+			t.Errorf("交易 %d 應沒有 MAE / MFE: %+v", id, r)
+		}
+	}
+
+	// 補上 K 線後重新計算該品種的已平倉交易
+	for m := 5; m <= 30; m++ {
+		save("XAUUSD", "M1", barTime(m), 2310, 2311, 2309, 2310)
+	}
+	n, err := RecalculateSymbol(db, 1, "XAUUSD")
+	if err != nil || n != 2 {
+		t.Fatalf("重新計算應包含 2 筆已平倉交易，得到 %d %v", n, err)
+	}
+	if r := read(103); r.tf.String != "M1" || r.mfe.Float64 != 40 {
+		t.Errorf("交易 103 錯誤: %+v", r)
+	}
+}
+
+func barTime(minute int) string {
+	return time.Date(2024, 5, 1, 8, minute, 0, 0, time.UTC).Format("2006-01-02 15:04")
+}
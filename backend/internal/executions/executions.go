@@ -0,0 +1,255 @@
+package executions
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+
+	"trade-journal/internal/audit"
+	"trade-journal/internal/dailyplans"
+	"trade-journal/internal/database"
+	"trade-journal/internal/excursions"
+	"trade-journal/internal/instruments"
+	"trade-journal/internal/models"
+)
+
+// 成交方向
+const (
+	SideBuy  = "buy"
+	SideSell = "sell"
+)
+
+// Summary 由成交推導出的交易欄位
+type Summary struct {
+	EntryPrice float64
+	LotSize    float64
+	EntryTime  time.Time
+	// 以下欄位在沒有平倉成交時為 nil
+	ExitPrice *float64
+	// ExitTime 僅在全部平倉後才有值
+	ExitTime *time.Time
+	// PnL 淨盈虧，GrossPnL 未扣除費用的盈虧，兩者僅在每筆平倉成交都有平台盈虧時才有值
+	PnL      *float64
+	GrossPnL *float64
+	// 所有成交的費用合計 (含進場成交)，支出為負數
+	Commission float64
+	Swap       float64
+	Fees       float64
+}
+
+// EntrySide 交易方向對應的進場成交方向
+func EntrySide(tradeSide string) string {
+	if tradeSide == "short" {
+		return SideSell
+	}
+	return SideBuy
+}
+
+// ExitSide 交易方向對應的平倉成交方向
+func ExitSide(tradeSide string) string {
+	if tradeSide == "short" {
+		return SideBuy
+	}
+	return SideSell
+}
+
+// Summarize 以成交量加權計算均價，沒有進場成交時回傳 false
+func Summarize(tradeSide string, fills []models.ExecutionCreate) (Summary, bool) {
+	var s Summary
+	var entryValue, exitValue, exitVolume, pnl float64
+	var lastExit time.Time
+	pnlKnown := true
+
+	for _, f := range fills {
+		s.Commission += f.Commission
+		s.Swap += f.Swap
+		s.Fees += f.Fee
+		if f.Side == EntrySide(tradeSide) {
+			if s.LotSize == 0 || f.ExecutedAt.Before(s.EntryTime) {
+				s.EntryTime = f.ExecutedAt
+			}
+			entryValue += f.Price * f.Volume
+			s.LotSize += f.Volume
+			continue
+		}
+		exitValue += f.Price * f.Volume
+		exitVolume += f.Volume
+		if f.ExecutedAt.After(lastExit) {
+			lastExit = f.ExecutedAt
+		}
+		if f.PnL == nil {
+			pnlKnown = false
+		} else {
+			pnl += *f.PnL
+		}
+	}
+	if s.LotSize == 0 {
+		return s, false
+	}
+
+	s.EntryPrice = entryValue / s.LotSize
+	if exitVolume > 0 {
+		exitPrice := exitValue / exitVolume
+		s.ExitPrice = &exitPrice
+		if exitVolume >= s.LotSize-1e-9 {
+			s.ExitTime = &lastExit
+		}
+		if pnlKnown {
+			gross := math.Round(pnl*100) / 100
+			total := math.Round((pnl+s.Commission+s.Swap+s.Fees)*100) / 100
+			s.GrossPnL, s.PnL = &gross, &total
+		}
+	}
+	return s, true
+}
+
+// Load 取得交易的所有成交，依時間排序
+func Load(q database.Querier, tradeID int64) ([]models.Execution, error) {
+	rows, err := q.Query(`
+		SELECT id, trade_id, side, price, volume, executed_at, COALESCE(commission, 0), COALESCE(swap, 0), COALESCE(fee, 0), pnl, external_id, created_at
+		FROM trade_executions WHERE trade_id = ?
+		ORDER BY executed_at, id
+	`, tradeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []models.Execution
+	for rows.Next() {
+		var e models.Execution
+		if err := rows.Scan(&e.ID, &e.TradeID, &e.Side, &e.Price, &e.Volume, &e.ExecutedAt, &e.Commission, &e.Swap, &e.Fee, &e.PnL, &e.ExternalID, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, e)
+	}
+	return list, rows.Err()
+}
+
+// Insert 新增一筆成交，不會重新計算交易欄位
+func Insert(q database.Querier, tradeID int64, e models.ExecutionCreate) (int64, error) {
+	return database.InsertID(q, `
+		INSERT INTO trade_executions (trade_id, side, price, volume, executed_at, commission, swap, fee, pnl, external_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, tradeID, e.Side, e.Price, e.Volume, e.ExecutedAt, e.Commission, e.Swap, e.Fee, e.PnL, e.ExternalID)
+}
+
+// EnsureEntry 交易還沒有任何成交時，以目前的進出場價、手數與時間補上成交
+// 讓成交功能上線前建立的交易也能加倉或分批平倉
+func EnsureEntry(q database.Querier, tradeID int64) error {
+	var count int
+	if err := q.QueryRow("SELECT COUNT(*) FROM trade_executions WHERE trade_id = ?", tradeID).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	var side string
+	var price, volume, exitPrice, pnl sql.NullFloat64
+	var entryTime time.Time
+	var exitTime sql.NullTime
+	err := q.QueryRow("SELECT side, entry_price, lot_size, entry_time, exit_price, exit_time, pnl FROM trades WHERE id = ?", tradeID).
+		Scan(&side, &price, &volume, &entryTime, &exitPrice, &exitTime, &pnl)
+	if err != nil {
+		return err
+	}
+	if price.Float64 <= 0 || volume.Float64 <= 0 {
+		return fmt.Errorf("交易 %d 沒有進場價或手數，請先新增進場成交", tradeID)
+	}
+	if _, err := Insert(q, tradeID, models.ExecutionCreate{Side: EntrySide(side), Price: price.Float64, Volume: volume.Float64, ExecutedAt: entryTime}); err != nil {
+		return err
+	}
+
+	if exitPrice.Float64 > 0 && exitTime.Valid {
+		exit := models.ExecutionCreate{Side: ExitSide(side), Price: exitPrice.Float64, Volume: volume.Float64, ExecutedAt: exitTime.Time}
+		if pnl.Valid {
+			exit.PnL = &pnl.Float64
+		}
+		if _, err := Insert(q, tradeID, exit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExternalExists 檢查帳號中是否已有相同平台編號的成交
+func ExternalExists(q database.Querier, accountID int64, externalID string) (bool, error) {
+	var exists bool
+	err := q.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM trade_executions e JOIN trades t ON e.trade_id = t.id
+		WHERE t.account_id = ? AND e.external_id = ?)
+	`, accountID, externalID).Scan(&exists)
+	return exists, err
+}
+
+// Recalculate 依成交重新計算交易的均價、手數、時間、盈虧與費用，再依品種規格計算點數與風報比
+// 並依已匯入的 K 線計算 MAE / MFE；沒有成交的交易維持手動輸入的價格
+func Recalculate(q database.Querier, tradeID int64) error {
+	var side string
+	if err := q.QueryRow("SELECT side FROM trades WHERE id = ?", tradeID).Scan(&side); err != nil {
+		return err
+	}
+
+	list, err := Load(q, tradeID)
+	if err != nil {
+		return err
+	}
+	if len(list) == 0 {
+		return applyDerived(q, tradeID)
+	}
+	fills := make([]models.ExecutionCreate, len(list))
+	for i, e := range list {
+		fills[i] = models.ExecutionCreate{Side: e.Side, Price: e.Price, Volume: e.Volume, ExecutedAt: e.ExecutedAt, Commission: e.Commission, Swap: e.Swap, Fee: e.Fee, PnL: e.PnL}
+	}
+
+	s, ok := Summarize(side, fills)
+	if !ok {
+		return fmt.Errorf("交易 %d 沒有進場成交 (%s)", tradeID, EntrySide(side))
+	}
+
+	query := "UPDATE trades SET entry_price = ?, lot_size = ?, entry_time = ?, exit_price = ?, exit_time = ?, commission = ?, swap = ?, fees = ?"
+	args := []interface{}{s.EntryPrice, s.LotSize, s.EntryTime, s.ExitPrice, s.ExitTime, s.Commission, s.Swap, s.Fees}
+	if s.PnL != nil {
+		query += ", pnl = ?, gross_pnl = ?"
+		args = append(args, *s.PnL, *s.GrossPnL)
+	}
+	args = append(args, tradeID)
+	if _, err := q.Exec(query+", updated_at = CURRENT_TIMESTAMP WHERE id = ?", args...); err != nil {
+		return err
+	}
+	return applyDerived(q, tradeID)
+}
+
+// CreateTrade 在同一個交易中新增交易、寫入成交、重新計算並記錄建立的異動
+// q 應為呼叫端開啟的 *sql.Tx，任何一步失敗都應整筆回復
+func CreateTrade(q database.Querier, userID int64, source string, fills []models.ExecutionCreate, query string, args ...interface{}) (int64, error) {
+	tradeID, err := database.InsertID(q, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	for _, f := range fills {
+		if _, err := Insert(q, tradeID, f); err != nil {
+			return 0, fmt.Errorf("寫入成交失敗: %w", err)
+		}
+	}
+	if err := Recalculate(q, tradeID); err != nil {
+		return 0, fmt.Errorf("重新計算交易失敗: %w", err)
+	}
+	if err := audit.RecordCreate(q, tradeID, userID, source); err != nil {
+		return 0, fmt.Errorf("記錄異動失敗: %w", err)
+	}
+	return tradeID, nil
+}
+
+// applyDerived 計算由品種規格與 K 線推算的欄位，並依進場日期連結每日規劃
+func applyDerived(q database.Querier, tradeID int64) error {
+	if err := instruments.Apply(q, tradeID); err != nil {
+		return err
+	}
+	if err := excursions.Apply(q, tradeID); err != nil {
+		return err
+	}
+	return dailyplans.Link(q, tradeID)
+}
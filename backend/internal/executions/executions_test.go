@@ -0,0 +1,138 @@
+package executions
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"trade-journal/internal/models"
+	"trade-journal/internal/testutil"
+)
+
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	return testutil.OpenDB(t,
+		"INSERT INTO users (id, username, password) VALUES (1, 'alice', 'x')",
+		"INSERT INTO accounts (id, user_id, name) VALUES (10, 1, 'main')",
+		"INSERT INTO trades (id, account_id, symbol, side, entry_price, lot_size, initial_sl, entry_time) VALUES (100, 10, 'XAUUSD', 'long', 2300, 1, 2290, '2024-05-01 08:00:00')",
+	)
+}
+
+func at(minute int) time.Time {
+	return time.Date(2024, 5, 1, 8, minute, 0, 0, time.UTC)
+}
+
+func pnl(v float64) *float64 { return &v }
+
+func TestSummarize(t *testing.T) {
+	fills := []models.ExecutionCreate{
+		{Side: SideSell, Price: 2300, Volume: 1, ExecutedAt: at(0), Commission: -1},
+		{Side: SideSell, Price: 2310, Volume: 1, ExecutedAt: at(5)},
+		{Side: SideBuy, Price: 2290, Volume: 1, ExecutedAt: at(30), PnL: pnl(150), Commission: -1, Swap: -0.5, Fee: -0.5},
+	}
+
+	s, ok := Summarize("short", fills)
+	if !ok || s.EntryPrice != 2305 || s.LotSize != 2 || !s.EntryTime.Equal(at(0)) {
+		t.Fatalf("進場均價或手數錯誤: %+v", s)
+	}
+	if s.ExitPrice == nil || *s.ExitPrice != 2290 || s.ExitTime != nil {
+		t.Fatalf("部分平倉應有出場均價但沒有出場時間: %+v", s)
+	}
+	if s.PnL == nil || *s.PnL != 147 || s.GrossPnL == nil || *s.GrossPnL != 150 {
+		t.Fatalf("盈虧應為平台盈虧加手續費: %+v", s)
+	}
+	if s.Commission != -2 || s.Swap != -0.5 || s.Fees != -0.5 {
+		t.Fatalf("費用應分開加總 (含進場成交): %+v", s)
+	}
+
+	fills = append(fills, models.ExecutionCreate{Side: SideBuy, Price: 2280, Volume: 1, ExecutedAt: at(45)})
+	s, _ = Summarize("short", fills)
+	if *s.ExitPrice != 2285 || s.ExitTime == nil || !s.ExitTime.Equal(at(45)) {
+		t.Fatalf("全部平倉後出場時間應為最後一筆成交: %+v", s)
+	}
+	if s.PnL != nil {
+		t.Fatalf("有平倉成交沒有盈虧時不應推算盈虧: %v", *s.PnL)
+	}
+
+	if _, ok := Summarize("long", fills[:2]); ok {
+		t.Fatal("沒有做多的進場成交時應回傳 false")
+	}
+}
+
+func TestRecalculate(t *testing.T) {
+	db := openTestDB(t)
+
+	if err := EnsureEntry(db, 100); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []models.ExecutionCreate{
+		{Side: SideBuy, Price: 2320, Volume: 1, ExecutedAt: at(10)},
+		{Side: SideSell, Price: 2330, Volume: 2, ExecutedAt: at(60), PnL: pnl(400)},
+	} {
+		if _, err := Insert(db, 100, f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := Recalculate(db, 100); err != nil {
+		t.Fatal(err)
+	}
+
+	var entry, lot, exit, total, rr float64
+	var exitTime sql.NullTime
+	db.QueryRow("SELECT entry_price, lot_size, exit_price, exit_time, pnl, rr_ratio FROM trades WHERE id = 100").
+		Scan(&entry, &lot, &exit, &exitTime, &total, &rr)
+	if entry != 2310 || lot != 2 || exit != 2330 || total != 400 || !exitTime.Valid {
+		t.Fatalf("交易欄位應由成交推算, got entry=%v lot=%v exit=%v pnl=%v", entry, lot, exit, total)
+	}
+	if rr != 1 {
+		t.Fatalf("風報比應以均價計算, got %v", rr)
+	}
+
+	list, _ := Load(db, 100)
+	if len(list) != 3 {
+		t.Fatalf("應補上原本的進場成交, got %d 筆", len(list))
+	}
+}
+
+func TestCreateTradeRollsBackOnFailure(t *testing.T) {
+	db := openTestDB(t)
+	testutil.Exec(t, db, "CREATE TRIGGER fail_execution BEFORE INSERT ON trade_executions WHEN NEW.price = 999 BEGIN SELECT RAISE(ABORT, 'boom'); END")
+	query := "INSERT INTO trades (account_id, symbol, side, entry_time, ticket) VALUES (?, ?, ?, ?, ?)"
+	create := func(ticket string, fills ...models.ExecutionCreate) error {
+		tx, err := db.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tx.Rollback()
+		if _, err := CreateTrade(tx, 0, "mt5", fills, query, 10, "XAUUSD", "long", at(0), ticket); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+
+	if err := create("ok",
+		models.ExecutionCreate{Side: SideBuy, Price: 2300, Volume: 1, ExecutedAt: at(0)},
+		models.ExecutionCreate{Side: SideSell, Price: 2310, Volume: 1, ExecutedAt: at(30), PnL: pnl(1000)},
+	); err != nil {
+		t.Fatalf("建立交易失敗: %v", err)
+	}
+	if err := create("bad",
+		models.ExecutionCreate{Side: SideBuy, Price: 2300, Volume: 1, ExecutedAt: at(0)},
+		models.ExecutionCreate{Side: SideSell, Price: 999, Volume: 1, ExecutedAt: at(30)},
+	); err == nil {
+		t.Fatal("寫入成交失敗時應回傳錯誤")
+	}
+
+	var trades, fills, revisions int
+	db.QueryRow("SELECT COUNT(*) FROM trades WHERE ticket IN ('ok', 'bad')").Scan(&trades)
+	db.QueryRow("SELECT COUNT(*) FROM trade_executions e JOIN trades t ON e.trade_id = t.id WHERE t.ticket = 'ok'").Scan(&fills)
+	db.QueryRow("SELECT COUNT(*) FROM trade_revisions r JOIN trades t ON r.trade_id = t.id WHERE t.ticket = 'ok'").Scan(&revisions)
+	if trades != 1 || fills != 2 || revisions != 1 {
+		t.Fatalf("應只留下成功的交易、成交與異動紀錄，得到 %d 筆交易、%d 筆成交、%d 筆異動", trades, fills, revisions)
+	}
+	var lot float64
+	db.QueryRow("SELECT lot_size FROM trades WHERE ticket = 'ok'").Scan(&lot)
+	if lot != 1 {
+		t.Fatalf("建立後應依成交重新計算手數，得到 %v", lot)
+	}
+}
@@ -0,0 +1,85 @@
+package executions
+
+import (
+	"encoding/json"
+	"math"
+)
+
+// Level 停損或停利價位的紀錄，sl_history 與 tp_history 皆為 Level 的 JSON 陣列
+type Level struct {
+	Price float64 `json:"price"`
+	Time  int64   `json:"time"` // 毫秒時間戳
+}
+
+// Levels 依價位去重的價位歷史
+type Levels []Level
+
+// ParseLevels 解析 sl_history / tp_history，格式錯誤時視為沒有紀錄
+func ParseLevels(s *string) Levels {
+	var l Levels
+	if s != nil && *s != "" {
+		json.Unmarshal([]byte(*s), &l)
+	}
+	return l
+}
+
+// Add 加入價位，相同價位只保留最早的時間；price <= 0 表示未設定，不記錄
+func (l *Levels) Add(price float64, t int64) {
+	if price <= 0 {
+		return
+	}
+	for i, existing := range *l {
+		if math.Abs(existing.Price-price) < 0.00001 {
+			if t < existing.Time {
+				(*l)[i].Time = t
+			}
+			return
+		}
+	}
+	*l = append(*l, Level{Price: price, Time: t})
+}
+
+// Earliest 時間最早的價位
+func (l Levels) Earliest() (Level, bool) {
+	if len(l) == 0 {
+		return Level{}, false
+	}
+	first := l[0]
+	for _, v := range l[1:] {
+		if v.Time < first.Time {
+			first = v
+		}
+	}
+	return first, true
+}
+
+// Latest 時間最晚的價位
+func (l Levels) Latest() (Level, bool) {
+	if len(l) == 0 {
+		return Level{}, false
+	}
+	last := l[0]
+	for _, v := range l[1:] {
+		if v.Time >= last.Time {
+			last = v
+		}
+	}
+	return last, true
+}
+
+// JSON 序列化為 sl_history / tp_history 欄位的值
+func (l Levels) JSON() string {
+	if l == nil {
+		l = Levels{}
+	}
+	b, _ := json.Marshal(l)
+	return string(b)
+}
+
+// Price 將券商回傳的價位轉為欄位值，0 表示未設定
+func Price(p float64) *float64 {
+	if p <= 0 {
+		return nil
+	}
+	return &p
+}
@@ -0,0 +1,33 @@
+package executions
+
+import "testing"
+
+func TestLevels(t *testing.T) {
+	var l Levels
+	l.Add(1.1000, 2000)
+	l.Add(0, 500) // 未設定
+	l.Add(1.1050, 3000)
+	l.Add(1.1000, 1000) // 相同價位保留最早的時間
+
+	if len(l) != 2 {
+		t.Fatalf("應有 2 個價位，得到 %+v", l)
+	}
+	if first, _ := l.Earliest(); first.Price != 1.1000 || first.Time != 1000 {
+		t.Errorf("最早的價位錯誤: %+v", first)
+	}
+	if last, _ := l.Latest(); last.Price != 1.1050 {
+		t.Errorf("最晚的價位錯誤: %+v", last)
+	}
+
+	s := l.JSON()
+	parsed := ParseLevels(&s)
+	if len(parsed) != 2 || parsed[1].Time != 3000 {
+		t.Errorf("JSON 往返後不一致: %s -> %+v", s, parsed)
+	}
+	if Levels(nil).JSON() != "[]" || ParseLevels(nil) != nil {
+		t.Error("沒有價位時應序列化為空陣列")
+	}
+	if Price(0) != nil || *Price(1.5) != 1.5 {
+		t.Error("Price 應將 0 視為未設定")
+	}
+}
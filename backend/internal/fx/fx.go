@@ -0,0 +1,316 @@
+package fx
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"trade-journal/internal/database"
+	"trade-journal/internal/models"
+)
+
+// DefaultCurrency 未設定幣別的帳號與跨幣別報表的預設幣別
+const DefaultCurrency = "USD"
+
+// pivot 沒有直接匯率時經由此幣別交叉換算
+const pivot = "USD"
+
+// ErrNotFound 匯率不存在或不屬於使用者
+var ErrNotFound = errors.New("匯率不存在")
+
+// dateLayouts 匯率日期接受的格式，統一存成 YYYY-MM-DD
+var dateLayouts = []string{"2006-01-02", "2006/01/02", "2006.01.02", "20060102"}
+
+// NormalizeCurrency 檢查幣別代碼 (ISO 4217 三碼英文) 並轉為大寫
+func NormalizeCurrency(code string) (string, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if len(code) != 3 {
+		return "", fmt.Errorf("無效的幣別: %q", code)
+	}
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			return "", fmt.Errorf("無效的幣別: %q", code)
+		}
+	}
+	return code, nil
+}
+
+// NormalizeDate 將匯率日期轉為 YYYY-MM-DD
+func NormalizeDate(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Format("2006-01-02"), nil
+		}
+	}
+	// 帶有時間的日期只取日期部分
+	if len(s) > 10 {
+		if t, err := time.Parse("2006-01-02", s[:10]); err == nil {
+			return t.Format("2006-01-02"), nil
+		}
+	}
+	return "", fmt.Errorf("無效的日期: %q", s)
+}
+
+type point struct {
+	date string
+	rate float64
+}
+
+// Rates 使用者的匯率表，key 為 "BASE/QUOTE"，每個貨幣對依日期排序
+// 匯率表示 1 單位 base 可兌換的 quote 數量
+type Rates map[string][]point
+
+// Load 取得使用者的所有匯率
+func Load(q database.Querier, userID int64) (Rates, error) {
+	rows, err := q.Query("SELECT base, quote, rate_date, rate FROM fx_rates WHERE user_id = ? ORDER BY base, quote, rate_date", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	rates := Rates{}
+	for rows.Next() {
+		var base, quote string
+		var p point
+		if err := rows.Scan(&base, &quote, &p.date, &p.rate); err != nil {
+			return nil, err
+		}
+		rates.add(base, quote, p)
+	}
+	return rates, rows.Err()
+}
+
+func (r Rates) add(base, quote string, p point) {
+	key := base + "/" + quote
+	r[key] = append(r[key], p)
+}
+
+// lookup 取得指定日期當天或之前最近的匯率，日期早於所有資料時使用最早的匯率
+func (r Rates) lookup(base, quote, date string) (float64, bool) {
+	list := r[base+"/"+quote]
+	if len(list) == 0 {
+		return 0, false
+	}
+	i := sort.Search(len(list), func(i int) bool { return list[i].date > date })
+	if i == 0 {
+		return list[0].rate, true
+	}
+	return list[i-1].rate, true
+}
+
+// direct 以直接或反向的匯率換算
+func (r Rates) direct(from, to, date string) (float64, bool) {
+	if rate, ok := r.lookup(from, to, date); ok {
+		return rate, true
+	}
+	if rate, ok := r.lookup(to, from, date); ok && rate != 0 {
+		return 1 / rate, true
+	}
+	return 0, false
+}
+
+// Rate 取得 from 換算為 to 的匯率，沒有直接或反向匯率時經由 USD 交叉換算
+func (r Rates) Rate(from, to string, at time.Time) (float64, bool) {
+	if from == to {
+		return 1, true
+	}
+	date := at.Format("2006-01-02")
+	if rate, ok := r.direct(from, to, date); ok {
+		return rate, true
+	}
+	if from == pivot || to == pivot {
+		return 0, false
+	}
+	a, ok := r.direct(from, pivot, date)
+	if !ok {
+		return 0, false
+	}
+	b, ok := r.direct(pivot, to, date)
+	if !ok {
+		return 0, false
+	}
+	return a * b, true
+}
+
+// Convert 將金額從 from 換算為 to，沒有可用的匯率時回傳 false
+func (r Rates) Convert(amount float64, from, to string, at time.Time) (float64, bool) {
+	rate, ok := r.Rate(from, to, at)
+	if !ok {
+		return 0, false
+	}
+	return amount * rate, true
+}
+
+// List 取得使用者的匯率，base / quote 為空字串時不篩選，依貨幣對與日期排序
+func List(q database.Querier, userID int64, base, quote string) ([]models.FXRate, error) {
+	query := "SELECT id, base, quote, rate_date, rate, created_at FROM fx_rates WHERE user_id = ?"
+	args := []interface{}{userID}
+	if base != "" {
+		query += " AND base = ?"
+		args = append(args, strings.ToUpper(base))
+	}
+	if quote != "" {
+		query += " AND quote = ?"
+		args = append(args, strings.ToUpper(quote))
+	}
+	rows, err := q.Query(query+" ORDER BY base, quote, rate_date DESC", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []models.FXRate{}
+	for rows.Next() {
+		var r models.FXRate
+		if err := rows.Scan(&r.ID, &r.Base, &r.Quote, &r.RateDate, &r.Rate, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+// Validate 檢查匯率請求，回傳幣別大寫、日期為 YYYY-MM-DD 的請求
+func Validate(req models.FXRateCreate) (models.FXRateCreate, error) {
+	base, err := NormalizeCurrency(req.Base)
+	if err != nil {
+		return req, err
+	}
+	quote, err := NormalizeCurrency(req.Quote)
+	if err != nil {
+		return req, err
+	}
+	if base == quote {
+		return req, fmt.Errorf("base 與 quote 不可相同")
+	}
+	date, err := NormalizeDate(req.RateDate)
+	if err != nil {
+		return req, err
+	}
+	if req.Rate <= 0 {
+		return req, fmt.Errorf("匯率必須大於 0")
+	}
+	return models.FXRateCreate{Base: base, Quote: quote, RateDate: date, Rate: req.Rate}, nil
+}
+
+// Save 新增或覆寫同一貨幣對同一天的匯率，回傳是否為新增
+func Save(q database.Querier, userID int64, req models.FXRateCreate) (bool, error) {
+	req, err := Validate(req)
+	if err != nil {
+		return false, err
+	}
+	base, quote, date := req.Base, req.Quote, req.RateDate
+
+	res, err := q.Exec("UPDATE fx_rates SET rate = ? WHERE user_id = ? AND base = ? AND quote = ? AND rate_date = ?",
+		req.Rate, userID, base, quote, date)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		return false, nil
+	}
+	_, err = q.Exec("INSERT INTO fx_rates (user_id, base, quote, rate_date, rate) VALUES (?, ?, ?, ?, ?)",
+		userID, base, quote, date, req.Rate)
+	return err == nil, err
+}
+
+// Delete 刪除單筆匯率
+func Delete(q database.Querier, userID, id int64) error {
+	res, err := q.Exec("DELETE FROM fx_rates WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ImportResult 匯率 CSV 匯入結果
+type ImportResult struct {
+	Created int      `json:"created"`
+	Updated int      `json:"updated"`
+	Errors  []string `json:"errors"`
+}
+
+// ImportCSV 匯入匯率 CSV，第一列為標題：date、rate 必填，貨幣對以 base + quote 或六碼的 pair (例如 EURUSD) 指定
+// 格式錯誤的資料列會略過並記錄在 Errors，同一貨幣對同一天的匯率會被覆寫
+func ImportCSV(q database.Querier, userID int64, r io.Reader) (ImportResult, error) {
+	result := ImportResult{Errors: []string{}}
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return result, fmt.Errorf("讀取標題失敗: %w", err)
+	}
+	cols := map[string]int{}
+	for i, name := range header {
+		cols[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	_, hasPair := cols["pair"]
+	_, hasBase := cols["base"]
+	_, hasQuote := cols["quote"]
+	if _, ok := cols["date"]; !ok {
+		return result, fmt.Errorf("CSV 缺少 date 欄位")
+	}
+	if _, ok := cols["rate"]; !ok {
+		return result, fmt.Errorf("CSV 缺少 rate 欄位")
+	}
+	if !hasPair && !(hasBase && hasQuote) {
+		return result, fmt.Errorf("CSV 需要 pair 或 base、quote 欄位")
+	}
+
+	field := func(record []string, name string) string {
+		i, ok := cols[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	line := 1
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line++
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("第 %d 列: %v", line, err))
+			continue
+		}
+
+		req := models.FXRateCreate{Base: field(record, "base"), Quote: field(record, "quote"), RateDate: field(record, "date")}
+		if req.Base == "" && req.Quote == "" {
+			pair := strings.NewReplacer("/", "", "_", "", "-", "").Replace(field(record, "pair"))
+			if len(pair) != 6 {
+				result.Errors = append(result.Errors, fmt.Sprintf("第 %d 列: 無效的貨幣對 %q", line, field(record, "pair")))
+				continue
+			}
+			req.Base, req.Quote = pair[:3], pair[3:]
+		}
+		req.Rate, err = strconv.ParseFloat(field(record, "rate"), 64)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("第 %d 列: 無效的匯率 %q", line, field(record, "rate")))
+			continue
+		}
+
+		created, err := Save(q, userID, req)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("第 %d 列: %v", line, err))
+			continue
+		}
+		if created {
+			result.Created++
+		} else {
+			result.Updated++
+		}
+	}
+	return result, nil
+}
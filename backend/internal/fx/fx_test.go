@@ -0,0 +1,69 @@
+package fx
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"trade-journal/internal/models"
+	"trade-journal/internal/testutil"
+)
+
+func day(s string) time.Time {
+	t, _ := time.Parse("2006-01-02", s)
+	return t
+}
+
+func TestRate(t *testing.T) {
+	rates := Rates{}
+	rates.add("EUR", "USD", point{"2024-05-01", 1.10})
+	rates.add("EUR", "USD", point{"2024-05-03", 1.20})
+	rates.add("USD", "JPY", point{"2024-05-01", 150})
+
+	cases := []struct {
+		from, to, date string
+		want           float64
+		ok             bool
+	}{
+		{"USD", "USD", "2024-05-01", 1, true},
+		{"EUR", "USD", "2024-05-02", 1.10, true}, // 使用當天或之前最近的匯率
+		{"EUR", "USD", "2024-05-03", 1.20, true},
+		{"EUR", "USD", "2024-04-01", 1.10, true},       // 早於所有資料時使用最早的匯率
+		{"USD", "EUR", "2024-05-10", 1 / 1.20, true},   // 反向匯率
+		{"EUR", "JPY", "2024-05-01", 1.10 * 150, true}, // 經由 USD 交叉換算
+		{"GBP", "USD", "2024-05-01", 0, false},
+	}
+	for _, tc := range cases {
+		got, ok := rates.Rate(tc.from, tc.to, day(tc.date))
+		if ok != tc.ok || (ok && got != tc.want) {
+			t.Errorf("%s/%s %s: 得到 %v %v，預期 %v %v", tc.from, tc.to, tc.date, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestImportCSV(t *testing.T) {
+	db := testutil.OpenDB(t, "INSERT INTO users (id, username, password) VALUES (1, 'alice', 'x')")
+	if _, err := Save(db, 1, models.FXRateCreate{Base: "eur", Quote: "usd", RateDate: "2024-05-01", Rate: 1.05}); err != nil {
+		t.Fatalf("新增匯率失敗: %v", err)
+	}
+
+	csv := "\ufeffDate,Pair,Rate\n2024/05/01,EUR/USD,1.07\n2024-05-02,EURUSD,1.08\n2024-05-02,EURUS,1\n2024-05-03,GBPUSD,abc\n"
+	result, err := ImportCSV(db, 1, strings.NewReader(csv))
+	if err != nil {
+		t.Fatalf("匯入失敗: %v", err)
+	}
+	if result.Created != 1 || result.Updated != 1 || len(result.Errors) != 2 {
+		t.Fatalf("匯入結果錯誤: %+v", result)
+	}
+
+	rates, err := Load(db, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rate, _ := rates.Rate("EUR", "USD", day("2024-05-01")); rate != 1.07 {
+		t.Errorf("同一天的匯率應被覆寫，得到 %v", rate)
+	}
+	if _, err := ImportCSV(db, 1, strings.NewReader("date,rate\n2024-05-01,1\n")); err == nil {
+		t.Error("缺少貨幣對欄位應回傳錯誤")
+	}
+}
@@ -0,0 +1,194 @@
+package gallery
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"trade-journal/internal/annotations"
+	"trade-journal/internal/database"
+	"trade-journal/internal/models"
+	"trade-journal/internal/strategies"
+)
+
+// 圖片類型，策略圖片為 strategies.ImageType
+const (
+	Entry      = "entry"
+	Exit       = "exit"
+	HTFContext = "htf_context" // 高週期背景
+	PostMortem = "post_mortem" // 事後檢討
+)
+
+var (
+	// ErrNotFound 圖片不存在或不屬於該交易
+	ErrNotFound = errors.New("圖片不存在")
+	// ErrStrategyType 策略圖片對應策略的圖片欄位，不能與其他類型互換
+	ErrStrategyType = errors.New("策略圖片不能變更類型")
+	// ErrInvalidTakenAt taken_at 格式錯誤
+	ErrInvalidTakenAt = errors.New("taken_at 需為 RFC 3339 時間")
+	// ErrOrderMismatch 排序清單與交易的圖片不一致
+	ErrOrderMismatch = errors.New("image_ids 需包含交易的所有圖片且不可重複")
+)
+
+const selectColumns = `
+	SELECT id, trade_id, image_type, image_path, COALESCE(image_order, 0), description, taken_at, created_at, slot
+	FROM trade_images`
+
+func scan(row interface{ Scan(...interface{}) error }) (models.Image, error) {
+	var img models.Image
+	err := row.Scan(&img.ID, &img.TradeID, &img.ImageType, &img.ImagePath, &img.ImageOrder, &img.Description, &img.TakenAt, &img.CreatedAt, &img.Slot)
+	return img, err
+}
+
+// Load 取得交易的圖片與標註圖層，依 image_order 排序
+func Load(q database.Querier, tradeID int64) ([]models.Image, error) {
+	rows, err := q.Query(selectColumns+" WHERE trade_id = ? ORDER BY image_order, id", tradeID)
+	if err != nil {
+		return nil, err
+	}
+	var list []models.Image
+	for rows.Next() {
+		img, err := scan(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		list = append(list, img)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	layers, err := annotations.ForTrade(q, tradeID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range list {
+		list[i].Annotations = layers[list[i].ID]
+	}
+	return list, nil
+}
+
+// Get 取得交易的單張圖片，找不到時回傳 ErrNotFound
+func Get(q database.Querier, tradeID, imageID int64) (models.Image, error) {
+	img, err := scan(q.QueryRow(selectColumns+" WHERE id = ? AND trade_id = ?", imageID, tradeID))
+	if err == sql.ErrNoRows {
+		return img, ErrNotFound
+	}
+	return img, err
+}
+
+// Add 新增圖片到交易最後，策略圖片需記錄對應的圖片欄位
+func Add(q database.Querier, tradeID int64, img models.ImageUpload) (int64, error) {
+	var slot interface{}
+	if img.ImageType == strategies.ImageType {
+		slot = img.Slot
+	}
+	var description interface{}
+	if s := strings.TrimSpace(img.Description); s != "" {
+		description = s
+	}
+	return database.InsertID(q, `
+		INSERT INTO trade_images (trade_id, image_type, image_path, slot, description, taken_at, image_order)
+		VALUES (?, ?, ?, ?, ?, ?, (SELECT COALESCE(MAX(image_order), -1) + 1 FROM trade_images WHERE trade_id = ?))
+	`, tradeID, img.ImageType, img.ImagePath, slot, description, img.TakenAt, tradeID)
+}
+
+// Update 修改圖片的類型、說明與截圖時間
+func Update(q database.Querier, tradeID, imageID int64, req models.ImageUpdate) error {
+	img, err := Get(q, tradeID, imageID)
+	if err != nil {
+		return err
+	}
+	if req.ImageType != nil && *req.ImageType != img.ImageType && img.ImageType == strategies.ImageType {
+		return ErrStrategyType
+	}
+
+	var sets []string
+	var args []interface{}
+	if req.ImageType != nil {
+		sets, args = append(sets, "image_type = ?"), append(args, *req.ImageType)
+	}
+	if req.Description != nil {
+		var v interface{}
+		if s := strings.TrimSpace(*req.Description); s != "" {
+			v = s
+		}
+		sets, args = append(sets, "description = ?"), append(args, v)
+	}
+	if req.TakenAt != nil {
+		var v interface{}
+		if *req.TakenAt != "" {
+			t, err := time.Parse(time.RFC3339, *req.TakenAt)
+			if err != nil {
+				return ErrInvalidTakenAt
+			}
+			v = t
+		}
+		sets, args = append(sets, "taken_at = ?"), append(args, v)
+	}
+	if len(sets) == 0 {
+		return nil
+	}
+	_, err = q.Exec("UPDATE trade_images SET "+strings.Join(sets, ", ")+" WHERE id = ? AND trade_id = ?", append(args, imageID, tradeID)...)
+	return err
+}
+
+// Delete 刪除交易的圖片與其標註圖層並重新編排順序，MinIO 中的物件保留
+func Delete(q database.Querier, tradeID, imageID int64) error {
+	if _, err := Get(q, tradeID, imageID); err != nil {
+		return err
+	}
+	if err := annotations.DeleteImage(q, imageID); err != nil {
+		return err
+	}
+	res, err := q.Exec("DELETE FROM trade_images WHERE id = ? AND trade_id = ?", imageID, tradeID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	list, err := Load(q, tradeID)
+	if err != nil {
+		return err
+	}
+	ids := make([]int64, len(list))
+	for i, img := range list {
+		ids[i] = img.ID
+	}
+	return setOrder(q, tradeID, ids)
+}
+
+// Reorder 依 ids 的順序重新排列交易的圖片，ids 需包含交易的所有圖片
+func Reorder(q database.Querier, tradeID int64, ids []int64) error {
+	list, err := Load(q, tradeID)
+	if err != nil {
+		return err
+	}
+	if len(ids) != len(list) {
+		return ErrOrderMismatch
+	}
+	remaining := make(map[int64]bool, len(list))
+	for _, img := range list {
+		remaining[img.ID] = true
+	}
+	for _, id := range ids {
+		if !remaining[id] {
+			return ErrOrderMismatch
+		}
+		delete(remaining, id)
+	}
+	return setOrder(q, tradeID, ids)
+}
+
+func setOrder(q database.Querier, tradeID int64, ids []int64) error {
+	for i, id := range ids {
+		if _, err := q.Exec("UPDATE trade_images SET image_order = ? WHERE id = ? AND trade_id = ?", i, id, tradeID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package gallery
+
+import (
+	"testing"
+	"time"
+
+	"trade-journal/internal/models"
+	"trade-journal/internal/testutil"
+)
+
+func TestGallery(t *testing.T) {
+	db := testutil.OpenDB(t,
+		"INSERT INTO users (id, username, password) VALUES (1, 'alice', 'x')",
+		"INSERT INTO accounts (id, user_id, name) VALUES (10, 1, 'main')",
+		"INSERT INTO trades (id, account_id, symbol, side, entry_price, entry_time) VALUES (100, 10, 'XAUUSD', 'long', 1, '2024-05-06 08:00:00')",
+		"INSERT INTO trade_images (id, trade_id, image_type, image_path, slot) VALUES (1, 100, 'strategy', 'a.png', 'htf')",
+	)
+
+	takenAt := time.Date(2024, 5, 6, 7, 45, 0, 0, time.UTC)
+	htf, err := Add(db, 100, models.ImageUpload{ImageType: HTFContext, ImagePath: "b.png", Description: " H4 結構 ", TakenAt: &takenAt})
+	if err != nil {
+		t.Fatal(err)
+	}
+	post, err := Add(db, 100, models.ImageUpload{ImageType: PostMortem, ImagePath: "c.png"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	order := func() []int64 {
+		t.Helper()
+		list, err := Load(db, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := make([]int64, len(list))
+		for i, img := range list {
+			if img.ImageOrder != i {
+				t.Fatalf("圖片 %d 的順序為 %d，預期 %d", img.ID, img.ImageOrder, i)
+			}
+			ids[i] = img.ID
+		}
+		return ids
+	}
+	if ids := order(); len(ids) != 3 || ids[0] != 1 || ids[1] != htf || ids[2] != post {
+		t.Fatalf("新增的圖片應排在最後: %v", ids)
+	}
+	img, err := Get(db, 100, htf)
+	if err != nil || img.Description == nil || *img.Description != "H4 結構" || img.TakenAt == nil || !img.TakenAt.Equal(takenAt) {
+		t.Fatalf("圖片說明或時間錯誤: %+v %v", img, err)
+	}
+
+	if err := Reorder(db, 100, []int64{post, 1}); err != ErrOrderMismatch {
+		t.Fatalf("缺少圖片應回傳 ErrOrderMismatch: %v", err)
+	}
+	if err := Reorder(db, 100, []int64{post, 1, post}); err != ErrOrderMismatch {
+		t.Fatalf("重複的圖片應回傳 ErrOrderMismatch: %v", err)
+	}
+	if err := Reorder(db, 100, []int64{post, htf, 1}); err != nil {
+		t.Fatal(err)
+	}
+	if ids := order(); ids[0] != post || ids[2] != 1 {
+		t.Fatalf("重新排序錯誤: %v", ids)
+	}
+
+	entry, empty := Entry, ""
+	if err := Update(db, 100, 1, models.ImageUpdate{ImageType: &entry}); err != ErrStrategyType {
+		t.Fatalf("策略圖片不能變更類型: %v", err)
+	}
+	bad := "yesterday"
+	if err := Update(db, 100, htf, models.ImageUpdate{TakenAt: &bad}); err != ErrInvalidTakenAt {
+		t.Fatalf("時間格式錯誤應回傳 ErrInvalidTakenAt: %v", err)
+	}
+	if err := Update(db, 100, htf, models.ImageUpdate{ImageType: &entry, Description: &empty, TakenAt: &empty}); err != nil {
+		t.Fatal(err)
+	}
+	if img, _ := Get(db, 100, htf); img.ImageType != Entry || img.Description != nil || img.TakenAt != nil {
+		t.Fatalf("更新圖片錯誤: %+v", img)
+	}
+
+	// 刪除後其餘圖片往前遞補
+	if err := Delete(db, 100, post); err != nil {
+		t.Fatal(err)
+	}
+	if ids := order(); len(ids) != 2 || ids[0] != htf {
+		t.Fatalf("刪除後順序錯誤: %v", ids)
+	}
+	if err := Delete(db, 100, post); err != ErrNotFound {
+		t.Fatalf("重複刪除應回傳 ErrNotFound: %v", err)
+	}
+}
@@ -5,14 +5,22 @@ import (
 	"encoding/csv"
 	"fmt"
 	"log"
-	"math"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
+	"trade-journal/internal/audit"
 	"trade-journal/internal/ctrader"
+	"trade-journal/internal/dailyplans"
+	"trade-journal/internal/database"
+	"trade-journal/internal/executions"
+	"trade-journal/internal/fx"
+	"trade-journal/internal/images"
+	"trade-journal/internal/instruments"
+	"trade-journal/internal/minio"
 	"trade-journal/internal/models"
 	"trade-journal/internal/mt5"
+	"trade-journal/internal/trash"
 
 	"github.com/gin-gonic/gin"
 )
@@ -28,16 +36,10 @@ func GetAccounts(db *sql.DB) gin.HandlerFunc {
 				COALESCE(ctrader_client_id, ''), COALESCE(ctrader_client_secret, ''),
 				COALESCE(ctrader_env, 'live'),
 				status, 
-				COALESCE(timezone_offset, 8), COALESCE(sync_status, 'idle'), last_synced_at, 
+				COALESCE(timezone_offset, 8), currency, COALESCE(sync_status, 'idle'), last_synced_at, 
 				COALESCE(last_sync_error, ''), created_at, updated_at,
 				(
 					SELECT COALESCE(SUM(
-						LENGTH(COALESCE(entry_strategy_image, '')) +
-						LENGTH(COALESCE(entry_strategy_image_original, '')) +
-						LENGTH(COALESCE(legend_king_image, '')) +
-						LENGTH(COALESCE(legend_king_image_original, '')) +
-						LENGTH(COALESCE(legend_htf_image, '')) +
-						LENGTH(COALESCE(legend_htf_image_original, '')) +
 						LENGTH(COALESCE(entry_signals, '')) +
 						LENGTH(COALESCE(entry_checklist, '')) +
 						LENGTH(COALESCE(trend_analysis, '')) +
@@ -45,10 +47,6 @@ func GetAccounts(db *sql.DB) gin.HandlerFunc {
 						LENGTH(COALESCE(entry_reason, '')) +
 						LENGTH(COALESCE(exit_reason, ''))
 					), 0) FROM trades WHERE account_id = a.id
-				) + (
-					SELECT COALESCE(SUM(LENGTH(COALESCE(image_path, ''))), 0) 
-					FROM trade_images 
-					WHERE trade_id IN (SELECT id FROM trades WHERE account_id = a.id)
 				) + (
 					SELECT COALESCE(SUM(
 						LENGTH(COALESCE(notes, '')) +
@@ -56,7 +54,7 @@ func GetAccounts(db *sql.DB) gin.HandlerFunc {
 					), 0) FROM daily_plans WHERE account_id = a.id
 				) AS storage_usage
 			FROM accounts a 
-			WHERE user_id = ? 
+			WHERE user_id = ? AND deleted_at IS NULL
 			ORDER BY created_at ASC`
 
 		rows, err := db.Query(query, userID)
@@ -75,7 +73,7 @@ func GetAccounts(db *sql.DB) gin.HandlerFunc {
 				&acc.CTraderClientID, &acc.CTraderClientSecret,
 				&acc.CTraderEnv,
 				&acc.Status, 
-				&acc.TimezoneOffset, &acc.SyncStatus, &acc.LastSyncedAt, &acc.LastSyncError, 
+				&acc.TimezoneOffset, &acc.Currency, &acc.SyncStatus, &acc.LastSyncedAt, &acc.LastSyncError, 
 				&acc.CreatedAt, &acc.UpdatedAt, &acc.StorageUsage,
 			)
 			if err != nil {
@@ -84,6 +82,17 @@ func GetAccounts(db *sql.DB) gin.HandlerFunc {
 			}
 			accounts = append(accounts, acc)
 		}
+		rows.Close()
+
+		// 圖片存放在 MinIO，依物件實際大小計算
+		usage, err := images.Usage(c.Request.Context(), db, minio.GlobalClient, "account_id IN (SELECT id FROM accounts WHERE user_id = ?)", userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		for i := range accounts {
+			accounts[i].StorageUsage += usage[accounts[i].ID]
+		}
 
 		c.JSON(http.StatusOK, accounts)
 	}
@@ -98,16 +107,23 @@ func CreateAccount(db *sql.DB) gin.HandlerFunc {
 			return
 		}
 
+		currency := fx.DefaultCurrency
+		if req.Currency != "" {
+			var err error
+			if currency, err = fx.NormalizeCurrency(req.Currency); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
 		userID := c.GetInt64("user_id")
-		res, err := db.Exec("INSERT INTO accounts (name, type, mt5_account_id, mt5_token, ctrader_account_id, ctrader_token, ctrader_client_id, ctrader_client_secret, ctrader_env, timezone_offset, user_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
-			req.Name, req.Type, req.MT5AccountID, req.MT5Token, req.CTraderAccountID, req.CTraderToken, req.CTraderClientID, req.CTraderClientSecret, req.CTraderEnv, req.TimezoneOffset, userID)
+		id, err := database.InsertID(db, "INSERT INTO accounts (name, type, mt5_account_id, mt5_token, ctrader_account_id, ctrader_token, ctrader_client_id, ctrader_client_secret, ctrader_env, timezone_offset, currency, user_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			req.Name, req.Type, req.MT5AccountID, req.MT5Token, req.CTraderAccountID, req.CTraderToken, req.CTraderClientID, req.CTraderClientSecret, req.CTraderEnv, req.TimezoneOffset, currency, userID)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
-		id, _ := res.LastInsertId()
-
 		// 如果是 MetaTrader 帳號，觸發同步 (目前 placeholder)
 		if req.Type == "metatrader" {
 			go mt5.SyncMT5History(db, id, req.MT5AccountID, req.MT5Token)
@@ -129,10 +145,20 @@ func UpdateAccount(db *sql.DB) gin.HandlerFunc {
 			return
 		}
 
+		// 變更基礎幣別不會換算既有交易的金額，只影響之後的報表換算
+		if req.Currency != nil {
+			currency, err := fx.NormalizeCurrency(*req.Currency)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			req.Currency = &currency
+		}
+
 		userID := c.GetInt64("user_id")
 		// 這裡為了簡化先做全量更新，實際上應該檢查 nil
-		res, err := db.Exec("UPDATE accounts SET name = COALESCE(?, name), mt5_account_id = COALESCE(?, mt5_account_id), mt5_token = COALESCE(?, mt5_token), ctrader_account_id = COALESCE(?, ctrader_account_id), ctrader_token = COALESCE(?, ctrader_token), ctrader_client_id = COALESCE(?, ctrader_client_id), ctrader_client_secret = COALESCE(?, ctrader_client_secret), ctrader_env = COALESCE(?, ctrader_env), timezone_offset = COALESCE(?, timezone_offset), updated_at = CURRENT_TIMESTAMP WHERE id = ? AND user_id = ?",
-			req.Name, req.MT5AccountID, req.MT5Token, req.CTraderAccountID, req.CTraderToken, req.CTraderClientID, req.CTraderClientSecret, req.CTraderEnv, req.TimezoneOffset, id, userID)
+		res, err := db.Exec("UPDATE accounts SET name = COALESCE(?, name), mt5_account_id = COALESCE(?, mt5_account_id), mt5_token = COALESCE(?, mt5_token), ctrader_account_id = COALESCE(?, ctrader_account_id), ctrader_token = COALESCE(?, ctrader_token), ctrader_client_id = COALESCE(?, ctrader_client_id), ctrader_client_secret = COALESCE(?, ctrader_client_secret), ctrader_env = COALESCE(?, ctrader_env), timezone_offset = COALESCE(?, timezone_offset), currency = COALESCE(?, currency), updated_at = CURRENT_TIMESTAMP WHERE id = ? AND user_id = ?",
+			req.Name, req.MT5AccountID, req.MT5Token, req.CTraderAccountID, req.CTraderToken, req.CTraderClientID, req.CTraderClientSecret, req.CTraderEnv, req.TimezoneOffset, req.Currency, id, userID)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
@@ -144,17 +170,26 @@ func UpdateAccount(db *sql.DB) gin.HandlerFunc {
 			return
 		}
 
+		// 交易依帳號時區的日期連結每日規劃，變更時區後重新連結
+		if req.TimezoneOffset != nil {
+			accountID, _ := strconv.ParseInt(id, 10, 64)
+			if err := dailyplans.LinkAccount(db, accountID); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
 		c.JSON(http.StatusOK, gin.H{"message": "帳號更新成功"})
 	}
 }
 
-// DeleteAccount 刪除帳號
+// DeleteAccount 刪除帳號 (移到垃圾桶，帳號下的交易與規劃會一併隱藏)
 func DeleteAccount(db *sql.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id := c.Param("id")
 		userID := c.GetInt64("user_id")
 
-		res, err := db.Exec("DELETE FROM accounts WHERE id = ? AND user_id = ?", id, userID)
+		res, err := db.Exec("UPDATE accounts SET deleted_at = CURRENT_TIMESTAMP, delete_batch = ? WHERE id = ? AND user_id = ? AND deleted_at IS NULL", trash.NewBatch(), id, userID)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
@@ -177,7 +212,7 @@ func SyncAccountHistory(db *sql.DB) gin.HandlerFunc {
 		userID := c.GetInt64("user_id")
 
 		var acc models.Account
-		err := db.QueryRow("SELECT id, type, COALESCE(mt5_account_id, ''), COALESCE(mt5_token, ''), COALESCE(ctrader_account_id, ''), COALESCE(ctrader_token, ''), COALESCE(ctrader_client_id, ''), COALESCE(ctrader_client_secret, ''), COALESCE(ctrader_env, 'live') FROM accounts WHERE id = ? AND user_id = ?", id, userID).
+		err := db.QueryRow("SELECT id, type, COALESCE(mt5_account_id, ''), COALESCE(mt5_token, ''), COALESCE(ctrader_account_id, ''), COALESCE(ctrader_token, ''), COALESCE(ctrader_client_id, ''), COALESCE(ctrader_client_secret, ''), COALESCE(ctrader_env, 'live') FROM accounts WHERE id = ? AND user_id = ? AND deleted_at IS NULL", id, userID).
 			Scan(&acc.ID, &acc.Type, &acc.MT5AccountID, &acc.MT5Token, &acc.CTraderAccountID, &acc.CTraderToken, &acc.CTraderClientID, &acc.CTraderClientSecret, &acc.CTraderEnv)
 
 		if err != nil {
@@ -298,7 +333,7 @@ func ImportTradesCSV(db *sql.DB) gin.HandlerFunc {
 		userID := c.GetInt64("user_id")
 		// 檢查帳號所屬權
 		var exists int
-		db.QueryRow("SELECT 1 FROM accounts WHERE id = ? AND user_id = ?", accountID, userID).Scan(&exists)
+		db.QueryRow("SELECT 1 FROM accounts WHERE id = ? AND user_id = ? AND deleted_at IS NULL", accountID, userID).Scan(&exists)
 		if exists == 0 {
 			c.JSON(http.StatusForbidden, gin.H{"error": "無權限操作此帳號"})
 			return
@@ -338,6 +373,12 @@ func ImportTradesCSV(db *sql.DB) gin.HandlerFunc {
 		var importedTickets []string
 		var duplicateTickets []string
 		var errorTickets []string
+		specs := make(map[string]models.Instrument)
+		aliases, err := instruments.LoadAliases(db, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
 
 		for i, row := range records {
 			if i == 0 {
@@ -355,9 +396,11 @@ func ImportTradesCSV(db *sql.DB) gin.HandlerFunc {
 			openTimeStr := row[1]
 			sideStr := row[2] // buy/sell
 			volumeStr := row[3]
-			symbol := row[4]
+			rawSymbol := row[4]
+			symbol := aliases.Canonical(rawSymbol)
 			entryPriceStr := row[5]
 			slPriceStr := row[6]
+			tpPriceStr := row[7]
 			closeTimeStr := row[8]
 			exitPriceStr := row[9]
 			swapStr := row[10]
@@ -383,6 +426,7 @@ func ImportTradesCSV(db *sql.DB) gin.HandlerFunc {
 			entryPrice, _ := strconv.ParseFloat(entryPriceStr, 64)
 			exitPrice, _ := strconv.ParseFloat(exitPriceStr, 64)
 			exitSl, _ := strconv.ParseFloat(slPriceStr, 64)
+			exitTp, _ := strconv.ParseFloat(tpPriceStr, 64)
 			swap, _ := strconv.ParseFloat(swapStr, 64)
 			commission, _ := strconv.ParseFloat(commissionStr, 64)
 			profit, _ := strconv.ParseFloat(profitStr, 64)
@@ -394,26 +438,18 @@ func ImportTradesCSV(db *sql.DB) gin.HandlerFunc {
 
 			totalPnL := profit + swap + commission
 
-			// 計算合約乘數
-			multiplier := 100.0 // 預設 (黃金 XAUUSD: $1 = 100點, 指數: 1.0 = 100點)
-			symbolUpper := strings.ToUpper(symbol)
-			if strings.Contains(symbolUpper, "JPY") {
-				multiplier = 1000.0 // JPY 貨幣對 (0.001 = 1點)
-			} else if strings.Contains(symbolUpper, "EUR") || strings.Contains(symbolUpper, "GBP") || strings.Contains(symbolUpper, "AUD") || (strings.Contains(symbolUpper, "USD") && !strings.Contains(symbolUpper, "XAU")) {
-				multiplier = 100000.0 // 預設外匯 (0.00001 = 1點)
-			}
-
-			// 重新計算盈虧點數 (根據使用者定義：1點 = 最小價格單位)
-			diff := exitPrice - entryPrice
-			if side == "short" {
-				diff = entryPrice - exitPrice
+			// 依品種規格計算盈虧點數 (CSV 不提供初始 SL，子彈大小與風報比不計算)
+			spec, ok := specs[symbol]
+			if !ok {
+				spec, err = instruments.Resolve(db, userID, symbol)
+				if err != nil {
+					log.Printf("Resolve instrument error for ticket %s: %v", ticket, err)
+					errorTickets = append(errorTickets, ticket)
+					continue
+				}
+				specs[symbol] = spec
 			}
-			calculatedPips := math.Round(diff*multiplier*100) / 100
-
-			// 計算子彈大小與風報比 (CSV 匯入暫時不提供初始 SL，因此不計算)
-			var bulletSize interface{} = nil
-			var rrRatio interface{} = nil
-			var initialSl interface{} = nil
+			metrics := instruments.Compute(spec, side, entryPrice, &exitPrice, nil, nil)
 
 			// 自動判斷時段
 			marketSession := determineMarketSession(openTime)
@@ -427,8 +463,8 @@ func ImportTradesCSV(db *sql.DB) gin.HandlerFunc {
 			} else {
 				// 如果沒有 Ticket，才使用 entry_time + lot_size
 				err = db.QueryRow(`
-					SELECT EXISTS(SELECT 1 FROM trades WHERE account_id = ? AND symbol = ? AND entry_time = ? AND lot_size = ?)
-				`, accountID, symbol, openTime, volume).Scan(&exists)
+					SELECT EXISTS(SELECT 1 FROM trades WHERE account_id = ? AND COALESCE(raw_symbol, symbol) = ? AND entry_time = ? AND lot_size = ?)
+				`, accountID, rawSymbol, openTime, volume).Scan(&exists)
 			}
 
 			if exists {
@@ -436,12 +472,22 @@ func ImportTradesCSV(db *sql.DB) gin.HandlerFunc {
 				continue
 			}
 
-			// 寫入資料庫
-			_, err = db.Exec(`
-				INSERT INTO trades (account_id, symbol, side, entry_price, exit_price, lot_size, pnl, pnl_points, entry_time, exit_time, trade_type, notes, timezone_offset, market_session, initial_sl, bullet_size, rr_ratio, ticket, exit_sl)
-				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-			`, accountID, symbol, side, entryPrice, exitPrice, volume, totalPnL, calculatedPips, openTime, closeTime, "actual", "FTMO CSV 匯入: Ticket "+ticket, 8, marketSession, initialSl, bulletSize, rrRatio, ticket, exitSl)
+			// FTMO 每列為一筆已平倉部位，記錄進場與平倉兩筆成交
+			fills := []models.ExecutionCreate{
+				{Side: executions.EntrySide(side), Price: entryPrice, Volume: volume, ExecutedAt: openTime},
+			}
+			if !closeTime.IsZero() {
+				fills = append(fills, models.ExecutionCreate{
+					Side: executions.ExitSide(side), Price: exitPrice, Volume: volume, ExecutedAt: closeTime,
+					Commission: commission, Swap: swap, PnL: &profit,
+				})
+			}
 
+			// 寫入資料庫，交易與成交在同一個交易中建立
+			err = insertImportedTrade(db, userID, audit.SourceCSV, fills, `
+				INSERT INTO trades (account_id, symbol, raw_symbol, side, entry_price, exit_price, lot_size, pnl, gross_pnl, commission, swap, fees, pnl_points, entry_time, exit_time, trade_type, notes, timezone_offset, market_session, initial_sl, bullet_size, rr_ratio, ticket, exit_sl, exit_tp)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			`, accountID, symbol, rawSymbol, side, entryPrice, exitPrice, volume, totalPnL, profit, commission, swap, 0, metrics.PnLPoints, openTime, closeTime, "actual", "FTMO CSV 匯入: Ticket "+ticket, 8, marketSession, nil, metrics.BulletSize, metrics.RRRatio, ticket, exitSl, executions.Price(exitTp))
 			if err != nil {
 				log.Printf("Import failed for ticket %s: %v", ticket, err)
 				errorTickets = append(errorTickets, ticket)
@@ -474,7 +520,33 @@ func ImportTradesCSV(db *sql.DB) gin.HandlerFunc {
 	}
 }
 
-// ClearAccountData 清除帳號的所有交易紀錄與規劃
+// insertImportedTrade 在同一個交易中建立匯入的交易、成交與異動紀錄，任一步驟失敗即整筆回復
+func insertImportedTrade(db *sql.DB, userID int64, source string, fills []models.ExecutionCreate, query string, args ...interface{}) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	tradeID, err := database.InsertID(tx, query, args...)
+	if err != nil {
+		return err
+	}
+	for _, f := range fills {
+		if _, err := executions.Insert(tx, tradeID, f); err != nil {
+			return fmt.Errorf("寫入成交失敗: %w", err)
+		}
+	}
+	if err := dailyplans.Link(tx, tradeID); err != nil {
+		return fmt.Errorf("連結規劃失敗: %w", err)
+	}
+	if err := audit.RecordCreate(tx, tradeID, userID, source); err != nil {
+		return fmt.Errorf("記錄異動失敗: %w", err)
+	}
+	return tx.Commit()
+}
+
+// ClearAccountData 清除帳號的所有交易紀錄與規劃 (移到垃圾桶，可用 batch 整批還原)
 func ClearAccountData(db *sql.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id := c.Param("id")
@@ -482,7 +554,7 @@ func ClearAccountData(db *sql.DB) gin.HandlerFunc {
 
 		// 檢查帳號所屬權
 		var exists int
-		db.QueryRow("SELECT 1 FROM accounts WHERE id = ? AND user_id = ?", id, userID).Scan(&exists)
+		db.QueryRow("SELECT 1 FROM accounts WHERE id = ? AND user_id = ? AND deleted_at IS NULL", id, userID).Scan(&exists)
 		if exists == 0 {
 			c.JSON(http.StatusForbidden, gin.H{"error": "無權限操作此帳號"})
 			return
@@ -495,25 +567,39 @@ func ClearAccountData(db *sql.DB) gin.HandlerFunc {
 		}
 		defer tx.Rollback()
 
-		// 刪除交易紀錄（這也會透過 CASCADE 刪除相關圖片與標籤）
-		_, err = tx.Exec("DELETE FROM trades WHERE account_id = ?", id)
+		batch := trash.NewBatch()
+
+		// 交易紀錄移到垃圾桶（圖片與標籤保留，還原時一併恢復）
+		res, err := tx.Exec("UPDATE trades SET deleted_at = CURRENT_TIMESTAMP, delete_batch = ? WHERE account_id = ? AND deleted_at IS NULL", batch, id)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "清除交易紀錄失敗: " + err.Error()})
 			return
 		}
+		tradeCount, _ := res.RowsAffected()
 
-		// 刪除每日規劃
-		_, err = tx.Exec("DELETE FROM daily_plans WHERE account_id = ?", id)
+		// 每日規劃移到垃圾桶
+		res, err = tx.Exec("UPDATE daily_plans SET deleted_at = CURRENT_TIMESTAMP, delete_batch = ? WHERE account_id = ? AND deleted_at IS NULL", batch, id)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "清除每日規劃失敗: " + err.Error()})
 			return
 		}
+		planCount, _ := res.RowsAffected()
+
+		if err := audit.RecordBatchDelete(tx, batch, userID, audit.SourceAPI); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
 
 		if err := tx.Commit(); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"message": "帳號資料已完成清除"})
+		c.JSON(http.StatusOK, gin.H{
+			"message": "帳號資料已移到垃圾桶",
+			"batch":   batch,
+			"trades":  tradeCount,
+			"plans":   planCount,
+		})
 	}
 }
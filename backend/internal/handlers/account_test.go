@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestImportTradesCSVWritesExecutionsInTradeTx(t *testing.T) {
+	s := newTestServer(t,
+		"INSERT INTO users (id, username, password) VALUES (1, 'alice', 'x')",
+		"INSERT INTO accounts (id, user_id, name) VALUES (10, 1, 'main')",
+		// 模擬寫入成交失敗，交易也不應留下
+		"CREATE TRIGGER fail_execution BEFORE INSERT ON trade_executions WHEN NEW.price = 999 BEGIN SELECT RAISE(ABORT, 'boom'); END",
+	)
+
+	csv := "Ticket,Open,Type,Volume,Symbol,Price,SL,TP,Close,Close Price,Swap,Commission,Profit,Pips\n" +
+		"1001,2024-05-01 08:00,buy,1,XAUUSD,2300,2290,2320,2024-05-01 09:00,2310,0,-5,1000,100\n" +
+		"1002,2024-05-02 08:00,buy,1,XAUUSD,999,990,1010,2024-05-02 09:00,1000,0,-5,100,10\n"
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, _ := mw.CreateFormFile("file", "ftmo.csv")
+	fw.Write([]byte(csv))
+	mw.Close()
+
+	s.POST("/accounts/:id/import", ImportTradesCSV(s.db))
+	req := httptest.NewRequest("POST", "/accounts/10/import", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w := s.serve(req)
+
+	var resp struct {
+		ImportedCount int `json:"imported_count"`
+		ErrorCount    int `json:"error_count"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != 200 || resp.ImportedCount != 1 || resp.ErrorCount != 1 {
+		t.Fatalf("匯入結果錯誤: %d %s", w.Code, w.Body.String())
+	}
+
+	var trades, fills int
+	s.db.QueryRow("SELECT COUNT(*) FROM trades WHERE account_id = 10").Scan(&trades)
+	s.db.QueryRow("SELECT COUNT(*) FROM trade_executions e JOIN trades t ON e.trade_id = t.id WHERE t.ticket = '1001'").Scan(&fills)
+	if trades != 1 || fills != 2 {
+		t.Fatalf("應只留下 1001 與其 2 筆成交，得到 %d 筆交易、%d 筆成交", trades, fills)
+	}
+}
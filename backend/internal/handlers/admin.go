@@ -5,6 +5,10 @@ import (
 	"net/http"
 	"time"
 
+	"trade-journal/internal/database"
+	"trade-journal/internal/images"
+	"trade-journal/internal/minio"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -37,12 +41,6 @@ func GetSystemUsageStat(db *sql.DB) gin.HandlerFunc {
 				a.name as account_name,
 				(
 					SELECT COALESCE(SUM(
-						LENGTH(COALESCE(entry_strategy_image, '')) +
-						LENGTH(COALESCE(entry_strategy_image_original, '')) +
-						LENGTH(COALESCE(legend_king_image, '')) +
-						LENGTH(COALESCE(legend_king_image_original, '')) +
-						LENGTH(COALESCE(legend_htf_image, '')) +
-						LENGTH(COALESCE(legend_htf_image_original, '')) +
 						LENGTH(COALESCE(entry_signals, '')) +
 						LENGTH(COALESCE(entry_checklist, '')) +
 						LENGTH(COALESCE(trend_analysis, '')) +
@@ -50,20 +48,16 @@ func GetSystemUsageStat(db *sql.DB) gin.HandlerFunc {
 						LENGTH(COALESCE(entry_reason, '')) +
 						LENGTH(COALESCE(exit_reason, ''))
 					), 0) FROM trades WHERE account_id = a.id
-				) + (
-					SELECT COALESCE(SUM(LENGTH(COALESCE(image_path, ''))), 0) 
-					FROM trade_images 
-					WHERE trade_id IN (SELECT id FROM trades WHERE account_id = a.id)
 				) + (
 					SELECT COALESCE(SUM(
 						LENGTH(COALESCE(notes, '')) +
 						LENGTH(COALESCE(trend_analysis, ''))
 					), 0) FROM daily_plans WHERE account_id = a.id
 				) AS storage_usage,
-				(SELECT COUNT(*) FROM trades t WHERE t.account_id = a.id) as trade_count,
-				(SELECT MAX(entry_time) FROM trades t WHERE t.account_id = a.id) as last_trade_time,
-				(SELECT COUNT(*) FROM daily_plans dp WHERE dp.account_id = a.id) as plan_count,
-				(SELECT MAX(plan_date) FROM daily_plans dp WHERE dp.account_id = a.id) as last_plan_date
+				(SELECT COUNT(*) FROM trades t WHERE t.account_id = a.id AND t.deleted_at IS NULL) as trade_count,
+				(SELECT MAX(entry_time) FROM trades t WHERE t.account_id = a.id AND t.deleted_at IS NULL) as last_trade_time,
+				(SELECT COUNT(*) FROM daily_plans dp WHERE dp.account_id = a.id AND dp.deleted_at IS NULL) as plan_count,
+				(SELECT MAX(plan_date) FROM daily_plans dp WHERE dp.account_id = a.id AND dp.deleted_at IS NULL) as last_plan_date
 			FROM users u
 			LEFT JOIN accounts a ON u.id = a.user_id
 			ORDER BY u.id, a.id;
@@ -149,11 +143,40 @@ func GetSystemUsageStat(db *sql.DB) gin.HandlerFunc {
 			}
 		}
 
+		rows.Close()
+
+		// 圖片存放在 MinIO，依物件實際大小計算
+		usage, err := images.Usage(c.Request.Context(), db, minio.GlobalClient, "1 = 1")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "查詢失敗: " + err.Error()})
+			return
+		}
+
 		result := make([]AdminUserUsage, 0, len(userOrder))
 		for _, uid := range userOrder {
-			result = append(result, *userMap[uid])
+			u := *userMap[uid]
+			for i := range u.Accounts {
+				u.Accounts[i].StorageUsage += usage[*u.Accounts[i].AccountID]
+			}
+			result = append(result, u)
 		}
 
 		c.JSON(http.StatusOK, result)
 	}
 }
+
+// GetMigrationStatus 取得資料庫遷移狀態
+func GetMigrationStatus(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		status, err := database.GetMigrationStatus(db)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "查詢失敗: " + err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"migrations": status,
+			"healthy":    database.CheckMigrations(db, true) == nil,
+		})
+	}
+}
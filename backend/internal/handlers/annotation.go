@@ -0,0 +1,297 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"image/png"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"trade-journal/internal/annotations"
+	"trade-journal/internal/gallery"
+	"trade-journal/internal/images"
+	"trade-journal/internal/minio"
+	"trade-journal/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// tradeImage 解析 :id 與 :imageId 並檢查存取權限
+// 交易擁有者與透過指定分享取得交易的使用者 (例如導師) 皆可存取，owner 表示是否為擁有者
+func tradeImage(c *gin.Context, db *sql.DB) (img models.Image, owner bool, ok bool) {
+	userID := c.GetInt64("user_id")
+	tradeID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "無效的交易 ID"})
+		return img, false, false
+	}
+	imageID, err := strconv.ParseInt(c.Param("imageId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "無效的圖片 ID"})
+		return img, false, false
+	}
+
+	var ownerID int64
+	err = db.QueryRow("SELECT a.user_id FROM trades t JOIN accounts a ON t.account_id = a.id WHERE t.id = ? AND t.deleted_at IS NULL AND a.deleted_at IS NULL", tradeID).Scan(&ownerID)
+	if err == nil && ownerID != userID {
+		var shared int
+		db.QueryRow(`
+			SELECT 1 FROM shares s JOIN share_users su ON su.share_id = s.id
+			WHERE s.resource_type = 'trade' AND s.resource_id = ? AND su.shared_with_user_id = ?
+		`, tradeID, userID).Scan(&shared)
+		if shared == 0 {
+			err = sql.ErrNoRows
+		}
+	}
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "交易紀錄不存在"})
+		return img, false, false
+	}
+
+	img, err = gallery.Get(db, tradeID, imageID)
+	if err != nil {
+		galleryError(c, err)
+		return img, false, false
+	}
+	return img, ownerID == userID, true
+}
+
+// GetImageAnnotations 取得圖片的標註圖層
+func GetImageAnnotations(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		img, _, ok := tradeImage(c, db)
+		if !ok {
+			return
+		}
+		list, err := annotations.List(db, img.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if list == nil {
+			list = []models.AnnotationLayer{}
+		}
+		c.JSON(http.StatusOK, list)
+	}
+}
+
+// CreateImageAnnotation 在圖片上新增目前使用者的標註圖層，不需重新上傳原圖
+func CreateImageAnnotation(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		img, _, ok := tradeImage(c, db)
+		if !ok {
+			return
+		}
+		var req models.AnnotationLayerCreate
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if strings.TrimSpace(req.Name) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "請提供圖層名稱"})
+			return
+		}
+		if err := annotations.Validate(req.Shapes); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		id, err := annotations.Create(db, img.ID, c.GetInt64("user_id"), req)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		layer, err := annotations.Get(db, img.ID, id)
+		if err != nil {
+			annotationError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, layer)
+	}
+}
+
+// imageLayer 取得 :layerId 指定的圖層
+func imageLayer(c *gin.Context, db *sql.DB, imageID int64) (models.AnnotationLayer, bool) {
+	layerID, err := strconv.ParseInt(c.Param("layerId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "無效的圖層 ID"})
+		return models.AnnotationLayer{}, false
+	}
+	layer, err := annotations.Get(db, imageID, layerID)
+	if err != nil {
+		annotationError(c, err)
+		return layer, false
+	}
+	return layer, true
+}
+
+// UpdateImageAnnotation 修改標註圖層，只有圖層作者可以修改
+func UpdateImageAnnotation(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		img, _, ok := tradeImage(c, db)
+		if !ok {
+			return
+		}
+		layer, ok := imageLayer(c, db, img.ID)
+		if !ok {
+			return
+		}
+		if layer.UserID != c.GetInt64("user_id") {
+			c.JSON(http.StatusForbidden, gin.H{"error": "只能修改自己的標註圖層"})
+			return
+		}
+		var req models.AnnotationLayerUpdate
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if req.Name != nil && strings.TrimSpace(*req.Name) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "請提供圖層名稱"})
+			return
+		}
+		if req.Shapes != nil {
+			if err := annotations.Validate(*req.Shapes); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		if err := annotations.Update(db, img.ID, layer.ID, req); err != nil {
+			annotationError(c, err)
+			return
+		}
+		layer, err := annotations.Get(db, img.ID, layer.ID)
+		if err != nil {
+			annotationError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, layer)
+	}
+}
+
+// DeleteImageAnnotation 刪除標註圖層，圖層作者與交易擁有者可以刪除
+func DeleteImageAnnotation(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		img, owner, ok := tradeImage(c, db)
+		if !ok {
+			return
+		}
+		layer, ok := imageLayer(c, db, img.ID)
+		if !ok {
+			return
+		}
+		if !owner && layer.UserID != c.GetInt64("user_id") {
+			c.JSON(http.StatusForbidden, gin.H{"error": "只能刪除自己的標註圖層"})
+			return
+		}
+		if err := annotations.Delete(db, img.ID, layer.ID); err != nil {
+			annotationError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "標註圖層刪除成功"})
+	}
+}
+
+// RenderTradeImage 將標註圖層疊加到原圖後輸出 PNG，供匯出使用
+// 預設繪製所有可見的圖層，layers=1,2 可指定要繪製的圖層 (包含隱藏的圖層)
+func RenderTradeImage(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		img, _, ok := tradeImage(c, db)
+		if !ok {
+			return
+		}
+		layers, err := annotations.List(db, img.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if v := c.Query("layers"); v != "" {
+			selected := map[int64]bool{}
+			for _, s := range strings.Split(v, ",") {
+				id, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "無效的圖層 ID"})
+					return
+				}
+				selected[id] = true
+			}
+			for i := range layers {
+				layers[i].Visible = selected[layers[i].ID]
+			}
+		}
+		renderImage(c, img, layers)
+	}
+}
+
+// RenderSharedImage 透過公開分享 Token 取得疊加可見圖層後的圖片 (免登入)
+func RenderSharedImage(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var tradeID int64
+		// 交易移到垃圾桶後，公開連結也不再提供圖片
+		err := db.QueryRow(`
+			SELECT s.resource_id FROM shares s
+			JOIN trades t ON t.id = s.resource_id
+			JOIN accounts a ON t.account_id = a.id
+			WHERE s.token = ? AND s.share_type = 'public' AND s.resource_type = 'trade'
+			  AND t.deleted_at IS NULL AND a.deleted_at IS NULL
+		`, c.Param("token")).Scan(&tradeID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "找不到此分享連結或已失效"})
+			return
+		}
+		imageID, err := strconv.ParseInt(c.Param("imageId"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "無效的圖片 ID"})
+			return
+		}
+		img, err := gallery.Get(db, tradeID, imageID)
+		if err != nil {
+			galleryError(c, err)
+			return
+		}
+		layers, err := annotations.List(db, img.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		renderImage(c, img, layers)
+	}
+}
+
+// renderImage 讀取原圖並疊加圖層，以 PNG 回應
+func renderImage(c *gin.Context, img models.Image, layers []models.AnnotationLayer) {
+	data, err := images.Read(context.Background(), minio.GlobalClient, img.ImagePath)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "圖片不存在"})
+		return
+	}
+	src, err := images.Decode(data)
+	if errors.Is(err, images.ErrTooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "不支援的圖片格式，僅支援 PNG、JPEG 與 GIF"})
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, annotations.Render(src, layers)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	// 圖層可隨時修改，不使用長期快取
+	c.Header("Cache-Control", "no-cache")
+	c.Data(http.StatusOK, "image/png", buf.Bytes())
+}
+
+func annotationError(c *gin.Context, err error) {
+	if err == annotations.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"testing"
+)
+
+func TestRenderSharedImage(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatal(err)
+	}
+	small := "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())
+	// 宣告 60000x60000 的 PNG，不應完整解碼
+	huge := buf.Bytes()
+	binary.BigEndian.PutUint32(huge[16:], 60000)
+	binary.BigEndian.PutUint32(huge[20:], 60000)
+	binary.BigEndian.PutUint32(huge[29:], crc32.ChecksumIEEE(huge[12:29]))
+	hugeURL := "data:image/png;base64," + base64.StdEncoding.EncodeToString(huge)
+
+	s := newTestServer(t,
+		"INSERT INTO users (id, username, password) VALUES (1, 'alice', 'x')",
+		"INSERT INTO accounts (id, user_id, name) VALUES (10, 1, 'main')",
+		"INSERT INTO trades (id, account_id, symbol, side, entry_time) VALUES (101, 10, 'XAUUSD', 'long', '2024-05-01 08:00:00')",
+		"INSERT INTO shares (user_id, resource_type, resource_id, share_type, token) VALUES (1, 'trade', 101, 'public', 'tok')",
+	)
+	if _, err := s.db.Exec("INSERT INTO trade_images (id, trade_id, image_type, image_path) VALUES (1, 101, 'entry', ?), (2, 101, 'entry', ?)", small, hugeURL); err != nil {
+		t.Fatal(err)
+	}
+
+	s.GET("/shares/public/:token/images/:imageId/render", RenderSharedImage(s.db))
+	get := func(url string) int {
+		t.Helper()
+		return s.do("GET", url, "", nil)
+	}
+
+	if code := get("/shares/public/tok/images/1/render"); code != 200 {
+		t.Fatalf("分享的圖片應可取得，得到 %d", code)
+	}
+	if code := get("/shares/public/tok/images/2/render"); code != 413 {
+		t.Fatalf("尺寸過大的圖片應回傳 413，得到 %d", code)
+	}
+	if _, err := s.db.Exec("UPDATE trades SET deleted_at = CURRENT_TIMESTAMP WHERE id = 101"); err != nil {
+		t.Fatal(err)
+	}
+	if code := get("/shares/public/tok/images/1/render"); code != 404 {
+		t.Fatalf("交易移到垃圾桶後應回傳 404，得到 %d", code)
+	}
+}
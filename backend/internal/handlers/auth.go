@@ -5,6 +5,7 @@ import (
 	"log"
 	"net/http"
 	"strings"
+	"trade-journal/internal/database"
 	"trade-journal/internal/models"
 	"trade-journal/internal/utils"
 
@@ -31,7 +32,7 @@ func Register(db *sql.DB) gin.HandlerFunc {
 		db.QueryRow("SELECT COUNT(*) FROM users").Scan(&count)
 		isAdmin := count == 0
 
-		res, err := db.Exec(
+		userID, err := database.InsertID(db,
 			"INSERT INTO users (username, password, is_admin) VALUES (?, ?, ?)",
 			req.Username, hashedPassword, isAdmin,
 		)
@@ -40,7 +41,10 @@ func Register(db *sql.DB) gin.HandlerFunc {
 			return
 		}
 
-		userID, _ := res.LastInsertId()
+		// 建立內建的達人、菁英、傳奇策略，使用者可再自行修改或新增
+		if err := database.SeedDefaultStrategies(db, userID); err != nil {
+			log.Printf("[Auth] 建立預設策略失敗: %v", err)
+		}
 
 		// 為新使用者建立預設帳號 (已移除，改由前端引導使用者手動建立)
 		// db.Exec("INSERT INTO accounts (name, type, user_id) VALUES (?, ?, ?)", "預設帳號", "local", userID)
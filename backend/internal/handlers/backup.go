@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"trade-journal/internal/backup"
+
+	"github.com/gin-gonic/gin"
+	miniogo "github.com/minio/minio-go/v7"
+)
+
+// ExportUserBackup 下載目前使用者的備份檔
+func ExportUserBackup(db *sql.DB, client *miniogo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetInt64("user_id")
+		streamBackup(c, db, client, userID, fmt.Sprintf("trade-journal-%s", c.GetString("username")))
+	}
+}
+
+// ExportFullBackup 下載整個系統的備份檔 (管理員)
+func ExportFullBackup(db *sql.DB, client *miniogo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		streamBackup(c, db, client, 0, "trade-journal-full")
+	}
+}
+
+func streamBackup(c *gin.Context, db *sql.DB, client *miniogo.Client, userID int64, name string) {
+	fileName := fmt.Sprintf("%s-%s.tar.gz", name, time.Now().Format("20060102-150405"))
+	c.Header("Content-Type", "application/gzip")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fileName))
+
+	if err := backup.Export(c.Request.Context(), db, client, userID, c.Writer); err != nil {
+		// 已開始傳送內容時無法再改回應狀態，只能記錄錯誤
+		if c.Writer.Written() {
+			log.Printf("[Backup] 備份傳送中斷: %v", err)
+			return
+		}
+		c.Header("Content-Disposition", "")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "備份失敗: " + err.Error()})
+	}
+}
+
+// RestoreUserBackup 將使用者備份匯入目前使用者
+func RestoreUserBackup(db *sql.DB, client *miniogo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		restoreBackup(c, db, client, backup.Target{UserID: c.GetInt64("user_id")})
+	}
+}
+
+// RestoreFullBackup 還原備份 (管理員)
+// 完整備份會建立其中的所有使用者；使用者備份需以 user_id 指定匯入對象
+func RestoreFullBackup(db *sql.DB, client *miniogo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		target := backup.Target{AllowFull: true}
+		if v := c.Query("user_id"); v != "" {
+			userID, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "無效的使用者 ID"})
+				return
+			}
+			var exists int
+			db.QueryRow("SELECT 1 FROM users WHERE id = ?", userID).Scan(&exists)
+			if exists == 0 {
+				c.JSON(http.StatusNotFound, gin.H{"error": "找不到使用者"})
+				return
+			}
+			target.UserID = userID
+		}
+		restoreBackup(c, db, client, target)
+	}
+}
+
+func restoreBackup(c *gin.Context, db *sql.DB, client *miniogo.Client, target backup.Target) {
+	file, _, err := c.Request.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "請選擇備份檔案"})
+		return
+	}
+	defer file.Close()
+
+	report, err := backup.Restore(c.Request.Context(), db, client, file, target)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "還原失敗: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "還原完成", "report": report})
+}
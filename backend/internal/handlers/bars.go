@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"trade-journal/internal/bars"
+	"trade-journal/internal/excursions"
+	"trade-journal/internal/instruments"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultBarLimit = 5000
+	maxBarLimit     = 50000
+)
+
+// barSeriesParams 解析品種與週期參數，品種依使用者的別名轉為標準名稱
+func barSeriesParams(db *sql.DB, userID int64, symbol, timeframe string) (string, string, error) {
+	if strings.TrimSpace(symbol) == "" {
+		return "", "", fmt.Errorf("請指定品種")
+	}
+	tf, err := bars.NormalizeTimeframe(timeframe)
+	if err != nil {
+		return "", "", err
+	}
+	symbol, err = instruments.Canonical(db, userID, symbol)
+	if err != nil {
+		return "", "", err
+	}
+	return symbol, tf, nil
+}
+
+// barRange 解析 from / to 參數，只有日期的 to 包含當天所有 K 線
+func barRange(c *gin.Context) (time.Time, time.Time, error) {
+	var from, to time.Time
+	var err error
+	if s := c.Query("from"); s != "" {
+		if from, err = bars.ParseTime(s, 0); err != nil {
+			return from, to, err
+		}
+	}
+	if s := c.Query("to"); s != "" {
+		if to, err = bars.ParseTime(s, 0); err != nil {
+			return from, to, err
+		}
+		if len(strings.TrimSpace(s)) == len("2006-01-02") {
+			to = to.Add(24*time.Hour - time.Second)
+		}
+	}
+	if !from.IsZero() && !to.IsZero() && to.Before(from) {
+		return from, to, fmt.Errorf("to 不可早於 from")
+	}
+	return from, to, nil
+}
+
+// GetBars 取得品種與週期在時間範圍內的 K 線，依時間排序
+func GetBars(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetInt64("user_id")
+		symbol, tf, err := barSeriesParams(db, userID, c.Query("symbol"), c.Query("tf"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		from, to, err := barRange(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		limit := defaultBarLimit
+		if s := c.Query("limit"); s != "" {
+			if limit, err = strconv.Atoi(s); err != nil || limit <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "無效的 limit"})
+				return
+			}
+			if limit > maxBarLimit {
+				limit = maxBarLimit
+			}
+		}
+
+		list, err := bars.Range(db, userID, symbol, tf, from, to, limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"symbol": symbol, "timeframe": tf, "bars": list})
+	}
+}
+
+// GetBarSeries 列出已匯入的品種與週期
+func GetBarSeries(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		list, err := bars.Series(db, c.GetInt64("user_id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, list)
+	}
+}
+
+// ImportBars 從 MT5 / cTrader 匯出的 CSV 匯入 K 線，整份檔案在同一個交易中寫入
+// 未指定品種與週期時依 MT5 的預設檔名推測，tz_offset 為檔案時間的 UTC 偏移 (小時)
+// 匯入後重新計算該品種已平倉交易的 MAE / MFE
+func ImportBars(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetInt64("user_id")
+		file, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "請上傳檔案"})
+			return
+		}
+
+		symbol, tf := c.PostForm("symbol"), c.PostForm("tf")
+		guessSymbol, guessTF := bars.ParseFilename(file.Filename)
+		if symbol == "" {
+			symbol = guessSymbol
+		}
+		if tf == "" {
+			tf = guessTF
+		}
+		symbol, tf, err = barSeriesParams(db, userID, symbol, tf)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var offset time.Duration
+		if s := c.PostForm("tz_offset"); s != "" {
+			hours, err := strconv.ParseFloat(s, 64)
+			if err != nil || hours < -14 || hours > 14 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "無效的 tz_offset"})
+				return
+			}
+			offset = time.Duration(hours * float64(time.Hour))
+		}
+
+		f, err := file.Open()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "無法讀取檔案"})
+			return
+		}
+		defer f.Close()
+
+		tx, err := db.Begin()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer tx.Rollback()
+
+		result, err := bars.ImportCSV(tx, userID, symbol, tf, f, offset)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if result.TradesUpdated, err = excursions.RecalculateSymbol(tx, userID, symbol); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// DeleteBars 刪除品種與週期的 K 線，可用 from / to 限制範圍，並重新計算該品種交易的 MAE / MFE
+func DeleteBars(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetInt64("user_id")
+		symbol, tf, err := barSeriesParams(db, userID, c.Query("symbol"), c.Query("tf"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		from, to, err := barRange(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		tx, err := db.Begin()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer tx.Rollback()
+
+		n, err := bars.Delete(tx, userID, symbol, tf, from, to)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		updated, err := excursions.RecalculateSymbol(tx, userID, symbol)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"deleted": n, "trades_updated": updated})
+	}
+}
@@ -0,0 +1,267 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"trade-journal/internal/audit"
+	"trade-journal/internal/database"
+	"trade-journal/internal/models"
+	"trade-journal/internal/reviews"
+	"trade-journal/internal/strategies"
+	"trade-journal/internal/trash"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxBulkTrades 單次批次操作的交易數上限
+const maxBulkTrades = 1000
+
+// 批次操作的單筆結果
+const (
+	bulkUpdated   = "updated"
+	bulkUnchanged = "unchanged"
+	bulkDeleted   = "deleted"
+	bulkNotFound  = "not_found"
+)
+
+// BulkTrades 批次修改欄位、增減標籤或刪除交易，全部在同一個交易中完成
+func BulkTrades(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetInt64("user_id")
+		var req models.TradeBulkRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		sets, setArgs := bulkSetColumns(req.Set)
+		strategySets, strategyArgs, err := bulkStrategyColumns(db, userID, req.Set)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		sets, setArgs = append(sets, strategySets...), append(setArgs, strategyArgs...)
+		addTags, removeTags := cleanTagNames(req.AddTags), cleanTagNames(req.RemoveTags)
+		if req.Action == "update" && len(sets) == 0 && len(addTags) == 0 && len(removeTags) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "請提供要修改的欄位或標籤"})
+			return
+		}
+
+		ids, status, err := bulkTargets(db, userID, req)
+		if err != nil {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer tx.Rollback()
+
+		batch := trash.NewBatch()
+		results := make([]models.TradeBulkResult, 0, len(ids))
+		counts := map[string]int{}
+		for _, id := range ids {
+			result := models.TradeBulkResult{ID: id, Status: bulkNotFound}
+
+			// 逐筆檢查所屬權，不屬於使用者或已刪除的交易不處理
+			var exists int
+			tx.QueryRow("SELECT 1 FROM trades t JOIN accounts a ON t.account_id = a.id WHERE t.id = ? AND a.user_id = ? AND t.deleted_at IS NULL AND a.deleted_at IS NULL", id, userID).Scan(&exists)
+			if exists == 1 {
+				if req.Action == "delete" {
+					_, err = tx.Exec("UPDATE trades SET deleted_at = CURRENT_TIMESTAMP, delete_batch = ? WHERE id = ?", batch, id)
+					result.Status = bulkDeleted
+				} else {
+					result.Status, err = bulkUpdate(tx, userID, id, sets, setArgs, addTags, removeTags)
+				}
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("交易 %d: %v", id, err)})
+					return
+				}
+			}
+			counts[result.Status]++
+			results = append(results, result)
+		}
+
+		if req.Action == "delete" {
+			if err := audit.RecordBatchDelete(tx, batch, userID, audit.SourceAPI); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "批次操作完成", "results": results, "summary": counts})
+	}
+}
+
+// bulkTargets 取得要處理的交易 ID，filter 只會找出使用者自己的交易
+func bulkTargets(db *sql.DB, userID int64, req models.TradeBulkRequest) ([]int64, int, error) {
+	if (len(req.TradeIDs) > 0) == (req.Filter != nil) {
+		return nil, http.StatusBadRequest, fmt.Errorf("trade_ids 與 filter 必須擇一提供")
+	}
+
+	var ids []int64
+	if req.Filter != nil {
+		if req.Filter.AccountID <= 0 {
+			return nil, http.StatusBadRequest, fmt.Errorf("filter 必須指定 account_id")
+		}
+		where, args := tradeFilter(*req.Filter)
+		rows, err := db.Query(`SELECT t.id FROM trades t JOIN accounts a ON t.account_id = a.id
+			WHERE a.user_id = ? AND t.deleted_at IS NULL AND a.deleted_at IS NULL`+where+" ORDER BY t.entry_time, t.id", append([]interface{}{userID}, args...)...)
+		if err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				return nil, http.StatusInternalServerError, err
+			}
+			ids = append(ids, id)
+		}
+		if err := rows.Err(); err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+	} else {
+		seen := make(map[int64]bool)
+		for _, id := range req.TradeIDs {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	if len(ids) > maxBulkTrades {
+		return nil, http.StatusBadRequest, fmt.Errorf("單次最多處理 %d 筆交易，目前為 %d 筆", maxBulkTrades, len(ids))
+	}
+	return ids, http.StatusOK, nil
+}
+
+// bulkSetColumns 將要設定的欄位轉為 UPDATE 的 SET 子句
+func bulkSetColumns(set models.TradeBulkSet) ([]string, []interface{}) {
+	var cols []string
+	var args []interface{}
+	for _, f := range []struct {
+		column string
+		value  *string
+	}{
+		{"trade_type", set.TradeType},
+		{"entry_pattern", set.EntryPattern},
+		{"entry_timeframe", set.EntryTimeframe},
+		{"trend_type", set.TrendType},
+		{"market_session", set.MarketSession},
+		{"color_tag", set.ColorTag},
+	} {
+		if f.value != nil {
+			cols = append(cols, f.column+" = ?")
+			args = append(args, *f.value)
+		}
+	}
+	if set.ReviewStatus != nil {
+		statusCols, statusArgs := reviews.StatusColumns(*set.ReviewStatus)
+		cols, args = append(cols, statusCols...), append(args, statusArgs...)
+	}
+	return cols, args
+}
+
+// bulkStrategyColumns 策略與 entry_strategy 需一起修改，讓交易對應到相同的策略定義
+// 換到不同策略的交易會清除訊號與檢查清單，避免留下舊策略的項目；批次修改不檢查策略的必填圖片
+func bulkStrategyColumns(db *sql.DB, userID int64, set models.TradeBulkSet) ([]string, []interface{}, error) {
+	if set.StrategyID == nil && set.EntryStrategy == nil {
+		return nil, nil, nil
+	}
+	var entryStrategy string
+	if set.EntryStrategy != nil {
+		entryStrategy = *set.EntryStrategy
+	}
+	s, key, err := strategies.Lookup(db, userID, set.StrategyID, entryStrategy)
+	if err != nil {
+		return nil, nil, err
+	}
+	var strategyID interface{}
+	var sameID int64
+	if s != nil {
+		strategyID, sameID = s.ID, s.ID
+	}
+	same := "COALESCE(strategy_id, 0) = ? AND COALESCE(entry_strategy, '') = ?"
+	cols := []string{
+		"strategy_id = ?",
+		"entry_strategy = ?",
+		"entry_signals = CASE WHEN " + same + " THEN entry_signals ELSE NULL END",
+		"entry_checklist = CASE WHEN " + same + " THEN entry_checklist ELSE NULL END",
+	}
+	return cols, []interface{}{strategyID, key, sameID, key, sameID, key}, nil
+}
+
+// bulkUpdate 修改單筆交易並記錄異動，回傳 updated 或 unchanged
+func bulkUpdate(tx *sql.Tx, userID, tradeID int64, sets []string, setArgs []interface{}, addTags, removeTags []string) (string, error) {
+	before, err := audit.Snapshot(tx, tradeID)
+	if err != nil {
+		return "", err
+	}
+
+	if len(sets) > 0 {
+		args := append(append([]interface{}{}, setArgs...), tradeID)
+		if _, err := tx.Exec("UPDATE trades SET "+strings.Join(sets, ", ")+", updated_at = CURRENT_TIMESTAMP WHERE id = ?", args...); err != nil {
+			return "", err
+		}
+	}
+	for _, name := range addTags {
+		tagID, err := ensureTag(tx, userID, name)
+		if err != nil {
+			return "", err
+		}
+		if _, err := tx.Exec("INSERT INTO trade_tags (trade_id, tag_id) SELECT ?, ? WHERE NOT EXISTS (SELECT 1 FROM trade_tags WHERE trade_id = ? AND tag_id = ?)", tradeID, tagID, tradeID, tagID); err != nil {
+			return "", err
+		}
+	}
+	for _, name := range removeTags {
+		if _, err := tx.Exec("DELETE FROM trade_tags WHERE trade_id = ? AND tag_id IN (SELECT id FROM tags WHERE user_id = ? AND name = ?)", tradeID, userID, name); err != nil {
+			return "", err
+		}
+	}
+
+	after, err := audit.Snapshot(tx, tradeID)
+	if err != nil {
+		return "", err
+	}
+	if len(audit.Diff(before, after)) == 0 {
+		return bulkUnchanged, nil
+	}
+	return bulkUpdated, audit.Record(tx, tradeID, userID, audit.ActionUpdate, audit.SourceAPI, before, after)
+}
+
+// ensureTag 取得使用者的標籤 ID，不存在時建立
+func ensureTag(q database.Querier, userID int64, name string) (int64, error) {
+	var tagID int64
+	err := q.QueryRow("SELECT id FROM tags WHERE name = ? AND user_id = ?", name, userID).Scan(&tagID)
+	if err == sql.ErrNoRows {
+		return database.InsertID(q, "INSERT INTO tags (name, user_id) VALUES (?, ?)", name, userID)
+	}
+	return tagID, err
+}
+
+// cleanTagNames 去除空白與重複的標籤名稱
+func cleanTagNames(names []string) []string {
+	var out []string
+	seen := make(map[string]bool)
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name != "" && !seen[name] {
+			seen[name] = true
+			out = append(out, name)
+		}
+	}
+	return out
+}
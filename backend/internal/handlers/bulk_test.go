@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"database/sql"
+	"testing"
+
+	"trade-journal/internal/models"
+)
+
+func TestBulkTrades(t *testing.T) {
+	s := newTestServer(t,
+		"INSERT INTO users (id, username, password) VALUES (1, 'alice', 'x'), (2, 'bob', 'x')",
+		"INSERT INTO accounts (id, user_id, name) VALUES (10, 1, 'main'), (20, 2, 'bob')",
+		`INSERT INTO trades (id, account_id, symbol, side, entry_time, entry_strategy, entry_signals, entry_checklist) VALUES
+			(101, 10, 'XAUUSD', 'long', '2024-05-01 08:00:00', 'expert', '["雙柱"]', NULL),
+			(102, 10, 'XAUUSD', 'long', '2024-05-02 08:00:00', 'elite', NULL, '{"trend_line": true}'),
+			(103, 10, 'EURUSD', 'long', '2024-05-03 08:00:00', NULL, NULL, NULL),
+			(201, 20, 'XAUUSD', 'long', '2024-05-01 08:00:00', NULL, NULL, NULL)`,
+		// 模擬批次中途失敗
+		"CREATE TRIGGER fail_bulk BEFORE UPDATE ON trades WHEN NEW.id = 102 AND NEW.color_tag = 'red' BEGIN SELECT RAISE(ABORT, 'boom'); END",
+	)
+	s.POST("/trades/bulk", BulkTrades(s.db))
+
+	type bulkResponse struct {
+		Results []models.TradeBulkResult `json:"results"`
+		Summary map[string]int           `json:"summary"`
+	}
+	do := func(body string) (int, bulkResponse) {
+		t.Helper()
+		var resp bulkResponse
+		code := s.do("POST", "/trades/bulk", body, &resp)
+		return code, resp
+	}
+	column := func(id int64, col string) sql.NullString {
+		t.Helper()
+		var v sql.NullString
+		if err := s.db.QueryRow("SELECT "+col+" FROM trades WHERE id = ?", id).Scan(&v); err != nil {
+			t.Fatalf("查詢交易 %d 失敗: %v", id, err)
+		}
+		return v
+	}
+
+	// 其他使用者的交易不處理
+	code, resp := do(`{"action": "update", "trade_ids": [101, 201], "set": {"color_tag": "green"}}`)
+	if code != 200 || resp.Summary[bulkUpdated] != 1 || resp.Summary[bulkNotFound] != 1 {
+		t.Fatalf("批次結果錯誤: %d %+v", code, resp)
+	}
+	if v := column(201, "color_tag"); v.Valid {
+		t.Fatalf("其他使用者的交易被修改: %v", v.String)
+	}
+	if v := column(101, "color_tag"); v.String != "green" {
+		t.Fatalf("color_tag 應為 green，得到 %q", v.String)
+	}
+
+	// 不合法的顏色
+	if code, _ := do(`{"action": "update", "trade_ids": [101], "set": {"color_tag": "blue"}}`); code != 400 {
+		t.Fatalf("不合法的顏色應回傳 400，得到 %d", code)
+	}
+
+	// 空字串清除顏色標籤
+	if code, resp := do(`{"action": "update", "trade_ids": [103], "set": {"color_tag": "yellow"}}`); code != 200 {
+		t.Fatalf("批次修改失敗: %d %+v", code, resp)
+	}
+	if code, resp := do(`{"action": "update", "trade_ids": [103], "set": {"color_tag": ""}}`); code != 200 || resp.Summary[bulkUpdated] != 1 {
+		t.Fatalf("清除顏色標籤失敗: %d %+v", code, resp)
+	}
+	if v := column(103, "color_tag"); v.String != "" {
+		t.Fatalf("color_tag 應已清除，得到 %q", v.String)
+	}
+
+	// 依篩選條件選取
+	code, resp = do(`{"action": "update", "filter": {"account_id": 10, "symbol": "XAUUSD"}, "set": {"trade_type": "observation"}}`)
+	if code != 200 || len(resp.Results) != 2 || resp.Results[0].ID != 101 || resp.Results[1].ID != 102 {
+		t.Fatalf("篩選結果錯誤: %d %+v", code, resp)
+	}
+	if v := column(103, "trade_type"); v.String == "observation" {
+		t.Fatal("不符合篩選條件的交易被修改")
+	}
+	if code, _ := do(`{"action": "update", "filter": {"symbol": "XAUUSD"}, "set": {"trade_type": "actual"}}`); code != 400 {
+		t.Fatalf("未指定 account_id 應回傳 400，得到 %d", code)
+	}
+
+	// 更換策略清除舊的訊號與檢查清單
+	if code, resp := do(`{"action": "update", "trade_ids": [101, 102], "set": {"entry_strategy": "elite"}}`); code != 200 {
+		t.Fatalf("批次修改失敗: %d %+v", code, resp)
+	}
+	if v := column(101, "entry_signals"); v.Valid {
+		t.Fatalf("換策略後應清除訊號，得到 %q", v.String)
+	}
+	if v := column(102, "entry_checklist"); v.String != `{"trend_line": true}` {
+		t.Fatalf("策略未變更的檢查清單不應清除，得到 %q", v.String)
+	}
+
+	// 中途失敗整批回復
+	if code, _ := do(`{"action": "update", "trade_ids": [101, 102], "set": {"color_tag": "red"}}`); code != 500 {
+		t.Fatalf("應回傳 500，得到 %d", code)
+	}
+	if v := column(101, "color_tag"); v.String != "green" {
+		t.Fatalf("失敗時已處理的交易應回復，得到 %q", v.String)
+	}
+}
@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"trade-journal/internal/fx"
+	"trade-journal/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetFXRates 取得使用者的匯率，可用 base / quote 篩選
+func GetFXRates(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		list, err := fx.List(db, c.GetInt64("user_id"), c.Query("base"), c.Query("quote"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, list)
+	}
+}
+
+// SaveFXRate 新增匯率，同一貨幣對同一天已有匯率時覆寫
+func SaveFXRate(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.FXRateCreate
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		req, err := fx.Validate(req)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		created, err := fx.Save(db, c.GetInt64("user_id"), req)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if created {
+			c.JSON(http.StatusCreated, gin.H{"message": "匯率新增成功"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "匯率更新成功"})
+	}
+}
+
+// DeleteFXRate 刪除匯率
+func DeleteFXRate(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "無效的匯率 ID"})
+			return
+		}
+		if err := fx.Delete(db, c.GetInt64("user_id"), id); err != nil {
+			if err == fx.ErrNotFound {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "匯率刪除成功"})
+	}
+}
+
+// ImportFXRates 從 CSV 匯入匯率，整份檔案在同一個交易中寫入
+func ImportFXRates(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		file, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "請上傳檔案"})
+			return
+		}
+		f, err := file.Open()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "無法讀取檔案"})
+			return
+		}
+		defer f.Close()
+
+		tx, err := db.Begin()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer tx.Rollback()
+
+		result, err := fx.ImportCSV(tx, c.GetInt64("user_id"), f)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// reportTrade 跨帳號報表使用的已平倉交易，金額為交易本身的幣別
+type reportTrade struct {
+	accountID       int64
+	accountName     string
+	accountCurrency string
+	currency        string // 盈虧幣別，未設定時為帳號的基礎幣別
+	symbol          string
+	closedAt        time.Time
+	lots            float64
+	gross           float64
+	commission      float64
+	swap            float64
+	fees            float64
+	pnl             float64
+}
+
+// loadReportTrades 取得符合篩選條件的已平倉交易
+func loadReportTrades(db *sql.DB, where string, args []interface{}) ([]reportTrade, error) {
+	rows, err := db.Query(`
+		SELECT t.account_id, a.name, a.currency, COALESCE(t.pnl_currency, a.currency), t.symbol, t.entry_time, t.exit_time,
+			   COALESCE(t.lot_size, 0), COALESCE(t.gross_pnl, t.pnl), COALESCE(t.commission, 0), COALESCE(t.swap, 0), COALESCE(t.fees, 0), t.pnl
+		FROM trades t
+		JOIN accounts a ON a.id = t.account_id
+		WHERE t.deleted_at IS NULL`+where+` AND t.exit_price IS NOT NULL AND t.pnl IS NOT NULL
+		ORDER BY t.exit_time ASC, t.id ASC
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []reportTrade{}
+	for rows.Next() {
+		var t reportTrade
+		var exitTime *time.Time
+		if err := rows.Scan(&t.accountID, &t.accountName, &t.accountCurrency, &t.currency, &t.symbol, &t.closedAt, &exitTime,
+			&t.lots, &t.gross, &t.commission, &t.swap, &t.fees, &t.pnl); err != nil {
+			return nil, err
+		}
+		// 沒有出場時間的交易以進場時間的匯率換算
+		if exitTime != nil {
+			t.closedAt = *exitTime
+		}
+		list = append(list, t)
+	}
+	return list, rows.Err()
+}
+
+// currencyConverter 將交易金額換算為報表幣別，並記錄缺少的匯率
+type currencyConverter struct {
+	currency string
+	rates    fx.Rates
+	missing  map[string]bool
+}
+
+// newCurrencyConverter 依 currency 參數決定報表幣別
+// 未指定時若所有交易的幣別相同則沿用，否則使用 USD；回傳 false 時已寫入錯誤回應
+func newCurrencyConverter(c *gin.Context, db *sql.DB, trades []reportTrade) (*currencyConverter, bool) {
+	currency := fx.DefaultCurrency
+	if len(trades) > 0 {
+		currency = trades[0].currency
+		for _, t := range trades[1:] {
+			if t.currency != currency {
+				currency = fx.DefaultCurrency
+				break
+			}
+		}
+	}
+	return loadConverter(c, db, currency)
+}
+
+// newAccountConverter 單一帳號的報表預設換算為帳號的基礎幣別，盈虧幣別不同的交易依匯率換算
+// 帳號需已由 statsFilter 檢查所屬權；回傳 false 時已寫入錯誤回應
+func newAccountConverter(c *gin.Context, db *sql.DB) (*currencyConverter, bool) {
+	var currency string
+	if err := db.QueryRow("SELECT currency FROM accounts WHERE id = ?", c.Query("account_id")).Scan(&currency); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return loadConverter(c, db, currency)
+}
+
+// loadConverter 以 currency 參數為報表幣別，未指定時使用 fallback
+func loadConverter(c *gin.Context, db *sql.DB, fallback string) (*currencyConverter, bool) {
+	currency := fallback
+	if q := c.Query("currency"); q != "" {
+		var err error
+		if currency, err = fx.NormalizeCurrency(q); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return nil, false
+		}
+	}
+
+	rates, err := fx.Load(db, c.GetInt64("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return &currencyConverter{currency: currency, rates: rates, missing: map[string]bool{}}, true
+}
+
+// rate 取得交易幣別換算為報表幣別的匯率，沒有匯率時記錄缺少的貨幣對
+func (cv *currencyConverter) rate(t reportTrade) (float64, bool) {
+	rate, ok := cv.rates.Rate(t.currency, cv.currency, t.closedAt)
+	if !ok {
+		cv.missing[t.currency+"/"+cv.currency] = true
+	}
+	return rate, ok
+}
+
+// missingRates 缺少匯率的貨幣對，依名稱排序
+func (cv *currencyConverter) missingRates() []string {
+	list := make([]string, 0, len(cv.missing))
+	for pair := range cv.missing {
+		list = append(list, pair)
+	}
+	sort.Strings(list)
+	return list
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"trade-journal/internal/customfields"
+	"trade-journal/internal/database"
+	"trade-journal/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetCustomFields 取得使用者的自訂欄位
+func GetCustomFields(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		list, err := customfields.List(db, c.GetInt64("user_id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, list)
+	}
+}
+
+// CreateCustomField 建立自訂欄位
+func CreateCustomField(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.CustomFieldCreate
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		options, err := customfields.Validate(req.Key, req.FieldType, req.Options)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		req.Options = options
+
+		id, err := customfields.Create(db, c.GetInt64("user_id"), req)
+		if err != nil {
+			customFieldError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"id": id, "message": "自訂欄位建立成功"})
+	}
+}
+
+// UpdateCustomField 更新自訂欄位的名稱、選項、必填與順序
+func UpdateCustomField(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetInt64("user_id")
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "無效的欄位 ID"})
+			return
+		}
+		var req models.CustomFieldUpdate
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		field, err := customfields.Get(db, userID, id)
+		if err != nil {
+			customFieldError(c, err)
+			return
+		}
+		options, err := customfields.Validate(field.Key, field.FieldType, req.Options)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		req.Options = options
+
+		if err := customfields.Update(db, userID, id, req); err != nil {
+			customFieldError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "自訂欄位更新成功"})
+	}
+}
+
+// DeleteCustomField 刪除自訂欄位，所有交易中的值一併刪除
+func DeleteCustomField(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "無效的欄位 ID"})
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer tx.Rollback()
+
+		if err := customfields.Delete(tx, c.GetInt64("user_id"), id); err != nil {
+			customFieldError(c, err)
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "自訂欄位刪除成功"})
+	}
+}
+
+func customFieldError(c *gin.Context, err error) {
+	switch {
+	case err == customfields.ErrNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case database.IsUniqueViolation(err):
+		c.JSON(http.StatusConflict, gin.H{"error": "欄位 key 已存在"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
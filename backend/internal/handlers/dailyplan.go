@@ -3,8 +3,14 @@ package handlers
 import (
 	"database/sql"
 	"net/http"
+	"strings"
 
+	"trade-journal/internal/audit"
+	"trade-journal/internal/dailyplans"
+	"trade-journal/internal/database"
+	"trade-journal/internal/instruments"
 	"trade-journal/internal/models"
+	"trade-journal/internal/trash"
 
 	"github.com/gin-gonic/gin"
 )
@@ -29,12 +35,22 @@ func GetDailyPlans(db *sql.DB) gin.HandlerFunc {
 
 		offset := (query.Page - 1) * query.PageSize
 
+		// 規劃的品種存成標準名稱，查詢條件同樣轉換 (GOLD -> XAUUSD)
+		if query.Symbol != "" {
+			symbol, err := instruments.Canonical(db, userID, query.Symbol)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			query.Symbol = symbol
+		}
+
 		// 建立查詢
 		sqlQuery := `
 			SELECT p.id, p.account_id, p.plan_date, p.symbol, p.market_session, COALESCE(p.notes, ''), COALESCE(p.trend_analysis, '{}'), p.created_at, p.updated_at
 			FROM daily_plans p
 			JOIN accounts a ON p.account_id = a.id
-			WHERE a.user_id = ?
+			WHERE a.user_id = ? AND p.deleted_at IS NULL AND a.deleted_at IS NULL
 		`
 
 		args := []interface{}{userID}
@@ -98,7 +114,7 @@ func GetDailyPlans(db *sql.DB) gin.HandlerFunc {
 
 		// 計算總數
 		var total int
-		countQuery := `SELECT COUNT(*) FROM daily_plans p JOIN accounts a ON p.account_id = a.id WHERE a.user_id = ?`
+		countQuery := `SELECT COUNT(*) FROM daily_plans p JOIN accounts a ON p.account_id = a.id WHERE a.user_id = ? AND p.deleted_at IS NULL AND a.deleted_at IS NULL`
 		countArgs := []interface{}{userID}
 
 		if query.AccountID > 0 {
@@ -148,7 +164,7 @@ func GetDailyPlan(db *sql.DB) gin.HandlerFunc {
 			SELECT p.id, p.account_id, p.plan_date, p.symbol, p.market_session, COALESCE(p.notes, ''), COALESCE(p.trend_analysis, '{}'), p.created_at, p.updated_at
 			FROM daily_plans p
 			JOIN accounts a ON p.account_id = a.id
-			WHERE p.id = ? AND a.user_id = ?
+			WHERE p.id = ? AND a.user_id = ? AND p.deleted_at IS NULL AND a.deleted_at IS NULL
 		`, id, userID).Scan(
 			&plan.ID, &plan.AccountID, &plan.PlanDate, &plan.Symbol, &plan.MarketSession, &plan.Notes,
 			&plan.TrendAnalysis, &plan.CreatedAt, &plan.UpdatedAt,
@@ -180,18 +196,25 @@ func CreateDailyPlan(db *sql.DB) gin.HandlerFunc {
 
 		// 檢查帳號所屬權
 		var exists int
-		db.QueryRow("SELECT 1 FROM accounts WHERE id = ? AND user_id = ?", req.AccountID, userID).Scan(&exists)
+		db.QueryRow("SELECT 1 FROM accounts WHERE id = ? AND user_id = ? AND deleted_at IS NULL", req.AccountID, userID).Scan(&exists)
 		if exists == 0 {
 			c.JSON(http.StatusForbidden, gin.H{"error": "無權限操作此帳號"})
 			return
 		}
 
+		symbol, err := instruments.Canonical(db, userID, req.Symbol)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		req.Symbol = symbol
+
 		// 檢查是否已存在同日期、同品種的規劃
 		var existsID int64
-		// 使用 date() 函數確保只比較日期部分
-		err := db.QueryRow(`
+		// 只比較日期部分
+		err = db.QueryRow(`
 			SELECT id FROM daily_plans 
-			WHERE date(plan_date) = date(?) AND symbol = ? AND account_id = ?
+			WHERE `+database.DateOf("plan_date")+` = `+database.DateOf("?")+` AND symbol = ? AND account_id = ? AND deleted_at IS NULL
 		`, req.PlanDate, req.Symbol, req.AccountID).Scan(&existsID)
 
 		if err == nil {
@@ -204,15 +227,14 @@ func CreateDailyPlan(db *sql.DB) gin.HandlerFunc {
 			return
 		}
 
-		result, err := db.Exec(`
+		id, err := database.InsertID(db, `
 			INSERT INTO daily_plans (account_id, plan_date, symbol, market_session, notes, trend_analysis)
 			VALUES (?, ?, ?, ?, ?, ?)
 		`, req.AccountID, req.PlanDate, req.Symbol, req.MarketSession, req.Notes, req.TrendAnalysis)
 
 		if err != nil {
-			// 檢查是否為唯一索引衝突 (SQLite 錯誤碼 2067 或檢查錯誤字串)
-			errStr := err.Error()
-			if errStr != "" && (errStr[0:10] == "UNIQUE con" || errStr[0:15] == "constraint fail") {
+			// 檢查是否為唯一索引衝突
+			if database.IsUniqueViolation(err) {
 				c.JSON(http.StatusConflict, gin.H{"error": "該日期與品種的規劃已存在，請直接編輯原有的規劃"})
 				return
 			}
@@ -220,7 +242,12 @@ func CreateDailyPlan(db *sql.DB) gin.HandlerFunc {
 			return
 		}
 
-		id, _ := result.LastInsertId()
+		// 同帳號、品種與日期的交易自動連結到新規劃
+		if err := dailyplans.LinkAccount(db, req.AccountID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
 		c.JSON(http.StatusCreated, gin.H{"id": id, "message": "規劃建立成功"})
 	}
 }
@@ -239,21 +266,29 @@ func UpdateDailyPlan(db *sql.DB) gin.HandlerFunc {
 		userID := c.GetInt64("user_id")
 
 		// 檢查規劃所屬權
-		var exists int
-		db.QueryRow("SELECT 1 FROM daily_plans p JOIN accounts a ON p.account_id = a.id WHERE p.id = ? AND a.user_id = ?", id, userID).Scan(&exists)
-		if exists == 0 {
+		var oldAccountID int64
+		db.QueryRow("SELECT p.account_id FROM daily_plans p JOIN accounts a ON p.account_id = a.id WHERE p.id = ? AND a.user_id = ? AND p.deleted_at IS NULL", id, userID).Scan(&oldAccountID)
+		if oldAccountID == 0 {
 			c.JSON(http.StatusForbidden, gin.H{"error": "無權限更新此規劃"})
 			return
 		}
 
 		// 檢查目標帳號所屬權
-		db.QueryRow("SELECT 1 FROM accounts WHERE id = ? AND user_id = ?", req.AccountID, userID).Scan(&exists)
+		var exists int
+		db.QueryRow("SELECT 1 FROM accounts WHERE id = ? AND user_id = ? AND deleted_at IS NULL", req.AccountID, userID).Scan(&exists)
 		if exists == 0 {
 			c.JSON(http.StatusForbidden, gin.H{"error": "無權限將規劃移動到此帳號"})
 			return
 		}
 
-		_, err := db.Exec(`
+		symbol, err := instruments.Canonical(db, userID, req.Symbol)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		req.Symbol = symbol
+
+		_, err = db.Exec(`
 			UPDATE daily_plans 
 			SET account_id=?, plan_date=?, symbol=?, market_session=?, notes=?, trend_analysis=?, updated_at=CURRENT_TIMESTAMP
 			WHERE id=?
@@ -264,17 +299,25 @@ func UpdateDailyPlan(db *sql.DB) gin.HandlerFunc {
 			return
 		}
 
+		// 日期、品種或帳號變更後重新連結原帳號與目標帳號的交易
+		for _, accountID := range []int64{oldAccountID, req.AccountID} {
+			if err := dailyplans.LinkAccount(db, accountID); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
 		c.JSON(http.StatusOK, gin.H{"message": "規劃更新成功"})
 	}
 }
 
-// DeleteDailyPlan 刪除每日規劃
+// DeleteDailyPlan 刪除每日規劃 (移到垃圾桶)
 func DeleteDailyPlan(db *sql.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id := c.Param("id")
 		userID := c.GetInt64("user_id")
 
-		res, err := db.Exec("DELETE FROM daily_plans WHERE id = ? AND id IN (SELECT p.id FROM daily_plans p JOIN accounts a ON p.account_id = a.id WHERE a.user_id = ?)", id, userID)
+		res, err := db.Exec("UPDATE daily_plans SET deleted_at = CURRENT_TIMESTAMP, delete_batch = ? WHERE id = ? AND deleted_at IS NULL AND id IN (SELECT p.id FROM daily_plans p JOIN accounts a ON p.account_id = a.id WHERE a.user_id = ?)", trash.NewBatch(), id, userID)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
@@ -289,3 +332,188 @@ func DeleteDailyPlan(db *sql.DB) gin.HandlerFunc {
 		c.JSON(http.StatusOK, gin.H{"message": "規劃刪除成功"})
 	}
 }
+
+// planTrade 交易與連結規劃的趨勢分析，規劃不存在或在垃圾桶中時 analysis 為 nil
+type planTrade struct {
+	models.DailyPlanTrade
+	analysis *string
+}
+
+// loadPlanTrades 取得符合條件的交易與連結的規劃，where 以 AND 開頭，t 為 trades 的別名
+func loadPlanTrades(db *sql.DB, where string, args []interface{}) ([]planTrade, error) {
+	rows, err := db.Query(`
+		SELECT t.id, t.account_id, p.id, COALESCE(t.plan_link_manual, FALSE), t.symbol, t.side, COALESCE(t.market_session, ''), COALESCE(t.trend_type, ''),
+			   t.entry_time, t.exit_time, t.pnl, p.trend_analysis
+		FROM trades t
+		LEFT JOIN daily_plans p ON p.id = t.daily_plan_id AND p.deleted_at IS NULL
+		WHERE t.deleted_at IS NULL`+where+`
+		ORDER BY t.entry_time ASC, t.id ASC
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []planTrade{}
+	for rows.Next() {
+		var t planTrade
+		if err := rows.Scan(&t.ID, &t.AccountID, &t.DailyPlanID, &t.PlanLinkManual, &t.Symbol, &t.Side, &t.MarketSession, &t.TrendType,
+			&t.EntryTime, &t.ExitTime, &t.PnL, &t.analysis); err != nil {
+			return nil, err
+		}
+		if t.DailyPlanID != nil && t.analysis == nil {
+			empty := "{}"
+			t.analysis = &empty
+		}
+		list = append(list, t)
+	}
+	return list, rows.Err()
+}
+
+// check 依指定週期比較交易與規劃方向
+func (t planTrade) check(timeframe string) models.DailyPlanTrade {
+	result := t.DailyPlanTrade
+	if t.analysis == nil {
+		result.Alignment = dailyplans.Unlinked
+		return result
+	}
+	result.Bias = dailyplans.Bias(*t.analysis, t.MarketSession, timeframe)
+	result.Alignment, result.TrendTypeMismatch = dailyplans.Check(t.Side, t.TrendType, result.Bias)
+	return result
+}
+
+// planTimeframe 解析 timeframe 參數，預設為 H4
+func planTimeframe(c *gin.Context) (string, bool) {
+	tf := strings.ToUpper(strings.TrimSpace(c.Query("timeframe")))
+	if tf == "" {
+		return dailyplans.DefaultTimeframe, true
+	}
+	for _, v := range dailyplans.Timeframes {
+		if v == tf {
+			return tf, true
+		}
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": "timeframe 必須是 " + strings.Join(dailyplans.Timeframes, "、") + " 其中之一"})
+	return "", false
+}
+
+// GetDailyPlanTrades 取得連結到規劃的交易，並依 timeframe (預設 H4) 比較交易與規劃方向
+func GetDailyPlanTrades(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		userID := c.GetInt64("user_id")
+		timeframe, ok := planTimeframe(c)
+		if !ok {
+			return
+		}
+
+		var planID int64
+		err := db.QueryRow(`
+			SELECT p.id FROM daily_plans p JOIN accounts a ON p.account_id = a.id
+			WHERE p.id = ? AND a.user_id = ? AND p.deleted_at IS NULL AND a.deleted_at IS NULL
+		`, id, userID).Scan(&planID)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "規劃不存在"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		list, err := loadPlanTrades(db, " AND t.daily_plan_id = ?", []interface{}{planID})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		trades := make([]models.DailyPlanTrade, 0, len(list))
+		for _, t := range list {
+			trades = append(trades, t.check(timeframe))
+		}
+		c.JSON(http.StatusOK, gin.H{"timeframe": timeframe, "trades": trades})
+	}
+}
+
+// SetTradeDailyPlan 手動指定交易的規劃 (daily_plan_id 為 null 表示不連結)，auto 為 true 時改回自動連結
+func SetTradeDailyPlan(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.DailyPlanTradeLink
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		userID := c.GetInt64("user_id")
+
+		var tradeID, accountID int64
+		err := db.QueryRow(`
+			SELECT t.id, t.account_id FROM trades t JOIN accounts a ON t.account_id = a.id
+			WHERE t.id = ? AND a.user_id = ? AND t.deleted_at IS NULL AND a.deleted_at IS NULL
+		`, c.Param("id"), userID).Scan(&tradeID, &accountID)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "交易紀錄不存在"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if !req.Auto && req.DailyPlanID != nil {
+			var planAccountID int64
+			err := db.QueryRow("SELECT account_id FROM daily_plans WHERE id = ? AND deleted_at IS NULL", *req.DailyPlanID).Scan(&planAccountID)
+			if err == sql.ErrNoRows || (err == nil && planAccountID != accountID) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "規劃不存在或不屬於交易的帳號"})
+				return
+			}
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer tx.Rollback()
+
+		before, err := audit.Snapshot(tx, tradeID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if req.Auto {
+			err = dailyplans.ResetAuto(tx, tradeID)
+		} else {
+			err = dailyplans.SetManual(tx, tradeID, req.DailyPlanID)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		after, err := audit.Snapshot(tx, tradeID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err := audit.Record(tx, tradeID, userID, audit.ActionUpdate, audit.SourceAPI, before, after); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		var link struct {
+			DailyPlanID    *int64 `json:"daily_plan_id"`
+			PlanLinkManual bool   `json:"plan_link_manual"`
+		}
+		if err := tx.QueryRow("SELECT daily_plan_id, COALESCE(plan_link_manual, FALSE) FROM trades WHERE id = ?", tradeID).Scan(&link.DailyPlanID, &link.PlanLinkManual); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, link)
+	}
+}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"trade-journal/internal/audit"
+	"trade-journal/internal/executions"
+	"trade-journal/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetTradeExecutions 取得交易的成交紀錄
+func GetTradeExecutions(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tradeID, ok := ownedTradeID(c, db)
+		if !ok {
+			return
+		}
+		list, err := executions.Load(db, tradeID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if list == nil {
+			list = []models.Execution{}
+		}
+		c.JSON(http.StatusOK, list)
+	}
+}
+
+// CreateTradeExecution 新增成交 (加倉或分批平倉)，並重新計算交易欄位
+func CreateTradeExecution(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tradeID, ok := ownedTradeID(c, db)
+		if !ok {
+			return
+		}
+		var req models.ExecutionCreate
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		changeExecutions(c, db, tradeID, http.StatusCreated, "成交紀錄新增成功", func(tx *sql.Tx) (bool, error) {
+			// 尚無成交的交易，先以原本的價格建立成交再加入新成交
+			if err := executions.EnsureEntry(tx, tradeID); err != nil {
+				return false, err
+			}
+			_, err := executions.Insert(tx, tradeID, req)
+			return true, err
+		})
+	}
+}
+
+// UpdateTradeExecution 更新成交，並重新計算交易欄位
+func UpdateTradeExecution(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tradeID, ok := ownedTradeID(c, db)
+		if !ok {
+			return
+		}
+		var req models.ExecutionCreate
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		changeExecutions(c, db, tradeID, http.StatusOK, "成交紀錄更新成功", func(tx *sql.Tx) (bool, error) {
+			return affected(tx.Exec(`
+				UPDATE trade_executions SET side = ?, price = ?, volume = ?, executed_at = ?, commission = ?, swap = ?, fee = ?, pnl = ?, external_id = ?
+				WHERE id = ? AND trade_id = ?
+			`, req.Side, req.Price, req.Volume, req.ExecutedAt, req.Commission, req.Swap, req.Fee, req.PnL, req.ExternalID, c.Param("executionId"), tradeID))
+		})
+	}
+}
+
+// DeleteTradeExecution 刪除成交，並重新計算交易欄位
+func DeleteTradeExecution(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tradeID, ok := ownedTradeID(c, db)
+		if !ok {
+			return
+		}
+
+		changeExecutions(c, db, tradeID, http.StatusOK, "成交紀錄刪除成功", func(tx *sql.Tx) (bool, error) {
+			return affected(tx.Exec("DELETE FROM trade_executions WHERE id = ? AND trade_id = ?", c.Param("executionId"), tradeID))
+		})
+	}
+}
+
+// ownedTradeID 解析路徑中的交易 ID 並檢查所屬權
+func ownedTradeID(c *gin.Context, db *sql.DB) (int64, bool) {
+	userID := c.GetInt64("user_id")
+	tradeID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "無效的交易 ID"})
+		return 0, false
+	}
+
+	var exists int
+	db.QueryRow("SELECT 1 FROM trades t JOIN accounts a ON t.account_id = a.id WHERE t.id = ? AND a.user_id = ? AND t.deleted_at IS NULL AND a.deleted_at IS NULL", tradeID, userID).Scan(&exists)
+	if exists == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "交易紀錄不存在"})
+		return 0, false
+	}
+	return tradeID, true
+}
+
+// changeExecutions 在交易中修改成交、重新計算交易欄位並記錄異動
+// change 回傳 false 表示找不到要修改的成交
+func changeExecutions(c *gin.Context, db *sql.DB, tradeID int64, status int, message string, change func(tx *sql.Tx) (bool, error)) {
+	userID := c.GetInt64("user_id")
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := audit.Snapshot(tx, tradeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	found, err := change(tx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "成交紀錄不存在"})
+		return
+	}
+
+	if err := executions.Recalculate(tx, tradeID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	after, err := audit.Snapshot(tx, tradeID)
+	if err == nil {
+		err = audit.Record(tx, tradeID, userID, audit.ActionUpdate, audit.SourceAPI, before, after)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	list, err := executions.Load(tx, tradeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(status, gin.H{"message": message, "executions": list})
+}
+
+func affected(res sql.Result, err error) (bool, error) {
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
@@ -1,25 +1,37 @@
 package handlers
 
 import (
+	"bytes"
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"path/filepath"
-	"time"
 
+	"trade-journal/internal/images"
 	"trade-journal/internal/minio"
+	"trade-journal/internal/models"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
 	miniogo "github.com/minio/minio-go/v7"
 )
 
+// maxImageUpload 單張圖片上傳的大小上限 (含表單欄位)
+const maxImageUpload = 20 << 20
+
 // UploadImage 上傳圖片到MinIO
-func UploadImage(client *miniogo.Client) gin.HandlerFunc {
+func UploadImage(db *sql.DB, client *miniogo.Client) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImageUpload)
 		file, header, err := c.Request.FormFile("image")
 		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("圖片不能超過 %d MB", maxImageUpload>>20)})
+				return
+			}
 			c.JSON(http.StatusBadRequest, gin.H{"error": "請選擇圖片檔案"})
 			return
 		}
@@ -27,22 +39,9 @@ func UploadImage(client *miniogo.Client) gin.HandlerFunc {
 
 		// 取得交易品種和類型（可選）
 		symbol := c.PostForm("symbol")
-		if symbol == "" {
-			symbol = "UNKNOWN"
-		}
 
 		// 生成檔案名稱: YYYY-MM/YYYYMMDD-SYMBOL-UUID.ext
-		now := time.Now()
-		ext := filepath.Ext(header.Filename)
-		fileName := fmt.Sprintf("%s-%s-%s%s",
-			now.Format("20060102"),
-			symbol,
-			uuid.New().String()[:8],
-			ext,
-		)
-
-		// 按月份組織路徑
-		objectPath := fmt.Sprintf("%s/%s", now.Format("2006-01"), fileName)
+		objectPath := images.ObjectPath(symbol, filepath.Ext(header.Filename))
 
 		// 上傳到MinIO
 		ctx := context.Background()
@@ -51,14 +50,23 @@ func UploadImage(client *miniogo.Client) gin.HandlerFunc {
 			contentType = "image/jpeg"
 		}
 
-	_, err = client.PutObject(ctx, minio.BucketName, objectPath, file, header.Size, miniogo.PutObjectOptions{
-		ContentType: contentType,
-	})
-
+		data, err := io.ReadAll(file)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "讀取圖片失敗: " + err.Error()})
+			return
+		}
+		_, err = client.PutObject(ctx, minio.BucketName, objectPath, bytes.NewReader(data), int64(len(data)), miniogo.PutObjectOptions{
+			ContentType: contentType,
+		})
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "圖片上傳失敗: " + err.Error()})
 			return
 		}
+		if err := images.RecordSize(db, objectPath, int64(len(data))); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		images.StartRenditions(db, client, objectPath, data)
 
 		c.JSON(http.StatusOK, gin.H{
 			"path":    objectPath,
@@ -68,6 +76,7 @@ func UploadImage(client *miniogo.Client) gin.HandlerFunc {
 }
 
 // GetImage 從MinIO取得圖片
+// size 為 thumb 或 medium 時回傳縮圖，縮圖尚未產生時回傳原圖
 func GetImage(client *miniogo.Client) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		filename := c.Param("filename")
@@ -75,6 +84,11 @@ func GetImage(client *miniogo.Client) gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "檔案名稱不能為空"})
 			return
 		}
+		size := c.Query("size")
+		if !images.ValidSize(size) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "size 需為 thumb、medium 或 original"})
+			return
+		}
 
 		// 從query參數取得完整路徑（包含月份資料夾）
 		objectPath := c.Query("path")
@@ -82,28 +96,73 @@ func GetImage(client *miniogo.Client) gin.HandlerFunc {
 			objectPath = filename
 		}
 
-	ctx := context.Background()
-	object, err := client.GetObject(ctx, minio.BucketName, objectPath, miniogo.GetObjectOptions{})
-		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "圖片不存在"})
-			return
+		ctx := context.Background()
+		cacheControl := "public, max-age=604800, immutable" // 7 days
+		renditionPath := images.RenditionPath(objectPath, size)
+		object, stat, err := openImage(ctx, client, renditionPath)
+		if err != nil && renditionPath != objectPath {
+			// 縮圖尚未產生，回傳原圖但不長期快取，產生後即可取得縮圖
+			object, stat, err = openImage(ctx, client, objectPath)
+			cacheControl = "no-cache"
 		}
-		defer object.Close()
-
-		// 取得物件資訊
-		stat, err := object.Stat()
 		if err != nil {
 			c.JSON(http.StatusNotFound, gin.H{"error": "圖片不存在"})
 			return
 		}
+		defer object.Close()
 
 		// 設定回應標頭
 		c.Header("Content-Type", stat.ContentType)
 		c.Header("Content-Length", fmt.Sprintf("%d", stat.Size))
-		c.Header("Cache-Control", "public, max-age=604800, immutable") // 7 days
+		c.Header("Cache-Control", cacheControl)
 
 		// 串流傳送圖片
 		io.Copy(c.Writer, object)
 	}
 }
 
+// openImage 開啟 MinIO 物件並取得物件資訊，物件不存在時回傳錯誤
+func openImage(ctx context.Context, client *miniogo.Client, objectPath string) (*miniogo.Object, miniogo.ObjectInfo, error) {
+	object, err := client.GetObject(ctx, minio.BucketName, objectPath, miniogo.GetObjectOptions{})
+	if err != nil {
+		return nil, miniogo.ObjectInfo{}, err
+	}
+	stat, err := object.Stat()
+	if err != nil {
+		object.Close()
+		return nil, stat, err
+	}
+	return object, stat, nil
+}
+
+// storeTradeImages 將請求中以 base64 內嵌的圖片轉存到 MinIO，欄位改存物件路徑
+func storeTradeImages(db *sql.DB, req *models.TradeCreate) error {
+	fields := []*string{
+		&req.EntryStrategyImage, &req.EntryStrategyImageOriginal,
+		&req.LegendKingImage, &req.LegendKingImageOriginal,
+		&req.LegendHTFImage, &req.LegendHTFImageOriginal,
+	}
+	ctx := context.Background()
+	for _, f := range fields {
+		v, err := images.Normalize(ctx, db, minio.GlobalClient, req.Symbol, *f)
+		if err != nil {
+			return err
+		}
+		*f = v
+	}
+	return nil
+}
+
+// resolveTradeImageURLs 將交易的圖片欄位由物件路徑轉為下載網址
+func resolveTradeImageURLs(trade *models.Trade) {
+	fields := []*string{
+		trade.EntryStrategyImage, trade.EntryStrategyImageOriginal,
+		trade.LegendKingImage, trade.LegendKingImageOriginal,
+		trade.LegendHTFImage, trade.LegendHTFImageOriginal,
+	}
+	for _, f := range fields {
+		if f != nil {
+			*f = images.URL(*f)
+		}
+	}
+}
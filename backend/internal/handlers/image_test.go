@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestUploadImageRejectsLargeFile(t *testing.T) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, _ := mw.CreateFormFile("image", "big.png")
+	fw.Write(make([]byte, maxImageUpload+1))
+	mw.Close()
+
+	// 超過上限時不會使用到 MinIO
+	s := newTestServer(t)
+	s.POST("/images/upload", UploadImage(s.db, nil))
+	req := httptest.NewRequest("POST", "/images/upload", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w := s.serve(req)
+	if w.Code != 413 {
+		t.Fatalf("應回傳 413，得到 %d %s", w.Code, w.Body.String())
+	}
+}
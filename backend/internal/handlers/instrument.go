@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+
+	"trade-journal/internal/excursions"
+	"trade-journal/internal/instruments"
+	"trade-journal/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetInstruments 取得品種規格，包含內建規格與使用者的自訂規格
+func GetInstruments(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		list, err := instruments.List(db, c.GetInt64("user_id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, list)
+	}
+}
+
+// GetInstrument 取得單一品種目前使用的規格，不在內建清單中的品種會依名稱推測
+func GetInstrument(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s, err := instruments.Resolve(db, c.GetInt64("user_id"), c.Param("symbol"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, s)
+	}
+}
+
+// SaveInstrument 建立或更新自訂品種規格，並重新計算該品種交易的點數、子彈大小與風報比
+func SaveInstrument(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetInt64("user_id")
+		symbol := instruments.Normalize(c.Param("symbol"))
+		if symbol == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "無效的品種名稱"})
+			return
+		}
+		var req models.InstrumentUpdate
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer tx.Rollback()
+
+		if err := instruments.Save(tx, userID, symbol, req); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		count, err := instruments.RecalculateSymbol(tx, userID, symbol)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		// MAE / MFE 點數同樣以品種規格換算
+		if _, err := excursions.RecalculateSymbol(tx, userID, instruments.Normalize(symbol)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "品種規格已儲存", "recalculated": count})
+	}
+}
+
+// DeleteInstrument 刪除自訂品種規格，改回內建規格並重新計算該品種的交易
+func DeleteInstrument(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetInt64("user_id")
+		symbol := c.Param("symbol")
+
+		tx, err := db.Begin()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer tx.Rollback()
+
+		if err := instruments.Delete(tx, userID, symbol); err != nil {
+			if err == instruments.ErrNotFound {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		count, err := instruments.RecalculateSymbol(tx, userID, symbol)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		// MAE / MFE 點數同樣以品種規格換算
+		if _, err := excursions.RecalculateSymbol(tx, userID, instruments.Normalize(symbol)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "已改回內建規格", "recalculated": count})
+	}
+}
@@ -0,0 +1,268 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"trade-journal/internal/audit"
+	"trade-journal/internal/database"
+	"trade-journal/internal/models"
+	"trade-journal/internal/reviews"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetMistakes 取得使用者的錯誤類型與標記的交易數
+func GetMistakes(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		list, err := reviews.List(db, c.GetInt64("user_id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, list)
+	}
+}
+
+// CreateMistake 建立錯誤類型
+func CreateMistake(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.MistakeCreate
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		id, err := reviews.Create(db, c.GetInt64("user_id"), req)
+		if err != nil {
+			mistakeError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"id": id, "message": "錯誤類型建立成功"})
+	}
+}
+
+// UpdateMistake 更新錯誤類型的名稱、說明與順序
+func UpdateMistake(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "無效的錯誤類型 ID"})
+			return
+		}
+		var req models.MistakeCreate
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := reviews.Update(db, c.GetInt64("user_id"), id, req); err != nil {
+			mistakeError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "錯誤類型更新成功"})
+	}
+}
+
+// DeleteMistake 刪除錯誤類型，所有交易上的標記一併移除
+func DeleteMistake(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "無效的錯誤類型 ID"})
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer tx.Rollback()
+
+		if err := reviews.Delete(tx, c.GetInt64("user_id"), id); err != nil {
+			mistakeError(c, err)
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "錯誤類型刪除成功"})
+	}
+}
+
+func mistakeError(c *gin.Context, err error) {
+	switch {
+	case err == reviews.ErrNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case database.IsUniqueViolation(err):
+		c.JSON(http.StatusConflict, gin.H{"error": "錯誤類型名稱已存在"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// UpdateTradeReview 檢討交易：設定檢討狀態、品質評等、心得與錯誤類型，未提供的欄位不變
+func UpdateTradeReview(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.TradeReview
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		userID := c.GetInt64("user_id")
+
+		var tradeID int64
+		err := db.QueryRow(`
+			SELECT t.id FROM trades t JOIN accounts a ON t.account_id = a.id
+			WHERE t.id = ? AND a.user_id = ? AND t.deleted_at IS NULL AND a.deleted_at IS NULL
+		`, c.Param("id"), userID).Scan(&tradeID)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "交易紀錄不存在"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err := reviews.Validate(db, userID, &req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer tx.Rollback()
+
+		before, err := audit.Snapshot(tx, tradeID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err := reviews.Apply(tx, tradeID, req); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		after, err := audit.Snapshot(tx, tradeID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err := audit.Record(tx, tradeID, userID, audit.ActionUpdate, audit.SourceAPI, before, after); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		var review struct {
+			ReviewStatus string                `json:"review_status"`
+			QualityGrade *string               `json:"quality_grade"`
+			Lessons      *string               `json:"lessons"`
+			ReviewedAt   *time.Time            `json:"reviewed_at"`
+			Mistakes     []models.TradeMistake `json:"mistakes"`
+		}
+		err = tx.QueryRow("SELECT COALESCE(review_status, 'unreviewed'), quality_grade, lessons, reviewed_at FROM trades WHERE id = ?", tradeID).
+			Scan(&review.ReviewStatus, &review.QualityGrade, &review.Lessons, &review.ReviewedAt)
+		if err == nil {
+			review.Mistakes, err = reviews.Load(tx, tradeID)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if review.Mistakes == nil {
+			review.Mistakes = []models.TradeMistake{}
+		}
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, review)
+	}
+}
+
+// GetReviewQueue 取得待檢討的已平倉交易，依平倉時間由舊到新排列
+// 篩選條件與交易列表相同，未指定 review_status 時包含未檢討與需導師檢討的交易
+func GetReviewQueue(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		where, args, ok := costFilter(c, db)
+		if !ok {
+			return
+		}
+		if c.Query("review_status") == "" {
+			where += " AND COALESCE(t.review_status, 'unreviewed') IN (?, ?)"
+			args = append(args, reviews.Unreviewed, reviews.NeedsMentor)
+		}
+		where += " AND t.exit_price IS NOT NULL"
+
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+		if limit <= 0 || limit > 200 {
+			limit = 50
+		}
+
+		counts := map[string]int{reviews.Unreviewed: 0, reviews.Reviewed: 0, reviews.NeedsMentor: 0}
+		rows, err := db.Query("SELECT COALESCE(t.review_status, 'unreviewed'), COUNT(*) FROM trades t WHERE t.deleted_at IS NULL"+where+" GROUP BY COALESCE(t.review_status, 'unreviewed')", args...)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		total := 0
+		for rows.Next() {
+			var status string
+			var n int
+			if err := rows.Scan(&status, &n); err != nil {
+				rows.Close()
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			counts[status] = n
+			total += n
+		}
+		rows.Close()
+
+		rows, err = db.Query(`
+			SELECT t.id, t.account_id, t.symbol, t.side, t.entry_time, t.exit_time, t.pnl, t.rr_ratio,
+				COALESCE(t.review_status, 'unreviewed'), t.quality_grade
+			FROM trades t WHERE t.deleted_at IS NULL`+where+`
+			ORDER BY t.exit_time, t.id LIMIT ?
+		`, append(args, limit)...)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer rows.Close()
+
+		queue := []models.ReviewQueueItem{}
+		for rows.Next() {
+			var item models.ReviewQueueItem
+			if err := rows.Scan(&item.ID, &item.AccountID, &item.Symbol, &item.Side, &item.EntryTime, &item.ExitTime, &item.PnL, &item.RRRatio,
+				&item.ReviewStatus, &item.QualityGrade); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			queue = append(queue, item)
+		}
+		if err := rows.Err(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		rows.Close()
+
+		for i := range queue {
+			mistakes, err := reviews.Load(db, queue[i].ID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			if mistakes == nil {
+				mistakes = []models.TradeMistake{}
+			}
+			queue[i].Mistakes = mistakes
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": queue, "total": total, "counts": counts})
+	}
+}
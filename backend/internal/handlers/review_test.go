@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"testing"
+
+	"trade-journal/internal/audit"
+	"trade-journal/internal/models"
+)
+
+func TestReviewWorkflow(t *testing.T) {
+	s := newStatsTestServer(t,
+		"INSERT INTO users (id, username, password) VALUES (1, 'alice', 'x')",
+		"INSERT INTO accounts (id, user_id, name) VALUES (10, 1, 'main')",
+		"INSERT INTO mistakes (id, user_id, name) VALUES (1, 1, 'FOMO'), (2, 1, '移動停損'), (3, 1, '過度交易')",
+		// 104 尚未平倉不列入檢討佇列與統計
+		`INSERT INTO trades (id, account_id, symbol, side, entry_price, exit_price, pnl, rr_ratio, entry_time, exit_time) VALUES
+			(101, 10, 'XAUUSD', 'long', 1, 2, -100, -1, '2024-05-01 08:00:00', '2024-05-01 09:00:00'),
+			(102, 10, 'XAUUSD', 'long', 1, 2, -50, -0.5, '2024-05-02 08:00:00', '2024-05-02 09:00:00'),
+			(103, 10, 'XAUUSD', 'long', 1, 2, 200, 2, '2024-05-03 08:00:00', '2024-05-03 09:00:00'),
+			(104, 10, 'XAUUSD', 'long', 1, NULL, NULL, NULL, '2024-05-04 08:00:00', NULL)`,
+	)
+	s.PUT("/trades/:id/review", UpdateTradeReview(s.db))
+	s.GET("/reviews/queue", GetReviewQueue(s.db))
+
+	var queue struct {
+		Data   []models.ReviewQueueItem `json:"data"`
+		Total  int                      `json:"total"`
+		Counts map[string]int           `json:"counts"`
+	}
+	if code := s.do("GET", "/reviews/queue", "", &queue); code != 200 || queue.Total != 3 || len(queue.Data) != 3 || queue.Data[0].ID != 101 {
+		t.Fatalf("檢討佇列錯誤: %d %+v", code, queue)
+	}
+
+	if code := s.do("PUT", "/trades/101/review", `{"quality_grade": "Z"}`, nil); code != 400 {
+		t.Fatalf("不合法的評等應回傳 400，得到 %d", code)
+	}
+	if code := s.do("PUT", "/trades/104/review", `{"review_status": "done"}`, nil); code != 400 {
+		t.Fatalf("不合法的狀態應回傳 400，得到 %d", code)
+	}
+	for _, req := range []struct{ id, body string }{
+		{"101", `{"review_status": "reviewed", "quality_grade": "d", "lessons": "等收盤確認", "mistake_ids": [1, 2]}`},
+		{"102", `{"review_status": "needs_mentor", "mistake_ids": [1]}`},
+		{"103", `{"review_status": "reviewed", "quality_grade": "A"}`},
+	} {
+		var review struct {
+			ReviewStatus string                `json:"review_status"`
+			ReviewedAt   *string               `json:"reviewed_at"`
+			Mistakes     []models.TradeMistake `json:"mistakes"`
+		}
+		if code := s.do("PUT", "/trades/"+req.id+"/review", req.body, &review); code != 200 || review.ReviewedAt == nil {
+			t.Fatalf("檢討交易 %s 失敗: %d %+v", req.id, code, review)
+		}
+	}
+
+	history, err := audit.History(s.db, 101)
+	if err != nil || len(history) != 1 {
+		t.Fatalf("應記錄一筆異動: %v %v", history, err)
+	}
+	if c, ok := history[0].Changes[audit.MistakesField]; !ok || len(c.New.([]interface{})) != 2 {
+		t.Fatalf("異動應包含錯誤類型: %+v", history[0].Changes)
+	}
+
+	queue.Data, queue.Counts = nil, nil
+	if code := s.do("GET", "/reviews/queue", "", &queue); code != 200 || queue.Total != 1 || queue.Data[0].ID != 102 || queue.Counts["needs_mentor"] != 1 {
+		t.Fatalf("檢討後的佇列錯誤: %d %+v", code, queue)
+	}
+	if len(queue.Data[0].Mistakes) != 1 || queue.Data[0].Mistakes[0].Name != "FOMO" {
+		t.Fatalf("佇列應包含錯誤類型: %+v", queue.Data[0])
+	}
+
+	var stats models.ReviewStats
+	if code := s.do("GET", "/stats/reviews?account_id=10", "", &stats); code != 200 {
+		t.Fatalf("統計失敗: %d", code)
+	}
+	if stats.TotalTrades != 3 || stats.Reviewed != 2 || stats.NeedsMentor != 1 || stats.Unreviewed != 0 || stats.ReviewRate != 100 {
+		t.Fatalf("檢討進度錯誤: %+v", stats)
+	}
+	// 依總盈虧排序，交易 101 同時計入 FOMO 與移動停損
+	if len(stats.Mistakes) != 3 || stats.Mistakes[0].Name != "FOMO" || stats.Mistakes[0].Trades != 2 ||
+		stats.Mistakes[0].TotalPnL != -150 || stats.Mistakes[0].TotalR != -1.5 || stats.Mistakes[0].AvgR != -0.75 {
+		t.Fatalf("FOMO 統計錯誤: %+v", stats.Mistakes)
+	}
+	if stats.Mistakes[1].Name != "移動停損" || stats.Mistakes[1].TotalPnL != -100 || stats.Mistakes[2].Trades != 0 {
+		t.Fatalf("錯誤類型統計錯誤: %+v", stats.Mistakes)
+	}
+	if stats.Clean.Trades != 1 || stats.Clean.TotalPnL != 200 || stats.Clean.WinRate != 100 {
+		t.Fatalf("無錯誤交易統計錯誤: %+v", stats.Clean)
+	}
+	if len(stats.ByGrade) != 2 || stats.ByGrade[0].Name != "A" || stats.ByGrade[1].Name != "D" || stats.ByGrade[1].TotalPnL != -100 {
+		t.Fatalf("評等統計錯誤: %+v", stats.ByGrade)
+	}
+}
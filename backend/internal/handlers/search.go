@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+
+	"trade-journal/internal/search"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Search 全文搜尋交易心得、進出場理由與每日規劃
+func Search(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetInt64("user_id")
+		var query search.Query
+		if err := c.ShouldBindQuery(&query); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := query.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		results, err := search.Search(db, userID, query)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"results": results})
+	}
+}
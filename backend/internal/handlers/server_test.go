@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"trade-journal/internal/testutil"
+
+	"github.com/gin-gonic/gin"
+)
+
+// testServer 測試用的資料庫與路由，所有請求都以使用者 1 登入
+type testServer struct {
+	*gin.Engine
+	t  *testing.T
+	db *sql.DB
+}
+
+// newTestServer 建立測試資料庫並依序執行 seed，路由由各測試自行註冊
+func newTestServer(t *testing.T, seed ...string) *testServer {
+	t.Helper()
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("user_id", int64(1)) })
+	return &testServer{Engine: r, t: t, db: testutil.OpenDB(t, seed...)}
+}
+
+// newStatsTestServer 與 newTestServer 相同，並註冊統計相關的路由
+func newStatsTestServer(t *testing.T, seed ...string) *testServer {
+	t.Helper()
+	s := newTestServer(t, seed...)
+	s.GET("/stats/summary", GetStatsSummary(s.db))
+	s.GET("/stats/equity-curve", GetEquityCurve(s.db))
+	s.GET("/stats/by-symbol", GetStatsBySymbol(s.db))
+	s.GET("/stats/costs", GetCostStats(s.db))
+	s.GET("/stats/portfolio", GetPortfolioStats(s.db))
+	s.GET("/stats/plan-adherence", GetPlanAdherenceStats(s.db))
+	s.GET("/stats/daily-plan-adherence", GetDailyPlanAdherenceStats(s.db))
+	s.GET("/stats/excursions", GetExcursionStats(s.db))
+	s.GET("/stats/by-tag", GetStatsByTag(s.db))
+	s.GET("/stats/by-field/:key", GetStatsByField(s.db))
+	s.GET("/stats/reviews", GetReviewStats(s.db))
+	return s
+}
+
+// serve 送出請求並回傳回應
+func (s *testServer) serve(req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	return w
+}
+
+// do 送出請求並回傳狀態碼，out 不為 nil 時解析回應的 JSON
+func (s *testServer) do(method, url, body string, out interface{}) int {
+	s.t.Helper()
+	var r io.Reader
+	if body != "" {
+		r = strings.NewReader(body)
+	}
+	w := s.serve(httptest.NewRequest(method, url, r))
+	if out != nil {
+		json.Unmarshal(w.Body.Bytes(), out)
+	}
+	return w.Code
+}
+
+// get 送出 GET 請求並解析回應，狀態碼不是 200 時中止測試
+func (s *testServer) get(url string, out interface{}) {
+	s.t.Helper()
+	w := s.serve(httptest.NewRequest("GET", url, nil))
+	if w.Code != 200 {
+		s.t.Fatalf("%s: %d %s", url, w.Code, w.Body.String())
+	}
+	if out != nil {
+		json.Unmarshal(w.Body.Bytes(), out)
+	}
+}
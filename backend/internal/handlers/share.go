@@ -6,6 +6,10 @@ import (
 	"encoding/hex"
 	"log"
 	"net/http"
+	"trade-journal/internal/database"
+	"trade-journal/internal/customfields"
+	"trade-journal/internal/executions"
+	"trade-journal/internal/gallery"
 	"trade-journal/internal/models"
 
 	"github.com/gin-gonic/gin"
@@ -34,13 +38,13 @@ func CreateShare(db *sql.DB) gin.HandlerFunc {
 		// 檢查權限 (確保資源屬於該使用者)
 		var ownerID int64
 		if req.ResourceType == "trade" {
-			err := db.QueryRow("SELECT a.user_id FROM trades t JOIN accounts a ON t.account_id = a.id WHERE t.id = ?", req.ResourceID).Scan(&ownerID)
+			err := db.QueryRow("SELECT a.user_id FROM trades t JOIN accounts a ON t.account_id = a.id WHERE t.id = ? AND t.deleted_at IS NULL AND a.deleted_at IS NULL", req.ResourceID).Scan(&ownerID)
 			if err != nil {
 				c.JSON(http.StatusNotFound, gin.H{"error": "找不到該交易紀錄"})
 				return
 			}
 		} else if req.ResourceType == "plan" {
-			err := db.QueryRow("SELECT a.user_id FROM daily_plans p JOIN accounts a ON p.account_id = a.id WHERE p.id = ?", req.ResourceID).Scan(&ownerID)
+			err := db.QueryRow("SELECT a.user_id FROM daily_plans p JOIN accounts a ON p.account_id = a.id WHERE p.id = ? AND p.deleted_at IS NULL AND a.deleted_at IS NULL", req.ResourceID).Scan(&ownerID)
 			if err != nil {
 				c.JSON(http.StatusNotFound, gin.H{"error": "找不到該規劃紀錄"})
 				return
@@ -70,15 +74,13 @@ func CreateShare(db *sql.DB) gin.HandlerFunc {
 		}
 		defer tx.Rollback()
 
-		res, err := tx.Exec("INSERT INTO shares (user_id, resource_type, resource_id, share_type, token) VALUES (?, ?, ?, ?, ?)",
+		shareID, err := database.InsertID(tx, "INSERT INTO shares (user_id, resource_type, resource_id, share_type, token) VALUES (?, ?, ?, ?, ?)",
 			userID, req.ResourceType, req.ResourceID, req.ShareType, token)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
-		shareID, _ := res.LastInsertId()
-
 		if req.ShareType == "specific" && len(req.SharedWith) > 0 {
 			for _, sharedUserID := range req.SharedWith {
 				_, err = tx.Exec("INSERT INTO share_users (share_id, shared_with_user_id) VALUES (?, ?)", shareID, sharedUserID)
@@ -142,27 +144,26 @@ func GetTradeInternal(db *sql.DB, id int64) (*models.Trade, error) {
 			   t.entry_strategy, t.entry_strategy_image, t.entry_strategy_image_original, t.entry_signals, t.entry_checklist, t.entry_pattern, t.trend_analysis, 
 			   t.entry_timeframe, t.trend_type, t.market_session, t.initial_sl, t.bullet_size, t.rr_ratio, t.timezone_offset, t.ticket, t.exit_sl,
 			   t.legend_king_htf, t.legend_king_image, t.legend_king_image_original, t.legend_htf, t.legend_htf_image, t.legend_htf_image_original, t.legend_de_htf,
-			   t.entry_time, t.exit_time, t.created_at, t.updated_at
-		FROM trades t WHERE t.id = ?`, id).Scan(
+			   t.entry_time, t.exit_time, t.created_at, t.updated_at, t.strategy_id, t.raw_symbol, t.gross_pnl, t.commission, t.swap, t.fees, t.pnl_currency, t.initial_tp, t.exit_tp, t.tp_history, t.planned_rr,
+			   t.mae, t.mfe, t.mae_points, t.mfe_points, t.mae_r, t.mfe_r, t.mae_exceeded_sl, t.excursion_timeframe
+		FROM trades t WHERE t.id = ? AND t.deleted_at IS NULL`, id).Scan(
 		&trade.ID, &trade.AccountID, &trade.TradeType, &trade.Symbol, &trade.Side, &trade.EntryPrice, &trade.ExitPrice,
 		&trade.LotSize, &trade.PnL, &trade.PnLPoints, &trade.Notes, &trade.EntryReason, &trade.ExitReason,
 		&trade.EntryStrategy, &trade.EntryStrategyImage, &trade.EntryStrategyImageOriginal, &trade.EntrySignals, &trade.EntryChecklist, &trade.EntryPattern, &trade.TrendAnalysis,
 		&trade.EntryTimeframe, &trade.TrendType, &trade.MarketSession, &trade.InitialSL, &trade.BulletSize, &trade.RRRatio, &trade.TimezoneOffset, &trade.Ticket, &trade.ExitSL,
 		&trade.LegendKingHTF, &trade.LegendKingImage, &trade.LegendKingImageOriginal, &trade.LegendHTF, &trade.LegendHTFImage, &trade.LegendHTFImageOriginal, &trade.LegendDeHTF,
-		&trade.EntryTime, &trade.ExitTime, &trade.CreatedAt, &trade.UpdatedAt,
+		&trade.EntryTime, &trade.ExitTime, &trade.CreatedAt, &trade.UpdatedAt, &trade.StrategyID, &trade.RawSymbol, &trade.GrossPnL, &trade.Commission, &trade.Swap, &trade.Fees, &trade.PnLCurrency, &trade.InitialTP, &trade.ExitTP, &trade.TPHistory, &trade.PlannedRR,
+		&trade.MAE, &trade.MFE, &trade.MAEPoints, &trade.MFEPoints, &trade.MAER, &trade.MFER, &trade.MAEExceededSL, &trade.ExcursionTimeframe,
 	)
 	if err != nil {
 		return nil, err
 	}
+	resolveTradeImageURLs(&trade)
 
 	// 抓取圖片
-	rows, _ := db.Query("SELECT id, trade_id, image_type, image_path, created_at FROM trade_images WHERE trade_id = ? ORDER BY id ASC", id)
-	defer rows.Close()
-	trade.Images = []models.Image{}
-	for rows.Next() {
-		var img models.Image
-		rows.Scan(&img.ID, &img.TradeID, &img.ImageType, &img.ImagePath, &img.CreatedAt)
-		trade.Images = append(trade.Images, img)
+	trade.Images, _ = gallery.Load(db, trade.ID)
+	if trade.Images == nil {
+		trade.Images = []models.Image{}
 	}
 
 	// 抓取標籤
@@ -174,6 +175,12 @@ func GetTradeInternal(db *sql.DB, id int64) (*models.Trade, error) {
 		tagRows.Scan(&tag.ID, &tag.Name, &tag.CreatedAt)
 		trade.Tags = append(trade.Tags, tag)
 	}
+
+	// 抓取成交紀錄
+	trade.Executions, _ = executions.Load(db, id)
+
+	// 抓取自訂欄位
+	trade.CustomFields, _ = customfields.Load(db, id)
 	return &trade, nil
 }
 
@@ -182,7 +189,7 @@ func GetPlanInternal(db *sql.DB, id int64) (*models.DailyPlan, error) {
 	var p models.DailyPlan
 	err := db.QueryRow(`
 		SELECT id, account_id, plan_date, symbol, market_session, notes, trend_analysis, created_at, updated_at
-		FROM daily_plans WHERE id = ?`, id).Scan(
+		FROM daily_plans WHERE id = ? AND deleted_at IS NULL`, id).Scan(
 		&p.ID, &p.AccountID, &p.PlanDate, &p.Symbol, &p.MarketSession, &p.Notes, &p.TrendAnalysis, &p.CreatedAt, &p.UpdatedAt,
 	)
 	if err != nil {
@@ -2,11 +2,19 @@ package handlers
 
 import (
 	"database/sql"
-	"encoding/json"
+	"fmt"
+	"math"
 	"net/http"
 	"sort"
+	"strconv"
+	"time"
 
+	"trade-journal/internal/customfields"
+	"trade-journal/internal/dailyplans"
 	"trade-journal/internal/models"
+	"trade-journal/internal/reviews"
+	"trade-journal/internal/strategies"
+	"trade-journal/internal/tags"
 
 	"github.com/gin-gonic/gin"
 )
@@ -14,58 +22,73 @@ import (
 // GetStatsSummary 取得統計摘要
 func GetStatsSummary(db *sql.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userID := c.GetInt64("user_id")
-		accountID := c.Query("account_id")
-		if accountID == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "請提供 account_id"})
-			return
-		}
-
-		// 檢查帳號所屬權
-		var exists int
-		db.QueryRow("SELECT 1 FROM accounts WHERE id = ? AND user_id = ?", accountID, userID).Scan(&exists)
-		if exists == 0 {
-			c.JSON(http.StatusForbidden, gin.H{"error": "無權限操作此帳號"})
+		// 與交易列表使用相同的篩選條件
+		where, args, ok := statsFilter(c, db)
+		if !ok {
 			return
 		}
 
 		var stats models.StatsSummary
 
 		// 總交易數
-		db.QueryRow("SELECT COUNT(*) FROM trades WHERE account_id = ? AND exit_price IS NOT NULL", accountID).Scan(&stats.TotalTrades)
+		db.QueryRow("SELECT COUNT(*) FROM trades t WHERE t.deleted_at IS NULL"+where+" AND exit_price IS NOT NULL", args...).Scan(&stats.TotalTrades)
 
 		// 勝場數與敗場數
-		db.QueryRow("SELECT COUNT(*) FROM trades WHERE account_id = ? AND pnl > 0", accountID).Scan(&stats.WinningTrades)
-		db.QueryRow("SELECT COUNT(*) FROM trades WHERE account_id = ? AND pnl < 0", accountID).Scan(&stats.LosingTrades)
+		db.QueryRow("SELECT COUNT(*) FROM trades t WHERE t.deleted_at IS NULL"+where+" AND pnl > 0", args...).Scan(&stats.WinningTrades)
+		db.QueryRow("SELECT COUNT(*) FROM trades t WHERE t.deleted_at IS NULL"+where+" AND pnl < 0", args...).Scan(&stats.LosingTrades)
 
 		// 勝率
 		if stats.TotalTrades > 0 {
 			stats.WinRate = float64(stats.WinningTrades) / float64(stats.TotalTrades) * 100
 		}
 
-		// 總盈虧
-		db.QueryRow("SELECT COALESCE(SUM(pnl), 0) FROM trades WHERE account_id = ? AND pnl IS NOT NULL", accountID).Scan(&stats.TotalPnL)
+		// 金額依匯率換算為帳號的基礎幣別 (或 currency 參數指定的幣別)
+		trades, err := loadReportTrades(db, where, args)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		cv, ok := newAccountConverter(c, db)
+		if !ok {
+			return
+		}
+		var totalProfit, totalLoss float64
+		for _, t := range trades {
+			rate, ok := cv.rate(t)
+			if !ok {
+				stats.UnconvertedTrades++
+				continue
+			}
+			pnl := t.pnl * rate
+			stats.TotalPnL += pnl
+			if pnl > 0 {
+				totalProfit += pnl
+				stats.LargestWin = math.Max(stats.LargestWin, pnl)
+			} else if pnl < 0 {
+				totalLoss -= pnl
+				stats.LargestLoss = math.Min(stats.LargestLoss, pnl)
+			}
+			// 沒有拆分費用的舊交易以淨盈虧作為毛盈虧
+			stats.GrossPnL += t.gross * rate
+			stats.TotalCommission += t.commission * rate
+			stats.TotalSwap += t.swap * rate
+			stats.TotalFees += t.fees * rate
+		}
 
 		// 平均盈虧
 		if stats.TotalTrades > 0 {
 			stats.AveragePnL = stats.TotalPnL / float64(stats.TotalTrades)
 		}
 
-		// 最大盈利
-		db.QueryRow("SELECT COALESCE(MAX(pnl), 0) FROM trades WHERE account_id = ? AND pnl > 0", accountID).Scan(&stats.LargestWin)
-
-		// 最大虧損
-		db.QueryRow("SELECT COALESCE(MIN(pnl), 0) FROM trades WHERE account_id = ? AND pnl < 0", accountID).Scan(&stats.LargestLoss)
-
 		// 盈虧比（Profit Factor）
-		var totalProfit, totalLoss float64
-		db.QueryRow("SELECT COALESCE(SUM(pnl), 0) FROM trades WHERE account_id = ? AND pnl > 0", accountID).Scan(&totalProfit)
-		db.QueryRow("SELECT COALESCE(ABS(SUM(pnl)), 0) FROM trades WHERE account_id = ? AND pnl < 0", accountID).Scan(&totalLoss)
-
 		if totalLoss > 0 {
 			stats.ProfitFactor = totalProfit / totalLoss
 		}
 
+		stats.TotalCosts = stats.TotalCommission + stats.TotalSwap + stats.TotalFees
+		stats.Currency = cv.currency
+		stats.MissingRates = cv.missingRates()
+
 		c.JSON(http.StatusOK, stats)
 	}
 }
@@ -73,47 +96,37 @@ func GetStatsSummary(db *sql.DB) gin.HandlerFunc {
 // GetEquityCurve 取得淨值曲線
 func GetEquityCurve(db *sql.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userID := c.GetInt64("user_id")
-		accountID := c.Query("account_id")
-		if accountID == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "請提供 account_id"})
-			return
-		}
-
-		// 檢查帳號所屬權
-		var exists int
-		db.QueryRow("SELECT 1 FROM accounts WHERE id = ? AND user_id = ?", accountID, userID).Scan(&exists)
-		if exists == 0 {
-			c.JSON(http.StatusForbidden, gin.H{"error": "無權限操作此帳號"})
+		// 與交易列表使用相同的篩選條件
+		where, args, ok := statsFilter(c, db)
+		if !ok {
 			return
 		}
 
-		rows, err := db.Query(`
-			SELECT DATE(exit_time) as date, SUM(pnl) as daily_pnl
-			FROM trades
-			WHERE account_id = ? AND exit_time IS NOT NULL AND pnl IS NOT NULL
-			GROUP BY DATE(exit_time)
-			ORDER BY date ASC
-		`, accountID)
+		trades, err := loadReportTrades(db, where, args)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		defer rows.Close()
+		cv, ok := newAccountConverter(c, db)
+		if !ok {
+			return
+		}
 
+		// 交易依出場時間排序，同一天的盈虧換算為帳號幣別後累加到同一點，缺少匯率的交易不計入
 		equityCurve := []models.EquityPoint{}
 		cumulativeEquity := 0.0
-
-		for rows.Next() {
-			var date string
-			var dailyPnL float64
-			rows.Scan(&date, &dailyPnL)
-
-			cumulativeEquity += dailyPnL
-			equityCurve = append(equityCurve, models.EquityPoint{
-				Date:   date,
-				Equity: cumulativeEquity,
-			})
+		for _, t := range trades {
+			rate, ok := cv.rate(t)
+			if !ok {
+				continue
+			}
+			cumulativeEquity += t.pnl * rate
+			date := t.closedAt.Format("2006-01-02")
+			if n := len(equityCurve); n > 0 && equityCurve[n-1].Date == date {
+				equityCurve[n-1].Equity = cumulativeEquity
+			} else {
+				equityCurve = append(equityCurve, models.EquityPoint{Date: date, Equity: cumulativeEquity})
+			}
 		}
 
 		c.JSON(http.StatusOK, equityCurve)
@@ -123,146 +136,538 @@ func GetEquityCurve(db *sql.DB) gin.HandlerFunc {
 // GetStatsBySymbol 取得各品種統計
 func GetStatsBySymbol(db *sql.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userID := c.GetInt64("user_id")
-		accountID := c.Query("account_id")
-		if accountID == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "請提供 account_id"})
+		// 與交易列表使用相同的篩選條件
+		where, args, ok := statsFilter(c, db)
+		if !ok {
+			return
+		}
+
+		trades, err := loadReportTrades(db, where, args)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		cv, ok := newAccountConverter(c, db)
+		if !ok {
+			return
+		}
+
+		// 金額換算為帳號幣別，缺少匯率的交易不計入
+		bySymbol := map[string]*models.SymbolStats{}
+		symbolStats := []models.SymbolStats{}
+		for _, t := range trades {
+			rate, ok := cv.rate(t)
+			if !ok {
+				continue
+			}
+			stat := bySymbol[t.symbol]
+			if stat == nil {
+				stat = &models.SymbolStats{Symbol: t.symbol}
+				bySymbol[t.symbol] = stat
+			}
+			stat.TotalTrades++
+			if t.pnl > 0 {
+				stat.WinningTrades++
+			}
+			stat.TotalPnL += t.pnl * rate
+			stat.GrossPnL += t.gross * rate
+			stat.TotalCosts += (t.commission + t.swap + t.fees) * rate
+		}
+		for _, stat := range bySymbol {
+			if stat.TotalTrades > 0 {
+				stat.WinRate = float64(stat.WinningTrades) / float64(stat.TotalTrades) * 100
+			}
+			symbolStats = append(symbolStats, *stat)
+		}
+		sort.Slice(symbolStats, func(i, j int) bool {
+			if symbolStats[i].TotalTrades != symbolStats[j].TotalTrades {
+				return symbolStats[i].TotalTrades > symbolStats[j].TotalTrades
+			}
+			return symbolStats[i].Symbol < symbolStats[j].Symbol
+		})
+
+		c.JSON(http.StatusOK, symbolStats)
+	}
+}
+
+// GetCostStats 交易成本分析：毛盈虧、手續費、隔夜利息與其他費用，依品種與帳號拆分
+// 未指定 account_id 時統計使用者所有帳號，金額依 currency 參數換算為同一幣別
+func GetCostStats(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		where, args, ok := costFilter(c, db)
+		if !ok {
+			return
+		}
+		trades, err := loadReportTrades(db, where, args)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		cv, ok := newCurrencyConverter(c, db, trades)
+		if !ok {
+			return
+		}
+
+		result := models.CostStats{Currency: cv.currency, BySymbol: []models.CostBreakdown{}, ByAccount: []models.CostBreakdown{}}
+		bySymbol := map[string]*models.CostBreakdown{}
+		byAccount := map[int64]*models.CostBreakdown{}
+		for _, t := range trades {
+			rate, ok := cv.rate(t)
+			if !ok {
+				result.UnconvertedTrades++
+				continue
+			}
+			s := bySymbol[t.symbol]
+			if s == nil {
+				s = &models.CostBreakdown{Symbol: t.symbol}
+				bySymbol[t.symbol] = s
+			}
+			a := byAccount[t.accountID]
+			if a == nil {
+				accountID := t.accountID
+				a = &models.CostBreakdown{AccountID: &accountID, AccountName: t.accountName, AccountCurrency: t.accountCurrency}
+				byAccount[t.accountID] = a
+			}
+			for _, b := range []*models.CostBreakdown{&result.CostBreakdown, s, a} {
+				addCosts(b, t, rate)
+			}
+		}
+
+		finishCosts(&result.CostBreakdown)
+		for _, b := range bySymbol {
+			finishCosts(b)
+			result.BySymbol = append(result.BySymbol, *b)
+		}
+		for _, b := range byAccount {
+			finishCosts(b)
+			result.ByAccount = append(result.ByAccount, *b)
+		}
+		// 成本為負值，由成本最高的排到最低
+		sort.Slice(result.BySymbol, func(i, j int) bool {
+			if result.BySymbol[i].TotalCosts != result.BySymbol[j].TotalCosts {
+				return result.BySymbol[i].TotalCosts < result.BySymbol[j].TotalCosts
+			}
+			return result.BySymbol[i].Symbol < result.BySymbol[j].Symbol
+		})
+		sort.Slice(result.ByAccount, func(i, j int) bool {
+			if result.ByAccount[i].TotalCosts != result.ByAccount[j].TotalCosts {
+				return result.ByAccount[i].TotalCosts < result.ByAccount[j].TotalCosts
+			}
+			return *result.ByAccount[i].AccountID < *result.ByAccount[j].AccountID
+		})
+		result.MissingRates = cv.missingRates()
+
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// addCosts 將交易的金額依匯率換算後累加，沒有拆分費用的舊交易以淨盈虧作為毛盈虧
+func addCosts(b *models.CostBreakdown, t reportTrade, rate float64) {
+	b.TotalTrades++
+	b.TotalLots += t.lots
+	b.GrossPnL += t.gross * rate
+	b.Commission += t.commission * rate
+	b.Swap += t.swap * rate
+	b.Fees += t.fees * rate
+	b.NetPnL += t.pnl * rate
+}
+
+// finishCosts 計算總成本與衍生指標
+func finishCosts(b *models.CostBreakdown) {
+	b.TotalCosts = b.Commission + b.Swap + b.Fees
+	if b.TotalTrades > 0 {
+		b.CostPerTrade = b.TotalCosts / float64(b.TotalTrades)
+	}
+	if b.TotalLots > 0 {
+		b.CostPerLot = b.TotalCosts / b.TotalLots
+	}
+	if b.GrossPnL > 0 {
+		b.CostShare = -b.TotalCosts / b.GrossPnL * 100
+	}
+}
+
+// GetPortfolioStats 跨帳號的投資組合統計，所有帳號的盈虧依 currency 參數換算為同一幣別
+// 未指定 account_id 時統計使用者所有帳號，缺少匯率的交易不計入並列出缺少的貨幣對
+func GetPortfolioStats(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		where, args, ok := costFilter(c, db)
+		if !ok {
+			return
+		}
+		trades, err := loadReportTrades(db, where, args)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		cv, ok := newCurrencyConverter(c, db, trades)
+		if !ok {
 			return
 		}
 
-		// 檢查帳號所屬權
-		var exists int
-		db.QueryRow("SELECT 1 FROM accounts WHERE id = ? AND user_id = ?", accountID, userID).Scan(&exists)
-		if exists == 0 {
-			c.JSON(http.StatusForbidden, gin.H{"error": "無權限操作此帳號"})
+		result := models.PortfolioStats{Currency: cv.currency, ByAccount: []models.PortfolioAccount{}, EquityCurve: []models.EquityPoint{}}
+		byAccount := map[int64]*models.PortfolioAccount{}
+		var order []int64
+		var totalProfit, totalLoss, equity float64
+		for _, t := range trades {
+			rate, ok := cv.rate(t)
+			if !ok {
+				result.UnconvertedTrades++
+				continue
+			}
+			pnl := t.pnl * rate
+
+			result.TotalTrades++
+			result.TotalPnL += pnl
+			result.GrossPnL += t.gross * rate
+			result.TotalCosts += (t.commission + t.swap + t.fees) * rate
+			if pnl > 0 {
+				result.WinningTrades++
+				totalProfit += pnl
+			} else if pnl < 0 {
+				result.LosingTrades++
+				totalLoss -= pnl
+			}
+
+			a := byAccount[t.accountID]
+			if a == nil {
+				a = &models.PortfolioAccount{AccountID: t.accountID, Name: t.accountName, Currency: t.accountCurrency}
+				byAccount[t.accountID] = a
+				order = append(order, t.accountID)
+			}
+			a.TotalTrades++
+			a.TotalPnL += pnl
+
+			// 交易依出場時間排序，同一天的盈虧累加到同一點
+			equity += pnl
+			date := t.closedAt.Format("2006-01-02")
+			if n := len(result.EquityCurve); n > 0 && result.EquityCurve[n-1].Date == date {
+				result.EquityCurve[n-1].Equity = equity
+			} else {
+				result.EquityCurve = append(result.EquityCurve, models.EquityPoint{Date: date, Equity: equity})
+			}
+		}
+
+		if result.TotalTrades > 0 {
+			result.WinRate = float64(result.WinningTrades) / float64(result.TotalTrades) * 100
+			result.AveragePnL = result.TotalPnL / float64(result.TotalTrades)
+		}
+		if totalLoss > 0 {
+			result.ProfitFactor = totalProfit / totalLoss
+		}
+		sort.Slice(order, func(i, j int) bool { return order[i] < order[j] })
+		for _, id := range order {
+			result.ByAccount = append(result.ByAccount, *byAccount[id])
+		}
+		result.MissingRates = cv.missingRates()
+
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// GetPlanAdherenceStats 計畫與實際執行的比較：以 R 計算獲利單是否提早出場、虧損單是否超過初始停損
+// 只統計有實際風報比 (需有初始停損) 的已平倉交易，tolerance 為容許誤差 (R，預設 0.1)，並依出場的 ISO 週拆分
+func GetPlanAdherenceStats(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		where, args, ok := statsFilter(c, db)
+		if !ok {
 			return
 		}
+		tolerance := 0.1
+		if v := c.Query("tolerance"); v != "" {
+			t, err := strconv.ParseFloat(v, 64)
+			if err != nil || t < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "tolerance 必須是不小於 0 的數字"})
+				return
+			}
+			tolerance = t
+		}
 
 		rows, err := db.Query(`
-			SELECT 
-				symbol,
-				COUNT(*) as total_trades,
-				SUM(CASE WHEN pnl > 0 THEN 1 ELSE 0 END) as winning_trades,
-				COALESCE(SUM(pnl), 0) as total_pnl
-			FROM trades
-			WHERE account_id = ? AND exit_price IS NOT NULL
-			GROUP BY symbol
-			ORDER BY total_trades DESC
-		`, accountID)
+			SELECT t.id, t.symbol, t.entry_time, t.exit_time, t.rr_ratio, t.planned_rr
+			FROM trades t
+			WHERE t.deleted_at IS NULL`+where+` AND t.exit_price IS NOT NULL AND t.rr_ratio IS NOT NULL
+			ORDER BY t.exit_time ASC, t.id ASC
+		`, args...)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 		defer rows.Close()
 
-		symbolStats := []models.SymbolStats{}
+		result := models.PlanAdherenceStats{Tolerance: tolerance, ByWeek: []models.PlanAdherencePeriod{}, Deviations: []models.PlanDeviation{}}
+		weeks := map[string]*models.PlanAdherencePeriod{}
+		var weekOrder []string
 		for rows.Next() {
-			var stat models.SymbolStats
-			rows.Scan(&stat.Symbol, &stat.TotalTrades, &stat.WinningTrades, &stat.TotalPnL)
+			var d models.PlanDeviation
+			var entryTime time.Time
+			var exitTime *time.Time
+			if err := rows.Scan(&d.TradeID, &d.Symbol, &entryTime, &exitTime, &d.RealizedR, &d.PlannedR); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			closedAt := entryTime
+			if exitTime != nil {
+				closedAt = *exitTime
+			}
+			d.ExitTime = closedAt
 
-			if stat.TotalTrades > 0 {
-				stat.WinRate = float64(stat.WinningTrades) / float64(stat.TotalTrades) * 100
+			year, week := closedAt.ISOWeek()
+			key := fmt.Sprintf("%d-W%02d", year, week)
+			w := weeks[key]
+			if w == nil {
+				w = &models.PlanAdherencePeriod{Week: key}
+				weeks[key] = w
+				weekOrder = append(weekOrder, key)
 			}
 
-			symbolStats = append(symbolStats, stat)
+			d.Kind = classifyPlanDeviation(d.RealizedR, d.PlannedR, tolerance)
+			for _, p := range []*models.PlanAdherencePeriod{&result.PlanAdherencePeriod, w} {
+				addPlanAdherence(p, d)
+			}
+			if d.Kind == models.DeviationCutShort || d.Kind == models.DeviationPastStop {
+				result.Deviations = append(result.Deviations, d)
+			}
 		}
 
-		c.JSON(http.StatusOK, symbolStats)
+		finishPlanAdherence(&result.PlanAdherencePeriod)
+		for _, key := range weekOrder {
+			finishPlanAdherence(weeks[key])
+			result.ByWeek = append(result.ByWeek, *weeks[key])
+		}
+
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// classifyPlanDeviation 依實際與計畫 R 判斷執行結果
+func classifyPlanDeviation(realized float64, planned *float64, tolerance float64) string {
+	switch {
+	case realized > 0 && planned != nil && *planned > 0:
+		if realized < *planned-tolerance {
+			return models.DeviationCutShort
+		}
+		return models.DeviationReachedTarget
+	case realized < -1-tolerance:
+		return models.DeviationPastStop
+	}
+	return ""
+}
+
+// addPlanAdherence 累加單筆交易，平均值先以合計暫存
+func addPlanAdherence(p *models.PlanAdherencePeriod, d models.PlanDeviation) {
+	p.TotalTrades++
+	p.AvgRealizedR += d.RealizedR
+	if d.PlannedR != nil {
+		p.PlannedTrades++
+		p.AvgPlannedR += *d.PlannedR
+	}
+	switch {
+	case d.RealizedR > 0:
+		p.Winners++
+		if d.PlannedR != nil && *d.PlannedR > 0 {
+			p.WinnersWithTarget++
+		}
+	case d.RealizedR < 0:
+		p.Losers++
+	}
+	switch d.Kind {
+	case models.DeviationReachedTarget:
+		p.WinnersReachedTarget++
+	case models.DeviationCutShort:
+		p.WinnersCutShort++
+		p.RLeftOnTable += *d.PlannedR - d.RealizedR
+	case models.DeviationPastStop:
+		p.LosersPastStop++
+		p.RLostPastStop += d.RealizedR + 1
+	}
+}
+
+// finishPlanAdherence 將合計轉為平均並計算比例
+func finishPlanAdherence(p *models.PlanAdherencePeriod) {
+	round := func(v float64) float64 { return math.Round(v*100) / 100 }
+	if p.TotalTrades > 0 {
+		p.AvgRealizedR = round(p.AvgRealizedR / float64(p.TotalTrades))
+	}
+	if p.PlannedTrades > 0 {
+		p.AvgPlannedR = round(p.AvgPlannedR / float64(p.PlannedTrades))
+	}
+	if p.WinnersWithTarget > 0 {
+		p.CutShortRate = float64(p.WinnersCutShort) / float64(p.WinnersWithTarget) * 100
+	}
+	if p.Losers > 0 {
+		p.PastStopRate = float64(p.LosersPastStop) / float64(p.Losers) * 100
+	}
+	p.RLeftOnTable = round(p.RLeftOnTable)
+	p.RLostPastStop = round(p.RLostPastStop)
+}
+
+// GetDailyPlanAdherenceStats 交易與每日規劃方向的比較：依 timeframe (預設 H4) 的規劃方向統計順勢與逆勢交易的表現
+// 並列出逆規劃方向或 trend_type 與規劃不符的交易，by_timeframe 為各週期的遵守比例
+func GetDailyPlanAdherenceStats(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		where, args, ok := statsFilter(c, db)
+		if !ok {
+			return
+		}
+		timeframe, ok := planTimeframe(c)
+		if !ok {
+			return
+		}
+
+		list, err := loadPlanTrades(db, where, args)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		result := models.DailyPlanAdherence{
+			Timeframe:   timeframe,
+			TotalTrades: len(list),
+			ByTimeframe: []models.DailyPlanTimeframeAdherence{},
+			Violations:  []models.DailyPlanTrade{},
+		}
+		groups := map[string]*models.DailyPlanAlignmentStats{
+			dailyplans.Aligned:  &result.Aligned,
+			dailyplans.Against:  &result.Against,
+			dailyplans.NoBias:   &result.NoBias,
+			dailyplans.Unlinked: &result.Unlinked,
+		}
+		for _, t := range list {
+			d := t.check(timeframe)
+			if d.Alignment != dailyplans.Unlinked {
+				result.LinkedTrades++
+			}
+			if d.TrendTypeMismatch {
+				result.TrendTypeMismatches++
+			}
+			addPlanAlignment(groups[d.Alignment], d)
+			if d.Alignment == dailyplans.Against || d.TrendTypeMismatch {
+				result.Violations = append(result.Violations, d)
+			}
+		}
+		result.WithBias = result.Aligned.Trades + result.Against.Trades
+		result.AdherenceRate = adherenceRate(result.Aligned.Trades, result.WithBias)
+		for _, g := range groups {
+			if g.ClosedTrades > 0 {
+				g.WinRate = float64(g.WinningTrades) / float64(g.ClosedTrades) * 100
+			}
+		}
+
+		for _, tf := range dailyplans.Timeframes {
+			s := models.DailyPlanTimeframeAdherence{Timeframe: tf}
+			for _, t := range list {
+				switch t.check(tf).Alignment {
+				case dailyplans.Aligned:
+					s.Aligned++
+				case dailyplans.Against:
+					s.Against++
+				}
+			}
+			s.WithBias = s.Aligned + s.Against
+			s.AdherenceRate = adherenceRate(s.Aligned, s.WithBias)
+			result.ByTimeframe = append(result.ByTimeframe, s)
+		}
+
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// addPlanAlignment 累加單筆交易，盈虧與勝率只計算已平倉交易
+func addPlanAlignment(s *models.DailyPlanAlignmentStats, t models.DailyPlanTrade) {
+	s.Trades++
+	if t.ExitTime == nil || t.PnL == nil {
+		return
+	}
+	s.ClosedTrades++
+	s.TotalPnL += *t.PnL
+	if *t.PnL > 0 {
+		s.WinningTrades++
 	}
 }
 
-// GetStatsByStrategy 取得各策略統計 (包含子項目)
+func adherenceRate(aligned, withBias int) float64 {
+	if withBias == 0 {
+		return 0
+	}
+	return math.Round(float64(aligned)/float64(withBias)*10000) / 100
+}
+
+// GetStatsByStrategy 取得各策略統計 (包含子項目)，子項目名稱依使用者的策略定義
 func GetStatsByStrategy(db *sql.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userID := c.GetInt64("user_id")
-		accountID := c.Query("account_id")
-		if accountID == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "請提供 account_id"})
+		// 與交易列表使用相同的篩選條件
+		where, args, ok := statsFilter(c, db)
+		if !ok {
 			return
 		}
 
-		// 檢查帳號所屬權
-		var exists int
-		db.QueryRow("SELECT 1 FROM accounts WHERE id = ? AND user_id = ?", accountID, userID).Scan(&exists)
-		if exists == 0 {
-			c.JSON(http.StatusForbidden, gin.H{"error": "無權限操作此帳號"})
+		definitions, err := strategies.List(db, c.GetInt64("user_id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
+		byID := make(map[int64]*models.Strategy, len(definitions))
+		for i := range definitions {
+			byID[definitions[i].ID] = &definitions[i]
+		}
 
 		rows, err := db.Query(`
 			SELECT 
-				COALESCE(entry_strategy, 'unspecified') as strategy,
-				entry_signals,
-				entry_checklist,
-				entry_pattern,
-				pnl
-			FROM trades
-			WHERE account_id = ? AND exit_price IS NOT NULL
-		`, accountID)
+				strategy_id,
+				COALESCE(entry_strategy, ''),
+				COALESCE(entry_signals, ''),
+				COALESCE(entry_checklist, ''),
+				COALESCE(entry_pattern, ''),
+				COALESCE(pnl, 0)
+			FROM trades t
+			WHERE t.deleted_at IS NULL`+where+` AND exit_price IS NOT NULL
+		`, args...)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 		defer rows.Close()
 
+		var order []string
 		strategyMap := make(map[string]*models.StrategyStats)
 		// 子項目統計的 Map: strategy -> subitemName -> stats
 		subItemMap := make(map[string]map[string]*models.SubItemStats)
 
 		for rows.Next() {
-			var strategy string
-			var signalsRaw, checklistRaw, patternRaw sql.NullString
+			var strategyID sql.NullInt64
+			var legacy, signals, checklist, patterns string
 			var pnl float64
-			rows.Scan(&strategy, &signalsRaw, &checklistRaw, &patternRaw, &pnl)
+			rows.Scan(&strategyID, &legacy, &signals, &checklist, &patterns, &pnl)
+
+			def := byID[strategyID.Int64]
+			group, code, name := strategyGroup(def, legacy)
 
-			if _, ok := strategyMap[strategy]; !ok {
-				strategyMap[strategy] = &models.StrategyStats{
-					Strategy: strategy,
+			if _, ok := strategyMap[group]; !ok {
+				stat := &models.StrategyStats{
+					Strategy:     code,
+					Name:         name,
 					SubItemStats: []models.SubItemStats{}, // 初始化為空陣列
 				}
-				subItemMap[strategy] = make(map[string]*models.SubItemStats)
+				if def != nil {
+					stat.StrategyID = &def.ID
+				}
+				strategyMap[group] = stat
+				subItemMap[group] = make(map[string]*models.SubItemStats)
+				order = append(order, group)
 			}
 
-			s := strategyMap[strategy]
+			s := strategyMap[group]
 			s.TotalTrades++
 			if pnl > 0 {
 				s.WinningTrades++
 			}
 			s.TotalPnL += pnl
 
-			// 處理子項目
-			var items []string
-			if strategy == "expert" && signalsRaw.Valid && signalsRaw.String != "[]" && signalsRaw.String != "" {
-				var sigs []string
-				json.Unmarshal([]byte(signalsRaw.String), &sigs)
-				items = sigs
-			} else if (strategy == "elite" || strategy == "legend") && checklistRaw.Valid && checklistRaw.String != "{}" && checklistRaw.String != "" {
-				var checklist map[string]bool
-				json.Unmarshal([]byte(checklistRaw.String), &checklist)
-				for item, checked := range checklist {
-					if checked {
-						items = append(items, item)
-					}
-				}
-			}
-			
-			// 菁英還有樣態
-			if strategy == "elite" && patternRaw.Valid && patternRaw.String != "[]" && patternRaw.String != "" {
-				var patterns []struct{ Name string }
-				json.Unmarshal([]byte(patternRaw.String), &patterns)
-				for _, p := range patterns {
-					if p.Name != "" {
-						items = append(items, "樣態: "+p.Name)
-					}
-				}
-			}
-
-			for _, itemName := range items {
-				if itemName == "" { continue }
-				if _, ok := subItemMap[strategy][itemName]; !ok {
-					subItemMap[strategy][itemName] = &models.SubItemStats{Name: itemName}
+			for _, itemName := range strategies.Items(def, signals, checklist, patterns) {
+				if _, ok := subItemMap[group][itemName]; !ok {
+					subItemMap[group][itemName] = &models.SubItemStats{Name: itemName}
 				}
-				sub := subItemMap[strategy][itemName]
+				sub := subItemMap[group][itemName]
 				sub.TotalTrades++
 				if pnl > 0 {
 					sub.WinningTrades++
@@ -272,50 +677,233 @@ func GetStatsByStrategy(db *sql.DB) gin.HandlerFunc {
 		}
 
 		result := []models.StrategyStats{}
-		for stra, s := range strategyMap {
+		for _, group := range order {
+			s := strategyMap[group]
 			if s.TotalTrades > 0 {
 				s.WinRate = float64(s.WinningTrades) / float64(s.TotalTrades) * 100
 			}
 
 			// 轉換子項目 Map 為 Slice 並排序
-			for _, sub := range subItemMap[stra] {
+			for _, sub := range subItemMap[group] {
 				if sub.TotalTrades > 0 {
 					sub.WinRate = float64(sub.WinningTrades) / float64(sub.TotalTrades) * 100
 				}
 				s.SubItemStats = append(s.SubItemStats, *sub)
 			}
 			sort.Slice(s.SubItemStats, func(i, j int) bool {
-				return s.SubItemStats[i].TotalTrades > s.SubItemStats[j].TotalTrades
+				if s.SubItemStats[i].TotalTrades != s.SubItemStats[j].TotalTrades {
+					return s.SubItemStats[i].TotalTrades > s.SubItemStats[j].TotalTrades
+				}
+				return s.SubItemStats[i].Name < s.SubItemStats[j].Name
 			})
 
 			result = append(result, *s)
 		}
 
-		// 如果完全沒資料，回傳空陣列而不是 null
-		if len(result) == 0 {
-			c.JSON(http.StatusOK, []models.StrategyStats{})
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// maeBucketEdges MAE 分佈的 R 區間邊界，最後一個區間沒有上限
+var maeBucketEdges = []float64{0, 0.25, 0.5, 0.75, 1, 1.5}
+
+// GetExcursionStats MAE / MFE 與最佳出場統計，整體與依策略拆分
+// 只統計已由 K 線計算出 MAE / MFE 的已平倉交易，R 相關統計只包含有初始停損的交易
+func GetExcursionStats(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		where, args, ok := statsFilter(c, db)
+		if !ok {
 			return
 		}
 
+		definitions, err := strategies.List(db, c.GetInt64("user_id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		byID := make(map[int64]*models.Strategy, len(definitions))
+		for i := range definitions {
+			byID[definitions[i].ID] = &definitions[i]
+		}
+
+		rows, err := db.Query(`
+			SELECT t.strategy_id, COALESCE(t.entry_strategy, ''), COALESCE(t.pnl, 0), t.rr_ratio, t.mae_r, t.mfe_r, t.mae_exceeded_sl, t.excursion_timeframe
+			FROM trades t
+			WHERE t.deleted_at IS NULL`+where+` AND t.exit_price IS NOT NULL
+			ORDER BY t.entry_time ASC, t.id ASC
+		`, args...)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer rows.Close()
+
+		result := models.ExcursionReport{ByStrategy: []models.ExcursionStats{}}
+		overall := &excursionAccumulator{stat: &result.Overall}
+		groups := map[string]*excursionAccumulator{}
+		var order []string
+		for rows.Next() {
+			var strategyID sql.NullInt64
+			var legacy string
+			var t excursionTrade
+			var timeframe sql.NullString
+			if err := rows.Scan(&strategyID, &legacy, &t.pnl, &t.realizedR, &t.maeR, &t.mfeR, &t.exceededSL, &timeframe); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			if !timeframe.Valid {
+				result.MissingBars++
+				continue
+			}
+
+			def := byID[strategyID.Int64]
+			group, code, name := strategyGroup(def, legacy)
+			acc := groups[group]
+			if acc == nil {
+				acc = &excursionAccumulator{stat: &models.ExcursionStats{Strategy: code, Name: name}}
+				if def != nil {
+					acc.stat.StrategyID = &def.ID
+				}
+				groups[group] = acc
+				order = append(order, group)
+			}
+			overall.add(t)
+			acc.add(t)
+		}
+		if err := rows.Err(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		overall.finish()
+		for _, group := range order {
+			groups[group].finish()
+			result.ByStrategy = append(result.ByStrategy, *groups[group].stat)
+		}
 		c.JSON(http.StatusOK, result)
 	}
 }
 
+// excursionTrade 計算偏移統計所需的交易欄位
+type excursionTrade struct {
+	pnl        float64
+	realizedR  *float64
+	maeR       *float64
+	mfeR       *float64
+	exceededSL sql.NullBool
+}
+
+// excursionAccumulator 累計單一分組的偏移，分佈在 finish 時計算
+type excursionAccumulator struct {
+	stat            *models.ExcursionStats
+	mae, mfe        []float64
+	winnersMAE      []float64
+	rLeft           float64
+	rLeftTrades     int
+	captured, ideal float64
+}
+
+func (a *excursionAccumulator) add(t excursionTrade) {
+	a.stat.Trades++
+	if t.maeR == nil || t.mfeR == nil {
+		return
+	}
+	a.stat.TradesWithR++
+	a.mae = append(a.mae, *t.maeR)
+	a.mfe = append(a.mfe, *t.mfeR)
+	if t.pnl > 0 {
+		a.winnersMAE = append(a.winnersMAE, *t.maeR)
+	}
+	if t.exceededSL.Valid && t.exceededSL.Bool {
+		a.stat.ExceededSL++
+	}
+	if t.realizedR != nil {
+		a.rLeft += *t.mfeR - *t.realizedR
+		a.rLeftTrades++
+		if *t.realizedR > 0 && *t.mfeR > 0 {
+			a.captured += *t.realizedR
+			a.ideal += *t.mfeR
+		}
+	}
+}
+
+func (a *excursionAccumulator) finish() {
+	round := func(v float64) float64 { return math.Round(v*100) / 100 }
+	s := a.stat
+	s.MAER = excursionDistribution(a.mae)
+	s.MFER = excursionDistribution(a.mfe)
+	s.WinnersMAER = excursionDistribution(a.winnersMAE)
+
+	s.MAEBuckets = make([]models.ExcursionBucket, len(maeBucketEdges))
+	for i, from := range maeBucketEdges {
+		s.MAEBuckets[i].From = from
+		if i+1 < len(maeBucketEdges) {
+			to := maeBucketEdges[i+1]
+			s.MAEBuckets[i].To = &to
+		}
+	}
+	for _, v := range a.mae {
+		i := sort.Search(len(maeBucketEdges), func(i int) bool { return maeBucketEdges[i] > v }) - 1
+		if i < 0 {
+			i = 0
+		}
+		s.MAEBuckets[i].Count++
+	}
+
+	if s.TradesWithR > 0 {
+		s.ExceededSLRate = round(float64(s.ExceededSL) / float64(s.TradesWithR) * 100)
+	}
+	if a.rLeftTrades > 0 {
+		s.AvgRLeft = round(a.rLeft / float64(a.rLeftTrades))
+	}
+	if a.ideal > 0 {
+		s.CaptureRate = round(a.captured / a.ideal * 100)
+	}
+}
+
+// excursionDistribution 平均與百分位數 (nearest-rank)，沒有資料時為零值
+func excursionDistribution(values []float64) models.ExcursionDistribution {
+	var d models.ExcursionDistribution
+	if len(values) == 0 {
+		return d
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	percentile := func(p float64) float64 {
+		return sorted[int(math.Ceil(p*float64(len(sorted))))-1]
+	}
+	var sum float64
+	for _, v := range sorted {
+		sum += v
+	}
+	d.Avg = math.Round(sum/float64(len(sorted))*100) / 100
+	d.P50, d.P75, d.P90 = percentile(0.5), percentile(0.75), percentile(0.9)
+	d.Max = sorted[len(sorted)-1]
+	return d
+}
+
+// strategyGroup 依策略定義分組，沒有對應定義的舊資料沿用 entry_strategy
+// 回傳分組 key、策略代碼 (內建策略代碼，自訂策略為名稱) 與顯示名稱
+func strategyGroup(def *models.Strategy, legacy string) (group, code, name string) {
+	if def == nil {
+		if legacy == "" {
+			legacy = strategies.Unspecified
+		}
+		return legacy, legacy, legacy
+	}
+	code = def.Name
+	if def.BuiltinKey != nil {
+		code = *def.BuiltinKey
+	}
+	return fmt.Sprintf("id:%d", def.ID), code, def.Name
+}
+
 // GetStatsByColorTag 取得顏色標籤統計
 func GetStatsByColorTag(db *sql.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userID := c.GetInt64("user_id")
-		accountID := c.Query("account_id")
-		if accountID == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "請提供 account_id"})
-			return
-		}
-
-		// 檢查帳號所屬權
-		var exists int
-		db.QueryRow("SELECT 1 FROM accounts WHERE id = ? AND user_id = ?", accountID, userID).Scan(&exists)
-		if exists == 0 {
-			c.JSON(http.StatusForbidden, gin.H{"error": "無權限操作此帳號"})
+		// 與交易列表使用相同的篩選條件
+		where, args, ok := statsFilter(c, db)
+		if !ok {
 			return
 		}
 
@@ -325,11 +913,11 @@ func GetStatsByColorTag(db *sql.DB) gin.HandlerFunc {
 				COUNT(*) as total_trades,
 				SUM(CASE WHEN pnl > 0 THEN 1 ELSE 0 END) as winning_trades,
 				COALESCE(SUM(pnl), 0) as total_pnl
-			FROM trades
-			WHERE account_id = ? AND exit_price IS NOT NULL AND color_tag IS NOT NULL AND color_tag != ''
+			FROM trades t
+			WHERE t.deleted_at IS NULL`+where+` AND exit_price IS NOT NULL AND color_tag IS NOT NULL AND color_tag != ''
 			GROUP BY color_tag
 			ORDER BY total_trades DESC
-		`, accountID)
+		`, args...)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
@@ -351,3 +939,377 @@ func GetStatsByColorTag(db *sql.DB) gin.HandlerFunc {
 		c.JSON(http.StatusOK, colorStats)
 	}
 }
+
+// GetStatsByField 依自訂欄位的值分組統計，多選欄位的每個選項各自計算
+func GetStatsByField(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// 與交易列表使用相同的篩選條件
+		where, args, ok := statsFilter(c, db)
+		if !ok {
+			return
+		}
+
+		field, err := customfields.GetByKey(db, c.GetInt64("user_id"), c.Param("key"))
+		if err == customfields.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		rows, err := db.Query(`
+			SELECT fv.value, COALESCE(t.pnl, 0)
+			FROM trades t
+			LEFT JOIN trade_custom_values fv ON fv.trade_id = t.id AND fv.field_id = ?
+			WHERE t.deleted_at IS NULL`+where+` AND t.exit_price IS NOT NULL
+		`, append([]interface{}{field.ID}, args...)...)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer rows.Close()
+
+		// 未填寫的交易以空字串分組，輸出時 value 為 null
+		groups := make(map[string]*models.FieldStats)
+		for rows.Next() {
+			var value sql.NullString
+			var pnl float64
+			rows.Scan(&value, &pnl)
+
+			keys := []string{""}
+			if value.Valid {
+				keys = []string{value.String}
+				if field.FieldType == customfields.TypeMultiSelect {
+					keys, _ = customfields.Decode(field.FieldType, value.String).([]string)
+				}
+			}
+			for _, key := range keys {
+				stat, ok := groups[key]
+				if !ok {
+					stat = &models.FieldStats{}
+					if key != "" {
+						stat.Value = key
+						if field.FieldType != customfields.TypeMultiSelect {
+							stat.Value = customfields.Decode(field.FieldType, key)
+						}
+					}
+					groups[key] = stat
+				}
+				stat.TotalTrades++
+				stat.TotalPnL += pnl
+				if pnl > 0 {
+					stat.WinningTrades++
+				}
+			}
+		}
+
+		// 選單欄位依選項順序，其他類型依交易數排序，未填寫的排在最後
+		position := make(map[string]int, len(field.Options))
+		for i, o := range field.Options {
+			position[o] = i
+		}
+		keys := make([]string, 0, len(groups))
+		for key := range groups {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			a, b := keys[i], keys[j]
+			if (a == "") != (b == "") {
+				return b == ""
+			}
+			pa, okA := position[a]
+			pb, okB := position[b]
+			if okA && okB {
+				return pa < pb
+			}
+			if okA != okB {
+				return okA
+			}
+			if groups[a].TotalTrades != groups[b].TotalTrades {
+				return groups[a].TotalTrades > groups[b].TotalTrades
+			}
+			return a < b
+		})
+
+		fieldStats := make([]models.FieldStats, 0, len(keys))
+		for _, key := range keys {
+			stat := groups[key]
+			stat.WinRate = float64(stat.WinningTrades) / float64(stat.TotalTrades) * 100
+			fieldStats = append(fieldStats, *stat)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"field": field, "stats": fieldStats})
+	}
+}
+
+// GetReviewStats 取得檢討進度與各錯誤類型的代價 (盈虧與 R)，只計算已平倉交易
+// 同一筆交易標記多個錯誤時計入每個錯誤；Clean 為已檢討且沒有錯誤的交易，作為比較基準
+func GetReviewStats(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		where, args, ok := statsFilter(c, db)
+		if !ok {
+			return
+		}
+		where += " AND t.exit_price IS NOT NULL"
+
+		type closedTrade struct {
+			pnl, r *float64
+			status string
+			grade  string
+		}
+		trades := map[int64]closedTrade{}
+		rows, err := db.Query(`
+			SELECT t.id, t.pnl, t.rr_ratio, COALESCE(t.review_status, 'unreviewed'), COALESCE(t.quality_grade, '')
+			FROM trades t WHERE t.deleted_at IS NULL`+where, args...)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		for rows.Next() {
+			var id int64
+			var t closedTrade
+			if err := rows.Scan(&id, &t.pnl, &t.r, &t.status, &t.grade); err != nil {
+				rows.Close()
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			trades[id] = t
+		}
+		rows.Close()
+
+		tradeMistakes := map[int64][]int64{}
+		rows, err = db.Query(`
+			SELECT tm.trade_id, tm.mistake_id FROM trade_mistakes tm JOIN trades t ON tm.trade_id = t.id
+			WHERE t.deleted_at IS NULL`+where, args...)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		for rows.Next() {
+			var tradeID, mistakeID int64
+			if err := rows.Scan(&tradeID, &mistakeID); err != nil {
+				rows.Close()
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			tradeMistakes[tradeID] = append(tradeMistakes[tradeID], mistakeID)
+		}
+		rows.Close()
+
+		definitions, err := reviews.List(db, c.GetInt64("user_id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		result := models.ReviewStats{
+			TotalTrades: len(trades),
+			Clean:       models.MistakeStats{Name: "clean"},
+			Mistakes:    make([]models.MistakeStats, len(definitions)),
+			ByGrade:     []models.MistakeStats{},
+		}
+		byMistake := make(map[int64]*models.MistakeStats, len(definitions))
+		for i, m := range definitions {
+			id := m.ID
+			result.Mistakes[i] = models.MistakeStats{MistakeID: &id, Name: m.Name}
+			byMistake[id] = &result.Mistakes[i]
+		}
+		byGrade := map[string]*models.MistakeStats{}
+		for _, g := range reviews.Grades {
+			byGrade[g] = &models.MistakeStats{Name: g}
+		}
+
+		for id, t := range trades {
+			switch t.status {
+			case reviews.Reviewed:
+				result.Reviewed++
+			case reviews.NeedsMentor:
+				result.NeedsMentor++
+			default:
+				result.Unreviewed++
+			}
+			for _, mistakeID := range tradeMistakes[id] {
+				if s, ok := byMistake[mistakeID]; ok {
+					addOutcome(&s.OutcomeStats, t.pnl, t.r)
+				}
+			}
+			if len(tradeMistakes[id]) == 0 && t.status != reviews.Unreviewed {
+				addOutcome(&result.Clean.OutcomeStats, t.pnl, t.r)
+			}
+			if s, ok := byGrade[t.grade]; ok {
+				addOutcome(&s.OutcomeStats, t.pnl, t.r)
+			}
+		}
+
+		result.ReviewRate = adherenceRate(result.Reviewed+result.NeedsMentor, result.TotalTrades)
+		finishOutcome(&result.Clean.OutcomeStats)
+		for i := range result.Mistakes {
+			finishOutcome(&result.Mistakes[i].OutcomeStats)
+		}
+		sort.SliceStable(result.Mistakes, func(i, j int) bool {
+			return result.Mistakes[i].TotalPnL < result.Mistakes[j].TotalPnL
+		})
+		for _, g := range reviews.Grades {
+			if s := byGrade[g]; s.Trades > 0 {
+				finishOutcome(&s.OutcomeStats)
+				result.ByGrade = append(result.ByGrade, *s)
+			}
+		}
+
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+func addOutcome(s *models.OutcomeStats, pnl, r *float64) {
+	s.Trades++
+	if pnl != nil {
+		s.TotalPnL += *pnl
+		if *pnl > 0 {
+			s.WinningTrades++
+		}
+	}
+	if r != nil {
+		s.TradesWithR++
+		s.TotalR += *r
+	}
+}
+
+func finishOutcome(s *models.OutcomeStats) {
+	if s.Trades > 0 {
+		s.AvgPnL = s.TotalPnL / float64(s.Trades)
+		s.WinRate = adherenceRate(s.WinningTrades, s.Trades)
+	}
+	if s.TradesWithR > 0 {
+		s.AvgR = s.TotalR / float64(s.TradesWithR)
+	}
+}
+
+// GetStatsByTag 取得各標籤與標籤分組的已平倉交易統計
+// 一筆交易有多個標籤時計入每個標籤，分組內只計算一次；未分組的標籤歸在 group_id 為 null 的分組並排在最後
+func GetStatsByTag(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		where, args, ok := statsFilter(c, db)
+		if !ok {
+			return
+		}
+		where += " AND t.exit_price IS NOT NULL"
+
+		type closedTrade struct{ pnl, r *float64 }
+		trades := map[int64]closedTrade{}
+		rows, err := db.Query("SELECT t.id, t.pnl, t.rr_ratio FROM trades t WHERE t.deleted_at IS NULL"+where, args...)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		for rows.Next() {
+			var id int64
+			var t closedTrade
+			if err := rows.Scan(&id, &t.pnl, &t.r); err != nil {
+				rows.Close()
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			trades[id] = t
+		}
+		rows.Close()
+
+		tradeTags := map[int64][]int64{}
+		rows, err = db.Query(`
+			SELECT tt.trade_id, tt.tag_id FROM trade_tags tt JOIN trades t ON tt.trade_id = t.id
+			WHERE t.deleted_at IS NULL`+where, args...)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		for rows.Next() {
+			var tradeID, tagID int64
+			if err := rows.Scan(&tradeID, &tagID); err != nil {
+				rows.Close()
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			tradeTags[tradeID] = append(tradeTags[tradeID], tagID)
+		}
+		rows.Close()
+
+		userID := c.GetInt64("user_id")
+		definitions, err := tags.List(db, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		groups, err := tags.ListGroups(db, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		// 分組依 position 排列，未分組的標籤放在最後一組
+		groupStats := make([]models.TagGroupStats, len(groups)+1)
+		groupIndex := map[int64]int{}
+		for i, g := range groups {
+			id := g.ID
+			groupStats[i] = models.TagGroupStats{GroupID: &id, Name: g.Name, Color: g.Color}
+			groupIndex[g.ID] = i
+		}
+		ungrouped := len(groups)
+		groupStats[ungrouped] = models.TagGroupStats{}
+
+		tagStats := make(map[int64]*models.TagStats, len(definitions))
+		tagGroup := make(map[int64]int, len(definitions))
+		for _, d := range definitions {
+			id := d.ID
+			tagStats[d.ID] = &models.TagStats{TagID: &id, Name: d.Name, Color: d.Color}
+			tagGroup[d.ID] = ungrouped
+			if d.GroupID != nil {
+				if i, ok := groupIndex[*d.GroupID]; ok {
+					tagGroup[d.ID] = i
+				}
+			}
+		}
+
+		var report models.TagStatsReport
+		for id, t := range trades {
+			if len(tradeTags[id]) == 0 {
+				addOutcome(&report.Untagged, t.pnl, t.r)
+				continue
+			}
+			counted := map[int]bool{}
+			for _, tagID := range tradeTags[id] {
+				s, ok := tagStats[tagID]
+				if !ok {
+					continue
+				}
+				addOutcome(&s.OutcomeStats, t.pnl, t.r)
+				if g := tagGroup[tagID]; !counted[g] {
+					counted[g] = true
+					addOutcome(&groupStats[g].OutcomeStats, t.pnl, t.r)
+				}
+			}
+		}
+		finishOutcome(&report.Untagged)
+
+		for _, d := range definitions {
+			s := tagStats[d.ID]
+			if s.Trades == 0 {
+				continue
+			}
+			finishOutcome(&s.OutcomeStats)
+			g := &groupStats[tagGroup[d.ID]]
+			g.Tags = append(g.Tags, *s)
+		}
+		report.Groups = []models.TagGroupStats{}
+		for _, g := range groupStats {
+			if g.Trades == 0 {
+				continue
+			}
+			finishOutcome(&g.OutcomeStats)
+			sort.SliceStable(g.Tags, func(i, j int) bool { return g.Tags[i].Trades > g.Tags[j].Trades })
+			report.Groups = append(report.Groups, g)
+		}
+
+		c.JSON(http.StatusOK, report)
+	}
+}
@@ -0,0 +1,348 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"trade-journal/internal/dailyplans"
+	"trade-journal/internal/models"
+)
+
+func TestGetCostStats(t *testing.T) {
+	s := newStatsTestServer(t,
+		"INSERT INTO users (id, username, password) VALUES (1, 'alice', 'x'), (2, 'bob', 'x')",
+		"INSERT INTO accounts (id, user_id, name) VALUES (10, 1, 'main'), (11, 1, 'prop'), (20, 2, 'other')",
+		// 104 為沒有拆分費用的舊交易，毛盈虧視為等於淨盈虧；105 屬於其他使用者
+		`INSERT INTO trades (id, account_id, symbol, side, entry_price, lot_size, exit_price, pnl, gross_pnl, commission, swap, fees, entry_time) VALUES
+			(101, 10, 'XAUUSD', 'long', 1, 2, 2, 90, 100, -7, -3, 0, '2024-05-01 08:00:00'),
+			(102, 10, 'XAUUSD', 'short', 1, 1, 2, -55, -50, -5, 0, 0, '2024-05-01 08:00:00'),
+			(103, 11, 'NAS100', 'long', 1, 1, 2, 18, 20, -1, 0, -1, '2024-05-01 08:00:00'),
+			(104, 11, 'NAS100', 'long', 1, 1, 2, 10, NULL, NULL, NULL, NULL, '2024-05-01 08:00:00'),
+			(105, 20, 'XAUUSD', 'long', 1, 1, 2, 1000, 1100, -100, 0, 0, '2024-05-01 08:00:00')`,
+	)
+
+	var costs models.CostStats
+	s.get("/stats/costs", &costs)
+	if costs.TotalTrades != 4 || costs.GrossPnL != 80 || costs.TotalCosts != -17 || costs.NetPnL != 63 {
+		t.Fatalf("總計錯誤 (不應包含其他使用者): %+v", costs.CostBreakdown)
+	}
+	if costs.Commission != -13 || costs.Swap != -3 || costs.Fees != -1 {
+		t.Fatalf("費用拆分錯誤: %+v", costs.CostBreakdown)
+	}
+	if len(costs.BySymbol) != 2 || costs.BySymbol[0].Symbol != "XAUUSD" || costs.BySymbol[0].TotalCosts != -15 || costs.BySymbol[0].CostPerLot != -5 {
+		t.Fatalf("品種拆分錯誤: %+v", costs.BySymbol)
+	}
+	if len(costs.ByAccount) != 2 || *costs.ByAccount[1].AccountID != 11 || costs.ByAccount[1].AccountName != "prop" || costs.ByAccount[1].CostShare != 2.0/30*100 {
+		t.Fatalf("帳號拆分錯誤: %+v", costs.ByAccount)
+	}
+
+	costs = models.CostStats{}
+	s.get("/stats/costs?account_id=11", &costs)
+	if costs.TotalTrades != 2 || len(costs.ByAccount) != 1 {
+		t.Fatalf("帳號篩選錯誤: %+v", costs)
+	}
+
+	if code := s.do("GET", "/stats/costs?account_id=20", "", nil); code != 403 {
+		t.Fatalf("其他使用者的帳號應拒絕, got %d", code)
+	}
+
+	var stats models.StatsSummary
+	s.get("/stats/summary?account_id=10", &stats)
+	if stats.TotalPnL != 35 || stats.GrossPnL != 50 || stats.TotalCommission != -12 || stats.TotalCosts != -15 {
+		t.Fatalf("摘要的毛/淨盈虧錯誤: %+v", stats)
+	}
+}
+
+func TestBalancePnL(t *testing.T) {
+	f := func(v float64) *float64 { return &v }
+
+	req := models.TradeCreate{GrossPnL: f(100), Commission: f(-7), Swap: f(-2.5)}
+	balancePnL(&req)
+	if req.PnL == nil || *req.PnL != 90.5 {
+		t.Fatalf("應由毛盈虧推算淨盈虧, got %v", req.PnL)
+	}
+
+	req = models.TradeCreate{PnL: f(40), Fees: f(-5)}
+	balancePnL(&req)
+	if req.GrossPnL == nil || *req.GrossPnL != 45 {
+		t.Fatalf("應由淨盈虧推算毛盈虧, got %v", req.GrossPnL)
+	}
+
+	req = models.TradeCreate{PnL: f(40)}
+	balancePnL(&req)
+	if req.GrossPnL != nil {
+		t.Fatalf("沒有費用時不應填入毛盈虧")
+	}
+}
+
+func TestGetPortfolioStats(t *testing.T) {
+	s := newStatsTestServer(t,
+		"INSERT INTO users (id, username, password) VALUES (1, 'alice', 'x')",
+		"INSERT INTO accounts (id, user_id, name, currency) VALUES (10, 1, 'personal', 'USD'), (11, 1, 'prop', 'EUR')",
+		`INSERT INTO fx_rates (user_id, base, quote, rate_date, rate) VALUES (1, 'EUR', 'USD', '2024-05-01', 1.1), (1, 'EUR', 'USD', '2024-05-02', 1.2)`,
+		// 103 以帳號幣別 (EUR) 計算，104 記錄為 GBP 但沒有匯率
+		`INSERT INTO trades (id, account_id, symbol, side, entry_price, lot_size, exit_price, pnl, entry_time, exit_time, pnl_currency) VALUES
+			(101, 10, 'XAUUSD', 'long', 1, 1, 2, 100, '2024-05-01 08:00:00', '2024-05-01 10:00:00', NULL),
+			(102, 10, 'XAUUSD', 'long', 1, 1, 2, -30, '2024-05-01 08:00:00', '2024-05-01 12:00:00', NULL),
+			(103, 11, 'GER40', 'long', 1, 1, 2, 50, '2024-05-02 08:00:00', '2024-05-02 10:00:00', NULL),
+			(104, 11, 'GBPUSD', 'long', 1, 1, 2, 10, '2024-05-02 08:00:00', '2024-05-02 10:00:00', 'GBP')`,
+	)
+
+	get := func(url string) models.PortfolioStats {
+		t.Helper()
+		var out models.PortfolioStats
+		s.get(url, &out)
+		return out
+	}
+
+	// 帳號幣別不同時預設以 USD 報表，EUR 交易依出場日的匯率換算
+	p := get("/stats/portfolio")
+	if p.Currency != "USD" || p.TotalTrades != 3 || p.TotalPnL != 130 {
+		t.Fatalf("USD 報表錯誤: %+v", p)
+	}
+	if p.UnconvertedTrades != 1 || len(p.MissingRates) != 1 || p.MissingRates[0] != "GBP/USD" {
+		t.Fatalf("應列出缺少的匯率: %+v", p)
+	}
+	if len(p.ByAccount) != 2 || p.ByAccount[1].Currency != "EUR" || p.ByAccount[1].TotalPnL != 60 {
+		t.Fatalf("帳號拆分錯誤: %+v", p.ByAccount)
+	}
+	if len(p.EquityCurve) != 2 || p.EquityCurve[0].Equity != 70 || p.EquityCurve[1].Equity != 130 {
+		t.Fatalf("淨值曲線錯誤: %+v", p.EquityCurve)
+	}
+
+	p = get("/stats/portfolio?currency=eur&account_id=10")
+	if p.Currency != "EUR" || p.TotalTrades != 2 || p.TotalPnL != 70/1.1 {
+		t.Fatalf("EUR 報表錯誤: %+v", p)
+	}
+
+	if code := s.do("GET", "/stats/portfolio?currency=dollars", "", nil); code != 400 {
+		t.Fatalf("無效的幣別應回傳 400, got %d", code)
+	}
+}
+
+func TestAccountStatsConvertPnLCurrency(t *testing.T) {
+	s := newStatsTestServer(t,
+		"INSERT INTO users (id, username, password) VALUES (1, 'alice', 'x')",
+		"INSERT INTO accounts (id, user_id, name, currency) VALUES (11, 1, 'prop', 'EUR')",
+		`INSERT INTO fx_rates (user_id, base, quote, rate_date, rate) VALUES (1, 'EUR', 'USD', '2024-05-01', 1.25)`,
+		// 102 的盈虧以 USD 記錄，應換算為帳號幣別 (EUR)；103 為 GBP 且沒有匯率
+		`INSERT INTO trades (id, account_id, symbol, side, entry_price, lot_size, exit_price, pnl, gross_pnl, commission, entry_time, exit_time, pnl_currency) VALUES
+			(101, 11, 'GER40', 'long', 1, 1, 2, 50, 55, -5, '2024-05-01 08:00:00', '2024-05-01 10:00:00', NULL),
+			(102, 11, 'GER40', 'long', 1, 1, 2, -100, -90, -10, '2024-05-01 08:00:00', '2024-05-01 12:00:00', 'USD'),
+			(103, 11, 'GBPUSD', 'long', 1, 1, 2, 10, 10, 0, '2024-05-02 08:00:00', '2024-05-02 10:00:00', 'GBP')`,
+	)
+
+	var stats models.StatsSummary
+	s.get("/stats/summary?account_id=11", &stats)
+	if stats.Currency != "EUR" || stats.TotalPnL != -30 || stats.LargestLoss != -80 || stats.GrossPnL != -17 || stats.TotalCommission != -13 {
+		t.Fatalf("摘要應換算為帳號幣別: %+v", stats)
+	}
+	if stats.UnconvertedTrades != 1 || len(stats.MissingRates) != 1 || stats.MissingRates[0] != "GBP/EUR" {
+		t.Fatalf("應列出缺少的匯率: %+v", stats)
+	}
+
+	var curve []models.EquityPoint
+	s.get("/stats/equity-curve?account_id=11", &curve)
+	if len(curve) != 1 || curve[0].Date != "2024-05-01" || curve[0].Equity != -30 {
+		t.Fatalf("淨值曲線應換算為帳號幣別: %+v", curve)
+	}
+
+	var symbols []models.SymbolStats
+	s.get("/stats/by-symbol?account_id=11", &symbols)
+	if len(symbols) != 1 || symbols[0].Symbol != "GER40" || symbols[0].TotalTrades != 2 || symbols[0].TotalPnL != -30 || symbols[0].TotalCosts != -13 {
+		t.Fatalf("品種統計應換算為帳號幣別: %+v", symbols)
+	}
+
+	stats = models.StatsSummary{}
+	s.get("/stats/summary?account_id=11&currency=usd", &stats)
+	if stats.Currency != "USD" || stats.TotalPnL != -37.5 {
+		t.Fatalf("指定 currency 時應換算為該幣別: %+v", stats)
+	}
+}
+
+func TestGetPlanAdherenceStats(t *testing.T) {
+	s := newStatsTestServer(t,
+		"INSERT INTO users (id, username, password) VALUES (1, 'alice', 'x')",
+		"INSERT INTO accounts (id, user_id, name) VALUES (10, 1, 'main')",
+		// 101 達標、102 提早出場、103 虧損超過停損、104 正常停損 (下一週)、105 沒有初始停損不列入
+		`INSERT INTO trades (id, account_id, symbol, side, entry_price, lot_size, exit_price, pnl, rr_ratio, planned_rr, entry_time, exit_time) VALUES
+			(101, 10, 'XAUUSD', 'long', 1, 1, 2, 30, 2.95, 3, '2024-05-06 08:00:00', '2024-05-06 10:00:00'),
+			(102, 10, 'XAUUSD', 'long', 1, 1, 2, 10, 1, 3, '2024-05-07 08:00:00', '2024-05-07 10:00:00'),
+			(103, 10, 'NAS100', 'long', 1, 1, 2, -15, -1.5, 2, '2024-05-08 08:00:00', '2024-05-08 10:00:00'),
+			(104, 10, 'NAS100', 'long', 1, 1, 2, -10, -1, 2, '2024-05-13 08:00:00', '2024-05-13 10:00:00'),
+			(105, 10, 'NAS100', 'long', 1, 1, 2, 10, NULL, NULL, '2024-05-13 08:00:00', '2024-05-13 10:00:00')`,
+	)
+
+	var stats models.PlanAdherenceStats
+	s.get("/stats/plan-adherence?account_id=10", &stats)
+
+	if stats.TotalTrades != 4 || stats.WinnersReachedTarget != 1 || stats.WinnersCutShort != 1 || stats.CutShortRate != 50 {
+		t.Fatalf("獲利單統計錯誤: %+v", stats.PlanAdherencePeriod)
+	}
+	if stats.LosersPastStop != 1 || stats.PastStopRate != 50 || stats.RLostPastStop != -0.5 || stats.RLeftOnTable != 2 {
+		t.Fatalf("虧損單統計錯誤: %+v", stats.PlanAdherencePeriod)
+	}
+	if len(stats.ByWeek) != 2 || stats.ByWeek[0].Week != "2024-W19" || stats.ByWeek[0].TotalTrades != 3 || stats.ByWeek[1].Losers != 1 {
+		t.Fatalf("每週統計錯誤: %+v", stats.ByWeek)
+	}
+	if len(stats.Deviations) != 2 || stats.Deviations[0].TradeID != 102 || stats.Deviations[1].Kind != models.DeviationPastStop {
+		t.Fatalf("偏離計畫的交易錯誤: %+v", stats.Deviations)
+	}
+}
+
+func TestGetExcursionStats(t *testing.T) {
+	s := newStatsTestServer(t,
+		"INSERT INTO users (id, username, password) VALUES (1, 'alice', 'x')",
+		"INSERT INTO accounts (id, user_id, name) VALUES (10, 1, 'main')",
+		// 101-103 為 legend，104 沒有初始停損，105 沒有 K 線
+		`INSERT INTO trades (id, account_id, symbol, side, entry_price, lot_size, exit_price, pnl, entry_strategy, rr_ratio, mae_r, mfe_r, mae_exceeded_sl, excursion_timeframe, entry_time) VALUES
+			(101, 10, 'XAUUSD', 'long', 1, 1, 2, 20, 'legend', 2, 0.2, 3, 0, 'M1', '2024-05-06 08:00:00'),
+			(102, 10, 'XAUUSD', 'long', 1, 1, 2, 10, 'legend', 1, 0.9, 2, 1, 'M1', '2024-05-07 08:00:00'),
+			(103, 10, 'XAUUSD', 'long', 1, 1, 2, -10, 'legend', -1, 1.6, 0.5, 0, 'M1', '2024-05-08 08:00:00'),
+			(104, 10, 'XAUUSD', 'long', 1, 1, 2, 10, 'elite', NULL, NULL, NULL, NULL, 'M5', '2024-05-09 08:00:00'),
+			(105, 10, 'XAUUSD', 'long', 1, 1, 2, 10, 'elite', 1, NULL, NULL, NULL, NULL, '2024-05-10 08:00:00')`,
+	)
+
+	var report models.ExcursionReport
+	s.get("/stats/excursions?account_id=10", &report)
+
+	if report.MissingBars != 1 || report.Overall.Trades != 4 || report.Overall.TradesWithR != 3 {
+		t.Fatalf("整體統計錯誤: %+v", report)
+	}
+	if len(report.ByStrategy) != 2 {
+		t.Fatalf("策略分組錯誤: %+v", report.ByStrategy)
+	}
+	legend := report.ByStrategy[0]
+	if legend.Strategy != "legend" || legend.TradesWithR != 3 || legend.ExceededSL != 1 || legend.ExceededSLRate != 33.33 {
+		t.Fatalf("legend 統計錯誤: %+v", legend)
+	}
+	if legend.MAER.P50 != 0.9 || legend.MAER.Max != 1.6 || legend.WinnersMAER.P90 != 0.9 || legend.MFER.Avg != 1.83 {
+		t.Fatalf("legend 分佈錯誤: %+v %+v %+v", legend.MAER, legend.WinnersMAER, legend.MFER)
+	}
+	// (3-2 + 2-1 + 0.5+1) / 3，獲利單 3R / 5R
+	if legend.AvgRLeft != 1.17 || legend.CaptureRate != 60 {
+		t.Fatalf("最佳出場統計錯誤: %+v", legend)
+	}
+	counts := []int{}
+	for _, b := range legend.MAEBuckets {
+		counts = append(counts, b.Count)
+	}
+	if len(counts) != 6 || counts[0] != 1 || counts[3] != 1 || counts[5] != 1 || legend.MAEBuckets[5].To != nil {
+		t.Fatalf("MAE 區間錯誤: %+v", legend.MAEBuckets)
+	}
+	if elite := report.ByStrategy[1]; elite.Trades != 1 || elite.TradesWithR != 0 {
+		t.Fatalf("elite 統計錯誤: %+v", elite)
+	}
+}
+
+func TestGetDailyPlanAdherenceStats(t *testing.T) {
+	s := newStatsTestServer(t,
+		"INSERT INTO users (id, username, password) VALUES (1, 'alice', 'x')",
+		"INSERT INTO accounts (id, user_id, name) VALUES (10, 1, 'main')",
+	)
+	s.PUT("/trades/:id/daily-plan", SetTradeDailyPlan(s.db))
+	s.GET("/daily-plans/:id/trades", GetDailyPlanTrades(s.db))
+	analysis := `{"asian":{"trends":{"H4":{"direction":"long"},"M15":{"direction":"short"}}},"european":{"trends":{"H4":{"direction":"short"}}},"us":{"trends":{}}}`
+	if _, err := s.db.Exec("INSERT INTO daily_plans (id, account_id, plan_date, symbol, market_session, trend_analysis) VALUES (1, 10, ?, 'XAUUSD', 'all', ?)",
+		time.Date(2024, 5, 6, 0, 0, 0, 0, time.UTC), analysis); err != nil {
+		t.Fatal(err)
+	}
+	// 101 亞洲盤順勢、102 亞洲盤逆勢且 trend_type 記錄錯誤、103 歐洲盤順勢、104 美洲盤沒有方向、105 沒有規劃
+	for _, tr := range []struct {
+		id                       int64
+		side, session, trendType string
+		day                      int
+		pnl                      float64
+	}{
+		{101, "long", "asian", "with_trend", 6, 30},
+		{102, "short", "asian", "with_trend", 6, -20},
+		{103, "short", "european", "with_trend", 6, 10},
+		{104, "long", "us", "", 6, 5},
+		{105, "long", "asian", "", 7, 8},
+	} {
+		entry := time.Date(2024, 5, tr.day, 2, 0, 0, 0, time.UTC)
+		if _, err := s.db.Exec(`INSERT INTO trades (id, account_id, symbol, side, entry_price, exit_price, pnl, market_session, trend_type, entry_time, exit_time)
+			VALUES (?, 10, 'XAUUSD', ?, 1, 2, ?, ?, ?, ?, ?)`, tr.id, tr.side, tr.pnl, tr.session, tr.trendType, entry, entry.Add(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		if err := dailyplans.Link(s.db, tr.id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var report models.DailyPlanAdherence
+	s.get("/stats/daily-plan-adherence?account_id=10", &report)
+	if report.Timeframe != "H4" || report.TotalTrades != 5 || report.LinkedTrades != 4 || report.WithBias != 3 {
+		t.Fatalf("總計錯誤: %+v", report)
+	}
+	if report.Aligned.Trades != 2 || report.Aligned.TotalPnL != 40 || report.Aligned.WinRate != 100 || report.Against.Trades != 1 || report.Against.TotalPnL != -20 {
+		t.Fatalf("順勢 / 逆勢統計錯誤: %+v %+v", report.Aligned, report.Against)
+	}
+	if report.NoBias.Trades != 1 || report.Unlinked.Trades != 1 || report.AdherenceRate != 66.67 || report.TrendTypeMismatches != 1 {
+		t.Fatalf("統計錯誤: %+v", report)
+	}
+	if len(report.Violations) != 1 || report.Violations[0].ID != 102 || report.Violations[0].Bias != "long" || !report.Violations[0].TrendTypeMismatch {
+		t.Fatalf("違規交易錯誤: %+v", report.Violations)
+	}
+	if len(report.ByTimeframe) != 5 || report.ByTimeframe[1].Timeframe != "M15" || report.ByTimeframe[1].WithBias != 2 || report.ByTimeframe[1].Aligned != 1 {
+		t.Fatalf("週期拆分錯誤: %+v", report.ByTimeframe)
+	}
+
+	// 102 手動取消連結後不列入規劃比較
+	if code := s.do("PUT", "/trades/102/daily-plan", `{"daily_plan_id": null}`, nil); code != 200 {
+		t.Fatalf("取消連結失敗: %d", code)
+	}
+	var planTrades struct {
+		Trades []models.DailyPlanTrade `json:"trades"`
+	}
+	s.get("/daily-plans/1/trades?timeframe=m15", &planTrades)
+	if len(planTrades.Trades) != 3 || planTrades.Trades[0].ID != 101 || planTrades.Trades[0].Alignment != "against" || planTrades.Trades[2].Alignment != "no_bias" {
+		t.Fatalf("規劃的交易錯誤: %+v", planTrades.Trades)
+	}
+
+	if code := s.do("PUT", "/trades/102/daily-plan", `{"daily_plan_id": 99}`, nil); code != 400 {
+		t.Fatalf("不存在的規劃應拒絕, got %d", code)
+	}
+	var linked struct {
+		DailyPlanID *int64 `json:"daily_plan_id"`
+	}
+	if code := s.do("PUT", "/trades/102/daily-plan", `{"auto": true}`, &linked); code != 200 || linked.DailyPlanID == nil || *linked.DailyPlanID != 1 {
+		t.Fatalf("改回自動連結錯誤: %d %+v", code, linked)
+	}
+}
+
+func TestGetStatsByTag(t *testing.T) {
+	s := newStatsTestServer(t,
+		"INSERT INTO users (id, username, password) VALUES (1, 'alice', 'x')",
+		"INSERT INTO accounts (id, user_id, name) VALUES (10, 1, 'main')",
+		"INSERT INTO tag_groups (id, user_id, name, position) VALUES (1, 1, '型態', 0), (2, 1, '情緒', 1)",
+		"INSERT INTO tags (id, user_id, name, group_id) VALUES (1, 1, 'breakout', 1), (2, 1, 'pullback', 1), (3, 1, 'FOMO', 2), (4, 1, 'news', NULL)",
+		`INSERT INTO trades (id, account_id, symbol, side, entry_price, exit_price, pnl, rr_ratio, entry_time) VALUES
+			(101, 10, 'XAUUSD', 'long', 1, 2, 100, 1, '2024-05-01 08:00:00'),
+			(102, 10, 'XAUUSD', 'long', 1, 2, -50, -1, '2024-05-02 08:00:00'),
+			(103, 10, 'XAUUSD', 'long', 1, 2, 30, NULL, '2024-05-03 08:00:00'),
+			(104, 10, 'XAUUSD', 'long', 1, NULL, NULL, NULL, '2024-05-04 08:00:00')`,
+		// 101 同一分組有兩個標籤，分組只計算一次；103 沒有標籤；104 未平倉
+		"INSERT INTO trade_tags (trade_id, tag_id) VALUES (101, 1), (101, 2), (102, 1), (102, 3), (102, 4), (104, 1)",
+	)
+
+	var report models.TagStatsReport
+	s.get("/stats/by-tag?account_id=10", &report)
+
+	if len(report.Groups) != 3 || report.Groups[0].Name != "型態" || report.Groups[1].Name != "情緒" || report.Groups[2].GroupID != nil {
+		t.Fatalf("分組順序錯誤: %+v", report.Groups)
+	}
+	setup := report.Groups[0]
+	if setup.Trades != 2 || setup.TotalPnL != 50 || setup.WinRate != 50 || setup.AvgR != 0 {
+		t.Fatalf("分組統計錯誤: %+v", setup.OutcomeStats)
+	}
+	if len(setup.Tags) != 2 || setup.Tags[0].Name != "breakout" || setup.Tags[0].Trades != 2 || setup.Tags[1].TotalPnL != 100 {
+		t.Fatalf("標籤統計錯誤: %+v", setup.Tags)
+	}
+	if len(report.Groups[2].Tags) != 1 || report.Groups[2].Tags[0].Name != "news" || report.Groups[2].TotalPnL != -50 {
+		t.Fatalf("未分組統計錯誤: %+v", report.Groups[2])
+	}
+	if report.Untagged.Trades != 1 || report.Untagged.TotalPnL != 30 || report.Untagged.TradesWithR != 0 {
+		t.Fatalf("沒有標籤的交易統計錯誤: %+v", report.Untagged)
+	}
+}
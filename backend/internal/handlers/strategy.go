@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"trade-journal/internal/database"
+	"trade-journal/internal/models"
+	"trade-journal/internal/strategies"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetStrategies 取得使用者的策略定義
+func GetStrategies(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		list, err := strategies.List(db, c.GetInt64("user_id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, list)
+	}
+}
+
+// GetStrategy 取得單一策略定義
+func GetStrategy(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "無效的策略 ID"})
+			return
+		}
+		s, err := strategies.Get(db, c.GetInt64("user_id"), id)
+		if err != nil {
+			strategyError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, s)
+	}
+}
+
+// CreateStrategy 建立策略
+func CreateStrategy(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.StrategyCreate
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := strategies.Validate(req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		id, err := strategies.Create(db, c.GetInt64("user_id"), req)
+		if err != nil {
+			strategyError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"id": id, "message": "策略建立成功"})
+	}
+}
+
+// UpdateStrategy 更新策略定義
+func UpdateStrategy(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "無效的策略 ID"})
+			return
+		}
+		var req models.StrategyCreate
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := strategies.Validate(req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := strategies.Update(db, c.GetInt64("user_id"), id, req); err != nil {
+			strategyError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "策略更新成功"})
+	}
+}
+
+// DeleteStrategy 刪除策略，仍有交易使用時拒絕
+func DeleteStrategy(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "無效的策略 ID"})
+			return
+		}
+		if err := strategies.Delete(db, c.GetInt64("user_id"), id); err != nil {
+			strategyError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "策略刪除成功"})
+	}
+}
+
+func strategyError(c *gin.Context, err error) {
+	switch {
+	case err == strategies.ErrNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case err == strategies.ErrInUse:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case database.IsUniqueViolation(err):
+		c.JSON(http.StatusConflict, gin.H{"error": "策略名稱已存在"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"trade-journal/internal/audit"
+	"trade-journal/internal/dailyplans"
+	"trade-journal/internal/database"
+	"trade-journal/internal/excursions"
+	"trade-journal/internal/instruments"
+	"trade-journal/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetSymbolAliases 取得使用者的品種別名
+func GetSymbolAliases(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		list, err := instruments.ListAliases(db, c.GetInt64("user_id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, list)
+	}
+}
+
+// CreateSymbolAlias 建立品種別名，只影響之後匯入與同步的交易，舊交易需重新正規化
+func CreateSymbolAlias(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.SymbolAliasCreate
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		id, err := instruments.CreateAlias(db, c.GetInt64("user_id"), req)
+		if err != nil {
+			if database.IsUniqueViolation(err) {
+				c.JSON(http.StatusConflict, gin.H{"error": "此別名已存在"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"id": id, "message": "品種別名建立成功"})
+	}
+}
+
+// DeleteSymbolAlias 刪除品種別名
+func DeleteSymbolAlias(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "無效的別名 ID"})
+			return
+		}
+		if err := instruments.DeleteAlias(db, c.GetInt64("user_id"), id); err != nil {
+			if err == instruments.ErrAliasNotFound {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "品種別名刪除成功"})
+	}
+}
+
+// RenormalizeSymbols 依目前的別名與內建規則，重新計算使用者所有交易 (含垃圾桶) 與每日規劃的標準品種名稱
+// 交易以 raw_symbol (舊交易為 symbol) 為原始名稱，品種變更的交易會重新計算點數並記錄異動
+func RenormalizeSymbols(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetInt64("user_id")
+
+		tx, err := db.Begin()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer tx.Rollback()
+
+		aliases, err := instruments.LoadAliases(tx, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		tradeCount, err := renormalizeTrades(tx, userID, aliases)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		planCount, conflicts, err := renormalizePlans(tx, userID, aliases)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		// 品種名稱變更後重新連結交易與規劃
+		if err := dailyplans.LinkUser(tx, userID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"message":        "品種名稱重新正規化完成",
+			"trades":         tradeCount,
+			"plans":          planCount,
+			"plan_conflicts": conflicts,
+		})
+	}
+}
+
+// renormalizeTrades 更新品種名稱有變更的交易，回傳更新筆數
+func renormalizeTrades(tx *sql.Tx, userID int64, aliases instruments.Aliases) (int, error) {
+	type pending struct {
+		id          int64
+		symbol, raw string
+	}
+	rows, err := tx.Query(`
+		SELECT t.id, t.symbol, t.raw_symbol FROM trades t JOIN accounts a ON t.account_id = a.id
+		WHERE a.user_id = ?
+	`, userID)
+	if err != nil {
+		return 0, err
+	}
+	var list []pending
+	for rows.Next() {
+		var p pending
+		var raw sql.NullString
+		if err := rows.Scan(&p.id, &p.symbol, &raw); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		p.raw = p.symbol
+		if raw.Valid {
+			p.raw = raw.String
+		}
+		// 沒有 raw_symbol 的舊交易也補上原始名稱
+		if aliases.Canonical(p.raw) != p.symbol || !raw.Valid {
+			list = append(list, p)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	updated := 0
+	for _, p := range list {
+		before, err := audit.Snapshot(tx, p.id)
+		if err != nil {
+			return 0, err
+		}
+		symbol := aliases.Canonical(p.raw)
+		if _, err := tx.Exec("UPDATE trades SET symbol = ?, raw_symbol = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", symbol, p.raw, p.id); err != nil {
+			return 0, err
+		}
+		if symbol == p.symbol {
+			continue
+		}
+		if err := instruments.Apply(tx, p.id); err != nil {
+			return 0, err
+		}
+		if err := excursions.Apply(tx, p.id); err != nil {
+			return 0, err
+		}
+		after, err := audit.Snapshot(tx, p.id)
+		if err != nil {
+			return 0, err
+		}
+		if err := audit.Record(tx, p.id, userID, audit.ActionUpdate, audit.SourceAPI, before, after); err != nil {
+			return 0, err
+		}
+		updated++
+	}
+	return updated, nil
+}
+
+// renormalizePlans 更新每日規劃的品種名稱
+// 轉換後與同帳號同日期的規劃重複時維持原名稱，回傳更新筆數與略過的規劃 ID
+func renormalizePlans(tx *sql.Tx, userID int64, aliases instruments.Aliases) (int, []int64, error) {
+	type pending struct {
+		id      int64
+		symbol  string
+		deleted bool
+	}
+	rows, err := tx.Query(`
+		SELECT p.id, COALESCE(p.symbol, ''), p.deleted_at IS NOT NULL
+		FROM daily_plans p JOIN accounts a ON p.account_id = a.id
+		WHERE a.user_id = ?
+	`, userID)
+	if err != nil {
+		return 0, nil, err
+	}
+	var list []pending
+	for rows.Next() {
+		var p pending
+		if err := rows.Scan(&p.id, &p.symbol, &p.deleted); err != nil {
+			rows.Close()
+			return 0, nil, err
+		}
+		if p.symbol != "" && aliases.Canonical(p.symbol) != p.symbol {
+			list = append(list, p)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, nil, err
+	}
+
+	updated := 0
+	conflicts := []int64{}
+	for _, p := range list {
+		symbol := aliases.Canonical(p.symbol)
+		if !p.deleted {
+			var exists int
+			err := tx.QueryRow(`
+				SELECT 1 FROM daily_plans o JOIN daily_plans p ON o.account_id = p.account_id AND o.plan_date = p.plan_date
+				WHERE p.id = ? AND o.id <> p.id AND o.symbol = ? AND o.deleted_at IS NULL
+			`, p.id, symbol).Scan(&exists)
+			if err == nil {
+				conflicts = append(conflicts, p.id)
+				continue
+			}
+			if err != sql.ErrNoRows {
+				return 0, nil, err
+			}
+		}
+		if _, err := tx.Exec("UPDATE daily_plans SET symbol = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", symbol, p.id); err != nil {
+			return 0, nil, err
+		}
+		updated++
+	}
+	return updated, conflicts, nil
+}
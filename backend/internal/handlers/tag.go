@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"trade-journal/internal/database"
+	"trade-journal/internal/models"
+	"trade-journal/internal/tags"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetTags 取得所有標籤，含顏色、分組與使用的交易數
+func GetTags(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		list, err := tags.List(db, c.GetInt64("user_id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, list)
+	}
+}
+
+// CreateTag 建立標籤
+func CreateTag(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetInt64("user_id")
+		var req models.TagCreate
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := tags.Validate(db, userID, &req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		id, err := tags.Create(db, userID, req)
+		if err != nil {
+			tagError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"id": id, "message": "標籤建立成功"})
+	}
+}
+
+// UpdateTag 更新標籤的名稱、顏色、說明與分組；改成已存在的名稱時請改用合併
+func UpdateTag(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetInt64("user_id")
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "無效的標籤 ID"})
+			return
+		}
+		var req models.TagCreate
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := tags.Validate(db, userID, &req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := tags.Update(db, userID, id, req); err != nil {
+			tagError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "標籤更新成功"})
+	}
+}
+
+// DeleteTag 刪除標籤，並從所有交易移除
+func DeleteTag(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "無效的標籤 ID"})
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer tx.Rollback()
+
+		if err := tags.Delete(tx, c.GetInt64("user_id"), id); err != nil {
+			tagError(c, err)
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "標籤刪除成功"})
+	}
+}
+
+// MergeTags 將來源標籤合併到目標標籤，例如把 "break-out" 合併到 "breakout"
+func MergeTags(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.TagMerge
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer tx.Rollback()
+
+		moved, err := tags.Merge(tx, c.GetInt64("user_id"), req.SourceIDs, req.TargetID)
+		if err != nil {
+			tagError(c, err)
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "標籤合併成功", "trades_updated": moved})
+	}
+}
+
+// GetTagGroups 取得使用者的標籤分組
+func GetTagGroups(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		list, err := tags.ListGroups(db, c.GetInt64("user_id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, list)
+	}
+}
+
+// CreateTagGroup 建立標籤分組
+func CreateTagGroup(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.TagGroupCreate
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := tags.ValidateGroup(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		id, err := tags.CreateGroup(db, c.GetInt64("user_id"), req)
+		if err != nil {
+			tagError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"id": id, "message": "標籤分組建立成功"})
+	}
+}
+
+// UpdateTagGroup 更新標籤分組的名稱、顏色與順序
+func UpdateTagGroup(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "無效的分組 ID"})
+			return
+		}
+		var req models.TagGroupCreate
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := tags.ValidateGroup(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := tags.UpdateGroup(db, c.GetInt64("user_id"), id, req); err != nil {
+			tagError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "標籤分組更新成功"})
+	}
+}
+
+// DeleteTagGroup 刪除標籤分組，組內的標籤改為未分組
+func DeleteTagGroup(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "無效的分組 ID"})
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer tx.Rollback()
+
+		if err := tags.DeleteGroup(tx, c.GetInt64("user_id"), id); err != nil {
+			tagError(c, err)
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "標籤分組刪除成功"})
+	}
+}
+
+func tagError(c *gin.Context, err error) {
+	switch {
+	case err == tags.ErrNotFound || err == tags.ErrGroupNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case err == tags.ErrMergeIntoSelf:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case database.IsUniqueViolation(err):
+		c.JSON(http.StatusConflict, gin.H{"error": "名稱已存在，重複的標籤請使用合併"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
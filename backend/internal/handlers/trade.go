@@ -2,9 +2,23 @@ package handlers
 
 import (
 	"database/sql"
+	"math"
 	"net/http"
-
+	"strconv"
+	"strings"
+	"time"
+
+	"trade-journal/internal/audit"
+	"trade-journal/internal/customfields"
+	"trade-journal/internal/database"
+	"trade-journal/internal/executions"
+	"trade-journal/internal/fx"
+	"trade-journal/internal/gallery"
+	"trade-journal/internal/instruments"
 	"trade-journal/internal/models"
+	"trade-journal/internal/reviews"
+	"trade-journal/internal/strategies"
+	"trade-journal/internal/trash"
 
 	"github.com/gin-gonic/gin"
 )
@@ -18,6 +32,7 @@ func GetTrades(db *sql.DB) gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		query.CustomFields = c.QueryMap("cf")
 
 		// 預設分頁
 		if query.Page <= 0 {
@@ -29,58 +44,70 @@ func GetTrades(db *sql.DB) gin.HandlerFunc {
 
 		offset := (query.Page - 1) * query.PageSize
 
-		// 建立查詢
-	sqlQuery := `
-		SELECT DISTINCT t.id, t.account_id, COALESCE(t.trade_type, 'actual'), t.symbol, t.side, t.entry_price, t.exit_price, 
-			   t.lot_size, t.pnl, t.pnl_points, COALESCE(t.notes, ''), t.entry_reason, t.exit_reason,
-			   t.entry_strategy, t.entry_strategy_image, t.entry_strategy_image_original, t.entry_signals, t.entry_checklist, t.entry_pattern, t.trend_analysis, 
-			   t.entry_timeframe, t.trend_type, t.market_session, t.initial_sl, t.bullet_size, t.rr_ratio, COALESCE(a.timezone_offset, t.timezone_offset, 8), t.ticket, t.exit_sl,
-			   t.legend_king_htf, t.legend_king_image, t.legend_king_image_original, t.legend_htf, t.legend_htf_image, t.legend_htf_image_original, t.legend_de_htf,
-			   t.entry_time, t.color_tag, t.exit_time, t.created_at, t.updated_at, t.sl_history
-		FROM trades t
-		LEFT JOIN accounts a ON t.account_id = a.id
-		LEFT JOIN trade_tags tt ON t.id = tt.trade_id
-		LEFT JOIN tags tg ON tt.tag_id = tg.id
-		WHERE a.user_id = ?
-	`
-		args := []interface{}{userID}
+		sort, err := parseTradeSort(query.Sort)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 
-		if query.AccountID > 0 {
-			sqlQuery += " AND t.account_id = ?"
-			args = append(args, query.AccountID)
-		} else {
+		if query.AccountID <= 0 {
 			// 如果沒有提供帳號 ID，目前邏輯不返回任何交易以避免混合不同帳號資料
 			c.JSON(http.StatusOK, []models.Trade{})
 			return
 		}
 
-		if query.Symbol != "" {
-			sqlQuery += " AND t.symbol = ?"
-			args = append(args, query.Symbol)
-		}
-
-		if query.Side != "" {
-			sqlQuery += " AND t.side = ?"
-			args = append(args, query.Side)
-		}
-
-		if query.Tag != "" {
-			sqlQuery += " AND tg.name = ?"
-			args = append(args, query.Tag)
-		}
+		// 建立查詢
+		from := `
+		FROM trades t
+		LEFT JOIN accounts a ON t.account_id = a.id
+		WHERE a.user_id = ? AND t.deleted_at IS NULL AND a.deleted_at IS NULL
+	`
+		where, filterArgs := tradeFilter(query)
+		args := append([]interface{}{userID}, filterArgs...)
 
-		if query.StartDate != "" {
-			sqlQuery += " AND t.entry_time >= ?"
-			args = append(args, query.StartDate)
+		// 計算總數 (與列表使用相同的篩選條件)
+		var total int
+		if err := db.QueryRow("SELECT COUNT(*)"+from+where, args...).Scan(&total); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
 		}
 
-		if query.EndDate != "" {
-			sqlQuery += " AND t.entry_time <= ?"
-			args = append(args, query.EndDate)
+		sqlQuery := `
+		SELECT t.id, t.account_id, COALESCE(t.trade_type, 'actual'), t.symbol, t.side, t.entry_price, t.exit_price, 
+			   t.lot_size, t.pnl, t.pnl_points, COALESCE(t.notes, ''), t.entry_reason, t.exit_reason,
+			   t.entry_strategy, t.entry_strategy_image, t.entry_strategy_image_original, t.entry_signals, t.entry_checklist, t.entry_pattern, t.trend_analysis, 
+			   t.entry_timeframe, t.trend_type, t.market_session, t.initial_sl, t.bullet_size, t.rr_ratio, COALESCE(a.timezone_offset, t.timezone_offset, 8), t.ticket, t.exit_sl,
+			   t.legend_king_htf, t.legend_king_image, t.legend_king_image_original, t.legend_htf, t.legend_htf_image, t.legend_htf_image_original, t.legend_de_htf,
+			   t.entry_time, t.color_tag, t.exit_time, t.created_at, t.updated_at, t.sl_history, t.strategy_id, t.raw_symbol, t.gross_pnl, t.commission, t.swap, t.fees, t.pnl_currency, t.initial_tp, t.exit_tp, t.tp_history, t.planned_rr,
+			   t.mae, t.mfe, t.mae_points, t.mfe_points, t.mae_r, t.mfe_r, t.mae_exceeded_sl, t.excursion_timeframe,
+			   t.daily_plan_id, COALESCE(t.plan_link_manual, FALSE),
+			   COALESCE(t.review_status, 'unreviewed'), t.quality_grade, t.lessons, t.reviewed_at` + from + where
+
+		// 有游標時從游標之後開始，否則使用頁碼
+		if query.Cursor != "" {
+			cursorID, err := decodeCursor(query.Cursor, sort)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			valid, err := cursorValid(db, userID, cursorID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			if !valid {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "游標已失效，請重新載入列表"})
+				return
+			}
+			afterWhere, afterArgs := sort.after(cursorID)
+			sqlQuery += afterWhere
+			args = append(args, afterArgs...)
+			offset = 0
 		}
 
-		sqlQuery += " ORDER BY t.entry_time DESC LIMIT ? OFFSET ?"
-		args = append(args, query.PageSize, offset)
+		// 多取一筆以判斷是否還有下一頁
+		sqlQuery += sort.orderBy() + " LIMIT ? OFFSET ?"
+		args = append(args, query.PageSize+1, offset)
 
 		rows, err := db.Query(sqlQuery, args...)
 		if err != nil {
@@ -98,45 +125,29 @@ func GetTrades(db *sql.DB) gin.HandlerFunc {
 				&trade.EntryStrategy, &trade.EntryStrategyImage, &trade.EntryStrategyImageOriginal, &trade.EntrySignals, &trade.EntryChecklist, &trade.EntryPattern, &trade.TrendAnalysis,
 				&trade.EntryTimeframe, &trade.TrendType, &trade.MarketSession, &trade.InitialSL, &trade.BulletSize, &trade.RRRatio, &trade.TimezoneOffset, &trade.Ticket, &trade.ExitSL,
 				&trade.LegendKingHTF, &trade.LegendKingImage, &trade.LegendKingImageOriginal, &trade.LegendHTF, &trade.LegendHTFImage, &trade.LegendHTFImageOriginal, &trade.LegendDeHTF,
-				&trade.EntryTime, &trade.ColorTag, &trade.ExitTime, &trade.CreatedAt, &trade.UpdatedAt, &trade.SLHistory,
+				&trade.EntryTime, &trade.ColorTag, &trade.ExitTime, &trade.CreatedAt, &trade.UpdatedAt, &trade.SLHistory, &trade.StrategyID, &trade.RawSymbol, &trade.GrossPnL, &trade.Commission, &trade.Swap, &trade.Fees, &trade.PnLCurrency, &trade.InitialTP, &trade.ExitTP, &trade.TPHistory, &trade.PlannedRR,
+				&trade.MAE, &trade.MFE, &trade.MAEPoints, &trade.MFEPoints, &trade.MAER, &trade.MFER, &trade.MAEExceededSL, &trade.ExcursionTimeframe,
+				&trade.DailyPlanID, &trade.PlanLinkManual,
+				&trade.ReviewStatus, &trade.QualityGrade, &trade.Lessons, &trade.ReviewedAt,
 			)
 			if err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 				return
 			}
 
-			// 載入關聯資料
-			loadTradeRelations(db, &trade)
 			trades = append(trades, trade)
 		}
 
-		// 計算總數
-		countQuery := `SELECT COUNT(DISTINCT t.id) FROM trades t
-			LEFT JOIN accounts a ON t.account_id = a.id
-			LEFT JOIN trade_tags tt ON t.id = tt.trade_id
-			LEFT JOIN tags tg ON tt.tag_id = tg.id
-			WHERE a.user_id = ?`
-
-		countArgs := []interface{}{userID}
-		if query.AccountID > 0 {
-			countQuery += " AND t.account_id = ?"
-			countArgs = append(countArgs, query.AccountID)
-		}
-		if query.Symbol != "" {
-			countQuery += " AND t.symbol = ?"
-			countArgs = append(countArgs, query.Symbol)
-		}
-		if query.Side != "" {
-			countQuery += " AND t.side = ?"
-			countArgs = append(countArgs, query.Side)
-		}
-		if query.Tag != "" {
-			countQuery += " AND tg.name = ?"
-			countArgs = append(countArgs, query.Tag)
+		var nextCursor interface{}
+		if len(trades) > query.PageSize {
+			trades = trades[:query.PageSize]
+			nextCursor = encodeCursor(sort, trades[len(trades)-1].ID)
 		}
 
-		var total int
-		db.QueryRow(countQuery, countArgs...).Scan(&total)
+		// 載入關聯資料
+		for i := range trades {
+			loadTradeRelations(db, &trades[i])
+		}
 
 		c.JSON(http.StatusOK, gin.H{
 			"data": trades,
@@ -145,6 +156,7 @@ func GetTrades(db *sql.DB) gin.HandlerFunc {
 				"page_size": query.PageSize,
 				"total":     total,
 			},
+			"next_cursor": nextCursor,
 		})
 	}
 }
@@ -161,17 +173,23 @@ func GetTrade(db *sql.DB) gin.HandlerFunc {
 				   COALESCE(t.notes, ''), t.entry_reason, t.exit_reason, t.entry_strategy, t.entry_strategy_image, t.entry_strategy_image_original, t.entry_signals, t.entry_checklist,
 				   t.entry_pattern, t.trend_analysis, t.entry_timeframe, t.trend_type, t.market_session, t.initial_sl, t.bullet_size, t.rr_ratio, COALESCE(a.timezone_offset, t.timezone_offset, 8), t.ticket, t.exit_sl,
 				   t.legend_king_htf, t.legend_king_image, t.legend_king_image_original, t.legend_htf, t.legend_htf_image, t.legend_htf_image_original, t.legend_de_htf,
-				   t.entry_time, t.color_tag, t.exit_time, t.created_at, t.updated_at, t.sl_history
+				   t.entry_time, t.color_tag, t.exit_time, t.created_at, t.updated_at, t.sl_history, t.strategy_id, t.raw_symbol, t.gross_pnl, t.commission, t.swap, t.fees, t.pnl_currency, t.initial_tp, t.exit_tp, t.tp_history, t.planned_rr,
+				   t.mae, t.mfe, t.mae_points, t.mfe_points, t.mae_r, t.mfe_r, t.mae_exceeded_sl, t.excursion_timeframe,
+				   t.daily_plan_id, COALESCE(t.plan_link_manual, FALSE),
+				   COALESCE(t.review_status, 'unreviewed'), t.quality_grade, t.lessons, t.reviewed_at
 			FROM trades t
 			LEFT JOIN accounts a ON t.account_id = a.id
-			WHERE t.id = ? AND a.user_id = ?
+			WHERE t.id = ? AND a.user_id = ? AND t.deleted_at IS NULL AND a.deleted_at IS NULL
 		`, id, userID).Scan(
 			&trade.ID, &trade.AccountID, &trade.TradeType, &trade.Symbol, &trade.Side, &trade.EntryPrice, &trade.ExitPrice,
 			&trade.LotSize, &trade.PnL, &trade.PnLPoints, &trade.Notes, &trade.EntryReason, &trade.ExitReason,
 			&trade.EntryStrategy, &trade.EntryStrategyImage, &trade.EntryStrategyImageOriginal, &trade.EntrySignals, &trade.EntryChecklist, &trade.EntryPattern, &trade.TrendAnalysis,
 			&trade.EntryTimeframe, &trade.TrendType, &trade.MarketSession, &trade.InitialSL, &trade.BulletSize, &trade.RRRatio, &trade.TimezoneOffset, &trade.Ticket, &trade.ExitSL,
 			&trade.LegendKingHTF, &trade.LegendKingImage, &trade.LegendKingImageOriginal, &trade.LegendHTF, &trade.LegendHTFImage, &trade.LegendHTFImageOriginal, &trade.LegendDeHTF,
-			&trade.EntryTime, &trade.ColorTag, &trade.ExitTime, &trade.CreatedAt, &trade.UpdatedAt, &trade.SLHistory,
+			&trade.EntryTime, &trade.ColorTag, &trade.ExitTime, &trade.CreatedAt, &trade.UpdatedAt, &trade.SLHistory, &trade.StrategyID, &trade.RawSymbol, &trade.GrossPnL, &trade.Commission, &trade.Swap, &trade.Fees, &trade.PnLCurrency, &trade.InitialTP, &trade.ExitTP, &trade.TPHistory, &trade.PlannedRR,
+			&trade.MAE, &trade.MFE, &trade.MAEPoints, &trade.MFEPoints, &trade.MAER, &trade.MFER, &trade.MAEExceededSL, &trade.ExcursionTimeframe,
+			&trade.DailyPlanID, &trade.PlanLinkManual,
+			&trade.ReviewStatus, &trade.QualityGrade, &trade.Lessons, &trade.ReviewedAt,
 		)
 
 		if err == sql.ErrNoRows {
@@ -201,7 +219,7 @@ func CreateTrade(db *sql.DB) gin.HandlerFunc {
 
 		// 檢查帳號所屬權
 		var exists int
-		db.QueryRow("SELECT 1 FROM accounts WHERE id = ? AND user_id = ?", req.AccountID, userID).Scan(&exists)
+		db.QueryRow("SELECT 1 FROM accounts WHERE id = ? AND user_id = ? AND deleted_at IS NULL", req.AccountID, userID).Scan(&exists)
 		if exists == 0 {
 			c.JSON(http.StatusForbidden, gin.H{"error": "無權限操作此帳號"})
 			return
@@ -219,6 +237,12 @@ func CreateTrade(db *sql.DB) gin.HandlerFunc {
 			}
 		}
 
+		// 內嵌的 base64 圖片改存到 MinIO
+		if err := storeTradeImages(db, &req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
 		// 開始交易
 		tx, err := db.Begin()
 		if err != nil {
@@ -227,34 +251,77 @@ func CreateTrade(db *sql.DB) gin.HandlerFunc {
 		}
 		defer tx.Rollback()
 
+		// 對應策略定義並檢查必填的策略圖片
+		if err := strategies.Resolve(tx, userID, &req, nil); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		customValues, err := customfields.Prepare(tx, userID, req.CustomFields, true)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		rawSymbol, err := canonicalSymbol(tx, userID, &req)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		balancePnL(&req)
+		if req.PnLCurrency != nil {
+			currency, err := fx.NormalizeCurrency(*req.PnLCurrency)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			req.PnLCurrency = &currency
+		}
+
 		// 插入交易紀錄
-		result, err := tx.Exec(`
-			INSERT INTO trades (account_id, trade_type, symbol, side, entry_price, exit_price, lot_size, pnl, pnl_points, notes, entry_reason, exit_reason, entry_strategy, entry_strategy_image, entry_strategy_image_original, entry_signals, entry_checklist, entry_pattern, trend_analysis, entry_timeframe, trend_type, market_session, initial_sl, bullet_size, rr_ratio, timezone_offset, exit_sl, legend_king_htf, legend_king_image, legend_king_image_original, legend_htf, legend_htf_image, legend_htf_image_original, legend_de_htf, entry_time, color_tag, exit_time)
-			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-		`, req.AccountID, req.TradeType, req.Symbol, req.Side, req.EntryPrice, req.ExitPrice, req.LotSize, req.PnL, req.PnLPoints, req.Notes, req.EntryReason, req.ExitReason, req.EntryStrategy, req.EntryStrategyImage, req.EntryStrategyImageOriginal, req.EntrySignals, req.EntryChecklist, req.EntryPattern, req.TrendAnalysis, req.EntryTimeframe, req.TrendType, req.MarketSession, req.InitialSL, req.BulletSize, req.RRRatio, req.TimezoneOffset, req.ExitSL, req.LegendKingHTF, req.LegendKingImage, req.LegendKingImageOriginal, req.LegendHTF, req.LegendHTFImage, req.LegendHTFImageOriginal, req.LegendDeHTF, req.EntryTime, req.ColorTag, req.ExitTime)
+		tradeID, err := database.InsertID(tx, `
+			INSERT INTO trades (account_id, trade_type, symbol, raw_symbol, side, entry_price, exit_price, lot_size, pnl, pnl_points, notes, entry_reason, exit_reason, entry_strategy, entry_strategy_image, entry_strategy_image_original, entry_signals, entry_checklist, entry_pattern, trend_analysis, entry_timeframe, trend_type, market_session, initial_sl, bullet_size, rr_ratio, timezone_offset, exit_sl, legend_king_htf, legend_king_image, legend_king_image_original, legend_htf, legend_htf_image, legend_htf_image_original, legend_de_htf, entry_time, color_tag, exit_time, strategy_id, gross_pnl, commission, swap, fees, pnl_currency, initial_tp, exit_tp, tp_history)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, req.AccountID, req.TradeType, req.Symbol, rawSymbol, req.Side, req.EntryPrice, req.ExitPrice, req.LotSize, req.PnL, req.PnLPoints, req.Notes, req.EntryReason, req.ExitReason, req.EntryStrategy, req.EntryStrategyImage, req.EntryStrategyImageOriginal, req.EntrySignals, req.EntryChecklist, req.EntryPattern, req.TrendAnalysis, req.EntryTimeframe, req.TrendType, req.MarketSession, req.InitialSL, req.BulletSize, req.RRRatio, req.TimezoneOffset, req.ExitSL, req.LegendKingHTF, req.LegendKingImage, req.LegendKingImageOriginal, req.LegendHTF, req.LegendHTFImage, req.LegendHTFImageOriginal, req.LegendDeHTF, req.EntryTime, req.ColorTag, req.ExitTime, req.StrategyID, req.GrossPnL, req.Commission, req.Swap, req.Fees, req.PnLCurrency, req.InitialTP, req.ExitTP, tpHistory(nil, req.InitialTP, req.ExitTP))
 
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
-		tradeID, _ := result.LastInsertId()
-
 		// 插入標籤 (現在標籤是使用者專屬的)
 		for _, tagName := range req.Tags {
 			var tagID int64
 			err = tx.QueryRow("SELECT id FROM tags WHERE name = ? AND user_id = ?", tagName, userID).Scan(&tagID)
 			if err == sql.ErrNoRows {
-				result, _ := tx.Exec("INSERT INTO tags (name, user_id) VALUES (?, ?)", tagName, userID)
-				tagID, _ = result.LastInsertId()
+				tagID, _ = database.InsertID(tx, "INSERT INTO tags (name, user_id) VALUES (?, ?)", tagName, userID)
 			}
 			tx.Exec("INSERT INTO trade_tags (trade_id, tag_id) VALUES (?, ?)", tradeID, tagID)
 		}
 
 		// 插入圖片
 		for _, img := range req.Images {
-			tx.Exec("INSERT INTO trade_images (trade_id, image_type, image_path) VALUES (?, ?, ?)",
-				tradeID, img.ImageType, img.ImagePath)
+			gallery.Add(tx, tradeID, img)
+		}
+
+		if err := customfields.Save(tx, tradeID, customValues); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		// 插入成交紀錄並推導價格與盈虧，點數與風報比依品種規格計算
+		for _, e := range req.Executions {
+			if _, err := executions.Insert(tx, tradeID, e); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		if err := executions.Recalculate(tx, tradeID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := audit.RecordCreate(tx, tradeID, userID, audit.SourceAPI); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
 		}
 
 		if err := tx.Commit(); err != nil {
@@ -281,14 +348,14 @@ func UpdateTrade(db *sql.DB) gin.HandlerFunc {
 
 		// 檢查交易所屬權 (透過 join accounts)
 		var exists int
-		db.QueryRow("SELECT 1 FROM trades t JOIN accounts a ON t.account_id = a.id WHERE t.id = ? AND a.user_id = ?", id, userID).Scan(&exists)
+		db.QueryRow("SELECT 1 FROM trades t JOIN accounts a ON t.account_id = a.id WHERE t.id = ? AND a.user_id = ? AND t.deleted_at IS NULL", id, userID).Scan(&exists)
 		if exists == 0 {
 			c.JSON(http.StatusForbidden, gin.H{"error": "無權限更新此交易"})
 			return
 		}
 
 		// 檢查目標帳號所屬權
-		db.QueryRow("SELECT 1 FROM accounts WHERE id = ? AND user_id = ?", req.AccountID, userID).Scan(&exists)
+		db.QueryRow("SELECT 1 FROM accounts WHERE id = ? AND user_id = ? AND deleted_at IS NULL", req.AccountID, userID).Scan(&exists)
 		if exists == 0 {
 			c.JSON(http.StatusForbidden, gin.H{"error": "無權限將交易移動到此帳號"})
 			return
@@ -306,6 +373,12 @@ func UpdateTrade(db *sql.DB) gin.HandlerFunc {
 			}
 		}
 
+		// 內嵌的 base64 圖片改存到 MinIO
+		if err := storeTradeImages(db, &req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
 		tx, err := db.Begin()
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -313,18 +386,61 @@ func UpdateTrade(db *sql.DB) gin.HandlerFunc {
 		}
 		defer tx.Rollback()
 
+		// 更新前的快照，用於記錄欄位異動
+		tradeID, _ := strconv.ParseInt(id, 10, 64)
+		before, err := audit.Snapshot(tx, tradeID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		var oldTPHistory *string
+		if err := tx.QueryRow("SELECT tp_history FROM trades WHERE id = ?", tradeID).Scan(&oldTPHistory); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		// 對應策略定義並檢查必填的策略圖片
+		stored, err := strategies.StoredImageSlots(tx, tradeID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err := strategies.Resolve(tx, userID, &req, stored); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		customValues, err := customfields.Prepare(tx, userID, req.CustomFields, false)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		rawSymbol, err := canonicalSymbol(tx, userID, &req)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		balancePnL(&req)
+		if req.PnLCurrency != nil {
+			currency, err := fx.NormalizeCurrency(*req.PnLCurrency)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			req.PnLCurrency = &currency
+		}
+
 		_, err = tx.Exec(`
-			UPDATE trades SET account_id=?, trade_type=?, symbol=?, side=?, entry_price=?, exit_price=?, lot_size=?, 
+			UPDATE trades SET account_id=?, trade_type=?, symbol=?, raw_symbol=?, side=?, entry_price=?, exit_price=?, lot_size=?, 
 				   pnl=?, pnl_points=?, notes=?, entry_reason=?, exit_reason=?, entry_strategy=?, entry_strategy_image=?, entry_strategy_image_original=?, entry_signals=?, entry_checklist=?,
 				   entry_pattern=?, trend_analysis=?, entry_timeframe=?, trend_type=?, market_session=?, initial_sl=?, bullet_size=?, rr_ratio=?, timezone_offset=?, exit_sl=?,
 				   legend_king_htf=?, legend_king_image=?, legend_king_image_original=?, legend_htf=?, legend_htf_image=?, legend_htf_image_original=?, legend_de_htf=?,
-				   entry_time=?, color_tag=?, exit_time=?, updated_at=CURRENT_TIMESTAMP
+				   entry_time=?, color_tag=?, exit_time=?, strategy_id=?, gross_pnl=?, commission=?, swap=?, fees=?, pnl_currency=?, initial_tp=?, exit_tp=?, tp_history=?, updated_at=CURRENT_TIMESTAMP
 			WHERE id=?
-		`, req.AccountID, req.TradeType, req.Symbol, req.Side, req.EntryPrice, req.ExitPrice, req.LotSize, req.PnL,
+		`, req.AccountID, req.TradeType, req.Symbol, rawSymbol, req.Side, req.EntryPrice, req.ExitPrice, req.LotSize, req.PnL,
 			req.PnLPoints, req.Notes, req.EntryReason, req.ExitReason, req.EntryStrategy, req.EntryStrategyImage, req.EntryStrategyImageOriginal, req.EntrySignals, req.EntryChecklist,
 			req.EntryPattern, req.TrendAnalysis, req.EntryTimeframe, req.TrendType, req.MarketSession, req.InitialSL, req.BulletSize, req.RRRatio, req.TimezoneOffset, req.ExitSL,
 			req.LegendKingHTF, req.LegendKingImage, req.LegendKingImageOriginal, req.LegendHTF, req.LegendHTFImage, req.LegendHTFImageOriginal, req.LegendDeHTF,
-			req.EntryTime, req.ColorTag, req.ExitTime, id)
+			req.EntryTime, req.ColorTag, req.ExitTime, req.StrategyID, req.GrossPnL, req.Commission, req.Swap, req.Fees, req.PnLCurrency, req.InitialTP, req.ExitTP, tpHistory(oldTPHistory, req.InitialTP, req.ExitTP), id)
 
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -337,12 +453,42 @@ func UpdateTrade(db *sql.DB) gin.HandlerFunc {
 			var tagID int64
 			err = tx.QueryRow("SELECT id FROM tags WHERE name = ? AND user_id = ?", tagName, userID).Scan(&tagID)
 			if err == sql.ErrNoRows {
-				result, _ := tx.Exec("INSERT INTO tags (name, user_id) VALUES (?, ?)", tagName, userID)
-				tagID, _ = result.LastInsertId()
+				tagID, _ = database.InsertID(tx, "INSERT INTO tags (name, user_id) VALUES (?, ?)", tagName, userID)
 			}
 			tx.Exec("INSERT INTO trade_tags (trade_id, tag_id) VALUES (?, ?)", id, tagID)
 		}
 
+		// 請求中有策略圖片時取代原本的策略圖片，進出場圖片維持不變
+		if hasStrategyImages(req.Images) {
+			tx.Exec("DELETE FROM trade_images WHERE trade_id = ? AND image_type = ?", tradeID, strategies.ImageType)
+			for _, img := range req.Images {
+				if img.ImageType == strategies.ImageType {
+					gallery.Add(tx, tradeID, img)
+				}
+			}
+		}
+
+		// 自訂欄位只修改請求中有的 key
+		if err := customfields.Save(tx, tradeID, customValues); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		// 有成交紀錄時，價格與盈虧以成交為準；點數與風報比依品種規格重新計算
+		if err := executions.Recalculate(tx, tradeID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		after, err := audit.Snapshot(tx, tradeID)
+		if err == nil {
+			err = audit.Record(tx, tradeID, userID, audit.ActionUpdate, audit.SourceAPI, before, after)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
 		if err := tx.Commit(); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
@@ -352,13 +498,21 @@ func UpdateTrade(db *sql.DB) gin.HandlerFunc {
 	}
 }
 
-// DeleteTrade 刪除交易
+// DeleteTrade 刪除交易 (移到垃圾桶)
 func DeleteTrade(db *sql.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id := c.Param("id")
 		userID := c.GetInt64("user_id")
 
-		result, err := db.Exec("DELETE FROM trades WHERE id = ? AND id IN (SELECT t.id FROM trades t JOIN accounts a ON t.account_id = a.id WHERE a.user_id = ?)", id, userID)
+		tx, err := db.Begin()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer tx.Rollback()
+
+		batch := trash.NewBatch()
+		result, err := tx.Exec("UPDATE trades SET deleted_at = CURRENT_TIMESTAMP, delete_batch = ? WHERE id = ? AND deleted_at IS NULL AND id IN (SELECT t.id FROM trades t JOIN accounts a ON t.account_id = a.id WHERE a.user_id = ?)", batch, id, userID)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
@@ -370,28 +524,30 @@ func DeleteTrade(db *sql.DB) gin.HandlerFunc {
 			return
 		}
 
+		if err := audit.RecordBatchDelete(tx, batch, userID, audit.SourceAPI); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
 		c.JSON(http.StatusOK, gin.H{"message": "交易紀錄刪除成功"})
 	}
 }
 
 // loadTradeRelations 載入交易的關聯資料（圖片和標籤）
 func loadTradeRelations(db *sql.DB, trade *models.Trade) {
-	// 載入圖片
-	imgRows, _ := db.Query(`
-		SELECT id, trade_id, image_type, image_path, created_at
-		FROM trade_images WHERE trade_id = ?
-	`, trade.ID)
-	defer imgRows.Close()
+	resolveTradeImageURLs(trade)
 
-	for imgRows.Next() {
-		var img models.Image
-		imgRows.Scan(&img.ID, &img.TradeID, &img.ImageType, &img.ImagePath, &img.CreatedAt)
-		trade.Images = append(trade.Images, img)
-	}
+	// 載入圖片 (依檢討順序)
+	trade.Images, _ = gallery.Load(db, trade.ID)
 
 	// 載入標籤
 	tagRows, _ := db.Query(`
-		SELECT t.id, t.name, t.created_at
+		SELECT t.id, t.name, t.color, t.group_id, t.created_at
 		FROM tags t
 		INNER JOIN trade_tags tt ON t.id = tt.tag_id
 		WHERE tt.trade_id = ?
@@ -400,29 +556,152 @@ func loadTradeRelations(db *sql.DB, trade *models.Trade) {
 
 	for tagRows.Next() {
 		var tag models.Tag
-		tagRows.Scan(&tag.ID, &tag.Name, &tag.CreatedAt)
+		tagRows.Scan(&tag.ID, &tag.Name, &tag.Color, &tag.GroupID, &tag.CreatedAt)
 		trade.Tags = append(trade.Tags, tag)
 	}
+
+	// 載入成交紀錄
+	trade.Executions, _ = executions.Load(db, trade.ID)
+
+	// 載入自訂欄位
+	trade.CustomFields, _ = customfields.Load(db, trade.ID)
+
+	// 載入錯誤類型
+	trade.Mistakes, _ = reviews.Load(db, trade.ID)
 }
 
-// GetTags 取得所有標籤
-func GetTags(db *sql.DB) gin.HandlerFunc {
+// GetTradeHistory 取得交易的欄位異動紀錄
+func GetTradeHistory(db *sql.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID := c.GetInt64("user_id")
-		rows, err := db.Query("SELECT id, name, created_at FROM tags WHERE user_id = ? ORDER BY name", userID)
+		tradeID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "無效的交易 ID"})
+			return
+		}
+
+		// 已刪除的交易仍可查看紀錄，方便從垃圾桶還原前確認內容
+		var exists int
+		db.QueryRow("SELECT 1 FROM trades t JOIN accounts a ON t.account_id = a.id WHERE t.id = ? AND a.user_id = ?", tradeID, userID).Scan(&exists)
+		if exists == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "交易紀錄不存在"})
+			return
+		}
+
+		revisions, err := audit.History(db, tradeID)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		defer rows.Close()
+		c.JSON(http.StatusOK, revisions)
+	}
+}
 
-		tags := []models.Tag{}
-		for rows.Next() {
-			var tag models.Tag
-			rows.Scan(&tag.ID, &tag.Name, &tag.CreatedAt)
-			tags = append(tags, tag)
+// RevertTrade 將交易還原到指定異動完成後的狀態
+func RevertTrade(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetInt64("user_id")
+		tradeID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "無效的交易 ID"})
+			return
+		}
+
+		var req struct {
+			RevisionID int64 `json:"revision_id" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var exists int
+		db.QueryRow("SELECT 1 FROM trades t JOIN accounts a ON t.account_id = a.id WHERE t.id = ? AND a.user_id = ? AND t.deleted_at IS NULL AND a.deleted_at IS NULL", tradeID, userID).Scan(&exists)
+		if exists == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "交易紀錄不存在"})
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer tx.Rollback()
+
+		changes, err := audit.Revert(tx, tradeID, req.RevisionID, userID)
+		if err == audit.ErrRevisionNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
 		}
 
-		c.JSON(http.StatusOK, tags)
+		c.JSON(http.StatusOK, gin.H{"message": "交易紀錄已還原", "changes": changes})
+	}
+}
+
+func hasStrategyImages(images []models.ImageUpload) bool {
+	for _, img := range images {
+		if img.ImageType == strategies.ImageType {
+			return true
+		}
+	}
+	return false
+}
+
+// canonicalSymbol 將請求中的品種名稱轉為標準名稱，回傳原始名稱存入 raw_symbol
+func canonicalSymbol(q database.Querier, userID int64, req *models.TradeCreate) (string, error) {
+	raw := strings.TrimSpace(req.Symbol)
+	symbol, err := instruments.Canonical(q, userID, raw)
+	if err != nil {
+		return "", err
+	}
+	req.Symbol = symbol
+	return raw, nil
+}
+
+// balancePnL 讓淨盈虧、毛盈虧與費用一致 (pnl = gross_pnl + commission + swap + fees)
+// 只提供淨盈虧或毛盈虧其中之一時由費用推算另一個，沒有任何費用時不處理
+func balancePnL(req *models.TradeCreate) {
+	if req.Commission == nil && req.Swap == nil && req.Fees == nil {
+		return
+	}
+	var costs float64
+	for _, v := range []*float64{req.Commission, req.Swap, req.Fees} {
+		if v != nil {
+			costs += *v
+		}
+	}
+	switch {
+	case req.PnL == nil && req.GrossPnL != nil:
+		pnl := math.Round((*req.GrossPnL+costs)*100) / 100
+		req.PnL = &pnl
+	case req.GrossPnL == nil && req.PnL != nil:
+		gross := math.Round((*req.PnL-costs)*100) / 100
+		req.GrossPnL = &gross
+	}
+}
+
+// tpHistory 將手動設定的停利價位加入既有的 tp_history，沒有任何停利時維持 NULL
+func tpHistory(existing *string, prices ...*float64) *string {
+	levels := executions.ParseLevels(existing)
+	now := time.Now().UnixMilli()
+	for _, p := range prices {
+		if p != nil {
+			levels.Add(*p, now)
+		}
+	}
+	if len(levels) == 0 {
+		return existing
 	}
+	history := levels.JSON()
+	return &history
 }
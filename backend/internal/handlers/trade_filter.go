@@ -0,0 +1,247 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"trade-journal/internal/customfields"
+	"trade-journal/internal/images"
+	"trade-journal/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultTradeSort 交易列表的預設排序
+const defaultTradeSort = "-entry_time"
+
+// tradeSortKeys 可排序的欄位，T 代表 trades 的別名
+// 可能為 NULL 的欄位以 COALESCE 補值，讓游標比較結果穩定
+var tradeSortKeys = map[string]string{
+	"entry_time": "T.entry_time",
+	"exit_time":  "COALESCE(T.exit_time, T.entry_time)",
+	"created_at": "T.created_at",
+	"symbol":     "T.symbol",
+	"pnl":        "COALESCE(T.pnl, 0)",
+	"r":          "COALESCE(T.rr_ratio, 0)",
+	"lot_size":   "COALESCE(T.lot_size, 0)",
+}
+
+// tradeSort 排序方式，相同值時再以 id 排序
+type tradeSort struct {
+	key  string
+	desc bool
+}
+
+// parseTradeSort 解析 sort 參數，例如 "pnl" 或 "-entry_time"
+func parseTradeSort(value string) (tradeSort, error) {
+	if value == "" {
+		value = defaultTradeSort
+	}
+	s := tradeSort{key: strings.TrimPrefix(value, "-"), desc: strings.HasPrefix(value, "-")}
+	if _, ok := tradeSortKeys[s.key]; !ok {
+		return s, fmt.Errorf("不支援的排序欄位: %s", s.key)
+	}
+	return s, nil
+}
+
+func (s tradeSort) String() string {
+	if s.desc {
+		return "-" + s.key
+	}
+	return s.key
+}
+
+// expr 以指定別名展開排序欄位
+func (s tradeSort) expr(alias string) string {
+	return strings.ReplaceAll(tradeSortKeys[s.key], "T.", alias+".")
+}
+
+// orderBy 回傳 ORDER BY 子句
+func (s tradeSort) orderBy() string {
+	dir := " ASC"
+	if s.desc {
+		dir = " DESC"
+	}
+	return " ORDER BY " + s.expr("t") + dir + ", t.id" + dir
+}
+
+// after 回傳排在游標交易之後的條件，以子查詢取得游標交易的排序值
+func (s tradeSort) after(cursorID int64) (string, []interface{}) {
+	op := ">"
+	if s.desc {
+		op = "<"
+	}
+	value := "(SELECT " + s.expr("c") + " FROM trades c WHERE c.id = ?)"
+	where := fmt.Sprintf(" AND (%s %s %s OR (%s = %s AND t.id %s ?))", s.expr("t"), op, value, s.expr("t"), value, op)
+	return where, []interface{}{cursorID, cursorID, cursorID}
+}
+
+// encodeCursor 將排序方式與最後一筆交易 ID 編成游標
+func encodeCursor(s tradeSort, lastID int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(s.String() + "|" + strconv.FormatInt(lastID, 10)))
+}
+
+// decodeCursor 解析游標，排序方式必須與產生游標時相同
+func decodeCursor(cursor string, s tradeSort) (int64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err == nil {
+		parts := strings.SplitN(string(raw), "|", 2)
+		if len(parts) == 2 && parts[0] == s.String() {
+			if id, err := strconv.ParseInt(parts[1], 10, 64); err == nil {
+				return id, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("無效的游標或排序方式已變更")
+}
+
+// cursorValid 游標指向的交易仍存在且未刪除，否則游標之後的條件會比對到 NULL 而回傳空頁
+func cursorValid(db *sql.DB, userID, cursorID int64) (bool, error) {
+	var exists bool
+	err := db.QueryRow(`SELECT EXISTS(SELECT 1 FROM trades t JOIN accounts a ON t.account_id = a.id
+		WHERE t.id = ? AND a.user_id = ? AND t.deleted_at IS NULL AND a.deleted_at IS NULL)`, cursorID, userID).Scan(&exists)
+	return exists, err
+}
+
+// tradeFilter 將篩選條件轉為 SQL 條件 (以 AND 開頭)，t 為 trades 的別名
+func tradeFilter(query models.TradeQuery) (string, []interface{}) {
+	var where string
+	var args []interface{}
+	add := func(cond string, values ...interface{}) {
+		where += " AND " + cond
+		args = append(args, values...)
+	}
+
+	if query.AccountID > 0 {
+		add("t.account_id = ?", query.AccountID)
+	}
+	for _, f := range []struct {
+		column string
+		value  string
+	}{
+		{"t.symbol", query.Symbol},
+		{"t.side", query.Side},
+		{"t.trade_type", query.TradeType},
+		{"t.entry_strategy", query.EntryStrategy},
+		{"t.strategy_id", query.StrategyID},
+		{"t.market_session", query.MarketSession},
+		{"t.entry_timeframe", query.EntryTimeframe},
+		{"t.trend_type", query.TrendType},
+		{"t.color_tag", query.ColorTag},
+		{"t.daily_plan_id", query.DailyPlanID},
+		{"COALESCE(t.review_status, 'unreviewed')", query.ReviewStatus},
+	} {
+		if cond, values := inList(f.column, f.value); cond != "" {
+			add(cond, values...)
+		}
+	}
+	if cond, values := inList("tg.name", query.Tag); cond != "" {
+		add("EXISTS (SELECT 1 FROM trade_tags tt JOIN tags tg ON tt.tag_id = tg.id WHERE tt.trade_id = t.id AND "+cond+")", values...)
+	}
+	if query.StartDate != "" {
+		add("t.entry_time >= ?", query.StartDate)
+	}
+	if query.EndDate != "" {
+		add("t.entry_time <= ?", query.EndDate)
+	}
+	if query.MinPnL != nil {
+		add("t.pnl >= ?", *query.MinPnL)
+	}
+	if query.MaxPnL != nil {
+		add("t.pnl <= ?", *query.MaxPnL)
+	}
+	if query.MinR != nil {
+		add("t.rr_ratio >= ?", *query.MinR)
+	}
+	if query.MaxR != nil {
+		add("t.rr_ratio <= ?", *query.MaxR)
+	}
+	// 與統計相同，有出場價即視為已平倉
+	switch query.Status {
+	case "open":
+		add("t.exit_price IS NULL")
+	case "closed":
+		add("t.exit_price IS NOT NULL")
+	}
+	if query.HasImages != nil {
+		// 圖片可能在圖庫 (trade_images)，或仍存放在交易的策略圖片欄位
+		conds := []string{"EXISTS (SELECT 1 FROM trade_images ti WHERE ti.trade_id = t.id)"}
+		for _, col := range images.TradeColumns {
+			conds = append(conds, "COALESCE(t."+col+", '') <> ''")
+		}
+		cond := "(" + strings.Join(conds, " OR ") + ")"
+		if !*query.HasImages {
+			cond = "NOT " + cond
+		}
+		add(cond)
+	}
+	customWhere, customArgs := customfields.Filter(query.CustomFields)
+	where += customWhere
+	args = append(args, customArgs...)
+	return where, args
+}
+
+// inList 將逗號分隔的值轉為 = 或 IN 條件，沒有值時回傳空字串
+func inList(column, value string) (string, []interface{}) {
+	var values []interface{}
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	switch len(values) {
+	case 0:
+		return "", nil
+	case 1:
+		return column + " = ?", values
+	}
+	return column + " IN (?" + strings.Repeat(", ?", len(values)-1) + ")", values
+}
+
+// statsFilter 解析與交易列表相同的篩選條件並檢查帳號所屬權
+// 回傳以 AND 開頭的條件，t 為 trades 的別名
+func statsFilter(c *gin.Context, db *sql.DB) (string, []interface{}, bool) {
+	userID := c.GetInt64("user_id")
+	var query models.TradeQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return "", nil, false
+	}
+	query.CustomFields = c.QueryMap("cf")
+	if query.AccountID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "請提供 account_id"})
+		return "", nil, false
+	}
+
+	// 檢查帳號所屬權
+	var exists int
+	db.QueryRow("SELECT 1 FROM accounts WHERE id = ? AND user_id = ? AND deleted_at IS NULL", query.AccountID, userID).Scan(&exists)
+	if exists == 0 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "無權限操作此帳號"})
+		return "", nil, false
+	}
+
+	where, args := tradeFilter(query)
+	return where, args, true
+}
+
+// costFilter 與 statsFilter 相同，但 account_id 可省略，省略時統計使用者所有帳號
+func costFilter(c *gin.Context, db *sql.DB) (string, []interface{}, bool) {
+	if c.Query("account_id") != "" {
+		return statsFilter(c, db)
+	}
+	var query models.TradeQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return "", nil, false
+	}
+	query.CustomFields = c.QueryMap("cf")
+
+	where, args := tradeFilter(query)
+	where = " AND t.account_id IN (SELECT id FROM accounts WHERE user_id = ? AND deleted_at IS NULL)" + where
+	return where, append([]interface{}{c.GetInt64("user_id")}, args...), true
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"fmt"
+	"testing"
+
+	"trade-journal/internal/models"
+	"trade-journal/internal/testutil"
+)
+
+func TestGetTradesFilterAndCursor(t *testing.T) {
+	s := newStatsTestServer(t,
+		"INSERT INTO users (id, username, password) VALUES (1, 'alice', 'x')",
+		"INSERT INTO accounts (id, user_id, name) VALUES (10, 1, 'main')",
+		// 102 與 103 的盈虧相同，用來確認游標在同值時不會重複或漏掉
+		`INSERT INTO trades (id, account_id, symbol, side, entry_price, lot_size, exit_price, pnl, market_session, entry_time) VALUES
+			(101, 10, 'XAUUSD', 'long', 1, 1, 2, 50, 'asian', '2024-05-01 08:00:00'),
+			(102, 10, 'XAUUSD', 'short', 1, 1, 2, -20, 'us', '2024-05-02 08:00:00'),
+			(103, 10, 'NAS100', 'long', 1, 1, 2, -20, 'european', '2024-05-03 08:00:00'),
+			(104, 10, 'EURUSD', 'long', 1, 1, NULL, NULL, 'asian', '2024-05-04 08:00:00')`,
+		`INSERT INTO custom_fields (id, user_id, field_key, name, field_type, options) VALUES (1, 1, 'news', '新聞', 'boolean', '[]')`,
+		`INSERT INTO trade_custom_values (trade_id, field_id, value) VALUES (101, 1, 'true'), (102, 1, 'false'), (103, 1, 'true')`,
+	)
+	s.GET("/trades", GetTrades(s.db))
+	type page struct {
+		Data       []models.Trade `json:"data"`
+		Pagination struct {
+			Total int `json:"total"`
+		} `json:"pagination"`
+		NextCursor string `json:"next_cursor"`
+	}
+
+	var p page
+	s.get("/trades?account_id=10&symbol=XAUUSD,NAS100&status=closed&start_date=2024-05-02", &p)
+	if p.Pagination.Total != 2 || len(p.Data) != 2 {
+		t.Fatalf("總數應套用日期篩選, got total=%d len=%d", p.Pagination.Total, len(p.Data))
+	}
+
+	var stats models.StatsSummary
+	s.get("/stats/summary?account_id=10&market_session=asian,us", &stats)
+	if stats.TotalTrades != 2 || stats.TotalPnL != 30 {
+		t.Fatalf("統計應套用相同篩選, got %+v", stats)
+	}
+
+	p = page{}
+	s.get("/trades?account_id=10&cf[news]=true", &p)
+	if p.Pagination.Total != 2 || p.Data[0].CustomFields["news"] != true {
+		t.Fatalf("自訂欄位篩選錯誤, got total=%d %+v", p.Pagination.Total, p.Data)
+	}
+
+	var byField struct {
+		Stats []models.FieldStats `json:"stats"`
+	}
+	s.get("/stats/by-field/news?account_id=10&symbol=XAUUSD", &byField)
+	if fmt.Sprint(byField.Stats) != "[{false 1 0 0 -20} {true 1 1 100 50}]" {
+		t.Fatalf("自訂欄位統計錯誤: %v", byField.Stats)
+	}
+
+	var ids []int64
+	url := "/trades?account_id=10&sort=pnl&page_size=1"
+	for i := 0; i < 10; i++ {
+		p = page{}
+		s.get(url, &p)
+		for _, trade := range p.Data {
+			ids = append(ids, trade.ID)
+		}
+		if p.NextCursor == "" {
+			break
+		}
+		url = "/trades?account_id=10&sort=pnl&page_size=1&cursor=" + p.NextCursor
+	}
+	if fmt.Sprint(ids) != "[102 103 104 101]" {
+		t.Fatalf("游標分頁順序錯誤: %v", ids)
+	}
+
+	// 游標指向的交易已刪除時回傳 400，而不是空頁
+	p = page{}
+	s.get("/trades?account_id=10&sort=pnl&page_size=1", &p)
+	if _, err := s.db.Exec("UPDATE trades SET deleted_at = CURRENT_TIMESTAMP WHERE id = ?", p.Data[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if code := s.do("GET", "/trades?account_id=10&sort=pnl&page_size=1&cursor="+p.NextCursor, "", nil); code != 400 {
+		t.Fatalf("失效的游標應回傳 400，得到 %d", code)
+	}
+
+	// 策略圖片欄位中的圖片也算有圖片
+	testutil.Exec(t, s.db,
+		"INSERT INTO trade_images (trade_id, image_type, image_path) VALUES (101, 'entry', '2024-05/a.png')",
+		"UPDATE trades SET legend_htf_image = '2024-05/b.png' WHERE id = 104",
+	)
+	for url, want := range map[string]string{
+		"/trades?account_id=10&has_images=true&sort=entry_time":  "[101 104]",
+		"/trades?account_id=10&has_images=false&sort=entry_time": "[103]",
+	} {
+		p = page{}
+		s.get(url, &p)
+		ids = nil
+		for _, trade := range p.Data {
+			ids = append(ids, trade.ID)
+		}
+		if fmt.Sprint(ids) != want {
+			t.Fatalf("%s: 得到 %v，應為 %s", url, ids, want)
+		}
+	}
+}
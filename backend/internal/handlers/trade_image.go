@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"trade-journal/internal/gallery"
+	"trade-journal/internal/images"
+	"trade-journal/internal/minio"
+	"trade-journal/internal/models"
+	"trade-journal/internal/strategies"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetTradeImages 取得交易的圖片，依檢討順序排列
+func GetTradeImages(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tradeID, ok := ownedTradeID(c, db)
+		if !ok {
+			return
+		}
+		list, err := gallery.Load(db, tradeID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if list == nil {
+			list = []models.Image{}
+		}
+		c.JSON(http.StatusOK, list)
+	}
+}
+
+// AddTradeImage 新增單張圖片到交易最後
+// image_path 可為 /images/upload 回傳的路徑、下載網址或 base64 data URL
+func AddTradeImage(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tradeID, ok := ownedTradeID(c, db)
+		if !ok {
+			return
+		}
+		var req models.ImageUpload
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if req.ImageType == strategies.ImageType {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "策略圖片請透過交易的 images 設定"})
+			return
+		}
+
+		var symbol string
+		db.QueryRow("SELECT symbol FROM trades WHERE id = ?", tradeID).Scan(&symbol)
+		path, err := images.Normalize(context.Background(), db, minio.GlobalClient, symbol, req.ImagePath)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		req.ImagePath = path
+
+		id, err := gallery.Add(db, tradeID, req)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		img, err := gallery.Get(db, tradeID, id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusCreated, img)
+	}
+}
+
+// UpdateTradeImage 修改圖片的類型、說明與截圖時間
+func UpdateTradeImage(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tradeID, ok := ownedTradeID(c, db)
+		if !ok {
+			return
+		}
+		imageID, err := strconv.ParseInt(c.Param("imageId"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "無效的圖片 ID"})
+			return
+		}
+		var req models.ImageUpdate
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := gallery.Update(db, tradeID, imageID, req); err != nil {
+			galleryError(c, err)
+			return
+		}
+		img, err := gallery.Get(db, tradeID, imageID)
+		if err != nil {
+			galleryError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, img)
+	}
+}
+
+// DeleteTradeImage 從交易移除圖片，其餘圖片的順序往前遞補
+func DeleteTradeImage(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tradeID, ok := ownedTradeID(c, db)
+		if !ok {
+			return
+		}
+		imageID, err := strconv.ParseInt(c.Param("imageId"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "無效的圖片 ID"})
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer tx.Rollback()
+
+		if err := gallery.Delete(tx, tradeID, imageID); err != nil {
+			galleryError(c, err)
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "圖片刪除成功"})
+	}
+}
+
+// ReorderTradeImages 依 image_ids 的順序重新排列交易的圖片
+func ReorderTradeImages(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tradeID, ok := ownedTradeID(c, db)
+		if !ok {
+			return
+		}
+		var req models.ImageOrder
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer tx.Rollback()
+
+		if err := gallery.Reorder(tx, tradeID, req.ImageIDs); err != nil {
+			galleryError(c, err)
+			return
+		}
+		list, err := gallery.Load(tx, tradeID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, list)
+	}
+}
+
+func galleryError(c *gin.Context, err error) {
+	switch err {
+	case gallery.ErrNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case gallery.ErrStrategyType, gallery.ErrInvalidTakenAt, gallery.ErrOrderMismatch:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+
+	"trade-journal/internal/trash"
+
+	"github.com/gin-gonic/gin"
+)
+
+// trashRequest 指定要處理的資料，可逐筆指定或以刪除批次整批處理
+type trashRequest struct {
+	Items []trash.Ref `json:"items" binding:"dive"`
+	Batch string      `json:"batch"`
+	All   bool        `json:"all"`
+}
+
+// GetTrash 取得垃圾桶內容
+func GetTrash(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetInt64("user_id")
+		items, err := trash.List(db, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"items":          items,
+			"retention_days": trash.RetentionDays(),
+		})
+	}
+}
+
+// RestoreTrash 從垃圾桶還原資料
+func RestoreTrash(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetInt64("user_id")
+		refs, ok := bindTrashRefs(c, db, userID)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"results": trash.Restore(db, userID, refs)})
+	}
+}
+
+// PurgeTrash 永久刪除垃圾桶中的資料
+func PurgeTrash(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetInt64("user_id")
+		refs, ok := bindTrashRefs(c, db, userID)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"results": trash.Purge(db, userID, refs)})
+	}
+}
+
+// bindTrashRefs 解析請求並展開 batch / all 為實際的資料清單
+func bindTrashRefs(c *gin.Context, db *sql.DB, userID int64) ([]trash.Ref, bool) {
+	var req trashRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	refs := req.Items
+	if req.Batch != "" || req.All {
+		items, err := trash.List(db, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return nil, false
+		}
+		for _, item := range items {
+			if req.All || item.Batch == req.Batch {
+				refs = append(refs, trash.Ref{Type: item.Type, ID: item.ID})
+			}
+		}
+	}
+
+	if len(refs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "請指定要處理的資料"})
+		return nil, false
+	}
+	return refs, true
+}
@@ -0,0 +1,178 @@
+package images
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"trade-journal/internal/minio"
+
+	"github.com/google/uuid"
+	miniogo "github.com/minio/minio-go/v7"
+)
+
+// URLPrefix 圖片下載路由，與前端 imagesAPI.getUrl 的格式一致
+const URLPrefix = "/api/v1/images/"
+
+// TradeColumns 過去以 base64 內嵌在 trades 的圖片欄位，現在存放 MinIO 物件路徑
+var TradeColumns = []string{
+	"entry_strategy_image",
+	"entry_strategy_image_original",
+	"legend_king_image",
+	"legend_king_image_original",
+	"legend_htf_image",
+	"legend_htf_image_original",
+}
+
+// ObjectPath 生成物件路徑: YYYY-MM/YYYYMMDD-SYMBOL-UUID.ext
+func ObjectPath(symbol, ext string) string {
+	if symbol == "" {
+		symbol = "UNKNOWN"
+	}
+	now := time.Now()
+	fileName := fmt.Sprintf("%s-%s-%s%s",
+		now.Format("20060102"),
+		symbol,
+		uuid.New().String()[:8],
+		ext,
+	)
+	return fmt.Sprintf("%s/%s", now.Format("2006-01"), fileName)
+}
+
+// IsDataURL 判斷是否為前端送來的 base64 data URL
+func IsDataURL(v string) bool {
+	return strings.HasPrefix(v, "data:")
+}
+
+// URL 將物件路徑轉為圖片下載網址
+func URL(objectPath string) string {
+	if objectPath == "" || IsDataURL(objectPath) || strings.HasPrefix(objectPath, URLPrefix) {
+		return objectPath
+	}
+	return URLPrefix + path.Base(objectPath) + "?path=" + url.QueryEscape(objectPath)
+}
+
+// PathFromValue 從 API 收到的值取回物件路徑（接受下載網址或路徑本身）
+func PathFromValue(v string) string {
+	if i := strings.Index(v, URLPrefix); i >= 0 {
+		if u, err := url.Parse(v[i:]); err == nil {
+			if p := u.Query().Get("path"); p != "" {
+				return p
+			}
+			return path.Base(u.Path)
+		}
+	}
+	return v
+}
+
+// decodeDataURL 解析 data:image/png;base64,xxxx
+func decodeDataURL(v string) (contentType string, data []byte, err error) {
+	comma := strings.Index(v, ",")
+	if !IsDataURL(v) || comma < 0 {
+		return "", nil, fmt.Errorf("不是有效的 data URL")
+	}
+	meta := v[len("data:"):comma]
+	if !strings.HasSuffix(meta, ";base64") {
+		return "", nil, fmt.Errorf("僅支援 base64 編碼的 data URL")
+	}
+	contentType = strings.TrimSuffix(meta, ";base64")
+	if contentType == "" {
+		contentType = "image/png"
+	}
+	data, err = base64.StdEncoding.DecodeString(v[comma+1:])
+	if err != nil {
+		return "", nil, fmt.Errorf("base64 解碼失敗: %w", err)
+	}
+	return contentType, data, nil
+}
+
+func extensionFor(contentType string) string {
+	switch contentType {
+	case "image/jpeg", "image/jpg":
+		return ".jpg"
+	case "image/gif":
+		return ".gif"
+	case "image/webp":
+		return ".webp"
+	default:
+		return ".png"
+	}
+}
+
+// StoreDataURL 將 base64 data URL 上傳到 MinIO 並回傳物件路徑，縮圖在背景產生
+// 物件大小記錄在 image_sizes，計算使用量時不需查詢 MinIO
+func StoreDataURL(ctx context.Context, db *sql.DB, client *miniogo.Client, symbol, dataURL string) (string, error) {
+	contentType, data, err := decodeDataURL(dataURL)
+	if err != nil {
+		return "", err
+	}
+
+	objectPath := ObjectPath(symbol, extensionFor(contentType))
+	_, err = client.PutObject(ctx, minio.BucketName, objectPath, bytes.NewReader(data), int64(len(data)), miniogo.PutObjectOptions{
+		ContentType: contentType,
+	})
+	if err != nil {
+		return "", fmt.Errorf("圖片上傳失敗: %w", err)
+	}
+	if err := RecordSize(db, objectPath, int64(len(data))); err != nil {
+		return "", err
+	}
+	StartRenditions(db, client, objectPath, data)
+	return objectPath, nil
+}
+
+// Normalize 將 API 收到的圖片欄位轉為要寫入資料庫的值
+// data URL 會上傳成物件；下載網址會轉回路徑；MinIO 未啟用時保留原值
+func Normalize(ctx context.Context, db *sql.DB, client *miniogo.Client, symbol, v string) (string, error) {
+	if v == "" {
+		return "", nil
+	}
+	if IsDataURL(v) {
+		if client == nil {
+			return v, nil
+		}
+		return StoreDataURL(ctx, db, client, symbol, v)
+	}
+	return PathFromValue(v), nil
+}
+
+// Read 讀取圖片內容，v 可為物件路徑、下載網址或 data URL
+func Read(ctx context.Context, client *miniogo.Client, v string) ([]byte, error) {
+	if IsDataURL(v) {
+		_, data, err := decodeDataURL(v)
+		return data, err
+	}
+	if client == nil {
+		return nil, fmt.Errorf("MinIO 未啟用")
+	}
+	object, err := client.GetObject(ctx, minio.BucketName, PathFromValue(v), miniogo.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+	return io.ReadAll(object)
+}
+
+// Remove 刪除物件與其縮圖，用於上傳後未被採用的物件，失敗時僅記錄
+func Remove(ctx context.Context, client *miniogo.Client, objectPath string) {
+	if client == nil {
+		return
+	}
+	paths := []string{objectPath}
+	for _, r := range Renditions {
+		paths = append(paths, RenditionPath(objectPath, r.Size))
+	}
+	for _, p := range paths {
+		if err := client.RemoveObject(ctx, minio.BucketName, p, miniogo.RemoveObjectOptions{}); err != nil {
+			log.Printf("[Images] 刪除 %s 失敗: %v", p, err)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package images
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"trade-journal/internal/testutil"
+)
+
+func TestURLRoundTrip(t *testing.T) {
+	p := "2024-05/20240501-XAUUSD-1a2b3c4d.png"
+	u := URL(p)
+	if u != "/api/v1/images/20240501-XAUUSD-1a2b3c4d.png?path=2024-05%2F20240501-XAUUSD-1a2b3c4d.png" {
+		t.Fatalf("URL = %s", u)
+	}
+	if got := PathFromValue(u); got != p {
+		t.Fatalf("PathFromValue(%s) = %s", u, got)
+	}
+	if got := PathFromValue("http://localhost:8080" + u); got != p {
+		t.Fatalf("absolute URL: got %s", got)
+	}
+	if got := URL("data:image/png;base64,AAAA"); got != "data:image/png;base64,AAAA" {
+		t.Fatalf("data URL should be kept, got %s", got)
+	}
+}
+
+func TestDecodeDataURL(t *testing.T) {
+	ct, data, err := decodeDataURL("data:image/jpeg;base64,aGVsbG8=")
+	if err != nil || ct != "image/jpeg" || string(data) != "hello" {
+		t.Fatalf("got %q %q %v", ct, data, err)
+	}
+	if extensionFor(ct) != ".jpg" {
+		t.Fatalf("extension = %s", extensionFor(ct))
+	}
+	if _, _, err := decodeDataURL("data:image/png,plain"); err == nil {
+		t.Fatal("expected error for non-base64 data URL")
+	}
+}
+
+func TestRenditionPath(t *testing.T) {
+	p := "2024-05/20240501-XAUUSD-1a2b3c4d.png"
+	if got := RenditionPath(p, SizeThumb); got != "2024-05/20240501-XAUUSD-1a2b3c4d.thumb.jpg" {
+		t.Fatalf("thumb = %s", got)
+	}
+	if got := RenditionPath(p, ""); got != p {
+		t.Fatalf("original = %s", got)
+	}
+	if !IsRendition(RenditionPath(p, SizeMedium)) || IsRendition(p) {
+		t.Fatal("IsRendition mismatch")
+	}
+	if renditionSource(RenditionPath(p, SizeThumb)) || !renditionSource(p) || renditionSource("2024-05/a.webp") {
+		t.Fatal("renditionSource mismatch")
+	}
+	if !ValidSize(SizeMedium) || !ValidSize(SizeOriginal) || ValidSize("large") {
+		t.Fatal("ValidSize mismatch")
+	}
+}
+
+func TestResize(t *testing.T) {
+	// 左半紅色、右半透明
+	src := image.NewNRGBA(image.Rect(0, 0, 400, 100))
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 200; x++ {
+			src.SetNRGBA(x, y, color.NRGBA{R: 0xff, A: 0xff})
+		}
+	}
+	dst := Resize(src, 40)
+	if b := dst.Bounds(); b.Dx() != 40 || b.Dy() != 10 {
+		t.Fatalf("size = %v", b)
+	}
+	if got := dst.RGBAAt(5, 5); got != (color.RGBA{R: 0xff, A: 0xff}) {
+		t.Fatalf("left = %v", got)
+	}
+	if got := dst.RGBAAt(35, 5); got != (color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}) {
+		t.Fatalf("transparent should be white, got %v", got)
+	}
+	if b := Resize(src, 1000).Bounds(); b.Dx() != 400 || b.Dy() != 100 {
+		t.Fatalf("small image should keep size, got %v", b)
+	}
+
+	data, err := encodeRendition(src, 40)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil || img.Bounds().Dx() != 40 {
+		t.Fatalf("jpeg = %v %v", img, err)
+	}
+}
+
+// opaque 隱藏圖片的具體型別，讓 Resize 走逐點讀取的路徑
+type opaque struct{ image.Image }
+
+func TestResizeFastPaths(t *testing.T) {
+	rect := image.Rect(3, 5, 203, 105)
+	rgba := image.NewRGBA(rect)
+	nrgba := image.NewNRGBA(rect)
+	ycbcr := image.NewYCbCr(rect, image.YCbCrSubsampleRatio420)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			c := color.NRGBA{R: uint8(x), G: uint8(y * 2), B: uint8(x + y), A: uint8(x * 3)}
+			rgba.Set(x, y, c)
+			nrgba.SetNRGBA(x, y, c)
+			ycbcr.Y[ycbcr.YOffset(x, y)] = uint8(x + y)
+			ycbcr.Cb[ycbcr.COffset(x, y)] = uint8(x)
+			ycbcr.Cr[ycbcr.COffset(x, y)] = uint8(y)
+		}
+	}
+	for _, src := range []image.Image{rgba, nrgba, ycbcr} {
+		fast, slow := Resize(src, 50), Resize(opaque{src}, 50)
+		for i := range fast.Pix {
+			if d := int(fast.Pix[i]) - int(slow.Pix[i]); d < -2 || d > 2 {
+				t.Fatalf("%T: pix[%d] = %d, want %d", src, i, fast.Pix[i], slow.Pix[i])
+			}
+		}
+	}
+}
+
+func TestDecodeRejectsHugeImage(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Decode(buf.Bytes()); err != nil {
+		t.Fatalf("small image: %v", err)
+	}
+
+	// 將 IHDR 宣告的尺寸改為 60000x60000
+	data := buf.Bytes()
+	binary.BigEndian.PutUint32(data[16:], 60000)
+	binary.BigEndian.PutUint32(data[20:], 60000)
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+	if _, err := Decode(data); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("err = %v, want ErrTooLarge", err)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	db := testutil.OpenDB(t,
+		"INSERT INTO users (id, username, password) VALUES (1, 'alice', 'x')",
+		"INSERT INTO accounts (id, user_id, name) VALUES (10, 1, 'main'), (11, 1, 'demo')",
+		"INSERT INTO trades (id, account_id, symbol, side, entry_time, entry_strategy_image, entry_strategy_image_original) VALUES (100, 10, 'XAUUSD', 'long', '2024-05-06', '2024-05/a.png', 'data:image/png;base64,AAAA')",
+		"INSERT INTO trades (id, account_id, symbol, side, entry_time, legend_htf_image) VALUES (101, 11, 'EURUSD', 'long', '2024-05-06', '/api/v1/images/b.png?path=2024-05%2Fb.png')",
+		"INSERT INTO trade_images (trade_id, image_type, image_path) VALUES (100, 'strategy', '2024-05/a.png'), (100, 'entry', '2024-05/c.png')",
+		"INSERT INTO image_sizes (object_path, size) VALUES ('2024-05/a.png', 1000), ('2024-05/b.png', 300)",
+	)
+	// 上傳時記錄的大小，MinIO 未啟用時也能計算
+	if err := RecordSize(db, "2024-05/c.png", 20); err != nil {
+		t.Fatal(err)
+	}
+
+	usage, err := Usage(context.Background(), db, nil, "account_id IN (SELECT id FROM accounts WHERE user_id = ?)", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a.png 被兩處參照只計算一次，data URL 以長度計算
+	if usage[10] != 1000+20+int64(len("data:image/png;base64,AAAA")) || usage[11] != 300 {
+		t.Fatalf("usage = %v", usage)
+	}
+}
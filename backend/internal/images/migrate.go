@@ -0,0 +1,100 @@
+package images
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+
+	miniogo "github.com/minio/minio-go/v7"
+)
+
+const migrateBatchSize = 50
+
+// StartMigration 在背景將 trades 中殘留的 base64 圖片搬到 MinIO
+func StartMigration(db *sql.DB, client *miniogo.Client) {
+	go func() {
+		converted, err := MigrateTradeImages(context.Background(), db, client)
+		if err != nil {
+			log.Printf("[Images] 圖片搬移中斷 (已轉換 %d 張): %v", converted, err)
+			return
+		}
+		if converted > 0 {
+			log.Printf("[Images] 圖片搬移完成，共轉換 %d 張", converted)
+		}
+	}()
+}
+
+// MigrateTradeImages 逐批轉換 base64 圖片欄位，回傳轉換的張數
+// 更新時會比對原值，避免覆蓋搬移期間使用者剛編輯過的內容
+func MigrateTradeImages(ctx context.Context, db *sql.DB, client *miniogo.Client) (int, error) {
+	conds := make([]string, len(TradeColumns))
+	for i, col := range TradeColumns {
+		conds[i] = col + " LIKE 'data:%'"
+	}
+	query := fmt.Sprintf(`SELECT id, symbol, %s FROM trades WHERE id > ? AND (%s) ORDER BY id LIMIT %d`,
+		strings.Join(TradeColumns, ", "), strings.Join(conds, " OR "), migrateBatchSize)
+
+	converted := 0
+	var lastID int64
+	for {
+		type pending struct {
+			id     int64
+			symbol string
+			values []sql.NullString
+		}
+
+		rows, err := db.Query(query, lastID)
+		if err != nil {
+			return converted, err
+		}
+		var batch []pending
+		for rows.Next() {
+			p := pending{values: make([]sql.NullString, len(TradeColumns))}
+			dest := []interface{}{&p.id, &p.symbol}
+			for i := range p.values {
+				dest = append(dest, &p.values[i])
+			}
+			if err := rows.Scan(dest...); err != nil {
+				rows.Close()
+				return converted, err
+			}
+			batch = append(batch, p)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return converted, err
+		}
+
+		if len(batch) == 0 {
+			return converted, nil
+		}
+
+		for _, p := range batch {
+			lastID = p.id
+			for i, col := range TradeColumns {
+				v := p.values[i]
+				if !v.Valid || !IsDataURL(v.String) {
+					continue
+				}
+				objectPath, err := StoreDataURL(ctx, db, client, p.symbol, v.String)
+				if err != nil {
+					// 單張圖片損毀不影響其他資料，保留原值待人工處理
+					log.Printf("[Images] 交易 %d 的 %s 轉換失敗: %v", p.id, col, err)
+					continue
+				}
+				res, err := db.Exec(fmt.Sprintf("UPDATE trades SET %s = ? WHERE id = ? AND %s = ?", col, col), objectPath, p.id, v.String)
+				if err != nil {
+					return converted, err
+				}
+				if n, _ := res.RowsAffected(); n == 0 {
+					// 搬移期間使用者已修改此欄位，剛上傳的物件不再被參照
+					Remove(ctx, client, objectPath)
+					continue
+				}
+				converted++
+			}
+		}
+	}
+}
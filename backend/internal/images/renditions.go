@@ -0,0 +1,299 @@
+package images
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"log"
+	"path"
+	"strings"
+	"sync"
+
+	"trade-journal/internal/minio"
+
+	miniogo "github.com/minio/minio-go/v7"
+)
+
+// 圖片尺寸，GetImage 的 size 參數
+const (
+	SizeOriginal = "original"
+	SizeThumb    = "thumb"  // 列表使用的縮圖
+	SizeMedium   = "medium" // 交易詳情使用的中圖
+)
+
+// Rendition 縮小後的圖片尺寸，寬度超過 MaxWidth 時等比例縮小
+type Rendition struct {
+	Size     string
+	MaxWidth int
+}
+
+// Renditions 上傳時產生的尺寸
+var Renditions = []Rendition{
+	{Size: SizeThumb, MaxWidth: 320},
+	{Size: SizeMedium, MaxWidth: 1280},
+}
+
+// renditionQuality 縮圖統一以 JPEG 儲存
+const renditionQuality = 85
+
+// MaxPixels 可解析的圖片像素上限，避免宣告超大尺寸的小檔案在解碼時耗盡記憶體
+const MaxPixels = 40_000_000
+
+// ErrTooLarge 圖片尺寸超過 MaxPixels
+var ErrTooLarge = errors.New("圖片尺寸過大")
+
+// Decode 先讀取圖片標頭檢查尺寸，未超過 MaxPixels 才完整解碼
+func Decode(data []byte) (image.Image, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("無法解析圖片: %w", err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || int64(cfg.Width)*int64(cfg.Height) > MaxPixels {
+		return nil, fmt.Errorf("%w: %dx%d", ErrTooLarge, cfg.Width, cfg.Height)
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("無法解析圖片: %w", err)
+	}
+	return src, nil
+}
+
+// ValidSize 檢查 size 參數，空字串視為原圖
+func ValidSize(size string) bool {
+	if size == "" || size == SizeOriginal {
+		return true
+	}
+	for _, r := range Renditions {
+		if r.Size == size {
+			return true
+		}
+	}
+	return false
+}
+
+// RenditionPath 縮圖與原圖放在同一個資料夾，例如 2024-05/xxx.png -> 2024-05/xxx.thumb.jpg
+func RenditionPath(objectPath, size string) string {
+	if size == "" || size == SizeOriginal {
+		return objectPath
+	}
+	return strings.TrimSuffix(objectPath, path.Ext(objectPath)) + "." + size + ".jpg"
+}
+
+// IsRendition 判斷物件是否為縮圖
+func IsRendition(objectPath string) bool {
+	for _, r := range Renditions {
+		if strings.HasSuffix(objectPath, "."+r.Size+".jpg") {
+			return true
+		}
+	}
+	return false
+}
+
+// Resize 以區域平均將圖片等比例縮小到寬度 maxWidth，透明部分以白色為底
+// 寬度未超過 maxWidth 時維持原尺寸
+func Resize(src image.Image, maxWidth int) *image.RGBA {
+	b := src.Bounds()
+	sw, sh := b.Dx(), b.Dy()
+	dw, dh := sw, sh
+	if sw > maxWidth {
+		dw = maxWidth
+		dh = sh * dw / sw
+		if dh < 1 {
+			dh = 1
+		}
+	}
+
+	// 每個縮圖像素累加對應區域的原圖像素 (預乘 alpha)
+	// 常見格式直接讀取 Pix，逐點呼叫 At 對大圖太慢
+	sums := make([][4]uint64, dw*dh)
+	counts := make([]uint64, dw*dh)
+	add := func(i int, r, g, bl, a uint32) {
+		sums[i][0] += uint64(r)
+		sums[i][1] += uint64(g)
+		sums[i][2] += uint64(bl)
+		sums[i][3] += uint64(a)
+		counts[i]++
+	}
+	for y := 0; y < sh; y++ {
+		row := (y * dh / sh) * dw
+		sy := b.Min.Y + y
+		switch s := src.(type) {
+		case *image.RGBA:
+			pix := s.Pix[s.PixOffset(b.Min.X, sy):]
+			for x := 0; x < sw; x++ {
+				p := pix[x*4 : x*4+4]
+				add(row+x*dw/sw, uint32(p[0])*0x101, uint32(p[1])*0x101, uint32(p[2])*0x101, uint32(p[3])*0x101)
+			}
+		case *image.NRGBA:
+			pix := s.Pix[s.PixOffset(b.Min.X, sy):]
+			for x := 0; x < sw; x++ {
+				p := pix[x*4 : x*4+4]
+				a := uint32(p[3]) * 0x101
+				add(row+x*dw/sw, uint32(p[0])*a/0xff, uint32(p[1])*a/0xff, uint32(p[2])*a/0xff, a)
+			}
+		case *image.YCbCr:
+			for x := 0; x < sw; x++ {
+				yi, ci := s.YOffset(b.Min.X+x, sy), s.COffset(b.Min.X+x, sy)
+				r, g, bl := color.YCbCrToRGB(s.Y[yi], s.Cb[ci], s.Cr[ci])
+				add(row+x*dw/sw, uint32(r)*0x101, uint32(g)*0x101, uint32(bl)*0x101, 0xffff)
+			}
+		default:
+			for x := 0; x < sw; x++ {
+				r, g, bl, a := src.At(b.Min.X+x, sy).RGBA()
+				add(row+x*dw/sw, r, g, bl, a)
+			}
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for i, s := range sums {
+		n := counts[i]
+		white := 0xffff - s[3]/n
+		for c := 0; c < 3; c++ {
+			dst.Pix[i*4+c] = uint8((s[c]/n + white) >> 8)
+		}
+		dst.Pix[i*4+3] = 0xff
+	}
+	return dst
+}
+
+// encodeRendition 產生縮圖的 JPEG 內容
+func encodeRendition(src image.Image, maxWidth int) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, Resize(src, maxWidth), &jpeg.Options{Quality: renditionQuality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// StoreRenditions 依原圖內容產生各尺寸的縮圖並上傳到原圖旁，並記錄縮圖的大小
+// 小於縮圖寬度的圖片也會產生，讓 GetImage 與補齊工作不需區分；超過 MaxPixels 的圖片不產生
+func StoreRenditions(ctx context.Context, db *sql.DB, client *miniogo.Client, objectPath string, data []byte) error {
+	src, err := Decode(data)
+	if err != nil {
+		return err
+	}
+	for _, r := range Renditions {
+		out, err := encodeRendition(src, r.MaxWidth)
+		if err != nil {
+			return err
+		}
+		renditionPath := RenditionPath(objectPath, r.Size)
+		_, err = client.PutObject(ctx, minio.BucketName, renditionPath, bytes.NewReader(out), int64(len(out)), miniogo.PutObjectOptions{
+			ContentType: "image/jpeg",
+		})
+		if err != nil {
+			return fmt.Errorf("縮圖上傳失敗: %w", err)
+		}
+		if err := RecordSize(db, renditionPath, int64(len(out))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type renditionJob struct {
+	db         *sql.DB
+	client     *miniogo.Client
+	objectPath string
+	data       []byte
+}
+
+// 背景產生縮圖的佇列，由單一 goroutine 依序處理以限制記憶體用量
+var (
+	renditionQueue = make(chan renditionJob, 16)
+	renditionOnce  sync.Once
+)
+
+// StartRenditions 將縮圖排入背景產生，尚未完成或失敗時 GetImage 會改用原圖
+// 佇列已滿時略過，留待下次啟動時補齊
+func StartRenditions(db *sql.DB, client *miniogo.Client, objectPath string, data []byte) {
+	renditionOnce.Do(func() {
+		go func() {
+			for job := range renditionQueue {
+				if err := StoreRenditions(context.Background(), job.db, job.client, job.objectPath, job.data); err != nil {
+					log.Printf("[Images] %s 產生縮圖失敗: %v", job.objectPath, err)
+				}
+			}
+		}()
+	})
+	select {
+	case renditionQueue <- renditionJob{db, client, objectPath, data}:
+	default:
+		log.Printf("[Images] 縮圖佇列已滿，%s 待下次啟動時補齊", objectPath)
+	}
+}
+
+// renditionSource 可產生縮圖的原圖格式
+func renditionSource(objectPath string) bool {
+	switch strings.ToLower(path.Ext(objectPath)) {
+	case ".png", ".jpg", ".jpeg", ".gif":
+		return !IsRendition(objectPath)
+	}
+	return false
+}
+
+// StartRenditionBackfill 在背景為既有的圖片補上縮圖
+func StartRenditionBackfill(db *sql.DB, client *miniogo.Client) {
+	go func() {
+		created, err := BackfillRenditions(context.Background(), db, client)
+		if err != nil {
+			log.Printf("[Images] 縮圖補齊中斷 (已處理 %d 張): %v", created, err)
+			return
+		}
+		if created > 0 {
+			log.Printf("[Images] 縮圖補齊完成，共處理 %d 張", created)
+		}
+	}()
+}
+
+// BackfillRenditions 為缺少任一尺寸縮圖的圖片產生縮圖，回傳處理的張數
+// 無法解析的圖片 (例如 webp) 略過，GetImage 會直接回傳原圖
+func BackfillRenditions(ctx context.Context, db *sql.DB, client *miniogo.Client) (int, error) {
+	existing := map[string]bool{}
+	var originals []string
+	for obj := range client.ListObjects(ctx, minio.BucketName, miniogo.ListObjectsOptions{Recursive: true}) {
+		if obj.Err != nil {
+			return 0, obj.Err
+		}
+		existing[obj.Key] = true
+		if renditionSource(obj.Key) {
+			originals = append(originals, obj.Key)
+		}
+	}
+
+	created := 0
+	for _, objectPath := range originals {
+		missing := false
+		for _, r := range Renditions {
+			if !existing[RenditionPath(objectPath, r.Size)] {
+				missing = true
+			}
+		}
+		if !missing {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return created, err
+		}
+		// 單一物件讀取失敗 (例如列出後已被刪除) 不影響其他圖片
+		data, err := Read(ctx, client, objectPath)
+		if err != nil {
+			log.Printf("[Images] %s 讀取失敗: %v", objectPath, err)
+			continue
+		}
+		if err := StoreRenditions(ctx, db, client, objectPath, data); err != nil {
+			log.Printf("[Images] %s 產生縮圖失敗: %v", objectPath, err)
+			continue
+		}
+		created++
+	}
+	return created, nil
+}
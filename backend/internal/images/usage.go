@@ -0,0 +1,144 @@
+package images
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+
+	"trade-journal/internal/database"
+	"trade-journal/internal/minio"
+
+	miniogo "github.com/minio/minio-go/v7"
+)
+
+// sizeBatch 一次查詢 image_sizes 的路徑數量
+const sizeBatch = 500
+
+// Usage 依帳號計算交易圖片佔用的空間 (Bytes)，where 為 trades 的條件 (不含別名)
+// MinIO 物件以實際大小計算，殘留的 data URL 以長度計算；同一帳號重複參照的物件只計算一次
+func Usage(ctx context.Context, db *sql.DB, client *miniogo.Client, where string, args ...interface{}) (map[int64]int64, error) {
+	var parts []string
+	var queryArgs []interface{}
+	for _, col := range TradeColumns {
+		parts = append(parts, fmt.Sprintf("SELECT account_id, %s FROM trades WHERE (%s) AND %s IS NOT NULL AND %s <> ''", col, where, col, col))
+		queryArgs = append(queryArgs, args...)
+	}
+	parts = append(parts, "SELECT t.account_id, ti.image_path FROM trade_images ti JOIN trades t ON ti.trade_id = t.id WHERE ti.trade_id IN (SELECT id FROM trades WHERE "+where+")")
+	queryArgs = append(queryArgs, args...)
+
+	rows, err := db.Query(strings.Join(parts, " UNION ALL "), queryArgs...)
+	if err != nil {
+		return nil, err
+	}
+	usage := map[int64]int64{}
+	paths := map[int64]map[string]bool{}
+	for rows.Next() {
+		var accountID int64
+		var v sql.NullString
+		if err := rows.Scan(&accountID, &v); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if !v.Valid || v.String == "" {
+			continue
+		}
+		if IsDataURL(v.String) {
+			usage[accountID] += int64(len(v.String))
+			continue
+		}
+		if paths[accountID] == nil {
+			paths[accountID] = map[string]bool{}
+		}
+		paths[accountID][PathFromValue(v.String)] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	all := map[string]bool{}
+	for _, set := range paths {
+		for p := range set {
+			all[p] = true
+		}
+	}
+	sizes, err := Sizes(ctx, db, client, all)
+	if err != nil {
+		return nil, err
+	}
+	for accountID, set := range paths {
+		for p := range set {
+			usage[accountID] += sizes[p]
+		}
+	}
+	return usage, nil
+}
+
+// Sizes 取得物件大小，上傳時已由 RecordSize 記錄；image_sizes 沒有記錄的舊物件向 MinIO 查詢後記錄
+// 不存在的物件記為 0；MinIO 未啟用或暫時無法連線時該次視為 0，不記錄
+func Sizes(ctx context.Context, db *sql.DB, client *miniogo.Client, paths map[string]bool) (map[string]int64, error) {
+	list := make([]string, 0, len(paths))
+	for p := range paths {
+		list = append(list, p)
+	}
+
+	sizes := make(map[string]int64, len(list))
+	for start := 0; start < len(list); start += sizeBatch {
+		batch := list[start:min(start+sizeBatch, len(list))]
+		args := make([]interface{}, len(batch))
+		for i, p := range batch {
+			args[i] = p
+		}
+		rows, err := db.Query("SELECT object_path, size FROM image_sizes WHERE object_path IN (?"+strings.Repeat(", ?", len(batch)-1)+")", args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var p string
+			var size int64
+			if err := rows.Scan(&p, &size); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			sizes[p] = size
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	if client == nil {
+		return sizes, nil
+	}
+	for _, p := range list {
+		if _, ok := sizes[p]; ok {
+			continue
+		}
+		// 請求已取消時不再查詢剩下的物件
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		info, err := client.StatObject(ctx, minio.BucketName, p, miniogo.StatObjectOptions{})
+		if err != nil {
+			if miniogo.ToErrorResponse(err).Code != "NoSuchKey" {
+				log.Printf("[Images] 無法取得 %s 的大小: %v", p, err)
+				continue
+			}
+			info.Size = 0
+		}
+		sizes[p] = info.Size
+		if _, err := db.Exec("INSERT INTO image_sizes (object_path, size) VALUES (?, ?) ON CONFLICT (object_path) DO NOTHING", p, info.Size); err != nil {
+			return nil, err
+		}
+	}
+	return sizes, nil
+}
+
+// RecordSize 上傳物件後記錄大小，計算使用量時不需再向 MinIO 查詢
+func RecordSize(q database.Querier, objectPath string, size int64) error {
+	_, err := q.Exec("INSERT INTO image_sizes (object_path, size) VALUES (?, ?) ON CONFLICT (object_path) DO UPDATE SET size = excluded.size", objectPath, size)
+	return err
+}
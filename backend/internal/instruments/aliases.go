@@ -0,0 +1,103 @@
+package instruments
+
+import (
+	"errors"
+	"strings"
+
+	"trade-journal/internal/database"
+	"trade-journal/internal/models"
+)
+
+// ErrAliasNotFound 別名不存在或不屬於使用者
+var ErrAliasNotFound = errors.New("品種別名不存在")
+
+// Aliases 使用者自訂的品種別名，key 為大寫的券商品種名稱
+type Aliases map[string]string
+
+// Canonical 將券商的原始品種名稱轉為標準名稱
+// 先比對完整的原始名稱，再比對去除後綴後的名稱，都沒有自訂別名時使用內建規則
+func (a Aliases) Canonical(raw string) string {
+	if symbol, ok := a[strings.ToUpper(strings.TrimSpace(raw))]; ok {
+		return symbol
+	}
+	normalized := Normalize(raw)
+	if symbol, ok := a[normalized]; ok {
+		return symbol
+	}
+	return normalized
+}
+
+// Canonical 依使用者的別名將單一品種名稱轉為標準名稱
+func Canonical(q database.Querier, userID int64, raw string) (string, error) {
+	aliases, err := LoadAliases(q, userID)
+	if err != nil {
+		return "", err
+	}
+	return aliases.Canonical(raw), nil
+}
+
+// LoadAliases 取得使用者的所有別名
+func LoadAliases(q database.Querier, userID int64) (Aliases, error) {
+	return loadAliases(q, "SELECT alias, symbol FROM symbol_aliases WHERE user_id = ?", userID)
+}
+
+// LoadAccountAliases 取得帳號擁有者的所有別名，供只知道帳號的同步流程使用
+func LoadAccountAliases(q database.Querier, accountID int64) (Aliases, error) {
+	return loadAliases(q, `
+		SELECT s.alias, s.symbol FROM symbol_aliases s JOIN accounts a ON s.user_id = a.user_id
+		WHERE a.id = ?
+	`, accountID)
+}
+
+func loadAliases(q database.Querier, query string, id int64) (Aliases, error) {
+	rows, err := q.Query(query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	aliases := Aliases{}
+	for rows.Next() {
+		var alias, symbol string
+		if err := rows.Scan(&alias, &symbol); err != nil {
+			return nil, err
+		}
+		aliases[alias] = symbol
+	}
+	return aliases, rows.Err()
+}
+
+// ListAliases 取得使用者的別名清單，依別名排序
+func ListAliases(q database.Querier, userID int64) ([]models.SymbolAlias, error) {
+	rows, err := q.Query("SELECT id, alias, symbol, created_at FROM symbol_aliases WHERE user_id = ? ORDER BY alias", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []models.SymbolAlias{}
+	for rows.Next() {
+		var a models.SymbolAlias
+		if err := rows.Scan(&a.ID, &a.Alias, &a.Symbol, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, a)
+	}
+	return list, rows.Err()
+}
+
+// CreateAlias 建立別名，別名存成大寫，標準名稱套用內建規則
+func CreateAlias(q database.Querier, userID int64, req models.SymbolAliasCreate) (int64, error) {
+	return database.InsertID(q, "INSERT INTO symbol_aliases (user_id, alias, symbol) VALUES (?, ?, ?)",
+		userID, strings.ToUpper(strings.TrimSpace(req.Alias)), Normalize(req.Symbol))
+}
+
+// DeleteAlias 刪除別名，已轉換的交易需另外重新正規化
+func DeleteAlias(q database.Querier, userID, id int64) error {
+	res, err := q.Exec("DELETE FROM symbol_aliases WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrAliasNotFound
+	}
+	return nil
+}
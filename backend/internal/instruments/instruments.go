@@ -0,0 +1,339 @@
+package instruments
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"trade-journal/internal/database"
+	"trade-journal/internal/models"
+)
+
+// 規格來源
+const (
+	SourceDefault = "default" // 內建的常見品種
+	SourceGuess   = "guess"   // 依名稱推測
+	SourceUser    = "user"    // 使用者自訂
+)
+
+// ErrNotFound 使用者沒有此品種的自訂規格
+var ErrNotFound = errors.New("沒有此品種的自訂規格")
+
+func spec(symbol string, tick, contract, pip float64, quote string) models.Instrument {
+	return models.Instrument{Symbol: symbol, TickSize: tick, ContractSize: contract, PipSize: pip, QuoteCurrency: quote, Source: SourceDefault}
+}
+
+// defaults 常見品種的規格，pip_size 即交易中「點數」的單位
+// 外匯以 pip (0.0001，日圓 0.01) 計算，貴金屬、指數與加密貨幣以 1.0 價格單位計算
+var defaults = map[string]models.Instrument{
+	"EURUSD": spec("EURUSD", 0.00001, 100000, 0.0001, "USD"),
+	"GBPUSD": spec("GBPUSD", 0.00001, 100000, 0.0001, "USD"),
+	"AUDUSD": spec("AUDUSD", 0.00001, 100000, 0.0001, "USD"),
+	"NZDUSD": spec("NZDUSD", 0.00001, 100000, 0.0001, "USD"),
+	"USDCAD": spec("USDCAD", 0.00001, 100000, 0.0001, "CAD"),
+	"USDCHF": spec("USDCHF", 0.00001, 100000, 0.0001, "CHF"),
+	"EURGBP": spec("EURGBP", 0.00001, 100000, 0.0001, "GBP"),
+	"USDJPY": spec("USDJPY", 0.001, 100000, 0.01, "JPY"),
+	"EURJPY": spec("EURJPY", 0.001, 100000, 0.01, "JPY"),
+	"GBPJPY": spec("GBPJPY", 0.001, 100000, 0.01, "JPY"),
+	"XAUUSD": spec("XAUUSD", 0.01, 100, 1, "USD"),
+	"XAGUSD": spec("XAGUSD", 0.001, 5000, 0.01, "USD"),
+	"XPTUSD": spec("XPTUSD", 0.01, 100, 1, "USD"),
+	"NAS100": spec("NAS100", 0.01, 1, 1, "USD"),
+	"US30":   spec("US30", 0.01, 1, 1, "USD"),
+	"US500":  spec("US500", 0.01, 1, 1, "USD"),
+	"GER40":  spec("GER40", 0.01, 1, 1, "EUR"),
+	"HK50":   spec("HK50", 0.01, 1, 1, "HKD"),
+	"BTCUSD": spec("BTCUSD", 0.01, 1, 1, "USD"),
+	"ETHUSD": spec("ETHUSD", 0.01, 1, 1, "USD"),
+}
+
+// currencies 用於判斷六碼外匯貨幣對
+var currencies = map[string]bool{
+	"USD": true, "EUR": true, "GBP": true, "JPY": true, "AUD": true, "NZD": true,
+	"CAD": true, "CHF": true, "HKD": true, "SGD": true, "CNH": true, "SEK": true, "NOK": true,
+}
+
+// builtinAliases 常見的券商品種別名，對應到內建規格使用的名稱
+var builtinAliases = map[string]string{
+	"GOLD":   "XAUUSD",
+	"SILVER": "XAGUSD",
+	"USTEC":  "NAS100",
+	"US100":  "NAS100",
+	"NDX100": "NAS100",
+	"WS30":   "US30",
+	"DJ30":   "US30",
+	"SPX500": "US500",
+	"SP500":  "US500",
+	"DE40":   "GER40",
+	"DAX40":  "GER40",
+}
+
+// Normalize 依內建規則統一品種名稱：去除券商後綴 (XAUUSD.r、EURUSD#、XAUUSDm)、
+// 移除斜線 (EUR/USD)、轉為大寫並對應內建別名 (GOLD -> XAUUSD)
+func Normalize(symbol string) string {
+	symbol = strings.ReplaceAll(strings.TrimSpace(symbol), "/", "")
+	if i := strings.IndexAny(symbol, ".#_+"); i > 0 {
+		symbol = symbol[:i]
+	}
+	// 小寫後綴，前面需至少三碼且全為大寫或數字，避免 Gold 被截成 G
+	if i := strings.LastIndexFunc(symbol, func(r rune) bool { return !unicode.IsLower(r) }); i >= 2 && i < len(symbol)-1 {
+		if prefix := symbol[:i+1]; strings.ToUpper(prefix) == prefix {
+			symbol = prefix
+		}
+	}
+	symbol = strings.ToUpper(symbol)
+	if alias, ok := builtinAliases[symbol]; ok {
+		return alias
+	}
+	return symbol
+}
+
+// Default 取得內建規格，不在清單中的品種依名稱推測
+func Default(symbol string) models.Instrument {
+	symbol = Normalize(symbol)
+	if s, ok := defaults[symbol]; ok {
+		return s
+	}
+
+	guess := func(s models.Instrument) models.Instrument {
+		s.Symbol, s.Source = symbol, SourceGuess
+		return s
+	}
+	switch {
+	case strings.Contains(symbol, "XAU") || strings.Contains(symbol, "GOLD"):
+		return guess(defaults["XAUUSD"])
+	case strings.Contains(symbol, "XAG") || strings.Contains(symbol, "SILVER"):
+		return guess(defaults["XAGUSD"])
+	}
+	// 六碼貨幣對，允許 EURUSDm 這類券商後綴
+	if len(symbol) >= 6 && currencies[symbol[:3]] && currencies[symbol[3:6]] {
+		if symbol[3:6] == "JPY" {
+			return guess(spec("", 0.001, 100000, 0.01, "JPY"))
+		}
+		return guess(spec("", 0.00001, 100000, 0.0001, symbol[3:6]))
+	}
+	return guess(spec("", 0.01, 1, 1, "USD"))
+}
+
+const selectColumns = `
+	SELECT id, symbol, tick_size, contract_size, quote_currency, pip_size, point_value, created_at, updated_at
+	FROM instruments`
+
+func scan(row interface{ Scan(...interface{}) error }) (models.Instrument, error) {
+	var s models.Instrument
+	var id int64
+	err := row.Scan(&id, &s.Symbol, &s.TickSize, &s.ContractSize, &s.QuoteCurrency, &s.PipSize, &s.PointValue, &s.CreatedAt, &s.UpdatedAt)
+	s.ID, s.Source = &id, SourceUser
+	return s, err
+}
+
+// Resolve 取得使用者的品種規格，自訂規格優先，其次為內建規格
+func Resolve(q database.Querier, userID int64, symbol string) (models.Instrument, error) {
+	s, err := scan(q.QueryRow(selectColumns+" WHERE user_id = ? AND symbol = ?", userID, Normalize(symbol)))
+	if err == sql.ErrNoRows {
+		return withPointValue(Default(symbol)), nil
+	}
+	if err != nil {
+		return s, err
+	}
+	return withPointValue(s), nil
+}
+
+// withPointValue 未指定每點價值時以 pip_size × contract_size 計算 (報價貨幣)
+func withPointValue(s models.Instrument) models.Instrument {
+	if s.PointValue == nil {
+		v := s.PipSize * s.ContractSize
+		s.PointValue = &v
+	}
+	return s
+}
+
+// List 取得內建規格與使用者的自訂規格，自訂規格取代同名的內建規格
+func List(q database.Querier, userID int64) ([]models.Instrument, error) {
+	bySymbol := make(map[string]models.Instrument, len(defaults))
+	for symbol, s := range defaults {
+		bySymbol[symbol] = s
+	}
+
+	rows, err := q.Query(selectColumns+" WHERE user_id = ?", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		s, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		bySymbol[s.Symbol] = s
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	list := make([]models.Instrument, 0, len(bySymbol))
+	for _, s := range bySymbol {
+		list = append(list, withPointValue(s))
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Symbol < list[j].Symbol })
+	return list, nil
+}
+
+// Save 建立或更新使用者的自訂規格
+func Save(q database.Querier, userID int64, symbol string, req models.InstrumentUpdate) error {
+	symbol = Normalize(symbol)
+	res, err := q.Exec(`
+		UPDATE instruments SET tick_size = ?, contract_size = ?, quote_currency = ?, pip_size = ?, point_value = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE user_id = ? AND symbol = ?
+	`, req.TickSize, req.ContractSize, strings.ToUpper(req.QuoteCurrency), req.PipSize, req.PointValue, userID, symbol)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		return nil
+	}
+	_, err = q.Exec(`
+		INSERT INTO instruments (user_id, symbol, tick_size, contract_size, quote_currency, pip_size, point_value)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, userID, symbol, req.TickSize, req.ContractSize, strings.ToUpper(req.QuoteCurrency), req.PipSize, req.PointValue)
+	return err
+}
+
+// Delete 刪除使用者的自訂規格，之後改用內建規格
+func Delete(q database.Querier, userID int64, symbol string) error {
+	res, err := q.Exec("DELETE FROM instruments WHERE user_id = ? AND symbol = ?", userID, Normalize(symbol))
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Metrics 依品種規格推算的交易欄位，無法計算的欄位為 nil
+type Metrics struct {
+	PnLPoints  *float64 // 帶方向的盈虧點數
+	BulletSize *float64 // 進場價到初始停損的點數
+	RRRatio    *float64 // 盈虧點數 / 停損點數，與品種規格無關
+	PlannedRR  *float64 // 初始停利距離 / 初始停損距離，停利在虧損方向時為負值
+}
+
+// Compute 以 pip_size 換算點數，結果四捨五入到小數兩位
+func Compute(s models.Instrument, side string, entry float64, exit, initialSL, initialTP *float64) Metrics {
+	var m Metrics
+	if entry <= 0 || s.PipSize <= 0 {
+		return m
+	}
+	round := func(v float64) *float64 {
+		v = math.Round(v*100) / 100
+		return &v
+	}
+
+	var move, risk float64
+	if exit != nil && *exit > 0 {
+		move = *exit - entry
+		if side == "short" {
+			move = -move
+		}
+		m.PnLPoints = round(move / s.PipSize)
+	}
+	if initialSL != nil && *initialSL > 0 {
+		risk = math.Abs(entry - *initialSL)
+		m.BulletSize = round(risk / s.PipSize)
+	}
+	// 以價格計算風報比，不受點數四捨五入影響
+	if m.PnLPoints != nil && risk > 0 {
+		m.RRRatio = round(move / risk)
+	}
+	if initialTP != nil && *initialTP > 0 && risk > 0 {
+		reward := *initialTP - entry
+		if side == "short" {
+			reward = -reward
+		}
+		m.PlannedRR = round(reward / risk)
+	}
+	return m
+}
+
+// Apply 依交易目前的進出場價與初始停損重新計算 pnl_points、bullet_size 與 rr_ratio
+// 無法計算的欄位維持原值，讓手動輸入的資料不被清除；planned_rr 只由停損停利推算，一律更新
+func Apply(q database.Querier, tradeID int64) error {
+	var userID int64
+	var symbol, side string
+	var entry, exit, initialSL, initialTP sql.NullFloat64
+	err := q.QueryRow(`
+		SELECT a.user_id, t.symbol, t.side, t.entry_price, t.exit_price, t.initial_sl, t.initial_tp
+		FROM trades t JOIN accounts a ON t.account_id = a.id WHERE t.id = ?
+	`, tradeID).Scan(&userID, &symbol, &side, &entry, &exit, &initialSL, &initialTP)
+	if err != nil {
+		return err
+	}
+
+	s, err := Resolve(q, userID, symbol)
+	if err != nil {
+		return err
+	}
+	m := Compute(s, side, entry.Float64, nullable(exit), nullable(initialSL), nullable(initialTP))
+
+	sets := []string{"planned_rr = ?"}
+	args := []interface{}{m.PlannedRR}
+	for _, f := range []struct {
+		column string
+		value  *float64
+	}{{"pnl_points", m.PnLPoints}, {"bullet_size", m.BulletSize}, {"rr_ratio", m.RRRatio}} {
+		if f.value != nil {
+			sets = append(sets, f.column+" = ?")
+			args = append(args, *f.value)
+		}
+	}
+	_, err = q.Exec("UPDATE trades SET "+strings.Join(sets, ", ")+" WHERE id = ?", append(args, tradeID)...)
+	return err
+}
+
+// RecalculateSymbol 自訂規格變更後，重新計算使用者該品種所有交易 (含垃圾桶) 的點數欄位
+// 交易中的品種名稱可能帶有券商後綴，因此以正規化後的名稱比對
+func RecalculateSymbol(q database.Querier, userID int64, symbol string) (int, error) {
+	symbol = Normalize(symbol)
+	rows, err := q.Query(`
+		SELECT t.id, t.symbol FROM trades t JOIN accounts a ON t.account_id = a.id
+		WHERE a.user_id = ?
+	`, userID)
+	if err != nil {
+		return 0, err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		var s string
+		if err := rows.Scan(&id, &s); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if Normalize(s) == symbol {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, id := range ids {
+		if err := Apply(q, id); err != nil {
+			return 0, err
+		}
+	}
+	return len(ids), nil
+}
+
+func nullable(v sql.NullFloat64) *float64 {
+	if !v.Valid {
+		return nil
+	}
+	return &v.Float64
+}
@@ -0,0 +1,195 @@
+package instruments
+
+import (
+	"database/sql"
+	"testing"
+
+	"trade-journal/internal/models"
+	"trade-journal/internal/testutil"
+)
+
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	return testutil.OpenDB(t,
+		"INSERT INTO users (id, username, password) VALUES (1, 'alice', 'x')",
+		"INSERT INTO accounts (id, user_id, name) VALUES (10, 1, 'main')",
+		"INSERT INTO trades (id, account_id, symbol, side, entry_price, exit_price, initial_sl, entry_time) VALUES (100, 10, 'XAUUSD.r', 'long', 2300, 2315, 2295, '2024-05-01 08:00:00')",
+		"INSERT INTO trades (id, account_id, symbol, side, entry_price, exit_price, initial_sl, entry_time) VALUES (101, 10, 'EURUSD', 'short', 1.0850, 1.0820, 1.0865, '2024-05-02 08:00:00')",
+		"INSERT INTO trades (id, account_id, symbol, side, entry_price, bullet_size, entry_time) VALUES (102, 10, 'NAS100', 'long', 18000, 25, '2024-05-03 08:00:00')",
+	)
+}
+
+func metrics(t *testing.T, db *sql.DB, tradeID int64) (pnlPoints, bullet, rr sql.NullFloat64) {
+	t.Helper()
+	err := db.QueryRow("SELECT pnl_points, bullet_size, rr_ratio FROM trades WHERE id = ?", tradeID).Scan(&pnlPoints, &bullet, &rr)
+	if err != nil {
+		t.Fatalf("讀取交易 %d 失敗: %v", tradeID, err)
+	}
+	return
+}
+
+func TestDefault(t *testing.T) {
+	for symbol, want := range map[string]struct {
+		pip    float64
+		quote  string
+		source string
+	}{
+		"XAUUSD":   {1, "USD", SourceDefault},
+		"xauusd.r": {1, "USD", SourceDefault},
+		"GOLD":     {1, "USD", SourceDefault},
+		"XAUUSDm":  {1, "USD", SourceDefault},
+		"XAUAUD":   {1, "USD", SourceGuess},
+		"USDJPY":   {0.01, "JPY", SourceDefault},
+		"AUDJPYm":  {0.01, "JPY", SourceGuess},
+		"EURAUD":   {0.0001, "AUD", SourceGuess},
+		"UK100":    {1, "USD", SourceGuess},
+	} {
+		s := Default(symbol)
+		if s.PipSize != want.pip || s.QuoteCurrency != want.quote || s.Source != want.source {
+			t.Errorf("%s: 得到 pip=%v quote=%s source=%s", symbol, s.PipSize, s.QuoteCurrency, s.Source)
+		}
+	}
+}
+
+func TestCompute(t *testing.T) {
+	exit, sl := 1.0820, 1.0865
+	tp := 1.0790
+	m := Compute(Default("EURUSD"), "short", 1.0850, &exit, &sl, &tp)
+	if m.PnLPoints == nil || *m.PnLPoints != 30 {
+		t.Errorf("pnl_points 應為 30，得到 %v", m.PnLPoints)
+	}
+	if m.BulletSize == nil || *m.BulletSize != 15 {
+		t.Errorf("bullet_size 應為 15，得到 %v", m.BulletSize)
+	}
+	if m.RRRatio == nil || *m.RRRatio != 2 {
+		t.Errorf("rr_ratio 應為 2，得到 %v", m.RRRatio)
+	}
+	if m.PlannedRR == nil || *m.PlannedRR != 4 {
+		t.Errorf("planned_rr 應為 4，得到 %v", m.PlannedRR)
+	}
+
+	// 沒有出場價時只計算子彈大小
+	m = Compute(Default("XAUUSD"), "long", 2300, nil, &sl, nil)
+	if m.PnLPoints != nil || m.RRRatio != nil {
+		t.Errorf("未平倉交易不應有 pnl_points 與 rr_ratio: %+v", m)
+	}
+}
+
+func TestApply(t *testing.T) {
+	db := openTestDB(t)
+
+	for _, id := range []int64{100, 101, 102} {
+		if err := Apply(db, id); err != nil {
+			t.Fatalf("Apply %d 失敗: %v", id, err)
+		}
+	}
+
+	pnl, bullet, rr := metrics(t, db, 100)
+	if pnl.Float64 != 15 || bullet.Float64 != 5 || rr.Float64 != 3 {
+		t.Errorf("XAUUSD.r 得到 pnl_points=%v bullet_size=%v rr_ratio=%v", pnl, bullet, rr)
+	}
+	pnl, bullet, rr = metrics(t, db, 101)
+	if pnl.Float64 != 30 || bullet.Float64 != 15 || rr.Float64 != 2 {
+		t.Errorf("EURUSD 得到 pnl_points=%v bullet_size=%v rr_ratio=%v", pnl, bullet, rr)
+	}
+	// 無法計算的欄位維持手動輸入的值
+	pnl, bullet, rr = metrics(t, db, 102)
+	if pnl.Valid || bullet.Float64 != 25 || rr.Valid {
+		t.Errorf("NAS100 得到 pnl_points=%v bullet_size=%v rr_ratio=%v", pnl, bullet, rr)
+	}
+}
+
+func TestOverride(t *testing.T) {
+	db := openTestDB(t)
+
+	// 以 0.1 為一點計算黃金
+	err := Save(db, 1, "xauusd", models.InstrumentUpdate{TickSize: 0.01, ContractSize: 100, QuoteCurrency: "usd", PipSize: 0.1})
+	if err != nil {
+		t.Fatalf("Save 失敗: %v", err)
+	}
+	s, err := Resolve(db, 1, "XAUUSD.r")
+	if err != nil {
+		t.Fatalf("Resolve 失敗: %v", err)
+	}
+	if s.Source != SourceUser || s.PipSize != 0.1 || s.QuoteCurrency != "USD" || s.PointValue == nil || *s.PointValue != 10 {
+		t.Errorf("自訂規格錯誤: %+v", s)
+	}
+
+	n, err := RecalculateSymbol(db, 1, "XAUUSD")
+	if err != nil || n != 1 {
+		t.Fatalf("RecalculateSymbol 得到 %d, %v", n, err)
+	}
+	pnl, bullet, rr := metrics(t, db, 100)
+	if pnl.Float64 != 150 || bullet.Float64 != 50 || rr.Float64 != 3 {
+		t.Errorf("自訂規格得到 pnl_points=%v bullet_size=%v rr_ratio=%v", pnl, bullet, rr)
+	}
+
+	list, err := List(db, 1)
+	if err != nil {
+		t.Fatalf("List 失敗: %v", err)
+	}
+	for _, s := range list {
+		if s.Symbol == "XAUUSD" && s.Source != SourceUser {
+			t.Errorf("List 應以自訂規格取代內建規格: %+v", s)
+		}
+	}
+
+	if err := Delete(db, 1, "XAUUSD"); err != nil {
+		t.Fatalf("Delete 失敗: %v", err)
+	}
+	if err := Delete(db, 1, "XAUUSD"); err != ErrNotFound {
+		t.Errorf("重複刪除應回傳 ErrNotFound，得到 %v", err)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	for raw, want := range map[string]string{
+		"XAUUSD.r":   "XAUUSD",
+		"XAUUSDm":    "XAUUSD",
+		"Gold":       "XAUUSD",
+		"EUR/USD":    "EURUSD",
+		"EURUSDpro":  "EURUSD",
+		"US30.cash":  "US30",
+		"USTEC":      "NAS100",
+		" btcusd# ":  "BTCUSD",
+		"GER40_spot": "GER40",
+	} {
+		if got := Normalize(raw); got != want {
+			t.Errorf("Normalize(%q) = %q，期望 %q", raw, got, want)
+		}
+	}
+}
+
+func TestAliases(t *testing.T) {
+	db := openTestDB(t)
+
+	for _, req := range []models.SymbolAliasCreate{
+		{Alias: "xau.pro", Symbol: "XAUUSD"},
+		{Alias: "GOLDSPOT", Symbol: "gold"},
+	} {
+		if _, err := CreateAlias(db, 1, req); err != nil {
+			t.Fatalf("CreateAlias 失敗: %v", err)
+		}
+	}
+	aliases, err := LoadAccountAliases(db, 10)
+	if err != nil {
+		t.Fatalf("LoadAccountAliases 失敗: %v", err)
+	}
+	for raw, want := range map[string]string{
+		"XAU.pro":    "XAUUSD", // 完整名稱比對
+		"GOLDSPOT.r": "XAUUSD", // 去除後綴後比對
+		"EURUSDm":    "EURUSD", // 沒有別名時使用內建規則
+	} {
+		if got := aliases.Canonical(raw); got != want {
+			t.Errorf("Canonical(%q) = %q，期望 %q", raw, got, want)
+		}
+	}
+
+	list, err := ListAliases(db, 1)
+	if err != nil || len(list) != 2 {
+		t.Fatalf("ListAliases 得到 %v, %v", list, err)
+	}
+	if err := DeleteAlias(db, 2, list[0].ID); err != ErrAliasNotFound {
+		t.Errorf("刪除其他使用者的別名應回傳 ErrAliasNotFound，得到 %v", err)
+	}
+}
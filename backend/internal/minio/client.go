@@ -14,6 +14,9 @@ const (
 	BucketName = "trade-journal"
 )
 
+// GlobalClient 初始化後的共用客戶端，供交易圖片轉存等非路由流程使用
+var GlobalClient *minio.Client
+
 // InitMinIO 初始化MinIO客戶端
 func InitMinIO() (*minio.Client, error) {
 	endpoint := os.Getenv("MINIO_ENDPOINT")
@@ -72,6 +75,7 @@ func InitMinIO() (*minio.Client, error) {
 		log.Printf("設定bucket policy警告: %v", err)
 	}
 
+	GlobalClient = client
 	log.Println("MinIO初始化成功")
 	return client, nil
 }
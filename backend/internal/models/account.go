@@ -16,6 +16,7 @@ type Account struct {
 	CTraderEnv      string     `json:"ctrader_env"` // "live" or "demo"
 	Status          string     `json:"status"` // "active", "disconnected"
 	TimezoneOffset int        `json:"timezone_offset"` // 時區偏移
+	Currency       string     `json:"currency"`        // 基礎幣別 (ISO 4217)，交易盈虧預設以此幣別計算
 	SyncStatus     string     `json:"sync_status"`     // "idle", "syncing", "success", "failed"
 	LastSyncedAt   *time.Time `json:"last_synced_at"`
 	LastSyncError  string     `json:"last_sync_error"`
@@ -36,6 +37,7 @@ type AccountCreate struct {
 	CTraderClientSecret string `json:"ctrader_client_secret"`
 	CTraderEnv      string `json:"ctrader_env"`
 	TimezoneOffset int    `json:"timezone_offset"`
+	Currency       string `json:"currency" binding:"omitempty,len=3"` // 預設 USD
 }
 
 // AccountUpdate 更新帳號請求
@@ -49,4 +51,5 @@ type AccountUpdate struct {
 	CTraderClientSecret *string `json:"ctrader_client_secret"`
 	CTraderEnv       *string `json:"ctrader_env"`
 	TimezoneOffset  *int    `json:"timezone_offset"`
+	Currency        *string `json:"currency" binding:"omitempty,len=3"`
 }
@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+// AnnotationShape 圖片上的向量標註，座標為相對圖片寬高的比例 (0-1)，原點在左上角
+// line 與 rect 使用 (x1, y1)-(x2, y2)；text 以 (x1, y1) 為左上角；price_level 為 y1 的水平線
+type AnnotationShape struct {
+	Type  string   `json:"type"` // "line"、"rect"、"text" 或 "price_level"
+	X1    float64  `json:"x1"`
+	Y1    float64  `json:"y1"`
+	X2    float64  `json:"x2,omitempty"`
+	Y2    float64  `json:"y2,omitempty"`
+	Text  string   `json:"text,omitempty"`  // 文字內容，價位線的標籤
+	Price *float64 `json:"price,omitempty"` // 價位線對應的價格，沒有 text 時作為標籤
+	Color string   `json:"color,omitempty"` // #RRGGBB，預設紅色
+	Width int      `json:"width,omitempty"` // 線寬 (像素)，預設 2
+	Size  int      `json:"size,omitempty"`  // 文字放大倍數，預設 2
+	Fill  bool     `json:"fill,omitempty"`  // 矩形是否以半透明填滿
+}
+
+// AnnotationLayer 圖片的標註圖層，每位使用者可在同一張圖片上建立自己的圖層
+type AnnotationLayer struct {
+	ID        int64             `json:"id"`
+	ImageID   int64             `json:"image_id"`
+	UserID    int64             `json:"user_id"`  // 圖層作者
+	Username  string            `json:"username"` // 圖層作者名稱
+	Name      string            `json:"name"`
+	Shapes    []AnnotationShape `json:"shapes"`
+	Visible   bool              `json:"visible"`
+	Position  int               `json:"position"` // 繪製順序，數字大的在上層
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// AnnotationLayerCreate 建立標註圖層請求
+type AnnotationLayerCreate struct {
+	Name    string            `json:"name" binding:"required,max=100"`
+	Shapes  []AnnotationShape `json:"shapes"`
+	Visible *bool             `json:"visible"`
+}
+
+// AnnotationLayerUpdate 修改標註圖層請求，未提供的欄位不變
+type AnnotationLayerUpdate struct {
+	Name     *string            `json:"name" binding:"omitempty,max=100"`
+	Shapes   *[]AnnotationShape `json:"shapes"`
+	Visible  *bool              `json:"visible"`
+	Position *int               `json:"position"`
+}
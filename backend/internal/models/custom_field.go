@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+// CustomField 使用者自訂的交易欄位
+type CustomField struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"user_id"`
+	Key       string    `json:"key"` // 交易 custom_fields 中使用的 key
+	Name      string    `json:"name"`
+	FieldType string    `json:"field_type"`
+	Options   []string  `json:"options"` // select / multi_select 的選項
+	Required  bool      `json:"required"`
+	Position  int       `json:"position"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// CustomFieldCreate 建立自訂欄位請求
+type CustomFieldCreate struct {
+	Key       string   `json:"key" binding:"required,max=50"`
+	Name      string   `json:"name" binding:"required,max=100"`
+	FieldType string   `json:"field_type" binding:"required,oneof=text number select multi_select boolean date"`
+	Options   []string `json:"options"`
+	Required  bool     `json:"required"`
+	Position  int      `json:"position"`
+}
+
+// CustomFieldUpdate 更新自訂欄位請求，key 與類型建立後不可修改
+type CustomFieldUpdate struct {
+	Name     string   `json:"name" binding:"required,max=100"`
+	Options  []string `json:"options"`
+	Required bool     `json:"required"`
+	Position int      `json:"position"`
+}
+
+// FieldStats 依自訂欄位值分組的統計，Value 為 nil 表示未填寫
+type FieldStats struct {
+	Value         interface{} `json:"value"`
+	TotalTrades   int         `json:"total_trades"`
+	WinningTrades int         `json:"winning_trades"`
+	WinRate       float64     `json:"win_rate"`
+	TotalPnL      float64     `json:"total_pnl"`
+}
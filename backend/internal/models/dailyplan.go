@@ -35,3 +35,64 @@ type DailyPlanQuery struct {
 	Page          int    `form:"page"`
 	PageSize      int    `form:"page_size"`
 }
+
+// DailyPlanTrade 連結到每日規劃的交易，與規劃方向的比較結果
+type DailyPlanTrade struct {
+	ID             int64      `json:"id"`
+	AccountID      int64      `json:"account_id"`
+	DailyPlanID    *int64     `json:"daily_plan_id"`
+	PlanLinkManual bool       `json:"plan_link_manual"`
+	Symbol         string     `json:"symbol"`
+	Side           string     `json:"side"`
+	MarketSession  string     `json:"market_session"`
+	TrendType      string     `json:"trend_type"`
+	EntryTime      time.Time  `json:"entry_time"`
+	ExitTime       *time.Time `json:"exit_time"`
+	PnL            *float64   `json:"pnl"`
+
+	// Bias 規劃在交易時段與週期的方向，Alignment 為 aligned / against / no_bias / unlinked
+	// TrendTypeMismatch 表示交易記錄的順勢 / 逆勢與規劃方向的比較結果不符
+	Bias              string `json:"bias"`
+	Alignment         string `json:"alignment"`
+	TrendTypeMismatch bool   `json:"trend_type_mismatch"`
+}
+
+// DailyPlanTradeLink 手動指定交易的規劃，auto 為 true 時改回自動連結
+type DailyPlanTradeLink struct {
+	DailyPlanID *int64 `json:"daily_plan_id"`
+	Auto        bool   `json:"auto"`
+}
+
+// DailyPlanAlignmentStats 依規劃方向分組的交易表現，勝率與盈虧只計算已平倉交易
+type DailyPlanAlignmentStats struct {
+	Trades        int     `json:"trades"`
+	ClosedTrades  int     `json:"closed_trades"`
+	WinningTrades int     `json:"winning_trades"`
+	WinRate       float64 `json:"win_rate"`
+	TotalPnL      float64 `json:"total_pnl"`
+}
+
+// DailyPlanTimeframeAdherence 單一週期的遵守比例
+type DailyPlanTimeframeAdherence struct {
+	Timeframe     string  `json:"timeframe"`
+	WithBias      int     `json:"with_bias"`
+	Aligned       int     `json:"aligned"`
+	Against       int     `json:"against"`
+	AdherenceRate float64 `json:"adherence_rate"` // 佔 WithBias 百分比
+}
+
+// DailyPlanAdherence 交易是否遵守每日規劃的方向，Violations 為逆規劃方向或 trend_type 不符的交易
+type DailyPlanAdherence struct {
+	Timeframe           string                        `json:"timeframe"`
+	TotalTrades         int                           `json:"total_trades"`
+	LinkedTrades        int                           `json:"linked_trades"`
+	WithBias            int                           `json:"with_bias"`
+	AdherenceRate       float64                       `json:"adherence_rate"` // 佔 WithBias 百分比
+	TrendTypeMismatches int                           `json:"trend_type_mismatches"`
+	Aligned             DailyPlanAlignmentStats       `json:"aligned"`
+	Against             DailyPlanAlignmentStats       `json:"against"`
+	NoBias              DailyPlanAlignmentStats       `json:"no_bias"`
+	Unlinked            DailyPlanAlignmentStats       `json:"unlinked"`
+	ByTimeframe         []DailyPlanTimeframeAdherence `json:"by_timeframe"`
+	Violations          []DailyPlanTrade              `json:"violations"`
+}
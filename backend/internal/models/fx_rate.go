@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// FXRate 使用者匯入的匯率，1 單位 base 可兌換 rate 單位的 quote
+type FXRate struct {
+	ID        int64     `json:"id"`
+	Base      string    `json:"base"`
+	Quote     string    `json:"quote"`
+	RateDate  string    `json:"rate_date"` // YYYY-MM-DD
+	Rate      float64   `json:"rate"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// FXRateCreate 新增匯率請求，同一貨幣對同一天的匯率會被覆寫
+type FXRateCreate struct {
+	Base     string  `json:"base" binding:"required,len=3"`
+	Quote    string  `json:"quote" binding:"required,len=3"`
+	RateDate string  `json:"rate_date" binding:"required"`
+	Rate     float64 `json:"rate" binding:"required,gt=0"`
+}
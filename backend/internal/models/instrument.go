@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// Instrument 品種規格，用於換算盈虧點數、子彈大小與風報比
+type Instrument struct {
+	ID            *int64     `json:"id,omitempty"` // 內建規格沒有 ID
+	Symbol        string     `json:"symbol"`
+	TickSize      float64    `json:"tick_size"`      // 最小跳動價位
+	ContractSize  float64    `json:"contract_size"`  // 每手合約數量
+	QuoteCurrency string     `json:"quote_currency"` // 報價貨幣
+	PipSize       float64    `json:"pip_size"`       // 一點的價格變動
+	PointValue    *float64   `json:"point_value"`    // 每手每點的價值 (報價貨幣)
+	Source        string     `json:"source"`         // default, guess, user
+	CreatedAt     *time.Time `json:"created_at,omitempty"`
+	UpdatedAt     *time.Time `json:"updated_at,omitempty"`
+}
+
+// InstrumentUpdate 建立或更新自訂品種規格請求，point_value 未提供時以 pip_size × contract_size 計算
+type InstrumentUpdate struct {
+	TickSize      float64  `json:"tick_size" binding:"required,gt=0"`
+	ContractSize  float64  `json:"contract_size" binding:"required,gt=0"`
+	QuoteCurrency string   `json:"quote_currency" binding:"required,len=3"`
+	PipSize       float64  `json:"pip_size" binding:"required,gt=0"`
+	PointValue    *float64 `json:"point_value" binding:"omitempty,gt=0"`
+}
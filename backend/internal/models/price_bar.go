@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// PriceBar 一根 K 線，Time 為開盤時間 (UTC)
+type PriceBar struct {
+	Time   time.Time `json:"time"`
+	Open   float64   `json:"open"`
+	High   float64   `json:"high"`
+	Low    float64   `json:"low"`
+	Close  float64   `json:"close"`
+	Volume float64   `json:"volume"`
+}
+
+// PriceBarSeries 使用者已匯入的品種與週期
+type PriceBarSeries struct {
+	Symbol    string    `json:"symbol"`
+	Timeframe string    `json:"timeframe"`
+	Bars      int       `json:"bars"`
+	From      time.Time `json:"from"`
+	To        time.Time `json:"to"`
+}
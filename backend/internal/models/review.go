@@ -0,0 +1,84 @@
+package models
+
+import "time"
+
+// Mistake 使用者自訂的錯誤類型，例如「移動停損」、「FOMO 進場」
+type Mistake struct {
+	ID          int64     `json:"id"`
+	UserID      int64     `json:"user_id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Position    int       `json:"position"`
+	TradeCount  int       `json:"trade_count"` // 標記此錯誤的交易數 (不含垃圾桶)
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// MistakeCreate 建立或更新錯誤類型請求
+type MistakeCreate struct {
+	Name        string `json:"name" binding:"required,max=100"`
+	Description string `json:"description"`
+	Position    int    `json:"position"`
+}
+
+// TradeMistake 交易標記的錯誤類型
+type TradeMistake struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+// TradeReview 檢討交易請求，nil 表示不修改
+// quality_grade 為 A-F，空字串表示清除；mistake_ids 為交易的完整錯誤清單，空陣列表示清除
+type TradeReview struct {
+	ReviewStatus *string  `json:"review_status" binding:"omitempty,oneof=unreviewed reviewed needs_mentor"`
+	QualityGrade *string  `json:"quality_grade"`
+	Lessons      *string  `json:"lessons"`
+	MistakeIDs   *[]int64 `json:"mistake_ids"`
+}
+
+// ReviewQueueItem 檢討佇列中的交易
+type ReviewQueueItem struct {
+	ID           int64          `json:"id"`
+	AccountID    int64          `json:"account_id"`
+	Symbol       string         `json:"symbol"`
+	Side         string         `json:"side"`
+	EntryTime    time.Time      `json:"entry_time"`
+	ExitTime     *time.Time     `json:"exit_time"`
+	PnL          *float64       `json:"pnl"`
+	RRRatio      *float64       `json:"rr_ratio"`
+	ReviewStatus string         `json:"review_status"`
+	QualityGrade *string        `json:"quality_grade"`
+	Mistakes     []TradeMistake `json:"mistakes"`
+}
+
+// OutcomeStats 一組已平倉交易的結果，用於依錯誤類型、評等或標籤分組的統計
+type OutcomeStats struct {
+	Trades        int     `json:"trades"`
+	WinningTrades int     `json:"winning_trades"`
+	WinRate       float64 `json:"win_rate"`
+	TotalPnL      float64 `json:"total_pnl"`
+	AvgPnL        float64 `json:"avg_pnl"`
+	TradesWithR   int     `json:"trades_with_r"` // 有風報比 (需有初始停損) 的交易
+	TotalR        float64 `json:"total_r"`
+	AvgR          float64 `json:"avg_r"`
+}
+
+// MistakeStats 錯誤類型的代價，只計算已平倉交易；同一筆交易有多個錯誤時會計入每個錯誤
+type MistakeStats struct {
+	MistakeID *int64 `json:"mistake_id,omitempty"`
+	Name      string `json:"name"`
+	OutcomeStats
+}
+
+// ReviewStats 檢討進度與錯誤類型的代價
+// Clean 為已檢討且沒有標記錯誤的交易，作為比較基準；Mistakes 依總盈虧由低到高排序
+type ReviewStats struct {
+	TotalTrades int            `json:"total_trades"`
+	Unreviewed  int            `json:"unreviewed"`
+	Reviewed    int            `json:"reviewed"`
+	NeedsMentor int            `json:"needs_mentor"`
+	ReviewRate  float64        `json:"review_rate"` // 已檢討與需導師檢討佔已平倉交易百分比
+	Clean       MistakeStats   `json:"clean"`
+	Mistakes    []MistakeStats `json:"mistakes"`
+	ByGrade     []MistakeStats `json:"by_grade"` // Name 為評等
+}
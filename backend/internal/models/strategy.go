@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+// Strategy 使用者定義的進場策略 (playbook)
+type Strategy struct {
+	ID          int64               `json:"id"`
+	UserID      int64               `json:"user_id"`
+	BuiltinKey  *string             `json:"builtin_key,omitempty"` // 內建策略代碼 (expert, elite, legend)
+	Name        string              `json:"name"`
+	Description string              `json:"description"`
+	Signals     []StrategyItem      `json:"signals"`
+	Checklist   []StrategyItem      `json:"checklist"`
+	Patterns    []StrategyItem      `json:"patterns"`
+	ImageSlots  []StrategyImageSlot `json:"image_slots"`
+	TradeCount  int                 `json:"trade_count"`
+	CreatedAt   time.Time           `json:"created_at"`
+	UpdatedAt   time.Time           `json:"updated_at"`
+}
+
+// StrategyItem 策略的訊號、檢查項目或樣態
+// id 即交易中 entry_signals / entry_checklist / entry_pattern 儲存的值
+type StrategyItem struct {
+	ID    string `json:"id" binding:"required,max=100"`
+	Label string `json:"label"`
+	Side  string `json:"side,omitempty" binding:"omitempty,oneof=long short"` // 僅適用於做多或做空，空白表示兩者皆可
+}
+
+// StrategyImageSlot 使用此策略的交易需附上的圖片
+type StrategyImageSlot struct {
+	ID       string `json:"id" binding:"required,max=50"`
+	Label    string `json:"label"`
+	Required bool   `json:"required"`
+}
+
+// StrategyCreate 建立/更新策略請求
+type StrategyCreate struct {
+	Name        string              `json:"name" binding:"required,max=100"`
+	Description string              `json:"description"`
+	Signals     []StrategyItem      `json:"signals" binding:"dive"`
+	Checklist   []StrategyItem      `json:"checklist" binding:"dive"`
+	Patterns    []StrategyItem      `json:"patterns" binding:"dive"`
+	ImageSlots  []StrategyImageSlot `json:"image_slots" binding:"dive"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// SymbolAlias 使用者自訂的品種別名，將券商的原始品種名稱對應到標準名稱
+type SymbolAlias struct {
+	ID        int64     `json:"id"`
+	Alias     string    `json:"alias"`  // 券商的品種名稱 (大寫)
+	Symbol    string    `json:"symbol"` // 標準品種名稱
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SymbolAliasCreate 建立品種別名請求
+type SymbolAliasCreate struct {
+	Alias  string `json:"alias" binding:"required,max=50"`
+	Symbol string `json:"symbol" binding:"required,max=20"`
+}
@@ -0,0 +1,68 @@
+package models
+
+import "time"
+
+// TagDetail 標籤管理使用的完整資料
+type TagDetail struct {
+	Tag
+	Description string  `json:"description"`
+	GroupName   *string `json:"group_name,omitempty"`
+	TradeCount  int     `json:"trade_count"` // 使用此標籤的交易數 (不含垃圾桶)
+}
+
+// TagCreate 建立或更新標籤請求，color 為 #RRGGBB，空字串表示不設定
+type TagCreate struct {
+	Name        string `json:"name" binding:"required,max=50"`
+	Color       string `json:"color"`
+	Description string `json:"description"`
+	GroupID     *int64 `json:"group_id"`
+}
+
+// TagMerge 合併標籤請求，來源標籤的交易改為使用目標標籤後刪除來源標籤
+type TagMerge struct {
+	SourceIDs []int64 `json:"source_ids" binding:"required,min=1"`
+	TargetID  int64   `json:"target_id" binding:"required"`
+}
+
+// TagGroup 標籤分組，例如「型態」、「情緒」、「市場狀況」
+type TagGroup struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"user_id"`
+	Name      string    `json:"name"`
+	Color     *string   `json:"color,omitempty"`
+	Position  int       `json:"position"`
+	TagCount  int       `json:"tag_count"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TagGroupCreate 建立或更新標籤分組請求
+type TagGroupCreate struct {
+	Name     string `json:"name" binding:"required,max=50"`
+	Color    string `json:"color"`
+	Position int    `json:"position"`
+}
+
+// TagStats 單一標籤的已平倉交易統計
+type TagStats struct {
+	TagID *int64  `json:"tag_id,omitempty"`
+	Name  string  `json:"name"`
+	Color *string `json:"color,omitempty"`
+	OutcomeStats
+}
+
+// TagGroupStats 標籤分組的統計，組內有任一標籤的交易只計算一次
+// 未分組的標籤歸在 GroupID 為 nil 的分組
+type TagGroupStats struct {
+	GroupID *int64  `json:"group_id"`
+	Name    string  `json:"name"`
+	Color   *string `json:"color,omitempty"`
+	OutcomeStats
+	Tags []TagStats `json:"tags"`
+}
+
+// TagStatsReport 依標籤與分組的統計
+type TagStatsReport struct {
+	Groups   []TagGroupStats `json:"groups"`
+	Untagged OutcomeStats    `json:"untagged"` // 沒有任何標籤的交易
+}
@@ -48,21 +48,102 @@ type Trade struct {
 	UpdatedAt                  time.Time  `json:"updated_at"`
 	Images                     []Image    `json:"images,omitempty"`
 	Tags                       []Tag      `json:"tags,omitempty"`
+
+	// Executions 成交紀錄，有成交時價格、手數與盈虧由成交推導
+	Executions []Execution `json:"executions,omitempty"`
+	// StrategyID 使用的策略定義，entry_strategy 保留內建策略代碼以相容舊資料
+	StrategyID *int64 `json:"strategy_id,omitempty"`
+	// CustomFields 自訂欄位的值，key 為欄位的 key
+	CustomFields map[string]interface{} `json:"custom_fields,omitempty"`
+	// RawSymbol 券商的原始品種名稱，symbol 為依別名轉換後的標準名稱
+	RawSymbol *string `json:"raw_symbol,omitempty"`
+	// GrossPnL 未扣除費用的盈虧，pnl = gross_pnl + commission + swap + fees (費用支出為負數)
+	GrossPnL   *float64 `json:"gross_pnl,omitempty"`
+	Commission *float64 `json:"commission,omitempty"`
+	Swap       *float64 `json:"swap,omitempty"`
+	Fees       *float64 `json:"fees,omitempty"`
+	// PnLCurrency 盈虧的幣別，未設定時與帳號的基礎幣別相同
+	PnLCurrency *string `json:"pnl_currency,omitempty"`
+	// 停利：初始停利、平倉時的停利與所有曾經設定過的停利 (JSON array，格式同 sl_history)
+	InitialTP *float64 `json:"initial_tp,omitempty"`
+	ExitTP    *float64 `json:"exit_tp,omitempty"`
+	TPHistory *string  `json:"tp_history,omitempty"`
+	// PlannedRR 進場時的計畫風報比 (初始停利距離 / 初始停損距離)，rr_ratio 為實際風報比
+	PlannedRR *float64 `json:"planned_rr,omitempty"`
+	// 依已匯入的 K 線計算的最大不利 / 有利偏移 (MAE / MFE)，mae / mfe 為距離進場價的價差
+	// MAEExceededSL 表示不利偏移超過初始停損距離 (停損曾被移動)，ExcursionTimeframe 為計算使用的 K 線週期
+	MAE                *float64 `json:"mae,omitempty"`
+	MFE                *float64 `json:"mfe,omitempty"`
+	MAEPoints          *float64 `json:"mae_points,omitempty"`
+	MFEPoints          *float64 `json:"mfe_points,omitempty"`
+	MAER               *float64 `json:"mae_r,omitempty"`
+	MFER               *float64 `json:"mfe_r,omitempty"`
+	MAEExceededSL      *bool    `json:"mae_exceeded_sl,omitempty"`
+	ExcursionTimeframe *string  `json:"excursion_timeframe,omitempty"`
+	// DailyPlanID 同帳號、品種與進場日期的每日規劃，PlanLinkManual 表示由使用者手動指定
+	DailyPlanID    *int64 `json:"daily_plan_id,omitempty"`
+	PlanLinkManual bool   `json:"plan_link_manual"`
+	// 檢討：ReviewStatus 為 unreviewed / reviewed / needs_mentor，QualityGrade 為 A-F
+	ReviewStatus string         `json:"review_status"`
+	QualityGrade *string        `json:"quality_grade,omitempty"`
+	Lessons      *string        `json:"lessons,omitempty"`
+	ReviewedAt   *time.Time     `json:"reviewed_at,omitempty"`
+	Mistakes     []TradeMistake `json:"mistakes,omitempty"`
 }
 
 // Image 圖片模型
 type Image struct {
-	ID        int64     `json:"id"`
-	TradeID   int64     `json:"trade_id"`
-	ImageType string    `json:"image_type"` // "entry" 或 "exit"
-	ImagePath string    `json:"image_path"`
-	CreatedAt time.Time `json:"created_at"`
+	ID          int64      `json:"id"`
+	TradeID     int64      `json:"trade_id"`
+	ImageType   string     `json:"image_type"` // "entry"、"exit"、"htf_context"、"post_mortem" 或 "strategy"
+	ImagePath   string     `json:"image_path"`
+	ImageOrder  int        `json:"image_order"` // 檢討時瀏覽的順序，由 0 開始
+	Description *string    `json:"description,omitempty"`
+	TakenAt     *time.Time `json:"taken_at,omitempty"` // 截圖對應的時間
+	CreatedAt   time.Time  `json:"created_at"`
+
+	// Slot 策略圖片欄位的 id，僅 image_type 為 "strategy" 時使用
+	Slot *string `json:"slot,omitempty"`
+
+	// Annotations 疊加在原圖上的標註圖層
+	Annotations []AnnotationLayer `json:"annotations,omitempty"`
+}
+
+// Execution 成交紀錄，一筆交易可有多筆成交 (加倉、分批平倉)
+type Execution struct {
+	ID         int64     `json:"id"`
+	TradeID    int64     `json:"trade_id"`
+	Side       string    `json:"side"` // "buy" 或 "sell"
+	Price      float64   `json:"price"`
+	Volume     float64   `json:"volume"`
+	ExecutedAt time.Time `json:"executed_at"`
+	Commission float64   `json:"commission"`            // 佣金，支出為負數
+	Swap       float64   `json:"swap"`                  // 隔夜利息，支出為負數
+	Fee        float64   `json:"fee"`                   // 其他費用，支出為負數 (舊資料包含佣金與隔夜利息)
+	PnL        *float64  `json:"pnl,omitempty"`         // 平台回報的已實現盈虧 (不含費用)
+	ExternalID *string   `json:"external_id,omitempty"` // 平台成交編號
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// ExecutionCreate 新增/更新成交請求
+type ExecutionCreate struct {
+	Side       string    `json:"side" binding:"required,oneof=buy sell"`
+	Price      float64   `json:"price" binding:"required,gt=0"`
+	Volume     float64   `json:"volume" binding:"required,gt=0"`
+	ExecutedAt time.Time `json:"executed_at" binding:"required"`
+	Commission float64   `json:"commission"`
+	Swap       float64   `json:"swap"`
+	Fee        float64   `json:"fee"`
+	PnL        *float64  `json:"pnl"`
+	ExternalID *string   `json:"external_id"`
 }
 
 // Tag 標籤模型
 type Tag struct {
 	ID        int64     `json:"id"`
 	Name      string    `json:"name"`
+	Color     *string   `json:"color,omitempty"`    // #RRGGBB
+	GroupID   *int64    `json:"group_id,omitempty"` // 所屬的標籤分組
 	CreatedAt time.Time `json:"created_at"`
 }
 
@@ -107,24 +188,108 @@ type TradeCreate struct {
 	ExitTime                   *time.Time    `json:"exit_time"`
 	Tags                       []string      `json:"tags"`
 	Images                     []ImageUpload `json:"images"`
+	// Executions 建立時可一併提供成交紀錄，價格、手數與盈虧將由成交推導
+	Executions []ExecutionCreate `json:"executions" binding:"dive"`
+	// StrategyID 策略定義，未提供時依 entry_strategy 對應到內建策略
+	StrategyID *int64 `json:"strategy_id"`
+	// CustomFields 自訂欄位的值，更新時只修改有提供的 key，值為 null 表示清除
+	CustomFields map[string]interface{} `json:"custom_fields"`
+	// GrossPnL 與費用 (支出為負數)，只提供其中一邊時由 pnl 推算另一邊
+	GrossPnL   *float64 `json:"gross_pnl"`
+	Commission *float64 `json:"commission"`
+	Swap       *float64 `json:"swap"`
+	Fees       *float64 `json:"fees"`
+	// PnLCurrency 盈虧的幣別，未提供時使用帳號的基礎幣別
+	PnLCurrency *string `json:"pnl_currency" binding:"omitempty,len=3"`
+	// InitialTP / ExitTP 初始停利與平倉時的停利，變更的價位會記錄到 tp_history
+	InitialTP *float64 `json:"initial_tp"`
+	ExitTP    *float64 `json:"exit_tp"`
 }
 
 // ImageUpload 圖片上傳資料
 type ImageUpload struct {
-	ImageType string `json:"image_type" binding:"required,oneof=entry exit"`
-	ImagePath string `json:"image_path" binding:"required"`
+	ImageType   string     `json:"image_type" binding:"required,oneof=entry exit htf_context post_mortem strategy"`
+	ImagePath   string     `json:"image_path" binding:"required"`
+	Slot        string     `json:"slot"` // image_type 為 strategy 時必填，對應策略的圖片欄位
+	Description string     `json:"description"`
+	TakenAt     *time.Time `json:"taken_at"`
+}
+
+// ImageUpdate 修改圖片請求，nil 表示不修改；taken_at 為 RFC 3339 時間，空字串表示清除
+type ImageUpdate struct {
+	ImageType   *string `json:"image_type" binding:"omitempty,oneof=entry exit htf_context post_mortem"`
+	Description *string `json:"description"`
+	TakenAt     *string `json:"taken_at"`
+}
+
+// ImageOrder 調整圖片順序請求，需包含交易的所有圖片
+type ImageOrder struct {
+	ImageIDs []int64 `json:"image_ids" binding:"required,min=1"`
 }
 
 // TradeQuery 查詢參數
 type TradeQuery struct {
-	AccountID int64  `form:"account_id"`
-	Symbol    string `form:"symbol"`
-	Side      string `form:"side"`
-	Tag       string `form:"tag"`
-	StartDate string `form:"start_date"`
-	EndDate   string `form:"end_date"`
-	Page      int    `form:"page"`
-	PageSize  int    `form:"page_size"`
+	AccountID int64  `form:"account_id" json:"account_id"`
+	Symbol    string `form:"symbol" json:"symbol"`
+	Side      string `form:"side" json:"side"`
+	Tag       string `form:"tag" json:"tag"`
+	StartDate string `form:"start_date" json:"start_date"`
+	EndDate   string `form:"end_date" json:"end_date"`
+	Page      int    `form:"page" json:"page"`
+	PageSize  int    `form:"page_size" json:"page_size"`
+
+	// 進階篩選，symbol、side、tag 與以下文字欄位都可用逗號分隔多個值 (IN)
+	TradeType      string   `form:"trade_type" json:"trade_type"`
+	EntryStrategy  string   `form:"entry_strategy" json:"entry_strategy"`
+	StrategyID     string   `form:"strategy_id" json:"strategy_id"`
+	MarketSession  string   `form:"market_session" json:"market_session"`
+	EntryTimeframe string   `form:"entry_timeframe" json:"entry_timeframe"`
+	TrendType      string   `form:"trend_type" json:"trend_type"`
+	ColorTag       string   `form:"color_tag" json:"color_tag"`
+	MinPnL         *float64 `form:"min_pnl" json:"min_pnl"`
+	MaxPnL         *float64 `form:"max_pnl" json:"max_pnl"`
+	MinR           *float64 `form:"min_r" json:"min_r"` // 風報比 (rr_ratio) 下限
+	MaxR           *float64 `form:"max_r" json:"max_r"`
+	Status         string   `form:"status" json:"status" binding:"omitempty,oneof=open closed"`
+	HasImages      *bool    `form:"has_images" json:"has_images"`
+	DailyPlanID    string   `form:"daily_plan_id" json:"daily_plan_id"`
+	ReviewStatus   string   `form:"review_status" json:"review_status"`
+
+	// 排序與游標分頁，sort 以 - 開頭表示遞減，例如 -pnl；提供 cursor 時忽略 page
+	Sort   string `form:"sort" json:"sort"`
+	Cursor string `form:"cursor" json:"cursor"`
+
+	// 自訂欄位篩選，查詢參數為 cf[key]=value，數字欄位可用 min..max 範圍
+	CustomFields map[string]string `form:"-" json:"custom_fields"`
+}
+
+// TradeBulkRequest 批次修改/刪除交易請求，trade_ids 與 filter 擇一
+type TradeBulkRequest struct {
+	TradeIDs   []int64      `json:"trade_ids"`
+	Filter     *TradeQuery  `json:"filter"` // 與交易列表相同的篩選條件，忽略分頁
+	Action     string       `json:"action" binding:"required,oneof=update delete"`
+	Set        TradeBulkSet `json:"set"`
+	AddTags    []string     `json:"add_tags"`
+	RemoveTags []string     `json:"remove_tags"`
+}
+
+// TradeBulkSet 批次設定的欄位，nil 表示不修改，空字串表示清除 (trade_type 與 review_status 必須指定值)
+type TradeBulkSet struct {
+	TradeType      *string `json:"trade_type" binding:"omitempty,oneof=actual observation"`
+	EntryStrategy  *string `json:"entry_strategy"`
+	EntryPattern   *string `json:"entry_pattern"`
+	EntryTimeframe *string `json:"entry_timeframe"`
+	TrendType      *string `json:"trend_type"`
+	MarketSession  *string `json:"market_session"`
+	ColorTag       *string `json:"color_tag" binding:"omitempty,oneof='' red yellow green"`
+	StrategyID     *int64  `json:"strategy_id"` // 會一併更新 entry_strategy；設定 entry_strategy 時也會對應到內建策略
+	ReviewStatus   *string `json:"review_status" binding:"omitempty,oneof=unreviewed reviewed needs_mentor"`
+}
+
+// TradeBulkResult 批次操作中單筆交易的結果
+type TradeBulkResult struct {
+	ID     int64  `json:"id"`
+	Status string `json:"status"` // "updated", "unchanged", "deleted", "not_found"
 }
 
 // StatsSummary 統計摘要
@@ -138,6 +303,18 @@ type StatsSummary struct {
 	LargestWin    float64 `json:"largest_win"`
 	LargestLoss   float64 `json:"largest_loss"`
 	ProfitFactor  float64 `json:"profit_factor"`
+
+	// 毛盈虧與交易成本，TotalPnL 為扣除成本後的淨盈虧 (費用為負值)
+	GrossPnL        float64 `json:"gross_pnl"`
+	TotalCommission float64 `json:"total_commission"`
+	TotalSwap       float64 `json:"total_swap"`
+	TotalFees       float64 `json:"total_fees"`
+	TotalCosts      float64 `json:"total_costs"`
+
+	// Currency 報表幣別，預設為帳號的基礎幣別；盈虧幣別不同的交易依匯率換算，缺少匯率的交易不計入金額
+	Currency          string   `json:"currency"`
+	UnconvertedTrades int      `json:"unconverted_trades"`
+	MissingRates      []string `json:"missing_rates"`
 }
 
 // EquityPoint 淨值曲線點
@@ -153,16 +330,174 @@ type SymbolStats struct {
 	WinningTrades int     `json:"winning_trades"`
 	WinRate       float64 `json:"win_rate"`
 	TotalPnL      float64 `json:"total_pnl"`
+	GrossPnL      float64 `json:"gross_pnl"`
+	TotalCosts    float64 `json:"total_costs"`
+}
+
+// CostBreakdown 交易成本彙總，費用為負值 (與 pnl 同號慣例)
+type CostBreakdown struct {
+	Symbol      string `json:"symbol,omitempty"`
+	AccountID   *int64 `json:"account_id,omitempty"`
+	AccountName string `json:"account_name,omitempty"`
+	// AccountCurrency 帳號的基礎幣別，金額已換算為報表幣別
+	AccountCurrency string `json:"account_currency,omitempty"`
+
+	TotalTrades  int     `json:"total_trades"`
+	TotalLots    float64 `json:"total_lots"`
+	GrossPnL     float64 `json:"gross_pnl"`
+	Commission   float64 `json:"commission"`
+	Swap         float64 `json:"swap"`
+	Fees         float64 `json:"fees"`
+	TotalCosts   float64 `json:"total_costs"`
+	NetPnL       float64 `json:"net_pnl"`
+	CostPerTrade float64 `json:"cost_per_trade"`
+	CostPerLot   float64 `json:"cost_per_lot"`
+	CostShare    float64 `json:"cost_share"` // 成本佔毛利的百分比，毛利不為正時為 0
+}
+
+// CostStats 成本分析，包含總計與依品種、帳號的拆分
+type CostStats struct {
+	CostBreakdown
+	BySymbol  []CostBreakdown `json:"by_symbol"`
+	ByAccount []CostBreakdown `json:"by_account"`
+
+	// Currency 報表幣別；缺少匯率無法換算的交易不計入，並列出缺少的貨幣對
+	Currency          string   `json:"currency"`
+	UnconvertedTrades int      `json:"unconverted_trades"`
+	MissingRates      []string `json:"missing_rates"`
+}
+
+// PortfolioStats 跨帳號的投資組合統計，金額皆已換算為報表幣別
+type PortfolioStats struct {
+	Currency      string  `json:"currency"`
+	TotalTrades   int     `json:"total_trades"`
+	WinningTrades int     `json:"winning_trades"`
+	LosingTrades  int     `json:"losing_trades"`
+	WinRate       float64 `json:"win_rate"`
+	TotalPnL      float64 `json:"total_pnl"`
+	AveragePnL    float64 `json:"average_pnl"`
+	ProfitFactor  float64 `json:"profit_factor"`
+	GrossPnL      float64 `json:"gross_pnl"`
+	TotalCosts    float64 `json:"total_costs"`
+
+	ByAccount   []PortfolioAccount `json:"by_account"`
+	EquityCurve []EquityPoint      `json:"equity_curve"`
+
+	UnconvertedTrades int      `json:"unconverted_trades"`
+	MissingRates      []string `json:"missing_rates"`
+}
+
+// PortfolioAccount 投資組合中單一帳號的統計
+type PortfolioAccount struct {
+	AccountID   int64   `json:"account_id"`
+	Name        string  `json:"name"`
+	Currency    string  `json:"currency"` // 帳號的基礎幣別
+	TotalTrades int     `json:"total_trades"`
+	TotalPnL    float64 `json:"total_pnl"` // 已換算為報表幣別
+}
+
+// 計畫與實際執行的比較結果
+const (
+	DeviationReachedTarget = "reached_target" // 獲利單達到計畫停利
+	DeviationCutShort      = "cut_short"      // 獲利單在計畫停利前出場
+	DeviationPastStop      = "past_stop"      // 虧損超過初始停損 (-1R)
+)
+
+// PlanAdherencePeriod 計畫與實際執行的統計，R 皆以初始停損距離為單位
+type PlanAdherencePeriod struct {
+	Week string `json:"week,omitempty"` // ISO 週，例如 2024-W18
+
+	TotalTrades   int     `json:"total_trades"`   // 有實際 R 的已平倉交易
+	PlannedTrades int     `json:"planned_trades"` // 其中有計畫 R 的交易
+	AvgPlannedR   float64 `json:"avg_planned_r"`
+	AvgRealizedR  float64 `json:"avg_realized_r"`
+
+	Winners              int     `json:"winners"`
+	WinnersWithTarget    int     `json:"winners_with_target"`
+	WinnersReachedTarget int     `json:"winners_reached_target"`
+	WinnersCutShort      int     `json:"winners_cut_short"`
+	CutShortRate         float64 `json:"cut_short_rate"`  // 佔有計畫停利的獲利單百分比
+	RLeftOnTable         float64 `json:"r_left_on_table"` // 提早出場少賺的 R 合計
+
+	Losers         int     `json:"losers"`
+	LosersPastStop int     `json:"losers_past_stop"`
+	PastStopRate   float64 `json:"past_stop_rate"`   // 佔虧損單百分比
+	RLostPastStop  float64 `json:"r_lost_past_stop"` // 超過 -1R 的虧損合計 (負值)
 }
 
-// StrategyStats 策略統計 (達人/菁英/傳奇)
+// PlanDeviation 偏離計畫的單筆交易
+type PlanDeviation struct {
+	TradeID   int64     `json:"trade_id"`
+	Symbol    string    `json:"symbol"`
+	ExitTime  time.Time `json:"exit_time"`
+	PlannedR  *float64  `json:"planned_r"`
+	RealizedR float64   `json:"realized_r"`
+	Kind      string    `json:"kind"` // cut_short 或 past_stop
+}
+
+// PlanAdherenceStats 計畫與實際執行的比較，包含總計、每週統計與偏離計畫的交易
+type PlanAdherenceStats struct {
+	Tolerance float64 `json:"tolerance"`
+	PlanAdherencePeriod
+	ByWeek     []PlanAdherencePeriod `json:"by_week"`
+	Deviations []PlanDeviation       `json:"deviations"`
+}
+
+// ExcursionDistribution 以 R 計算的偏移分佈
+type ExcursionDistribution struct {
+	Avg float64 `json:"avg"`
+	P50 float64 `json:"p50"`
+	P75 float64 `json:"p75"`
+	P90 float64 `json:"p90"`
+	Max float64 `json:"max"`
+}
+
+// ExcursionBucket MAE 的 R 區間，To 為 nil 表示 From 以上
+type ExcursionBucket struct {
+	From  float64  `json:"from"`
+	To    *float64 `json:"to"`
+	Count int      `json:"count"`
+}
+
+// ExcursionStats MAE / MFE 與最佳出場統計
+type ExcursionStats struct {
+	Strategy   string `json:"strategy"` // 同 StrategyStats.Strategy，整體統計為空字串
+	StrategyID *int64 `json:"strategy_id,omitempty"`
+	Name       string `json:"name"`
+
+	Trades      int                   `json:"trades"`        // 有 MAE / MFE 的已平倉交易
+	TradesWithR int                   `json:"trades_with_r"` // 有初始停損、可換算 R 的交易
+	MAER        ExcursionDistribution `json:"mae_r"`
+	MFER        ExcursionDistribution `json:"mfe_r"`
+	WinnersMAER ExcursionDistribution `json:"winners_mae_r"` // 獲利單的 MAE，判斷停損是否過緊
+	MAEBuckets  []ExcursionBucket     `json:"mae_buckets"`
+
+	ExceededSL     int     `json:"exceeded_sl"`      // 不利偏移超過初始停損距離的交易
+	ExceededSLRate float64 `json:"exceeded_sl_rate"` // 佔 TradesWithR 百分比
+	AvgRLeft       float64 `json:"avg_r_left"`       // 平均 MFE R - 實際 R，最佳出場與實際出場的差距
+	CaptureRate    float64 `json:"capture_rate"`     // 獲利單實際 R 合計 / MFE R 合計 (百分比)
+}
+
+// ExcursionReport MAE / MFE 統計，整體與依策略拆分
+type ExcursionReport struct {
+	Overall    ExcursionStats   `json:"overall"`
+	ByStrategy []ExcursionStats `json:"by_strategy"`
+	// MissingBars 沒有涵蓋持倉期間 K 線、無法計算 MAE / MFE 的已平倉交易數
+	MissingBars int `json:"missing_bars"`
+}
+
+// StrategyStats 策略統計，依使用者定義的策略分組
 type StrategyStats struct {
-	Strategy      string            `json:"strategy"`
+	Strategy      string            `json:"strategy"` // 內建策略代碼，自訂策略為名稱，未指定為 "unspecified"
 	TotalTrades   int               `json:"total_trades"`
 	WinningTrades int               `json:"winning_trades"`
 	WinRate       float64           `json:"win_rate"`
 	TotalPnL      float64           `json:"total_pnl"`
 	SubItemStats  []SubItemStats    `json:"sub_item_stats"`
+
+	// StrategyID / Name 對應的策略定義，未指定策略時為空
+	StrategyID *int64 `json:"strategy_id,omitempty"`
+	Name       string `json:"name"`
 }
 
 // SubItemStats 策略子項目統計 (訊號/樣態/檢查項)
@@ -8,6 +8,9 @@ import (
 	"log"
 	"net/http"
 	"time"
+	"trade-journal/internal/audit"
+	"trade-journal/internal/executions"
+	"trade-journal/internal/instruments"
 	"trade-journal/internal/models"
 )
 
@@ -158,79 +161,182 @@ func internalSync(db *sql.DB, accountID int64, mt5AccountNumber string, token st
 		Swap       float64   `json:"swap"`
 		Time       time.Time `json:"time"`
 		PositionID string    `json:"positionId"`
+		StopLoss   float64   `json:"stopLoss"`   // 成交當下的停損，未設定時為 0
+		TakeProfit float64   `json:"takeProfit"` // 成交當下的停利，未設定時為 0
 	}
 
 	if err := json.NewDecoder(resp.Body).Decode(&deals); err != nil {
 		return err
 	}
 
-	// 2. 將成交組合為 Position (交易紀錄)
-	positions := make(map[string]*models.Trade)
+	// 2. 將成交組合為 Position (交易紀錄)，每筆成交保留為 trade_executions
+	type position struct {
+		symbol string
+		side   string
+		fills  []models.ExecutionCreate
+		// 進場成交的停損停利為初始值，最後一筆平倉成交的為平倉時的值
+		initialSL, initialTP, exitSL, exitTP *float64
+		sls, tps                             executions.Levels
+	}
+	positions := make(map[string]*position)
+	var order []string
 
 	for _, deal := range deals {
-		trade, ok := positions[deal.PositionID]
+		var side string
+		switch deal.Type {
+		case "DEAL_TYPE_BUY":
+			side = executions.SideBuy
+		case "DEAL_TYPE_SELL":
+			side = executions.SideSell
+		default:
+			continue // 入金、出金等非交易紀錄
+		}
+
+		pos, ok := positions[deal.PositionID]
 		if !ok {
-			vol := deal.Volume
-			pnl := 0.0
-			trade = &models.Trade{
-				AccountID: accountID,
-				Symbol:    deal.Symbol,
-				LotSize:   &vol,
-				PnL:       &pnl,
-				TradeType: "actual",
-			}
-			positions[deal.PositionID] = trade
+			pos = &position{symbol: deal.Symbol}
+			positions[deal.PositionID] = pos
+			order = append(order, deal.PositionID)
 		}
 
+		externalID := "mt5-deal-" + deal.ID
+		fill := models.ExecutionCreate{
+			Side:       side,
+			Price:      deal.Price,
+			Volume:     deal.Volume,
+			ExecutedAt: deal.Time,
+			Commission: deal.Commission,
+			Swap:       deal.Swap,
+			ExternalID: &externalID,
+		}
+		pos.sls.Add(deal.StopLoss, deal.Time.UnixMilli())
+		pos.tps.Add(deal.TakeProfit, deal.Time.UnixMilli())
 		if deal.EntryType == "DEAL_ENTRY_IN" {
-			trade.Side = "long"
-			if deal.Type == "DEAL_TYPE_SELL" {
-				trade.Side = "short"
-			}
-			price := deal.Price
-			trade.EntryPrice = &price
-			trade.EntryTime = deal.Time
-		} else if deal.EntryType == "DEAL_ENTRY_OUT" {
-			price := deal.Price
-			trade.ExitPrice = &price
-			trade.ExitTime = &deal.Time
-
-			currentPnL := 0.0
-			if trade.PnL != nil {
-				currentPnL = *trade.PnL
+			if pos.side == "" {
+				pos.side = "long"
+				if side == executions.SideSell {
+					pos.side = "short"
+				}
+				pos.initialSL, pos.initialTP = executions.Price(deal.StopLoss), executions.Price(deal.TakeProfit)
 			}
-			newPnL := currentPnL + deal.Profit + deal.Commission + deal.Swap
-			trade.PnL = &newPnL
+		} else {
+			profit := deal.Profit
+			fill.PnL = &profit
+			pos.exitSL, pos.exitTP = executions.Price(deal.StopLoss), executions.Price(deal.TakeProfit)
 		}
+		pos.fills = append(pos.fills, fill)
 	}
 
-	// 3. 存入資料庫 (去重檢查)
-	for posID, trade := range positions {
-		if trade.ExitPrice == nil {
+	// 3. 存入資料庫 (去重檢查)，品種名稱依使用者的別名轉為標準名稱
+	aliases, err := instruments.LoadAccountAliases(db, accountID)
+	if err != nil {
+		return err
+	}
+	for _, posID := range order {
+		pos := positions[posID]
+		if pos.side == "" {
+			log.Printf("Skip MT5 position %s: entry deal is outside the sync range", posID)
+			continue
+		}
+		summary, ok := executions.Summarize(pos.side, pos.fills)
+		if !ok || summary.ExitPrice == nil {
 			continue
 		}
 
+		// 已同步過的部位只補上新的成交 (例如之後才分批平倉)
+		ticket := "mt5-pos-" + posID
+		var tradeID int64
+		err := db.QueryRow("SELECT id FROM trades WHERE account_id = ? AND ticket = ?", accountID, ticket).Scan(&tradeID)
+		if err == nil {
+			if err := appendNewFills(db, accountID, tradeID, pos.fills); err != nil {
+				log.Printf("Update synced position %s error: %v", posID, err)
+			}
+			continue
+		} else if err != sql.ErrNoRows {
+			log.Printf("Check existence error: %v", err)
+			continue
+		}
+
+		// 舊版同步的紀錄沒有 ticket，以進場時間與手數判斷
 		var exists bool
-		err := db.QueryRow(`
-			SELECT EXISTS(SELECT 1 FROM trades WHERE account_id = ? AND symbol = ? AND entry_time = ? AND lot_size = ?)
-		`, accountID, trade.Symbol, trade.EntryTime, trade.LotSize).Scan(&exists)
+		err = db.QueryRow(`
+			SELECT EXISTS(SELECT 1 FROM trades WHERE account_id = ? AND COALESCE(raw_symbol, symbol) = ? AND entry_time = ? AND lot_size = ?)
+		`, accountID, pos.symbol, summary.EntryTime, summary.LotSize).Scan(&exists)
 
 		if err != nil {
 			log.Printf("Check existence error: %v", err)
 			continue
 		}
+		if exists {
+			continue
+		}
 
-		if !exists {
-			_, err = db.Exec(`
-				INSERT INTO trades (account_id, symbol, side, entry_price, exit_price, lot_size, pnl, entry_time, exit_time, trade_type, notes)
-				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-			`, accountID, trade.Symbol, trade.Side, trade.EntryPrice, trade.ExitPrice, trade.LotSize, trade.PnL, trade.EntryTime, trade.ExitTime, "actual", "MT5 Sync: Position "+posID)
-
-			if err != nil {
-				log.Printf("Insert synced trade error: %v", err)
-			}
+		if err := insertSyncedTrade(db, pos.fills, `
+			INSERT INTO trades (account_id, symbol, raw_symbol, side, entry_price, exit_price, lot_size, pnl, entry_time, exit_time, trade_type, notes, ticket,
+				initial_sl, exit_sl, sl_history, initial_tp, exit_tp, tp_history)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, accountID, aliases.Canonical(pos.symbol), pos.symbol, pos.side, summary.EntryPrice, summary.ExitPrice, summary.LotSize, summary.PnL, summary.EntryTime, summary.ExitTime, "actual", "MT5 Sync: Position "+posID, ticket,
+			pos.initialSL, pos.exitSL, pos.sls.JSON(), pos.initialTP, pos.exitTP, pos.tps.JSON()); err != nil {
+			return fmt.Errorf("insert synced position %s: %w", posID, err)
 		}
 	}
 
 	return nil
 }
+
+// insertSyncedTrade 在同一個交易中新增部位、寫入成交並記錄異動，費用分項、點數與風報比由成交與品種規格計算
+func insertSyncedTrade(db *sql.DB, fills []models.ExecutionCreate, query string, args ...interface{}) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := executions.CreateTrade(tx, 0, audit.SourceMT5, fills, query, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// appendNewFills 補上尚未記錄的成交並重新計算交易欄位
+func appendNewFills(db *sql.DB, accountID, tradeID int64, fills []models.ExecutionCreate) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := audit.Snapshot(tx, tradeID)
+	if err != nil {
+		return err
+	}
+	added := 0
+	for _, f := range fills {
+		exists, err := executions.ExternalExists(tx, accountID, *f.ExternalID)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		if _, err := executions.Insert(tx, tradeID, f); err != nil {
+			return err
+		}
+		added++
+	}
+	if added == 0 {
+		return nil
+	}
+
+	if err := executions.Recalculate(tx, tradeID); err != nil {
+		return err
+	}
+	after, err := audit.Snapshot(tx, tradeID)
+	if err != nil {
+		return err
+	}
+	if err := audit.Record(tx, tradeID, 0, audit.ActionUpdate, audit.SourceMT5, before, after); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
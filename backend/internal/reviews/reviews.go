@@ -0,0 +1,263 @@
+package reviews
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"trade-journal/internal/database"
+	"trade-journal/internal/models"
+)
+
+// 檢討狀態
+const (
+	Unreviewed  = "unreviewed"
+	Reviewed    = "reviewed"
+	NeedsMentor = "needs_mentor" // 需要導師或教練一起檢討
+)
+
+// Grades 交易品質評等，A 最好
+var Grades = []string{"A", "B", "C", "D", "F"}
+
+// ErrNotFound 錯誤類型不存在或不屬於使用者
+var ErrNotFound = errors.New("錯誤類型不存在")
+
+const selectColumns = `
+	SELECT m.id, m.user_id, m.name, COALESCE(m.description, ''), COALESCE(m.position, 0), m.created_at, m.updated_at,
+		(SELECT COUNT(*) FROM trade_mistakes tm JOIN trades t ON tm.trade_id = t.id WHERE tm.mistake_id = m.id AND t.deleted_at IS NULL)
+	FROM mistakes m`
+
+func scan(row interface{ Scan(...interface{}) error }) (models.Mistake, error) {
+	var m models.Mistake
+	err := row.Scan(&m.ID, &m.UserID, &m.Name, &m.Description, &m.Position, &m.CreatedAt, &m.UpdatedAt, &m.TradeCount)
+	return m, err
+}
+
+// ValidGrade 檢查評等，空字串表示未評等
+func ValidGrade(grade string) bool {
+	if grade == "" {
+		return true
+	}
+	for _, g := range Grades {
+		if g == grade {
+			return true
+		}
+	}
+	return false
+}
+
+// List 取得使用者的所有錯誤類型，依 position 排序
+func List(q database.Querier, userID int64) ([]models.Mistake, error) {
+	rows, err := q.Query(selectColumns+" WHERE m.user_id = ? ORDER BY m.position, m.id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.Mistake{}
+	for rows.Next() {
+		m, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, m)
+	}
+	return list, rows.Err()
+}
+
+// Get 取得使用者的單一錯誤類型，找不到時回傳 ErrNotFound
+func Get(q database.Querier, userID, id int64) (models.Mistake, error) {
+	m, err := scan(q.QueryRow(selectColumns+" WHERE m.id = ? AND m.user_id = ?", id, userID))
+	if err == sql.ErrNoRows {
+		return m, ErrNotFound
+	}
+	return m, err
+}
+
+// Create 建立錯誤類型
+func Create(q database.Querier, userID int64, req models.MistakeCreate) (int64, error) {
+	return database.InsertID(q, `
+		INSERT INTO mistakes (name, description, position, user_id) VALUES (?, ?, ?, ?)
+	`, strings.TrimSpace(req.Name), req.Description, req.Position, userID)
+}
+
+// Update 更新錯誤類型，已標記的交易會沿用新名稱
+func Update(q database.Querier, userID, id int64, req models.MistakeCreate) error {
+	res, err := q.Exec(`
+		UPDATE mistakes SET name = ?, description = ?, position = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND user_id = ?
+	`, strings.TrimSpace(req.Name), req.Description, req.Position, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Delete 刪除錯誤類型與所有交易上的標記
+func Delete(q database.Querier, userID, id int64) error {
+	if _, err := Get(q, userID, id); err != nil {
+		return err
+	}
+	if _, err := q.Exec("DELETE FROM trade_mistakes WHERE mistake_id = ?", id); err != nil {
+		return err
+	}
+	_, err := q.Exec("DELETE FROM mistakes WHERE id = ? AND user_id = ?", id, userID)
+	return err
+}
+
+// Load 取得交易標記的錯誤類型
+func Load(q database.Querier, tradeID int64) ([]models.TradeMistake, error) {
+	rows, err := q.Query(`
+		SELECT m.id, m.name FROM trade_mistakes tm JOIN mistakes m ON tm.mistake_id = m.id
+		WHERE tm.trade_id = ? ORDER BY m.position, m.id
+	`, tradeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []models.TradeMistake
+	for rows.Next() {
+		var m models.TradeMistake
+		if err := rows.Scan(&m.ID, &m.Name); err != nil {
+			return nil, err
+		}
+		list = append(list, m)
+	}
+	return list, rows.Err()
+}
+
+// Names 取得交易標記的錯誤名稱 (已排序)，用於異動紀錄
+func Names(q database.Querier, tradeID int64) ([]string, error) {
+	list, err := Load(q, tradeID)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(list))
+	for _, m := range list {
+		names = append(names, m.Name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Set 以完整清單取代交易標記的錯誤類型，錯誤類型需先以 Validate 確認屬於使用者
+func Set(q database.Querier, tradeID int64, ids []int64) error {
+	if _, err := q.Exec("DELETE FROM trade_mistakes WHERE trade_id = ?", tradeID); err != nil {
+		return err
+	}
+	seen := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if _, err := q.Exec("INSERT INTO trade_mistakes (trade_id, mistake_id) VALUES (?, ?)", tradeID, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReplaceByName 以名稱還原交易的錯誤標記，已刪除的錯誤類型會略過
+func ReplaceByName(q database.Querier, userID, tradeID int64, names []interface{}) error {
+	if _, err := q.Exec("DELETE FROM trade_mistakes WHERE trade_id = ?", tradeID); err != nil {
+		return err
+	}
+	for _, n := range names {
+		name, ok := n.(string)
+		if !ok || name == "" {
+			continue
+		}
+		var id int64
+		err := q.QueryRow("SELECT id FROM mistakes WHERE name = ? AND user_id = ?", name, userID).Scan(&id)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := q.Exec("INSERT INTO trade_mistakes (trade_id, mistake_id) VALUES (?, ?)", tradeID, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StatusColumns 更新檢討狀態的 SET 子句；改為已檢討或需導師檢討時記錄檢討時間，改回未檢討時清除
+func StatusColumns(status string) ([]string, []interface{}) {
+	sets := []string{
+		`reviewed_at = CASE
+			WHEN ? = 'unreviewed' THEN NULL
+			WHEN COALESCE(review_status, 'unreviewed') = ? AND reviewed_at IS NOT NULL THEN reviewed_at
+			ELSE CURRENT_TIMESTAMP END`,
+		"review_status = ?",
+	}
+	return sets, []interface{}{status, status, status}
+}
+
+// SetStatus 更新交易的檢討狀態
+func SetStatus(q database.Querier, tradeID int64, status string) error {
+	sets, args := StatusColumns(status)
+	_, err := q.Exec("UPDATE trades SET "+strings.Join(sets, ", ")+" WHERE id = ?", append(args, tradeID)...)
+	return err
+}
+
+// Validate 檢查檢討請求的評等與錯誤類型，並整理評等格式
+func Validate(q database.Querier, userID int64, req *models.TradeReview) error {
+	if req.QualityGrade != nil {
+		grade := strings.ToUpper(strings.TrimSpace(*req.QualityGrade))
+		if !ValidGrade(grade) {
+			return fmt.Errorf("品質評等需為 %s", strings.Join(Grades, "、"))
+		}
+		req.QualityGrade = &grade
+	}
+	if req.MistakeIDs != nil {
+		for _, id := range *req.MistakeIDs {
+			if _, err := Get(q, userID, id); err == ErrNotFound {
+				return fmt.Errorf("錯誤類型 %d 不存在", id)
+			} else if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Apply 套用已通過 Validate 的檢討請求，呼叫前需確認交易屬於使用者
+func Apply(q database.Querier, tradeID int64, req models.TradeReview) error {
+	if req.QualityGrade != nil {
+		var v interface{}
+		if *req.QualityGrade != "" {
+			v = *req.QualityGrade
+		}
+		if _, err := q.Exec("UPDATE trades SET quality_grade = ? WHERE id = ?", v, tradeID); err != nil {
+			return err
+		}
+	}
+	if req.Lessons != nil {
+		var v interface{}
+		if s := strings.TrimSpace(*req.Lessons); s != "" {
+			v = s
+		}
+		if _, err := q.Exec("UPDATE trades SET lessons = ? WHERE id = ?", v, tradeID); err != nil {
+			return err
+		}
+	}
+	if req.MistakeIDs != nil {
+		if err := Set(q, tradeID, *req.MistakeIDs); err != nil {
+			return err
+		}
+	}
+	if req.ReviewStatus != nil {
+		if err := SetStatus(q, tradeID, *req.ReviewStatus); err != nil {
+			return err
+		}
+	}
+	return nil
+}
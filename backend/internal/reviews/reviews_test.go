@@ -0,0 +1,95 @@
+package reviews
+
+import (
+	"database/sql"
+	"testing"
+
+	"trade-journal/internal/database"
+	"trade-journal/internal/models"
+	"trade-journal/internal/testutil"
+)
+
+func TestReview(t *testing.T) {
+	db := testutil.OpenDB(t,
+		"INSERT INTO users (id, username, password) VALUES (1, 'alice', 'x'), (2, 'bob', 'x')",
+		"INSERT INTO accounts (id, user_id, name) VALUES (10, 1, 'main')",
+		"INSERT INTO trades (id, account_id, symbol, side, entry_price, entry_time) VALUES (100, 10, 'XAUUSD', 'long', 1, '2024-05-06 08:00:00')",
+	)
+
+	fomo, err := Create(db, 1, models.MistakeCreate{Name: " FOMO "})
+	if err != nil {
+		t.Fatal(err)
+	}
+	movedSL, err := Create(db, 1, models.MistakeCreate{Name: "移動停損"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := Create(db, 2, models.MistakeCreate{Name: "FOMO"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Create(db, 1, models.MistakeCreate{Name: "FOMO"}); !database.IsUniqueViolation(err) {
+		t.Fatalf("同名錯誤類型應違反唯一限制: %v", err)
+	}
+
+	// 其他使用者的錯誤類型與不合法的評等不能使用
+	if err := Validate(db, 1, &models.TradeReview{MistakeIDs: &[]int64{other}}); err == nil {
+		t.Fatal("不應接受其他使用者的錯誤類型")
+	}
+	bad := "E"
+	if err := Validate(db, 1, &models.TradeReview{QualityGrade: &bad}); err == nil {
+		t.Fatal("不應接受評等 E")
+	}
+
+	status, grade := Reviewed, " b "
+	req := models.TradeReview{ReviewStatus: &status, QualityGrade: &grade, MistakeIDs: &[]int64{fomo, movedSL, fomo}}
+	if err := Validate(db, 1, &req); err != nil {
+		t.Fatal(err)
+	}
+	if err := Apply(db, 100, req); err != nil {
+		t.Fatal(err)
+	}
+	var reviewStatus string
+	var qualityGrade sql.NullString
+	var reviewedAt sql.NullTime
+	load := func() {
+		t.Helper()
+		if err := db.QueryRow("SELECT review_status, quality_grade, reviewed_at FROM trades WHERE id = 100").Scan(&reviewStatus, &qualityGrade, &reviewedAt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	load()
+	if reviewStatus != Reviewed || qualityGrade.String != "B" || !reviewedAt.Valid {
+		t.Fatalf("檢討結果錯誤: %s %v %v", reviewStatus, qualityGrade, reviewedAt)
+	}
+	names, err := Names(db, 100)
+	if err != nil || len(names) != 2 || names[0] != "FOMO" || names[1] != "移動停損" {
+		t.Fatalf("錯誤類型錯誤: %v %v", names, err)
+	}
+
+	// 以名稱還原時略過已不存在的錯誤類型
+	if err := ReplaceByName(db, 1, 100, []interface{}{"FOMO", "已刪除"}); err != nil {
+		t.Fatal(err)
+	}
+	if names, _ := Names(db, 100); len(names) != 1 || names[0] != "FOMO" {
+		t.Fatalf("還原錯誤類型錯誤: %v", names)
+	}
+
+	// 刪除錯誤類型時移除交易上的標記，改回未檢討時清除檢討時間
+	if err := Delete(db, 1, fomo); err != nil {
+		t.Fatal(err)
+	}
+	if names, _ := Names(db, 100); len(names) != 0 {
+		t.Fatalf("刪除後仍有標記: %v", names)
+	}
+	if err := SetStatus(db, 100, Unreviewed); err != nil {
+		t.Fatal(err)
+	}
+	load()
+	if reviewStatus != Unreviewed || reviewedAt.Valid {
+		t.Fatalf("改回未檢討錯誤: %s %v", reviewStatus, reviewedAt)
+	}
+	if err := Delete(db, 1, other); err != ErrNotFound {
+		t.Fatalf("刪除其他使用者的錯誤類型應回傳 ErrNotFound: %v", err)
+	}
+}
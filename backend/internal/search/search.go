@@ -0,0 +1,337 @@
+package search
+
+import (
+	"database/sql"
+	"fmt"
+	"html"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"trade-journal/internal/database"
+)
+
+// 搜尋結果類型
+const (
+	TypeTrade = "trade"
+	TypePlan  = "plan"
+)
+
+const (
+	DefaultLimit = 20
+	MaxLimit     = 100
+
+	// minTermLength trigram 分詞無法比對少於 3 個字的詞，改以 LIKE 搜尋
+	minTermLength = 3
+
+	// 資料庫產生摘要時的標記，轉義 HTML 後才換成 <mark>
+	markStart = "\x02"
+	markEnd   = "\x03"
+)
+
+// Query 搜尋參數
+type Query struct {
+	Q         string `form:"q"`
+	Type      string `form:"type"` // trade, plan，空白表示全部
+	AccountID int64  `form:"account_id"`
+	Limit     int    `form:"limit"`
+}
+
+// Result 單筆搜尋結果，Snippet 已轉義 HTML，符合的文字以 <mark> 標示
+type Result struct {
+	Type      string    `json:"type"`
+	ID        int64     `json:"id"`
+	AccountID int64     `json:"account_id"`
+	Symbol    string    `json:"symbol"`
+	Date      time.Time `json:"date"`
+	Snippet   string    `json:"snippet"`
+	Score     float64   `json:"score"`
+}
+
+// Validate 檢查搜尋參數
+func (q Query) Validate() error {
+	if strings.TrimSpace(q.Q) == "" {
+		return fmt.Errorf("請輸入搜尋關鍵字")
+	}
+	if q.Type != "" && q.Type != TypeTrade && q.Type != TypePlan {
+		return fmt.Errorf("type 必須是 %s 或 %s", TypeTrade, TypePlan)
+	}
+	return nil
+}
+
+// Search 在使用者的交易心得與每日規劃中搜尋，依相關程度排序
+func Search(db *sql.DB, userID int64, q Query) ([]Result, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	terms := strings.Fields(q.Q)
+	if q.Limit <= 0 {
+		q.Limit = DefaultLimit
+	}
+	if q.Limit > MaxLimit {
+		q.Limit = MaxLimit
+	}
+
+	var sources []source
+	if q.Type == "" || q.Type == TypeTrade {
+		sources = append(sources, tradeSource)
+	}
+	if q.Type == "" || q.Type == TypePlan {
+		sources = append(sources, planSource)
+	}
+
+	results := []Result{}
+	for _, src := range sources {
+		var found []Result
+		var err error
+		switch {
+		case database.CurrentDialect() == database.DialectPostgres:
+			found, err = searchPostgres(db, src, userID, q, terms)
+		case hasShortTerm(terms):
+			found, err = searchLike(db, src, userID, q, terms)
+		default:
+			found, err = searchFTS(db, src, userID, q, terms)
+		}
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, found...)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Date.After(results[j].Date)
+	})
+	if len(results) > q.Limit {
+		results = results[:q.Limit]
+	}
+	return results, nil
+}
+
+// source 可搜尋的資料表
+type source struct {
+	typ      string
+	table    string
+	fts      string
+	document string
+	dateCol  string
+	columns  []string
+}
+
+var tradeSource = source{
+	typ:      TypeTrade,
+	table:    "trades",
+	fts:      "trades_fts",
+	document: database.TradeSearchDocument,
+	dateCol:  "entry_time",
+	columns:  []string{"notes", "entry_reason", "exit_reason"},
+}
+
+var planSource = source{
+	typ:      TypePlan,
+	table:    "daily_plans",
+	fts:      "daily_plans_fts",
+	document: database.PlanSearchDocument,
+	dateCol:  "plan_date",
+	columns:  []string{"notes", "trend_analysis"},
+}
+
+// scope 限定為使用者未刪除的帳號與資料
+func scope(userID int64, q Query) (string, []interface{}) {
+	where := " AND a.user_id = ? AND r.deleted_at IS NULL AND a.deleted_at IS NULL"
+	args := []interface{}{userID}
+	if q.AccountID > 0 {
+		where += " AND r.account_id = ?"
+		args = append(args, q.AccountID)
+	}
+	return where, args
+}
+
+// searchFTS SQLite FTS5 搜尋，每個詞以片語比對並全部符合
+func searchFTS(db *sql.DB, src source, userID int64, q Query, terms []string) ([]Result, error) {
+	phrases := make([]string, len(terms))
+	for i, t := range terms {
+		phrases[i] = `"` + strings.ReplaceAll(t, `"`, `""`) + `"`
+	}
+
+	where, args := scope(userID, q)
+	query := fmt.Sprintf(`
+		SELECT r.id, r.account_id, COALESCE(r.symbol, ''), r.%[3]s,
+			snippet(%[2]s, -1, char(2), char(3), '…', 16), -bm25(%[2]s)
+		FROM %[2]s
+		JOIN %[1]s r ON r.id = %[2]s.rowid
+		JOIN accounts a ON r.account_id = a.id
+		WHERE %[2]s MATCH ?`+where+`
+		ORDER BY bm25(%[2]s)
+		LIMIT ?
+	`, src.table, src.fts, src.dateCol)
+	args = append([]interface{}{strings.Join(phrases, " ")}, args...)
+	args = append(args, q.Limit)
+	return scanResults(db, src, query, args, nil)
+}
+
+// searchPostgres PostgreSQL 以 tsvector 搜尋，中文需以完整詞彙比對
+func searchPostgres(db *sql.DB, src source, userID int64, q Query, terms []string) ([]Result, error) {
+	text := "COALESCE(r." + strings.Join(src.columns, ", '') || ' ' || COALESCE(r.") + ", '')"
+	document := strings.ReplaceAll(src.document, "COALESCE(", "COALESCE(r.")
+
+	where, args := scope(userID, q)
+	query := fmt.Sprintf(`
+		SELECT r.id, r.account_id, COALESCE(r.symbol, ''), r.%[2]s,
+			ts_headline('simple', %[3]s, plainto_tsquery('simple', ?),
+				'StartSel=' || chr(2) || ', StopSel=' || chr(3) || ', MaxWords=24, MinWords=8'),
+			ts_rank(%[4]s, plainto_tsquery('simple', ?))
+		FROM %[1]s r
+		JOIN accounts a ON r.account_id = a.id
+		WHERE %[4]s @@ plainto_tsquery('simple', ?)`+where+`
+		ORDER BY 6 DESC
+		LIMIT ?
+	`, src.table, src.dateCol, text, document)
+	joined := strings.Join(terms, " ")
+	args = append([]interface{}{joined, joined, joined}, args...)
+	args = append(args, q.Limit)
+	return scanResults(db, src, query, args, nil)
+}
+
+// searchLike 關鍵字過短時的備援搜尋，摘要在程式中產生
+func searchLike(db *sql.DB, src source, userID int64, q Query, terms []string) ([]Result, error) {
+	where, args := scope(userID, q)
+	var conds []string
+	var likeArgs []interface{}
+	for _, t := range terms {
+		pattern := "%" + escapeLike(t) + "%"
+		var ors []string
+		for _, col := range src.columns {
+			ors = append(ors, "r."+col+` LIKE ? ESCAPE '\'`)
+			likeArgs = append(likeArgs, pattern)
+		}
+		conds = append(conds, "("+strings.Join(ors, " OR ")+")")
+	}
+
+	query := fmt.Sprintf(`
+		SELECT r.id, r.account_id, COALESCE(r.symbol, ''), r.%[2]s,
+			COALESCE(r.%[3]s, ''), 0
+		FROM %[1]s r
+		JOIN accounts a ON r.account_id = a.id
+		WHERE %[4]s`+where+`
+		ORDER BY r.%[2]s DESC
+		LIMIT ?
+	`, src.table, src.dateCol, strings.Join(src.columns, ", '') || char(10) || COALESCE(r."), strings.Join(conds, " AND "))
+	args = append(likeArgs, args...)
+	args = append(args, q.Limit)
+	return scanResults(db, src, query, args, func(text string) string {
+		return makeSnippet(text, terms)
+	})
+}
+
+func scanResults(db *sql.DB, src source, query string, args []interface{}, snippetFn func(string) string) ([]Result, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("搜尋失敗: %w", err)
+	}
+	defer rows.Close()
+
+	var results []Result
+	for rows.Next() {
+		r := Result{Type: src.typ}
+		var snippet string
+		if err := rows.Scan(&r.ID, &r.AccountID, &r.Symbol, &r.Date, &snippet, &r.Score); err != nil {
+			return nil, err
+		}
+		if snippetFn != nil {
+			snippet = snippetFn(snippet)
+		}
+		r.Snippet = highlight(snippet)
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// highlight 轉義 HTML 後將標記換成 <mark>
+func highlight(s string) string {
+	s = html.EscapeString(s)
+	s = strings.ReplaceAll(s, markStart, "<mark>")
+	return strings.ReplaceAll(s, markEnd, "</mark>")
+}
+
+// makeSnippet 擷取第一個關鍵字附近的文字，並標記所有關鍵字
+func makeSnippet(text string, terms []string) string {
+	const radius = 24
+
+	start, end := 0, len(text)
+	if i := indexFold(text, terms[0]); i >= 0 {
+		start, end = i, i
+		for n := 0; n < radius && start > 0; n++ {
+			_, size := utf8.DecodeLastRuneInString(text[:start])
+			start -= size
+		}
+		for n := 0; n < radius+utf8.RuneCountInString(terms[0]) && end < len(text); n++ {
+			_, size := utf8.DecodeRuneInString(text[end:])
+			end += size
+		}
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	b.WriteString(markTerms(text[start:end], terms))
+	if end < len(text) {
+		b.WriteString("…")
+	}
+	return strings.ReplaceAll(b.String(), "\n", " ")
+}
+
+func markTerms(s string, terms []string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		n := 0
+		for _, t := range terms {
+			if len(t) > n && hasPrefixFold(s[i:], t) {
+				n = len(t)
+			}
+		}
+		if n > 0 {
+			b.WriteString(markStart + s[i:i+n] + markEnd)
+			i += n
+			continue
+		}
+		_, size := utf8.DecodeRuneInString(s[i:])
+		b.WriteString(s[i : i+size])
+		i += size
+	}
+	return b.String()
+}
+
+// indexFold 不分大小寫的 strings.Index
+func indexFold(s, substr string) int {
+	for i := 0; i < len(s); {
+		if hasPrefixFold(s[i:], substr) {
+			return i
+		}
+		_, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+	}
+	return -1
+}
+
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
+
+func hasShortTerm(terms []string) bool {
+	for _, t := range terms {
+		if utf8.RuneCountInString(t) < minTermLength {
+			return true
+		}
+	}
+	return false
+}
+
+func escapeLike(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+	return r.Replace(s)
+}
@@ -0,0 +1,85 @@
+package search
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+
+	"trade-journal/internal/testutil"
+)
+
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	return testutil.OpenDB(t,
+		"INSERT INTO users (id, username, password) VALUES (1, 'alice', 'x'), (2, 'bob', 'x')",
+		"INSERT INTO accounts (id, user_id, name) VALUES (10, 1, 'main'), (20, 2, 'other')",
+		"INSERT INTO trades (id, account_id, symbol, side, entry_time, notes) VALUES (100, 10, 'XAUUSD', 'short', '2024-05-01 08:00:00', 'Faded the London open <b>again</b>')",
+		"INSERT INTO trades (id, account_id, symbol, side, entry_time, entry_reason) VALUES (101, 10, 'XAUUSD', 'long', '2024-05-02 08:00:00', '倫敦開盤假突破後做多')",
+		"INSERT INTO trades (id, account_id, symbol, side, entry_time, notes) VALUES (200, 20, 'XAUUSD', 'short', '2024-05-01 08:00:00', 'london open too')",
+		"INSERT INTO daily_plans (id, account_id, plan_date, symbol, notes) VALUES (50, 10, '2024-05-01 00:00:00', 'XAUUSD', '等待倫敦開盤再決定方向')",
+	)
+}
+
+func ids(results []Result) []int64 {
+	var out []int64
+	for _, r := range results {
+		out = append(out, r.ID)
+	}
+	return out
+}
+
+func TestSearch(t *testing.T) {
+	db := openTestDB(t)
+
+	results, err := Search(db, 1, Query{Q: "london OPEN"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].ID != 100 {
+		t.Fatalf("應只找到自己的交易 100, got %v", ids(results))
+	}
+	if s := results[0].Snippet; !strings.Contains(s, "<mark>London</mark>") || !strings.Contains(s, "&lt;b&gt;") {
+		t.Fatalf("摘要應標記關鍵字並轉義 HTML: %s", s)
+	}
+
+	results, _ = Search(db, 1, Query{Q: "倫敦開盤"})
+	if len(results) != 2 {
+		t.Fatalf("應找到交易與規劃各一筆, got %+v", results)
+	}
+	results, _ = Search(db, 1, Query{Q: "倫敦開盤", Type: TypePlan})
+	if len(results) != 1 || results[0].Type != TypePlan {
+		t.Fatalf("應只找到規劃, got %+v", results)
+	}
+}
+
+func TestSearchFollowsWrites(t *testing.T) {
+	db := openTestDB(t)
+
+	db.Exec("UPDATE trades SET notes = 'asian range breakout' WHERE id = 100")
+	if results, _ := Search(db, 1, Query{Q: "london"}); len(results) != 0 {
+		t.Fatalf("更新後不應再找到舊內容, got %v", ids(results))
+	}
+	if results, _ := Search(db, 1, Query{Q: "breakout"}); len(results) != 1 {
+		t.Fatalf("應找到更新後的內容, got %v", ids(results))
+	}
+
+	db.Exec("UPDATE trades SET deleted_at = CURRENT_TIMESTAMP WHERE id = 101")
+	if results, _ := Search(db, 1, Query{Q: "倫敦開盤", Type: TypeTrade}); len(results) != 0 {
+		t.Fatalf("不應找到已刪除的交易, got %v", ids(results))
+	}
+}
+
+func TestSearchShortTerm(t *testing.T) {
+	db := openTestDB(t)
+
+	results, err := Search(db, 1, Query{Q: "突破"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].ID != 101 {
+		t.Fatalf("短關鍵字應以 LIKE 找到交易 101, got %v", ids(results))
+	}
+	if !strings.Contains(results[0].Snippet, "<mark>突破</mark>") {
+		t.Fatalf("摘要應標記關鍵字: %s", results[0].Snippet)
+	}
+}
@@ -0,0 +1,351 @@
+package strategies
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"trade-journal/internal/database"
+	"trade-journal/internal/models"
+)
+
+// ErrNotFound 策略不存在或不屬於使用者
+var ErrNotFound = errors.New("策略不存在")
+
+// ErrInUse 仍有交易使用此策略
+var ErrInUse = errors.New("仍有交易使用此策略，請先將交易改為其他策略")
+
+// ImageType 策略圖片在 trade_images 中的 image_type
+const ImageType = "strategy"
+
+// Unspecified 未指定策略的交易在統計中的分組名稱
+const Unspecified = "unspecified"
+
+const selectColumns = `
+	SELECT s.id, s.user_id, s.builtin_key, s.name, COALESCE(s.description, ''), s.signals, s.checklist, s.patterns, s.image_slots,
+		(SELECT COUNT(*) FROM trades t WHERE t.strategy_id = s.id AND t.deleted_at IS NULL), s.created_at, s.updated_at
+	FROM strategies s`
+
+func scan(row interface{ Scan(...interface{}) error }) (models.Strategy, error) {
+	var s models.Strategy
+	var signals, checklist, patterns, slots string
+	err := row.Scan(&s.ID, &s.UserID, &s.BuiltinKey, &s.Name, &s.Description, &signals, &checklist, &patterns, &slots, &s.TradeCount, &s.CreatedAt, &s.UpdatedAt)
+	if err != nil {
+		return s, err
+	}
+	for _, f := range []struct {
+		raw  string
+		dest interface{}
+	}{
+		{signals, &s.Signals}, {checklist, &s.Checklist}, {patterns, &s.Patterns}, {slots, &s.ImageSlots},
+	} {
+		if err := json.Unmarshal([]byte(f.raw), f.dest); err != nil {
+			return s, fmt.Errorf("策略 %d 定義格式錯誤: %w", s.ID, err)
+		}
+	}
+	return s, nil
+}
+
+// List 取得使用者的所有策略，內建策略排在前面
+func List(q database.Querier, userID int64) ([]models.Strategy, error) {
+	rows, err := q.Query(selectColumns+" WHERE s.user_id = ? ORDER BY CASE WHEN s.builtin_key IS NULL THEN 1 ELSE 0 END, s.id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.Strategy{}
+	for rows.Next() {
+		s, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, s)
+	}
+	return list, rows.Err()
+}
+
+// Get 取得使用者的單一策略，找不到時回傳 ErrNotFound
+func Get(q database.Querier, userID, id int64) (models.Strategy, error) {
+	s, err := scan(q.QueryRow(selectColumns+" WHERE s.id = ? AND s.user_id = ?", id, userID))
+	if err == sql.ErrNoRows {
+		return s, ErrNotFound
+	}
+	return s, err
+}
+
+// Validate 檢查策略定義中的 id 不重複
+func Validate(req models.StrategyCreate) error {
+	check := func(kind string, ids []string) error {
+		seen := make(map[string]bool)
+		for _, id := range ids {
+			if seen[id] {
+				return fmt.Errorf("%s的 id 重複: %s", kind, id)
+			}
+			seen[id] = true
+		}
+		return nil
+	}
+	for _, l := range []struct {
+		kind  string
+		items []models.StrategyItem
+	}{{"訊號", req.Signals}, {"檢查項目", req.Checklist}, {"樣態", req.Patterns}} {
+		ids := make([]string, len(l.items))
+		for i, item := range l.items {
+			ids[i] = item.ID
+		}
+		if err := check(l.kind, ids); err != nil {
+			return err
+		}
+	}
+	ids := make([]string, len(req.ImageSlots))
+	for i, slot := range req.ImageSlots {
+		ids[i] = slot.ID
+	}
+	return check("圖片欄位", ids)
+}
+
+// definitionArgs 將策略定義轉為 JSON 欄位值，空清單存為 []
+func definitionArgs(req models.StrategyCreate) ([]interface{}, error) {
+	args := []interface{}{req.Name, req.Description}
+	for _, v := range []interface{}{req.Signals, req.Checklist, req.Patterns, req.ImageSlots} {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		if string(data) == "null" {
+			data = []byte("[]")
+		}
+		args = append(args, string(data))
+	}
+	return args, nil
+}
+
+// Create 建立策略
+func Create(q database.Querier, userID int64, req models.StrategyCreate) (int64, error) {
+	args, err := definitionArgs(req)
+	if err != nil {
+		return 0, err
+	}
+	return database.InsertID(q, `
+		INSERT INTO strategies (name, description, signals, checklist, patterns, image_slots, user_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, append(args, userID)...)
+}
+
+// Update 更新策略定義，已使用的項目 id 若被移除，舊交易的該項目在統計中會以 id 顯示
+func Update(q database.Querier, userID, id int64, req models.StrategyCreate) error {
+	args, err := definitionArgs(req)
+	if err != nil {
+		return err
+	}
+	res, err := q.Exec(`
+		UPDATE strategies SET name = ?, description = ?, signals = ?, checklist = ?, patterns = ?, image_slots = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND user_id = ?
+	`, append(args, id, userID)...)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Delete 刪除策略，垃圾桶中的交易也算在使用中，避免還原後參照不存在的策略
+func Delete(q database.Querier, userID, id int64) error {
+	if _, err := Get(q, userID, id); err != nil {
+		return err
+	}
+	var used int
+	if err := q.QueryRow("SELECT COUNT(*) FROM trades WHERE strategy_id = ?", id).Scan(&used); err != nil {
+		return err
+	}
+	if used > 0 {
+		return ErrInUse
+	}
+	_, err := q.Exec("DELETE FROM strategies WHERE id = ? AND user_id = ?", id, userID)
+	return err
+}
+
+// Lookup 依 strategy_id 或內建策略代碼找出策略，回傳策略 (找不到內建策略時為 nil) 與應寫入的 entry_strategy
+func Lookup(q database.Querier, userID int64, strategyID *int64, entryStrategy string) (*models.Strategy, string, error) {
+	if strategyID == nil {
+		if entryStrategy == "" {
+			return nil, "", nil
+		}
+		var id int64
+		err := q.QueryRow("SELECT id FROM strategies WHERE user_id = ? AND builtin_key = ?", userID, entryStrategy).Scan(&id)
+		if err == sql.ErrNoRows {
+			return nil, entryStrategy, nil
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		strategyID = &id
+	}
+
+	s, err := Get(q, userID, *strategyID)
+	if err != nil {
+		return nil, "", err
+	}
+	if s.BuiltinKey != nil {
+		return &s, *s.BuiltinKey, nil
+	}
+	return &s, "", nil
+}
+
+// Resolve 決定交易使用的策略並檢查策略圖片
+// 未提供 strategy_id 時，以 entry_strategy 對應到內建策略；提供時 entry_strategy 改為策略的內建代碼
+// 請求中有策略圖片時會取代 stored (交易目前已有的策略圖片欄位)
+func Resolve(q database.Querier, userID int64, req *models.TradeCreate, stored map[string]bool) error {
+	slots, err := ImageSlots(req.Images)
+	if err != nil {
+		return err
+	}
+
+	s, key, err := Lookup(q, userID, req.StrategyID, req.EntryStrategy)
+	if err != nil {
+		return err
+	}
+	req.EntryStrategy = key
+	if s == nil {
+		req.StrategyID = nil
+		if len(slots) > 0 {
+			return fmt.Errorf("未選擇策略的交易不能有策略圖片")
+		}
+		return nil
+	}
+	req.StrategyID = &s.ID
+
+	defined := make(map[string]bool)
+	for _, slot := range s.ImageSlots {
+		defined[slot.ID] = true
+	}
+	for slot := range slots {
+		if !defined[slot] {
+			return fmt.Errorf("策略「%s」沒有圖片欄位 %s", s.Name, slot)
+		}
+	}
+
+	if slots == nil {
+		slots = stored
+	}
+	var missing []string
+	for _, slot := range s.ImageSlots {
+		if slot.Required && !slots[slot.ID] {
+			label := slot.Label
+			if label == "" {
+				label = slot.ID
+			}
+			missing = append(missing, label)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("策略「%s」需要以下圖片: %s", s.Name, strings.Join(missing, "、"))
+	}
+	return nil
+}
+
+// ImageSlots 取得請求中的策略圖片欄位，沒有策略圖片時回傳 nil
+func ImageSlots(images []models.ImageUpload) (map[string]bool, error) {
+	var slots map[string]bool
+	for _, img := range images {
+		if img.ImageType != ImageType {
+			continue
+		}
+		if img.Slot == "" {
+			return nil, fmt.Errorf("策略圖片需指定 slot")
+		}
+		if slots == nil {
+			slots = make(map[string]bool)
+		}
+		slots[img.Slot] = true
+	}
+	return slots, nil
+}
+
+// StoredImageSlots 取得交易目前已有的策略圖片欄位
+func StoredImageSlots(q database.Querier, tradeID int64) (map[string]bool, error) {
+	rows, err := q.Query("SELECT slot FROM trade_images WHERE trade_id = ? AND image_type = ? AND slot IS NOT NULL", tradeID, ImageType)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	slots := make(map[string]bool)
+	for rows.Next() {
+		var slot string
+		if err := rows.Scan(&slot); err != nil {
+			return nil, err
+		}
+		slots[slot] = true
+	}
+	return slots, rows.Err()
+}
+
+// Items 依策略定義取出交易勾選的訊號、檢查項目與樣態名稱，用於子項目統計
+// 定義中已不存在的項目以原始 id 顯示
+func Items(s *models.Strategy, signals, checklist, patterns string) []string {
+	var defSignals, defChecklist, defPatterns []models.StrategyItem
+	if s != nil {
+		defSignals, defChecklist, defPatterns = s.Signals, s.Checklist, s.Patterns
+	}
+
+	var items []string
+	for _, id := range selectedNames(signals) {
+		items = append(items, label(defSignals, id))
+	}
+	var checked map[string]bool
+	if json.Unmarshal([]byte(checklist), &checked) == nil {
+		// 依定義順序輸出，讓結果穩定
+		for _, item := range defChecklist {
+			if checked[item.ID] {
+				items = append(items, label(defChecklist, item.ID))
+				delete(checked, item.ID)
+			}
+		}
+		for id, ok := range checked {
+			if ok {
+				items = append(items, id)
+			}
+		}
+	}
+	for _, id := range selectedNames(patterns) {
+		items = append(items, "樣態: "+label(defPatterns, id))
+	}
+	return items
+}
+
+// selectedNames 解析字串陣列或 [{"name": ...}] 格式的勾選項目
+func selectedNames(raw string) []string {
+	var list []json.RawMessage
+	if json.Unmarshal([]byte(raw), &list) != nil {
+		return nil
+	}
+	var names []string
+	for _, v := range list {
+		var name string
+		if json.Unmarshal(v, &name) != nil {
+			var obj struct {
+				Name string `json:"name"`
+			}
+			json.Unmarshal(v, &obj)
+			name = obj.Name
+		}
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func label(items []models.StrategyItem, id string) string {
+	for _, item := range items {
+		if item.ID == id && item.Label != "" {
+			return item.Label
+		}
+	}
+	return id
+}
@@ -0,0 +1,112 @@
+package strategies
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+
+	"trade-journal/internal/database"
+	"trade-journal/internal/models"
+	"trade-journal/internal/testutil"
+)
+
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db := testutil.OpenDB(t, "INSERT INTO users (id, username, password) VALUES (1, 'alice', 'x')")
+	if err := database.SeedDefaultStrategies(db, 1); err != nil {
+		t.Fatalf("建立內建策略失敗: %v", err)
+	}
+	return db
+}
+
+func TestResolve(t *testing.T) {
+	db := openTestDB(t)
+
+	// entry_strategy 對應到內建策略
+	req := models.TradeCreate{EntryStrategy: "elite"}
+	if err := Resolve(db, 1, &req, nil); err != nil {
+		t.Fatalf("Resolve 失敗: %v", err)
+	}
+	if req.StrategyID == nil {
+		t.Fatal("elite 應對應到內建策略")
+	}
+	elite := *req.StrategyID
+
+	id, err := Create(db, 1, models.StrategyCreate{
+		Name:       "突破",
+		ImageSlots: []models.StrategyImageSlot{{ID: "htf", Label: "大週期", Required: true}, {ID: "ltf"}},
+	})
+	if err != nil {
+		t.Fatalf("建立策略失敗: %v", err)
+	}
+
+	// 指定自訂策略時 entry_strategy 清空，並檢查必填圖片
+	req = models.TradeCreate{StrategyID: &id, EntryStrategy: "elite"}
+	if err := Resolve(db, 1, &req, nil); err == nil {
+		t.Fatal("缺少必填圖片應回傳錯誤")
+	}
+	req.Images = []models.ImageUpload{{ImageType: ImageType, ImagePath: "a.png", Slot: "htf"}}
+	if err := Resolve(db, 1, &req, nil); err != nil {
+		t.Fatalf("Resolve 失敗: %v", err)
+	}
+	if req.EntryStrategy != "" || *req.StrategyID != id {
+		t.Fatalf("entry_strategy = %q, strategy_id = %d", req.EntryStrategy, *req.StrategyID)
+	}
+
+	// 沒有上傳策略圖片時以交易已有的圖片檢查
+	req = models.TradeCreate{StrategyID: &id}
+	if err := Resolve(db, 1, &req, map[string]bool{"htf": true}); err != nil {
+		t.Fatalf("已有必填圖片不應回傳錯誤: %v", err)
+	}
+
+	req.Images = []models.ImageUpload{{ImageType: ImageType, ImagePath: "a.png", Slot: "unknown"}}
+	if err := Resolve(db, 1, &req, nil); err == nil {
+		t.Fatal("未定義的圖片欄位應回傳錯誤")
+	}
+
+	other := int64(999)
+	req = models.TradeCreate{StrategyID: &other}
+	if err := Resolve(db, 1, &req, nil); err != ErrNotFound {
+		t.Fatalf("不存在的策略應回傳 ErrNotFound, got %v", err)
+	}
+
+	if _, err := db.Exec("INSERT INTO accounts (id, user_id, name) VALUES (10, 1, 'main')"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO trades (account_id, symbol, side, entry_price, entry_time, strategy_id) VALUES (10, 'XAUUSD', 'long', 2300, '2024-05-01 08:00:00', ?)", elite); err != nil {
+		t.Fatal(err)
+	}
+	if err := Delete(db, 1, elite); err != ErrInUse {
+		t.Fatalf("使用中的策略應回傳 ErrInUse, got %v", err)
+	}
+	if err := Delete(db, 1, id); err != nil {
+		t.Fatalf("刪除策略失敗: %v", err)
+	}
+}
+
+func TestItems(t *testing.T) {
+	db := openTestDB(t)
+	list, err := List(db, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var elite *models.Strategy
+	for i := range list {
+		if list[i].BuiltinKey != nil && *list[i].BuiltinKey == "elite" {
+			elite = &list[i]
+		}
+	}
+	if elite == nil {
+		t.Fatal("找不到內建策略 elite")
+	}
+
+	got := Items(elite, "", `{"price_level": true, "trend_line": true, "removed": true, "high_low": false}`, `["甲", {"name": "乙"}]`)
+	want := []string{"破趨勢線了嗎?", "破價位了嗎?", "removed", "樣態: 甲", "樣態: 乙"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Items = %v, want %v", got, want)
+	}
+
+	if got := Items(nil, `["自訂"]`, "", ""); !reflect.DeepEqual(got, []string{"自訂"}) {
+		t.Fatalf("沒有定義時應以 id 顯示, got %v", got)
+	}
+}
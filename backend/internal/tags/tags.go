@@ -0,0 +1,328 @@
+package tags
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"trade-journal/internal/audit"
+	"trade-journal/internal/database"
+	"trade-journal/internal/models"
+)
+
+// ErrNotFound 標籤不存在或不屬於使用者
+var ErrNotFound = errors.New("標籤不存在")
+
+// ErrGroupNotFound 標籤分組不存在或不屬於使用者
+var ErrGroupNotFound = errors.New("標籤分組不存在")
+
+// ErrMergeIntoSelf 合併的來源包含目標標籤
+var ErrMergeIntoSelf = errors.New("不能將標籤合併到自己")
+
+var colorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// ValidColor 檢查顏色格式 (#RRGGBB)，空字串表示不設定
+func ValidColor(color string) bool {
+	return color == "" || colorPattern.MatchString(color)
+}
+
+// nullable 空字串存為 NULL
+func nullable(s string) interface{} {
+	if s = strings.TrimSpace(s); s == "" {
+		return nil
+	}
+	return s
+}
+
+const selectColumns = `
+	SELECT tg.id, tg.name, tg.color, tg.group_id, tg.created_at, COALESCE(tg.description, ''), g.name,
+		(SELECT COUNT(*) FROM trade_tags tt JOIN trades t ON tt.trade_id = t.id WHERE tt.tag_id = tg.id AND t.deleted_at IS NULL)
+	FROM tags tg
+	LEFT JOIN tag_groups g ON tg.group_id = g.id`
+
+func scan(row interface{ Scan(...interface{}) error }) (models.TagDetail, error) {
+	var t models.TagDetail
+	err := row.Scan(&t.ID, &t.Name, &t.Color, &t.GroupID, &t.CreatedAt, &t.Description, &t.GroupName, &t.TradeCount)
+	return t, err
+}
+
+// List 取得使用者的所有標籤，依名稱排序
+func List(q database.Querier, userID int64) ([]models.TagDetail, error) {
+	rows, err := q.Query(selectColumns+" WHERE tg.user_id = ? ORDER BY tg.name", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.TagDetail{}
+	for rows.Next() {
+		t, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, t)
+	}
+	return list, rows.Err()
+}
+
+// Get 取得使用者的單一標籤，找不到時回傳 ErrNotFound
+func Get(q database.Querier, userID, id int64) (models.TagDetail, error) {
+	t, err := scan(q.QueryRow(selectColumns+" WHERE tg.id = ? AND tg.user_id = ?", id, userID))
+	if err == sql.ErrNoRows {
+		return t, ErrNotFound
+	}
+	return t, err
+}
+
+// Validate 檢查標籤名稱、顏色與分組，並整理名稱格式
+func Validate(q database.Querier, userID int64, req *models.TagCreate) error {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return fmt.Errorf("標籤名稱不可為空白")
+	}
+	if !ValidColor(req.Color) {
+		return fmt.Errorf("顏色格式需為 #RRGGBB")
+	}
+	if req.GroupID != nil {
+		if _, err := GetGroup(q, userID, *req.GroupID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Create 建立標籤，呼叫前需先以 Validate 檢查
+func Create(q database.Querier, userID int64, req models.TagCreate) (int64, error) {
+	return database.InsertID(q, `
+		INSERT INTO tags (name, color, description, group_id, user_id) VALUES (?, ?, ?, ?, ?)
+	`, req.Name, nullable(req.Color), nullable(req.Description), req.GroupID, userID)
+}
+
+// Update 更新標籤的名稱、顏色、說明與分組，改名後所有交易沿用新名稱
+func Update(q database.Querier, userID, id int64, req models.TagCreate) error {
+	res, err := q.Exec(`
+		UPDATE tags SET name = ?, color = ?, description = ?, group_id = ? WHERE id = ? AND user_id = ?
+	`, req.Name, nullable(req.Color), nullable(req.Description), req.GroupID, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Delete 刪除標籤並從所有交易移除，受影響的交易在同一交易中寫入異動紀錄
+func Delete(q database.Querier, userID, id int64) error {
+	if _, err := Get(q, userID, id); err != nil {
+		return err
+	}
+	return withRevisions(q, userID, []int64{id}, func() error {
+		return remove(q, userID, id)
+	})
+}
+
+// Merge 將來源標籤的交易改為使用目標標籤，並刪除來源標籤，回傳新增目標標籤的交易數
+// 已同時有來源與目標標籤的交易只保留目標標籤；來源名稱記錄在 tag_merges，還原舊紀錄時對應到目標標籤
+func Merge(q database.Querier, userID int64, sourceIDs []int64, targetID int64) (int, error) {
+	if _, err := Get(q, userID, targetID); err != nil {
+		return 0, err
+	}
+	var sources []models.TagDetail
+	merged := map[int64]bool{}
+	for _, id := range sourceIDs {
+		if id == targetID {
+			return 0, ErrMergeIntoSelf
+		}
+		tag, err := Get(q, userID, id)
+		if err != nil {
+			return 0, err
+		}
+		if !merged[id] {
+			merged[id] = true
+			sources = append(sources, tag)
+		}
+	}
+
+	ids := []int64{targetID}
+	for _, tag := range sources {
+		ids = append(ids, tag.ID)
+	}
+	moved := 0
+	err := withRevisions(q, userID, ids, func() error {
+		for _, tag := range sources {
+			res, err := q.Exec(`
+				INSERT INTO trade_tags (trade_id, tag_id)
+				SELECT trade_id, ? FROM trade_tags
+				WHERE tag_id = ? AND trade_id NOT IN (SELECT trade_id FROM trade_tags WHERE tag_id = ?)
+			`, targetID, tag.ID, targetID)
+			if err != nil {
+				return err
+			}
+			n, _ := res.RowsAffected()
+			moved += int(n)
+			// 先前合併到來源標籤的名稱改為對應目標標籤
+			if _, err := q.Exec("UPDATE tag_merges SET tag_id = ? WHERE tag_id = ? AND user_id = ?", targetID, tag.ID, userID); err != nil {
+				return err
+			}
+			if _, err := q.Exec(`
+				INSERT INTO tag_merges (user_id, name, tag_id) VALUES (?, ?, ?)
+				ON CONFLICT (user_id, name) DO UPDATE SET tag_id = excluded.tag_id
+			`, userID, tag.Name, targetID); err != nil {
+				return err
+			}
+			if err := remove(q, userID, tag.ID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return moved, nil
+}
+
+// remove 刪除標籤與交易上的標籤，不寫入異動紀錄
+func remove(q database.Querier, userID, id int64) error {
+	if _, err := q.Exec("DELETE FROM trade_tags WHERE tag_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := q.Exec("DELETE FROM tag_merges WHERE tag_id = ? AND user_id = ?", id, userID); err != nil {
+		return err
+	}
+	_, err := q.Exec("DELETE FROM tags WHERE id = ? AND user_id = ?", id, userID)
+	return err
+}
+
+// withRevisions 在 fn 前後對帶有任一標籤的交易建立快照，並為每筆交易寫入異動紀錄
+func withRevisions(q database.Querier, userID int64, tagIDs []int64, fn func() error) error {
+	args := make([]interface{}, len(tagIDs))
+	for i, id := range tagIDs {
+		args[i] = id
+	}
+	rows, err := q.Query("SELECT DISTINCT trade_id FROM trade_tags WHERE tag_id IN (?"+strings.Repeat(", ?", len(tagIDs)-1)+") ORDER BY trade_id", args...)
+	if err != nil {
+		return err
+	}
+	var tradeIDs []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		tradeIDs = append(tradeIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	before := make([]map[string]interface{}, len(tradeIDs))
+	for i, id := range tradeIDs {
+		if before[i], err = audit.Snapshot(q, id); err != nil {
+			return err
+		}
+	}
+	if err := fn(); err != nil {
+		return err
+	}
+	for i, id := range tradeIDs {
+		after, err := audit.Snapshot(q, id)
+		if err != nil {
+			return err
+		}
+		if err := audit.Record(q, id, userID, audit.ActionUpdate, audit.SourceAPI, before[i], after); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const selectGroupColumns = `
+	SELECT g.id, g.user_id, g.name, g.color, COALESCE(g.position, 0), g.created_at, g.updated_at,
+		(SELECT COUNT(*) FROM tags tg WHERE tg.group_id = g.id)
+	FROM tag_groups g`
+
+func scanGroup(row interface{ Scan(...interface{}) error }) (models.TagGroup, error) {
+	var g models.TagGroup
+	err := row.Scan(&g.ID, &g.UserID, &g.Name, &g.Color, &g.Position, &g.CreatedAt, &g.UpdatedAt, &g.TagCount)
+	return g, err
+}
+
+// ListGroups 取得使用者的標籤分組，依 position 排序
+func ListGroups(q database.Querier, userID int64) ([]models.TagGroup, error) {
+	rows, err := q.Query(selectGroupColumns+" WHERE g.user_id = ? ORDER BY g.position, g.id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.TagGroup{}
+	for rows.Next() {
+		g, err := scanGroup(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, g)
+	}
+	return list, rows.Err()
+}
+
+// GetGroup 取得使用者的單一標籤分組，找不到時回傳 ErrGroupNotFound
+func GetGroup(q database.Querier, userID, id int64) (models.TagGroup, error) {
+	g, err := scanGroup(q.QueryRow(selectGroupColumns+" WHERE g.id = ? AND g.user_id = ?", id, userID))
+	if err == sql.ErrNoRows {
+		return g, ErrGroupNotFound
+	}
+	return g, err
+}
+
+// ValidateGroup 檢查分組名稱與顏色，並整理名稱格式
+func ValidateGroup(req *models.TagGroupCreate) error {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return fmt.Errorf("分組名稱不可為空白")
+	}
+	if !ValidColor(req.Color) {
+		return fmt.Errorf("顏色格式需為 #RRGGBB")
+	}
+	return nil
+}
+
+// CreateGroup 建立標籤分組
+func CreateGroup(q database.Querier, userID int64, req models.TagGroupCreate) (int64, error) {
+	return database.InsertID(q, `
+		INSERT INTO tag_groups (name, color, position, user_id) VALUES (?, ?, ?, ?)
+	`, req.Name, nullable(req.Color), req.Position, userID)
+}
+
+// UpdateGroup 更新標籤分組
+func UpdateGroup(q database.Querier, userID, id int64, req models.TagGroupCreate) error {
+	res, err := q.Exec(`
+		UPDATE tag_groups SET name = ?, color = ?, position = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND user_id = ?
+	`, req.Name, nullable(req.Color), req.Position, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrGroupNotFound
+	}
+	return nil
+}
+
+// DeleteGroup 刪除標籤分組，組內的標籤改為未分組
+func DeleteGroup(q database.Querier, userID, id int64) error {
+	if _, err := GetGroup(q, userID, id); err != nil {
+		return err
+	}
+	if _, err := q.Exec("UPDATE tags SET group_id = NULL WHERE group_id = ?", id); err != nil {
+		return err
+	}
+	_, err := q.Exec("DELETE FROM tag_groups WHERE id = ? AND user_id = ?", id, userID)
+	return err
+}
@@ -0,0 +1,150 @@
+package tags
+
+import (
+	"reflect"
+	"testing"
+
+	"trade-journal/internal/audit"
+	"trade-journal/internal/models"
+	"trade-journal/internal/testutil"
+)
+
+func TestMergeAndGroups(t *testing.T) {
+	db := testutil.OpenDB(t,
+		"INSERT INTO users (id, username, password) VALUES (1, 'alice', 'x'), (2, 'bob', 'x')",
+		"INSERT INTO accounts (id, user_id, name) VALUES (10, 1, 'main')",
+		"INSERT INTO tags (id, user_id, name) VALUES (1, 1, 'breakout'), (2, 1, 'break-out'), (3, 1, 'Breakout '), (4, 2, 'other')",
+		`INSERT INTO trades (id, account_id, symbol, side, entry_price, entry_time) VALUES
+			(100, 10, 'XAUUSD', 'long', 1, '2024-05-06 08:00:00'),
+			(101, 10, 'XAUUSD', 'long', 1, '2024-05-06 08:00:00'),
+			(102, 10, 'XAUUSD', 'long', 1, '2024-05-06 08:00:00')`,
+		// 100 同時有 breakout 與 break-out，合併後只保留一筆
+		"INSERT INTO trade_tags (trade_id, tag_id) VALUES (100, 1), (100, 2), (101, 2), (102, 3)",
+	)
+
+	if _, err := Merge(db, 1, []int64{2, 1}, 1); err != ErrMergeIntoSelf {
+		t.Fatalf("合併到自己應回傳 ErrMergeIntoSelf: %v", err)
+	}
+	if _, err := Merge(db, 1, []int64{4}, 1); err != ErrNotFound {
+		t.Fatalf("不能合併其他使用者的標籤: %v", err)
+	}
+	moved, err := Merge(db, 1, []int64{2, 3}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moved != 2 {
+		t.Fatalf("應新增 2 筆交易的目標標籤，得到 %d", moved)
+	}
+	list, err := List(db, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].Name != "breakout" || list[0].TradeCount != 3 {
+		t.Fatalf("合併後的標籤錯誤: %+v", list)
+	}
+
+	req := models.TagGroupCreate{Name: " 型態 ", Color: "#ff8800"}
+	if err := ValidateGroup(&req); err != nil {
+		t.Fatal(err)
+	}
+	groupID, err := CreateGroup(db, 1, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag := models.TagCreate{Name: "breakout", Color: "red", GroupID: &groupID}
+	if err := Validate(db, 1, &tag); err == nil {
+		t.Fatal("不應接受非 #RRGGBB 的顏色")
+	}
+	tag.Color = "#00AA00"
+	if err := Validate(db, 2, &tag); err != ErrGroupNotFound {
+		t.Fatalf("不能使用其他使用者的分組: %v", err)
+	}
+	if err := Validate(db, 1, &tag); err != nil {
+		t.Fatal(err)
+	}
+	if err := Update(db, 1, 1, tag); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Get(db, 1, 1)
+	if err != nil || got.GroupName == nil || *got.GroupName != "型態" || *got.Color != "#00AA00" {
+		t.Fatalf("更新標籤錯誤: %+v %v", got, err)
+	}
+
+	// 刪除分組後標籤改為未分組
+	if err := DeleteGroup(db, 1, groupID); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := Get(db, 1, 1); got.GroupID != nil {
+		t.Fatalf("刪除分組後標籤仍有分組: %v", *got.GroupID)
+	}
+	if err := Delete(db, 1, 1); err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	db.QueryRow("SELECT COUNT(*) FROM trade_tags").Scan(&n)
+	if n != 0 {
+		t.Fatalf("刪除標籤後仍有 %d 筆交易標籤", n)
+	}
+}
+
+func TestDeleteAndMergeRecordRevisions(t *testing.T) {
+	db := testutil.OpenDB(t,
+		"INSERT INTO users (id, username, password) VALUES (1, 'alice', 'x')",
+		"INSERT INTO accounts (id, user_id, name) VALUES (10, 1, 'main')",
+		"INSERT INTO tags (id, user_id, name) VALUES (1, 1, 'breakout'), (2, 1, 'break-out'), (3, 1, 'scalp')",
+		"INSERT INTO trades (id, account_id, symbol, side, entry_price, entry_time) VALUES (100, 10, 'XAUUSD', 'long', 1, '2024-05-06 08:00:00')",
+		"INSERT INTO trade_tags (trade_id, tag_id) VALUES (100, 2), (100, 3)",
+	)
+	if err := audit.RecordCreate(db, 100, 1, audit.SourceAPI); err != nil {
+		t.Fatal(err)
+	}
+	history := func() []audit.Revision {
+		t.Helper()
+		revisions, err := audit.History(db, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return revisions
+	}
+	created := history()[0].ID
+
+	if err := Delete(db, 1, 3); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Merge(db, 1, []int64{2}, 1); err != nil {
+		t.Fatal(err)
+	}
+	revisions := history()
+	if len(revisions) != 3 {
+		t.Fatalf("刪除與合併應各寫入一筆異動，得到 %d 筆", len(revisions))
+	}
+	merge := revisions[2].Changes[audit.TagsField]
+	if !reflect.DeepEqual(merge.Old, []interface{}{"break-out"}) || !reflect.DeepEqual(merge.New, []interface{}{"breakout"}) {
+		t.Fatalf("合併的異動內容錯誤: %+v", merge)
+	}
+
+	// 還原到建立時：合併掉的名稱對應到 breakout，已刪除的 scalp 重新建立
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := audit.Revert(tx, 100, created, 1); err != nil {
+		tx.Rollback()
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	after, err := audit.Snapshot(db, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(after[audit.TagsField], []interface{}{"breakout", "scalp"}) {
+		t.Fatalf("還原後的標籤錯誤: %v", after[audit.TagsField])
+	}
+	var n int
+	db.QueryRow("SELECT COUNT(*) FROM tags WHERE name = 'break-out'").Scan(&n)
+	if n != 0 {
+		t.Fatal("還原不應重新建立已合併的標籤")
+	}
+}
@@ -0,0 +1,35 @@
+// Package testutil 各套件測試共用的輔助函式
+package testutil
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"trade-journal/internal/database"
+)
+
+// OpenDB 在暫存目錄建立已套用所有遷移的 SQLite 資料庫並依序執行 seed，測試結束時關閉
+func OpenDB(t testing.TB, seed ...string) *sql.DB {
+	t.Helper()
+	db, err := database.OpenSQLite(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("開啟資料庫失敗: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := database.Migrate(db); err != nil {
+		t.Fatalf("遷移失敗: %v", err)
+	}
+	Exec(t, db, seed...)
+	return db
+}
+
+// Exec 依序執行 SQL，任一失敗即中止測試
+func Exec(t testing.TB, db *sql.DB, queries ...string) {
+	t.Helper()
+	for _, q := range queries {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatalf("%s: %v", q, err)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package trash
+
+import (
+	"database/sql"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+const defaultRetentionDays = 30
+
+// RetentionDays 垃圾桶保留天數 (TRASH_RETENTION_DAYS)，0 表示不自動清除
+func RetentionDays() int {
+	v := os.Getenv("TRASH_RETENTION_DAYS")
+	if v == "" {
+		return defaultRetentionDays
+	}
+	days, err := strconv.Atoi(v)
+	if err != nil || days < 0 {
+		log.Printf("[Trash] TRASH_RETENTION_DAYS 設定無效 (%q)，使用預設 %d 天", v, defaultRetentionDays)
+		return defaultRetentionDays
+	}
+	return days
+}
+
+// StartPurger 啟動背景清除，每小時永久刪除超過保留期限的資料
+func StartPurger(db *sql.DB) {
+	days := RetentionDays()
+	if days == 0 {
+		log.Println("[Trash] 未啟用自動清除")
+		return
+	}
+
+	go func() {
+		for {
+			cutoff := time.Now().UTC().AddDate(0, 0, -days)
+			n, err := PurgeExpired(db, cutoff)
+			if err != nil {
+				log.Printf("[Trash] 自動清除失敗: %v", err)
+			} else if n > 0 {
+				log.Printf("[Trash] 已永久刪除 %d 筆超過 %d 天的資料", n, days)
+			}
+			time.Sleep(1 * time.Hour)
+		}
+	}()
+}
+
+// PurgeExpired 永久刪除在 cutoff 之前移到垃圾桶的資料，回傳刪除筆數
+func PurgeExpired(db *sql.DB, cutoff time.Time) (int, error) {
+	var refs []Ref
+	for _, q := range []struct {
+		typ   string
+		query string
+	}{
+		{TypeAccount, "SELECT id FROM accounts WHERE deleted_at IS NOT NULL AND deleted_at < ?"},
+		{TypePlan, "SELECT id FROM daily_plans WHERE deleted_at IS NOT NULL AND deleted_at < ?"},
+		{TypeTrade, "SELECT id FROM trades WHERE deleted_at IS NOT NULL AND deleted_at < ?"},
+	} {
+		rows, err := db.Query(q.query, cutoff)
+		if err != nil {
+			return 0, err
+		}
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return 0, err
+			}
+			refs = append(refs, Ref{Type: q.typ, ID: id})
+		}
+		rows.Close()
+	}
+
+	purged := 0
+	for _, ref := range refs {
+		if err := hardDelete(db, ref); err != nil {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
@@ -0,0 +1,341 @@
+package trash
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"trade-journal/internal/audit"
+	"trade-journal/internal/dailyplans"
+	"trade-journal/internal/database"
+
+	"github.com/google/uuid"
+)
+
+// 垃圾桶中的資料類型
+const (
+	TypeTrade   = "trade"
+	TypePlan    = "plan"
+	TypeAccount = "account"
+)
+
+// Item 垃圾桶中的一筆資料
+type Item struct {
+	Type        string     `json:"type"`
+	ID          int64      `json:"id"`
+	Title       string     `json:"title"`
+	AccountID   int64      `json:"account_id"`
+	AccountName string     `json:"account_name"`
+	DeletedAt   time.Time  `json:"deleted_at"`
+	Batch       string     `json:"batch,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+}
+
+// Ref 指定垃圾桶中的資料
+type Ref struct {
+	Type string `json:"type" binding:"required,oneof=trade plan account"`
+	ID   int64  `json:"id" binding:"required"`
+}
+
+// Result 單筆還原/清除結果
+type Result struct {
+	Type    string `json:"type"`
+	ID      int64  `json:"id"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+// NewBatch 產生刪除批次代碼，同一次操作刪除的資料共用同一個代碼
+func NewBatch() string {
+	return uuid.New().String()
+}
+
+// List 列出使用者垃圾桶中的資料，最近刪除的在前
+func List(db *sql.DB, userID int64) ([]Item, error) {
+	items := []Item{}
+
+	rows, err := db.Query(`
+		SELECT t.id, t.symbol, t.side, t.entry_time, t.account_id, a.name, t.deleted_at, COALESCE(t.delete_batch, '')
+		FROM trades t JOIN accounts a ON t.account_id = a.id
+		WHERE a.user_id = ? AND t.deleted_at IS NOT NULL
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		item := Item{Type: TypeTrade}
+		var symbol, side string
+		var entryTime time.Time
+		if err := rows.Scan(&item.ID, &symbol, &side, &entryTime, &item.AccountID, &item.AccountName, &item.DeletedAt, &item.Batch); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		item.Title = fmt.Sprintf("%s %s %s", entryTime.Format("2006-01-02 15:04"), symbol, side)
+		items = append(items, item)
+	}
+	rows.Close()
+
+	rows, err = db.Query(`
+		SELECT p.id, p.plan_date, COALESCE(p.symbol, ''), p.account_id, a.name, p.deleted_at, COALESCE(p.delete_batch, '')
+		FROM daily_plans p JOIN accounts a ON p.account_id = a.id
+		WHERE a.user_id = ? AND p.deleted_at IS NOT NULL
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		item := Item{Type: TypePlan}
+		var planDate time.Time
+		var symbol string
+		if err := rows.Scan(&item.ID, &planDate, &symbol, &item.AccountID, &item.AccountName, &item.DeletedAt, &item.Batch); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		item.Title = fmt.Sprintf("%s %s 每日規劃", planDate.Format("2006-01-02"), symbol)
+		items = append(items, item)
+	}
+	rows.Close()
+
+	rows, err = db.Query(`
+		SELECT id, name, deleted_at, COALESCE(delete_batch, '')
+		FROM accounts WHERE user_id = ? AND deleted_at IS NOT NULL
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		item := Item{Type: TypeAccount}
+		if err := rows.Scan(&item.ID, &item.AccountName, &item.DeletedAt, &item.Batch); err != nil {
+			return nil, err
+		}
+		item.AccountID = item.ID
+		item.Title = item.AccountName
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if days := RetentionDays(); days > 0 {
+		for i := range items {
+			expires := items[i].DeletedAt.AddDate(0, 0, days)
+			items[i].ExpiresAt = &expires
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].DeletedAt.After(items[j].DeletedAt)
+	})
+	return items, nil
+}
+
+// typeOrder 還原時先處理帳號，再處理帳號底下的資料
+var typeOrder = map[string]int{TypeAccount: 0, TypePlan: 1, TypeTrade: 2}
+
+func sortRefs(refs []Ref) {
+	sort.SliceStable(refs, func(i, j int) bool {
+		return typeOrder[refs[i].Type] < typeOrder[refs[j].Type]
+	})
+}
+
+// Restore 將資料從垃圾桶還原
+func Restore(db *sql.DB, userID int64, refs []Ref) []Result {
+	sortRefs(refs)
+	results := make([]Result, 0, len(refs))
+	for _, ref := range refs {
+		results = append(results, toResult(ref, restoreOne(db, userID, ref)))
+	}
+	return results
+}
+
+func restoreOne(db *sql.DB, userID int64, ref Ref) error {
+	var accountDeleted int
+	var err error
+	switch ref.Type {
+	case TypeAccount:
+		res, err := db.Exec("UPDATE accounts SET deleted_at = NULL, delete_batch = NULL WHERE id = ? AND user_id = ? AND deleted_at IS NOT NULL", ref.ID, userID)
+		return affectedOne(res, err)
+
+	case TypeTrade:
+		return restoreTrade(db, userID, ref.ID)
+
+	case TypePlan:
+		var accountID int64
+		err = db.QueryRow(`
+			SELECT p.account_id, CASE WHEN a.deleted_at IS NULL THEN 0 ELSE 1 END
+			FROM daily_plans p JOIN accounts a ON p.account_id = a.id
+			WHERE p.id = ? AND a.user_id = ? AND p.deleted_at IS NOT NULL
+		`, ref.ID, userID).Scan(&accountID, &accountDeleted)
+		if err != nil {
+			return notFound(err)
+		}
+		if accountDeleted == 1 {
+			return fmt.Errorf("所屬帳號已刪除，請先還原帳號")
+		}
+		res, err := db.Exec("UPDATE daily_plans SET deleted_at = NULL, delete_batch = NULL WHERE id = ?", ref.ID)
+		if database.IsUniqueViolation(err) {
+			return fmt.Errorf("該日期與品種已有其他規劃")
+		}
+		if err := affectedOne(res, err); err != nil {
+			return err
+		}
+		// 規劃在垃圾桶期間新增的交易沒有自動連結
+		return dailyplans.LinkAccount(db, accountID)
+	}
+	return fmt.Errorf("未知的類型 %s", ref.Type)
+}
+
+// restoreTrade 在單一交易中還原交易並記錄異動
+func restoreTrade(db *sql.DB, userID, id int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var accountDeleted int
+	err = tx.QueryRow(`
+		SELECT CASE WHEN a.deleted_at IS NULL THEN 0 ELSE 1 END
+		FROM trades t JOIN accounts a ON t.account_id = a.id
+		WHERE t.id = ? AND a.user_id = ? AND t.deleted_at IS NOT NULL
+	`, id, userID).Scan(&accountDeleted)
+	if err != nil {
+		return notFound(err)
+	}
+	if accountDeleted == 1 {
+		return fmt.Errorf("所屬帳號已刪除，請先還原帳號")
+	}
+	before, err := audit.Snapshot(tx, id)
+	if err != nil {
+		return err
+	}
+	res, err := tx.Exec("UPDATE trades SET deleted_at = NULL, delete_batch = NULL WHERE id = ?", id)
+	if err := affectedOne(res, err); err != nil {
+		return err
+	}
+	after, err := audit.Snapshot(tx, id)
+	if err != nil {
+		return err
+	}
+	if err := audit.Record(tx, id, userID, audit.ActionRestore, audit.SourceAPI, before, after); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Purge 永久刪除垃圾桶中的資料
+func Purge(db *sql.DB, userID int64, refs []Ref) []Result {
+	results := make([]Result, 0, len(refs))
+	for _, ref := range refs {
+		results = append(results, toResult(ref, purgeOne(db, userID, ref)))
+	}
+	return results
+}
+
+func purgeOne(db *sql.DB, userID int64, ref Ref) error {
+	var ownerQuery string
+	switch ref.Type {
+	case TypeAccount:
+		ownerQuery = "SELECT 1 FROM accounts WHERE id = ? AND user_id = ? AND deleted_at IS NOT NULL"
+	case TypeTrade:
+		ownerQuery = "SELECT 1 FROM trades t JOIN accounts a ON t.account_id = a.id WHERE t.id = ? AND a.user_id = ? AND t.deleted_at IS NOT NULL"
+	case TypePlan:
+		ownerQuery = "SELECT 1 FROM daily_plans p JOIN accounts a ON p.account_id = a.id WHERE p.id = ? AND a.user_id = ? AND p.deleted_at IS NOT NULL"
+	default:
+		return fmt.Errorf("未知的類型 %s", ref.Type)
+	}
+	var exists int
+	if err := db.QueryRow(ownerQuery, ref.ID, userID).Scan(&exists); err != nil {
+		return notFound(err)
+	}
+	return hardDelete(db, ref)
+}
+
+// hardDelete 在單一交易中刪除資料與其關聯
+// SQLite 預設未啟用外鍵，不能依賴 ON DELETE CASCADE
+func hardDelete(db *sql.DB, ref Ref) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	switch ref.Type {
+	case TypeTrade:
+		err = deleteTrades(tx, "id = ?", ref.ID)
+	case TypePlan:
+		err = deletePlans(tx, "id = ?", ref.ID)
+	case TypeAccount:
+		if err = deleteTrades(tx, "account_id = ?", ref.ID); err == nil {
+			if err = deletePlans(tx, "account_id = ?", ref.ID); err == nil {
+				_, err = tx.Exec("DELETE FROM accounts WHERE id = ?", ref.ID)
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func deleteTrades(tx *sql.Tx, where string, arg interface{}) error {
+	ids := "SELECT id FROM trades WHERE " + where
+	for _, q := range []string{
+		"DELETE FROM trade_tags WHERE trade_id IN (" + ids + ")",
+		"DELETE FROM image_annotations WHERE image_id IN (SELECT id FROM trade_images WHERE trade_id IN (" + ids + "))",
+		"DELETE FROM trade_images WHERE trade_id IN (" + ids + ")",
+		"DELETE FROM trade_revisions WHERE trade_id IN (" + ids + ")",
+		"DELETE FROM trade_executions WHERE trade_id IN (" + ids + ")",
+		"DELETE FROM trade_custom_values WHERE trade_id IN (" + ids + ")",
+		"DELETE FROM trade_mistakes WHERE trade_id IN (" + ids + ")",
+		"DELETE FROM share_users WHERE share_id IN (SELECT id FROM shares WHERE resource_type = 'trade' AND resource_id IN (" + ids + "))",
+		"DELETE FROM shares WHERE resource_type = 'trade' AND resource_id IN (" + ids + ")",
+		"DELETE FROM trades WHERE " + where,
+	} {
+		if _, err := tx.Exec(q, arg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func deletePlans(tx *sql.Tx, where string, arg interface{}) error {
+	ids := "SELECT id FROM daily_plans WHERE " + where
+	for _, q := range []string{
+		"DELETE FROM share_users WHERE share_id IN (SELECT id FROM shares WHERE resource_type = 'plan' AND resource_id IN (" + ids + "))",
+		"DELETE FROM shares WHERE resource_type = 'plan' AND resource_id IN (" + ids + ")",
+		"UPDATE trades SET daily_plan_id = NULL, plan_link_manual = FALSE WHERE daily_plan_id IN (" + ids + ")",
+		"DELETE FROM daily_plans WHERE " + where,
+	} {
+		if _, err := tx.Exec(q, arg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func affectedOne(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("垃圾桶中找不到該資料")
+	}
+	return nil
+}
+
+func notFound(err error) error {
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("垃圾桶中找不到該資料")
+	}
+	return err
+}
+
+func toResult(ref Ref, err error) Result {
+	r := Result{Type: ref.Type, ID: ref.ID, Success: err == nil}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	return r
+}
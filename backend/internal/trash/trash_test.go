@@ -0,0 +1,106 @@
+package trash
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"trade-journal/internal/testutil"
+)
+
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	return testutil.OpenDB(t,
+		"INSERT INTO users (id, username, password) VALUES (1, 'alice', 'x'), (2, 'bob', 'x')",
+		"INSERT INTO accounts (id, user_id, name) VALUES (10, 1, 'main')",
+		"INSERT INTO trades (id, account_id, symbol, side, entry_time) VALUES (100, 10, 'XAUUSD', 'long', '2024-05-01 08:00:00')",
+		"INSERT INTO trade_tags (trade_id, tag_id) VALUES (100, 1)",
+		"INSERT INTO daily_plans (id, account_id, plan_date, symbol) VALUES (50, 10, '2024-05-01 00:00:00', 'XAUUSD')",
+	)
+}
+
+func TestRestoreBatch(t *testing.T) {
+	db := openTestDB(t)
+	batch := NewBatch()
+	db.Exec("UPDATE trades SET deleted_at = CURRENT_TIMESTAMP, delete_batch = ? WHERE account_id = 10", batch)
+	db.Exec("UPDATE daily_plans SET deleted_at = CURRENT_TIMESTAMP, delete_batch = ? WHERE account_id = 10", batch)
+
+	items, err := List(db, 1)
+	if err != nil || len(items) != 2 {
+		t.Fatalf("垃圾桶應有 2 筆, got %d (%v)", len(items), err)
+	}
+	if others, _ := List(db, 2); len(others) != 0 {
+		t.Fatal("不應看到其他使用者的垃圾桶")
+	}
+
+	// 刪除後可建立同日期的規劃，此時還原舊規劃需回報衝突
+	if _, err := db.Exec("INSERT INTO daily_plans (account_id, plan_date, symbol) VALUES (10, '2024-05-01 00:00:00', 'XAUUSD')"); err != nil {
+		t.Fatalf("已刪除的規劃不應阻擋新增: %v", err)
+	}
+
+	results := Restore(db, 1, []Ref{{TypeTrade, 100}, {TypePlan, 50}})
+	for _, r := range results {
+		if r.Type == TypeTrade && !r.Success {
+			t.Fatalf("交易應可還原: %+v", r)
+		}
+		if r.Type == TypePlan && r.Success {
+			t.Fatalf("規劃應因衝突而無法還原: %+v", r)
+		}
+	}
+
+	if r := Restore(db, 2, []Ref{{TypePlan, 50}}); r[0].Success {
+		t.Fatal("不應可還原其他使用者的資料")
+	}
+}
+
+func TestRestoreTradeRollsBackWhenAuditFails(t *testing.T) {
+	db := openTestDB(t)
+	testutil.Exec(t, db,
+		"UPDATE trades SET deleted_at = CURRENT_TIMESTAMP WHERE id = 100",
+		"CREATE TRIGGER fail_revision BEFORE INSERT ON trade_revisions BEGIN SELECT RAISE(ABORT, 'fail'); END",
+	)
+
+	if r := Restore(db, 1, []Ref{{TypeTrade, 100}}); r[0].Success {
+		t.Fatal("寫入異動失敗時不應回報還原成功")
+	}
+	var deleted int
+	db.QueryRow("SELECT COUNT(*) FROM trades WHERE id = 100 AND deleted_at IS NOT NULL").Scan(&deleted)
+	if deleted != 1 {
+		t.Fatal("寫入異動失敗時交易應留在垃圾桶")
+	}
+}
+
+func TestPurgeExpired(t *testing.T) {
+	db := openTestDB(t)
+	db.Exec("UPDATE trades SET deleted_at = '2024-01-01 00:00:00' WHERE id = 100")
+	db.Exec("UPDATE daily_plans SET deleted_at = CURRENT_TIMESTAMP WHERE id = 50")
+
+	n, err := PurgeExpired(db, time.Now().UTC().AddDate(0, 0, -30))
+	if err != nil || n != 1 {
+		t.Fatalf("應清除 1 筆, got %d (%v)", n, err)
+	}
+
+	var count int
+	db.QueryRow("SELECT COUNT(*) FROM trade_tags WHERE trade_id = 100").Scan(&count)
+	if count != 0 {
+		t.Fatal("交易的標籤關聯應一併刪除")
+	}
+	db.QueryRow("SELECT COUNT(*) FROM daily_plans WHERE id = 50").Scan(&count)
+	if count != 1 {
+		t.Fatal("未過期的規劃不應被清除")
+	}
+}
+
+func TestPurgeAccount(t *testing.T) {
+	db := openTestDB(t)
+	db.Exec("UPDATE accounts SET deleted_at = CURRENT_TIMESTAMP WHERE id = 10")
+
+	if r := Purge(db, 1, []Ref{{TypeAccount, 10}}); !r[0].Success {
+		t.Fatalf("清除帳號失敗: %+v", r)
+	}
+	var count int
+	db.QueryRow("SELECT (SELECT COUNT(*) FROM trades) + (SELECT COUNT(*) FROM daily_plans) + (SELECT COUNT(*) FROM accounts)").Scan(&count)
+	if count != 0 {
+		t.Fatalf("帳號與其資料應全部刪除, 剩 %d 筆", count)
+	}
+}
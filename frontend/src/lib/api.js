@@ -47,10 +47,12 @@ export const imagesAPI = {
         'Content-Type': 'multipart/form-data',
       },
     }),
-  getUrl: path => {
+  getUrl: (path, size) => {
     // path 格式: 2025-01/20250101-XAUUSD-abc123.jpg
+    // size: 'thumb' (列表) 或 'medium' (詳情)，省略時取得原圖
     const filename = path.split('/').pop(); // 取得檔名
-    return `${API_BASE_URL}/images/${filename}?path=${encodeURIComponent(path)}`;
+    const url = `${API_BASE_URL}/images/${filename}?path=${encodeURIComponent(path)}`;
+    return size ? `${url}&size=${size}` : url;
   },
 };
 